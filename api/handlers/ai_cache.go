@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AICacheHandler struct {
+	cacheService *services.AICacheService
+	log          *logger.Logger
+}
+
+func NewAICacheHandler(db *gorm.DB, log *logger.Logger) *AICacheHandler {
+	return &AICacheHandler{
+		cacheService: services.NewAICacheService(db, log),
+		log:          log,
+	}
+}
+
+// GetStats 获取缓存是否启用、有效期、条数和命中次数
+// GET /api/v1/ai-cache/stats
+func (h *AICacheHandler) GetStats(c *gin.Context) {
+	stats, err := h.cacheService.Stats()
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, stats)
+}
+
+// ListEntries 分页查询缓存记录，不含响应内容
+// GET /api/v1/ai-cache
+func (h *AICacheHandler) ListEntries(c *gin.Context) {
+	var query services.AICacheQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+
+	entries, total, err := h.cacheService.List(&query)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.SuccessWithPagination(c, entries, total, query.Page, query.PageSize)
+}
+
+// GetEntry 获取缓存记录及响应内容
+// GET /api/v1/ai-cache/:id
+func (h *AICacheHandler) GetEntry(c *gin.Context) {
+	entryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	entry, err := h.cacheService.Get(uint(entryID))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, entry)
+}
+
+// DeleteEntry 删除一条缓存
+// DELETE /api/v1/ai-cache/:id
+func (h *AICacheHandler) DeleteEntry(c *gin.Context) {
+	entryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	if err := h.cacheService.Delete(uint(entryID)); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// ClearEntries 按服务商、模型、操作清除缓存，expired_only=true 时只清除已过期的记录
+// DELETE /api/v1/ai-cache
+func (h *AICacheHandler) ClearEntries(c *gin.Context) {
+	var query services.AICacheQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	deleted, err := h.cacheService.Clear(&query, c.Query("expired_only") == "true")
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	h.log.Infow("AI response cache cleared", "deleted", deleted, "provider", query.Provider, "model", query.Model, "operation", query.Operation)
+	response.Success(c, gin.H{"deleted": deleted})
+}
+
+func (h *AICacheHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.NotFound(c, "缓存记录不存在")
+		return
+	}
+	h.log.Errorw("AI cache request failed", "error", err)
+	response.InternalError(c, err.Error())
+}
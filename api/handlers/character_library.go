@@ -268,7 +268,7 @@ func (h *CharacterLibraryHandler) DeleteCharacter(c *gin.Context) {
 	response.Success(c, gin.H{"message": "角色已删除"})
 }
 
-// ExtractCharacters 从剧本提取角色
+// ExtractCharacters 从剧本提取角色，no_cache=true 时不使用缓存的AI响应
 func (h *CharacterLibraryHandler) ExtractCharacters(c *gin.Context) {
 	episodeIDStr := c.Param("episode_id")
 	episodeID, err := strconv.ParseUint(episodeIDStr, 10, 32)
@@ -277,7 +277,7 @@ func (h *CharacterLibraryHandler) ExtractCharacters(c *gin.Context) {
 		return
 	}
 
-	taskID, err := h.libraryService.ExtractCharactersFromScript(uint(episodeID))
+	taskID, err := h.libraryService.ExtractCharactersFromScript(uint(episodeID), c.Query("no_cache") == "true")
 	if err != nil {
 		h.log.Errorw("Failed to extract characters", "error", err)
 		response.InternalError(c, err.Error())
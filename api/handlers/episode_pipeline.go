@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/infrastructure/storage"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type EpisodePipelineHandler struct {
+	pipelineService *services.EpisodePipelineService
+	log             *logger.Logger
+}
+
+func NewEpisodePipelineHandler(db *gorm.DB, cfg *config.Config, log *logger.Logger, transferService *services.ResourceTransferService, localStorage *storage.LocalStorage) *EpisodePipelineHandler {
+	return &EpisodePipelineHandler{
+		pipelineService: services.NewEpisodePipelineService(db, cfg, transferService, localStorage, log),
+		log:             log,
+	}
+}
+
+// ProduceEpisode 一键制作章节：依次提取角色/道具/场景、生成分镜、帧提示词、图片、视频并合成成片
+// POST /api/v1/episodes/:episode_id/produce
+func (h *EpisodePipelineHandler) ProduceEpisode(c *gin.Context) {
+	episodeID := c.Param("episode_id")
+
+	var req services.ProduceEpisodeRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	task, err := h.pipelineService.ProduceEpisode(episodeID, &req)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "章节或任务不存在")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPipelineStage) ||
+			errors.Is(err, services.ErrPipelineRunning) ||
+			errors.Is(err, services.ErrPipelineNotResumable) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Errorw("Failed to start episode production", "error", err, "episode_id", episodeID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{"task_id": task.ID, "task": task, "message": "制作任务已提交"})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/drama-generator/backend/application/services"
@@ -36,14 +37,22 @@ func (h *ImageGenerationHandler) GenerateImage(c *gin.Context) {
 		return
 	}
 
-	imageGen, err := h.imageService.GenerateImage(&req)
+	imageGens, err := h.imageService.GenerateImageTakes(&req)
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		h.log.Errorw("Failed to generate image", "error", err)
 		response.InternalError(c, err.Error())
 		return
 	}
 
-	response.Success(c, imageGen)
+	// 请求多个候选时返回全部记录，否则保持返回单条记录
+	if req.Candidates > 1 {
+		response.Success(c, imageGens)
+		return
+	}
+	response.Success(c, imageGens[0])
 }
 
 func (h *ImageGenerationHandler) GenerateImagesForScene(c *gin.Context) {
@@ -74,6 +83,7 @@ func (h *ImageGenerationHandler) GetBackgroundsForEpisode(c *gin.Context) {
 	response.Success(c, backgrounds)
 }
 
+// ExtractBackgroundsForEpisode 提取分集的场景，no_cache=true 时不使用缓存的AI响应
 func (h *ImageGenerationHandler) ExtractBackgroundsForEpisode(c *gin.Context) {
 	episodeID := c.Param("episode_id")
 
@@ -93,7 +103,7 @@ func (h *ImageGenerationHandler) ExtractBackgroundsForEpisode(c *gin.Context) {
 	}
 
 	// 直接调用服务层的异步方法，该方法会创建任务并返回任务ID
-	taskID, err := h.imageService.ExtractBackgroundsForEpisode(episodeID, req.Model, req.Style)
+	taskID, err := h.imageService.ExtractBackgroundsForEpisode(episodeID, req.Model, req.Style, c.Query("no_cache") == "true")
 	if err != nil {
 		h.log.Errorw("Failed to extract backgrounds", "error", err, "episode_id", episodeID)
 		response.InternalError(c, err.Error())
@@ -114,6 +124,9 @@ func (h *ImageGenerationHandler) BatchGenerateForEpisode(c *gin.Context) {
 
 	images, err := h.imageService.BatchGenerateImagesForEpisode(episodeID)
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		h.log.Errorw("Failed to batch generate images", "error", err)
 		response.InternalError(c, err.Error())
 		return
@@ -122,6 +135,117 @@ func (h *ImageGenerationHandler) BatchGenerateForEpisode(c *gin.Context) {
 	response.Success(c, images)
 }
 
+// RetryImageGeneration 使用原参数重新生成失败的图片
+func (h *ImageGenerationHandler) RetryImageGeneration(c *gin.Context) {
+	imageGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	imageGen, err := h.imageService.RetryImageGeneration(uint(imageGenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "图片生成记录不存在")
+			return
+		}
+		if errors.Is(err, services.ErrGenerationNotFailed) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Errorw("Failed to retry image generation", "error", err, "id", imageGenID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, imageGen)
+}
+
+// EditImage 在已完成的图片基础上按提示词修改（可带蒙版局部重绘），生成关联到原图的新记录
+// POST /api/v1/images/:id/edit
+func (h *ImageGenerationHandler) EditImage(c *gin.Context) {
+	imageGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req services.EditImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	imageGen, err := h.imageService.EditImage(uint(imageGenID), &req)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "图片生成记录不存在")
+			return
+		}
+		if errors.Is(err, services.ErrImageNotEditable) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		if respondBudgetExceeded(c, err) {
+			return
+		}
+		h.log.Errorw("Failed to edit image", "error", err, "id", imageGenID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Created(c, imageGen)
+}
+
+// GetImageLineage 获取图片的编辑链
+// GET /api/v1/images/:id/lineage
+func (h *ImageGenerationHandler) GetImageLineage(c *gin.Context) {
+	imageGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	lineage, err := h.imageService.GetImageLineage(uint(imageGenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "图片生成记录不存在")
+			return
+		}
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, lineage)
+}
+
+// CheckImageQuality 对分镜图片重新进行画面质检，结果异步写入记录
+// POST /api/v1/images/:id/qa
+func (h *ImageGenerationHandler) CheckImageQuality(c *gin.Context) {
+	imageGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	imageGen, err := h.imageService.CheckImageQuality(uint(imageGenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "图片生成记录不存在")
+			return
+		}
+		if errors.Is(err, services.ErrImageQANotApplicable) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Errorw("Failed to queue image QA", "error", err, "id", imageGenID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, imageGen)
+}
+
 func (h *ImageGenerationHandler) GetImageGeneration(c *gin.Context) {
 
 	imageGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ModelCapabilityHandler struct {
+	capabilityService *services.ModelCapabilityService
+	log               *logger.Logger
+}
+
+func NewModelCapabilityHandler(db *gorm.DB, log *logger.Logger) *ModelCapabilityHandler {
+	return &ModelCapabilityHandler{
+		capabilityService: services.NewModelCapabilityService(db, log),
+		log:               log,
+	}
+}
+
+// ListProviders 获取服务商及各模型支持的参数
+// GET /api/v1/ai-providers?service_type=video
+func (h *ModelCapabilityHandler) ListProviders(c *gin.Context) {
+	providers, err := h.capabilityService.ListProviders(c.Query("service_type"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, providers)
+}
+
+// GetCapabilities 查询某个服务商/模型生成时使用的能力
+// GET /api/v1/ai-providers/capabilities?service_type=video&provider=chatfire&model=sora-2
+func (h *ModelCapabilityHandler) GetCapabilities(c *gin.Context) {
+	serviceType := c.Query("service_type")
+	provider := c.Query("provider")
+	if serviceType == "" || provider == "" {
+		response.BadRequest(c, "service_type 和 provider 不能为空")
+		return
+	}
+
+	resolved, err := h.capabilityService.Resolve(serviceType, provider, c.Query("model"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "未登记该模型的能力，生成时不校验参数")
+			return
+		}
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, resolved)
+}
+
+// UpsertModel 新增或修改服务商下某个模型的能力
+// PUT /api/v1/ai-providers/:id/models
+func (h *ModelCapabilityHandler) UpsertModel(c *gin.Context) {
+	providerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req services.UpsertModelCapabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	capability, err := h.capabilityService.UpsertModel(uint(providerID), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, capability)
+}
+
+// DeleteModel 删除模型能力
+// DELETE /api/v1/ai-providers/models/:id
+func (h *ModelCapabilityHandler) DeleteModel(c *gin.Context) {
+	capabilityID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	if err := h.capabilityService.DeleteModel(uint(capabilityID)); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// SetProviderActive 启用或停用服务商的能力校验
+// PUT /api/v1/ai-providers/:id/active
+func (h *ModelCapabilityHandler) SetProviderActive(c *gin.Context) {
+	providerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req struct {
+		IsActive bool `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.capabilityService.SetProviderActive(uint(providerID), req.IsActive); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"is_active": req.IsActive})
+}
+
+func (h *ModelCapabilityHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.NotFound(c, "记录不存在")
+		return
+	}
+	h.log.Errorw("Model capability request failed", "error", err)
+	response.InternalError(c, err.Error())
+}
@@ -103,7 +103,7 @@ func (h *PropHandler) DeleteProp(c *gin.Context) {
 	response.Success(c, nil)
 }
 
-// ExtractProps 提取道具
+// ExtractProps 提取道具，no_cache=true 时不使用缓存的AI响应
 func (h *PropHandler) ExtractProps(c *gin.Context) {
 	episodeIDStr := c.Param("episode_id")
 	episodeID, err := strconv.ParseUint(episodeIDStr, 10, 32)
@@ -112,7 +112,7 @@ func (h *PropHandler) ExtractProps(c *gin.Context) {
 		return
 	}
 
-	taskID, err := h.propService.ExtractPropsFromScript(uint(episodeID))
+	taskID, err := h.propService.ExtractPropsFromScript(uint(episodeID), c.Query("no_cache") == "true")
 	if err != nil {
 		response.InternalError(c, err.Error())
 		return
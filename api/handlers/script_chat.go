@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ScriptChatHandler struct {
+	chatService *services.ScriptChatService
+	log         *logger.Logger
+}
+
+func NewScriptChatHandler(db *gorm.DB, cfg *config.Config, log *logger.Logger) *ScriptChatHandler {
+	return &ScriptChatHandler{
+		chatService: services.NewScriptChatService(db, cfg, log),
+		log:         log,
+	}
+}
+
+// CreateSession 创建剧本修改对话
+// POST /api/v1/script-chats
+func (h *ScriptChatHandler) CreateSession(c *gin.Context) {
+	var req services.CreateScriptChatSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	session, err := h.chatService.CreateSession(&req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Created(c, session)
+}
+
+// ListSessions 获取剧本的对话列表
+// GET /api/v1/script-chats?drama_id=1&episode_id=2
+func (h *ScriptChatHandler) ListSessions(c *gin.Context) {
+	dramaID, err := strconv.ParseUint(c.Query("drama_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的drama_id")
+		return
+	}
+	var episodeID *uint
+	if value := c.Query("episode_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			response.BadRequest(c, "无效的episode_id")
+			return
+		}
+		episode := uint(id)
+		episodeID = &episode
+	}
+
+	sessions, err := h.chatService.ListSessions(uint(dramaID), episodeID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, sessions)
+}
+
+// GetSession 获取对话及全部消息
+// GET /api/v1/script-chats/:id
+func (h *ScriptChatHandler) GetSession(c *gin.Context) {
+	sessionID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	session, err := h.chatService.GetSession(sessionID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, session)
+}
+
+// DeleteSession 删除对话
+// DELETE /api/v1/script-chats/:id
+func (h *ScriptChatHandler) DeleteSession(c *gin.Context) {
+	sessionID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.chatService.DeleteSession(sessionID); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// SendMessage 发送消息并等待助手回复，回复附带修订稿时同时返回与当前剧本的差异
+// POST /api/v1/script-chats/:id/messages
+func (h *ScriptChatHandler) SendMessage(c *gin.Context) {
+	sessionID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req services.SendScriptChatMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	reply, err := h.chatService.SendMessage(c.Request.Context(), sessionID, &req)
+	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, reply)
+}
+
+// GetRevisionDiff 获取修订稿与该集当前剧本的差异
+// GET /api/v1/script-chats/:id/messages/:message_id/diff
+func (h *ScriptChatHandler) GetRevisionDiff(c *gin.Context) {
+	sessionID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	messageID, ok := parseIDParam(c, "message_id")
+	if !ok {
+		return
+	}
+
+	diff, err := h.chatService.GetRevisionDiff(sessionID, messageID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, diff)
+}
+
+// AcceptRevision 采纳修订稿，写入分集剧本。剧本在提出修订后被修改过时返回 409 和当前的差异，
+// 确认后以 force=true 重新提交
+// POST /api/v1/script-chats/:id/messages/:message_id/accept
+func (h *ScriptChatHandler) AcceptRevision(c *gin.Context) {
+	sessionID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	messageID, ok := parseIDParam(c, "message_id")
+	if !ok {
+		return
+	}
+
+	var req services.AcceptScriptRevisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	diff, err := h.chatService.AcceptRevision(sessionID, messageID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrScriptRevisionConflict) {
+			response.ErrorWithDetails(c, http.StatusConflict, "REVISION_CONFLICT", err.Error(), diff)
+			return
+		}
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, diff)
+}
+
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *ScriptChatHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.NotFound(c, "记录不存在")
+		return
+	}
+	if errors.Is(err, services.ErrNoScriptRevision) || errors.Is(err, services.ErrScriptRevisionAccepted) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	h.log.Errorw("Script chat request failed", "error", err)
+	response.InternalError(c, err.Error())
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/drama-generator/backend/application/services"
@@ -110,3 +111,90 @@ func (h *StoryboardHandler) DeleteStoryboard(c *gin.Context) {
 
 	response.Success(c, nil)
 }
+
+// GetStoryboardTakes 获取分镜的图片和视频候选
+// GET /api/v1/storyboards/:id/takes
+func (h *StoryboardHandler) GetStoryboardTakes(c *gin.Context) {
+	storyboardID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "Invalid ID")
+		return
+	}
+
+	takes, err := h.storyboardService.GetStoryboardTakes(uint(storyboardID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "分镜不存在")
+			return
+		}
+		h.log.Errorw("Failed to get storyboard takes", "error", err, "storyboard_id", storyboardID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, takes)
+}
+
+// SelectImageTake 选定分镜使用的图片
+// PUT /api/v1/storyboards/:id/selected-image
+func (h *StoryboardHandler) SelectImageTake(c *gin.Context) {
+	storyboardID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "Invalid ID")
+		return
+	}
+
+	var req struct {
+		ImageGenID uint `json:"image_gen_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	storyboard, err := h.storyboardService.SelectImageTake(uint(storyboardID), req.ImageGenID)
+	if err != nil {
+		h.respondTakeError(c, err, "分镜或图片生成记录不存在")
+		return
+	}
+
+	response.Success(c, storyboard)
+}
+
+// SelectVideoTake 选定分镜使用的视频
+// PUT /api/v1/storyboards/:id/selected-video
+func (h *StoryboardHandler) SelectVideoTake(c *gin.Context) {
+	storyboardID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "Invalid ID")
+		return
+	}
+
+	var req struct {
+		VideoGenID uint `json:"video_gen_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	storyboard, err := h.storyboardService.SelectVideoTake(uint(storyboardID), req.VideoGenID)
+	if err != nil {
+		h.respondTakeError(c, err, "分镜或视频生成记录不存在")
+		return
+	}
+
+	response.Success(c, storyboard)
+}
+
+func (h *StoryboardHandler) respondTakeError(c *gin.Context, err error, notFoundMsg string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NotFound(c, notFoundMsg)
+	case errors.Is(err, services.ErrTakeNotInStoryboard), errors.Is(err, services.ErrTakeNotCompleted):
+		response.BadRequest(c, err.Error())
+	default:
+		h.log.Errorw("Failed to select take", "error", err)
+		response.InternalError(c, err.Error())
+	}
+}
@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/pkg/logger"
 	"github.com/drama-generator/backend/pkg/response"
 	"github.com/gin-gonic/gin"
@@ -9,12 +16,14 @@ import (
 )
 
 type TaskHandler struct {
+	db          *gorm.DB
 	taskService *services.TaskService
 	log         *logger.Logger
 }
 
 func NewTaskHandler(db *gorm.DB, log *logger.Logger) *TaskHandler {
 	return &TaskHandler{
+		db:          db,
 		taskService: services.NewTaskService(db, log),
 		log:         log,
 	}
@@ -38,14 +47,39 @@ func (h *TaskHandler) GetTaskStatus(c *gin.Context) {
 	response.Success(c, task)
 }
 
-// GetResourceTasks 获取资源相关的所有任务
-func (h *TaskHandler) GetResourceTasks(c *gin.Context) {
-	resourceID := c.Query("resource_id")
-	if resourceID == "" {
-		response.BadRequest(c, "缺少resource_id参数")
+// ListTasks 按类型、状态、资源和创建时间筛选任务，支持分页。
+// 只传 resource_id 时保持原接口行为，返回该资源的全部任务数组
+func (h *TaskHandler) ListTasks(c *gin.Context) {
+	if params := c.Request.URL.Query(); len(params) == 1 && params.Get("resource_id") != "" {
+		h.getResourceTasks(c, params.Get("resource_id"))
+		return
+	}
+
+	var query services.TaskListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+
+	tasks, total, err := h.taskService.ListTasks(&query)
+	if err != nil {
+		h.log.Errorw("Failed to list tasks", "error", err)
+		response.InternalError(c, err.Error())
 		return
 	}
 
+	response.SuccessWithPagination(c, tasks, total, query.Page, query.PageSize)
+}
+
+// getResourceTasks 获取资源相关的所有任务
+func (h *TaskHandler) getResourceTasks(c *gin.Context, resourceID string) {
 	tasks, err := h.taskService.GetTasksByResource(resourceID)
 	if err != nil {
 		h.log.Errorw("Failed to get resource tasks", "error", err, "resource_id", resourceID)
@@ -55,3 +89,136 @@ func (h *TaskHandler) GetResourceTasks(c *gin.Context) {
 
 	response.Success(c, tasks)
 }
+
+// CancelTask 取消排队中或执行中的任务
+func (h *TaskHandler) CancelTask(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	task, err := h.taskService.CancelTask(taskID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "任务不存在")
+			return
+		}
+		if errors.Is(err, services.ErrTaskNotCancellable) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Errorw("Failed to cancel task", "error", err, "task_id", taskID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, task)
+}
+
+// sseKeepaliveInterval SSE 心跳间隔，避免代理因连接空闲断开
+const sseKeepaliveInterval = 15 * time.Second
+
+// StreamTaskEvents 以 SSE 推送单个任务的进度，任务结束后关闭连接
+func (h *TaskHandler) StreamTaskEvents(c *gin.Context) {
+	taskID := c.Param("task_id")
+
+	// 先订阅再读取快照，避免两者之间的状态变化丢失
+	events, unsubscribe := services.SubscribeProgressEvents(func(e services.ProgressEvent) bool {
+		return e.Type == services.EventTypeTask && e.TaskID == taskID
+	})
+	defer unsubscribe()
+
+	task, err := h.taskService.GetTask(taskID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "任务不存在")
+			return
+		}
+		h.log.Errorw("Failed to get task", "error", err, "task_id", taskID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	startSSE(c)
+	c.SSEvent(services.EventTypeTask, services.ProgressEvent{
+		Type:      services.EventTypeTask,
+		TaskID:    task.ID,
+		Data:      task,
+		Timestamp: time.Now(),
+	})
+	c.Writer.Flush()
+	if isTaskFinished(task) {
+		return
+	}
+
+	streamSSE(c, events, func(e services.ProgressEvent) bool {
+		task, ok := e.Data.(*models.AsyncTask)
+		return ok && isTaskFinished(task)
+	})
+}
+
+// StreamEpisodeEvents 以 SSE 推送章节下所有任务和图片/视频生成记录的状态变化，直到客户端断开
+func (h *TaskHandler) StreamEpisodeEvents(c *gin.Context) {
+	episodeID, err := strconv.ParseUint(c.Param("episode_id"), 10, 32)
+	if err != nil || episodeID == 0 {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	// 无法解析所属章节的事件 EpisodeID 为 0，必须先确认章节存在
+	var episode models.Episode
+	if err := h.db.Select("id").First(&episode, episodeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "章节不存在")
+			return
+		}
+		h.log.Errorw("Failed to get episode", "error", err, "episode_id", episodeID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	events, unsubscribe := services.SubscribeProgressEvents(func(e services.ProgressEvent) bool {
+		return e.EpisodeID == uint(episodeID)
+	})
+	defer unsubscribe()
+
+	startSSE(c)
+	c.Writer.Flush()
+	streamSSE(c, events, nil)
+}
+
+// isTaskFinished 任务是否已进入终态（pending 可能是等待重试，不算结束）
+func isTaskFinished(task *models.AsyncTask) bool {
+	switch task.Status {
+	case models.TaskStatusCompleted, models.TaskStatusFailed, models.TaskStatusCancelled, models.TaskStatusDeadLetter:
+		return true
+	}
+	return false
+}
+
+func startSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// 长连接不受服务器 WriteTimeout 限制
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+}
+
+// streamSSE 持续写出事件，客户端断开或 stop 返回 true 时结束
+func streamSSE(c *gin.Context, events <-chan services.ProgressEvent, stop func(services.ProgressEvent) bool) {
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case e := <-events:
+			c.SSEvent(e.Type, e)
+			return stop == nil || !stop(e)
+		case <-keepalive.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		}
+	})
+}
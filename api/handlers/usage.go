@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+type UsageHandler struct {
+	usageService *services.UsageService
+	config       *config.Config
+	log          *logger.Logger
+}
+
+func NewUsageHandler(db *gorm.DB, cfg *config.Config, log *logger.Logger) *UsageHandler {
+	return &UsageHandler{
+		usageService: services.NewUsageService(db, log),
+		config:       cfg,
+		log:          log,
+	}
+}
+
+// GetSummary 按维度汇总用量和费用，group_by 可选 drama、episode、storyboard、provider、config、model、service_type、operation
+// GET /api/v1/usage/summary
+func (h *UsageHandler) GetSummary(c *gin.Context) {
+	var query services.UsageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	summaries, err := h.usageService.Summary(&query, c.DefaultQuery("group_by", "drama"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, summaries)
+}
+
+// GetTimeline 按时间段统计用量和费用，interval 可选 day、week、month
+// GET /api/v1/usage/timeline
+func (h *UsageHandler) GetTimeline(c *gin.Context) {
+	var query services.UsageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	timeline, err := h.usageService.Timeline(&query, c.Query("interval"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, timeline)
+}
+
+// ListRecords 分页查询用量明细
+// GET /api/v1/usage/records
+func (h *UsageHandler) ListRecords(c *gin.Context) {
+	var query services.UsageRecordQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+
+	records, total, err := h.usageService.ListRecords(&query)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.SuccessWithPagination(c, records, total, query.Page, query.PageSize)
+}
+
+// ListPrices 获取模型价格表
+// GET /api/v1/usage/prices
+func (h *UsageHandler) ListPrices(c *gin.Context) {
+	prices, err := h.usageService.ListPrices()
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, prices)
+}
+
+// UpsertPrice 设置模型单价，已存在时覆盖
+// PUT /api/v1/usage/prices
+func (h *UsageHandler) UpsertPrice(c *gin.Context) {
+	var req services.UpsertModelPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	price, err := h.usageService.UpsertPrice(&req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, price)
+}
+
+// DeletePrice 删除模型单价
+// DELETE /api/v1/usage/prices/:id
+func (h *UsageHandler) DeletePrice(c *gin.Context) {
+	priceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	if err := h.usageService.DeletePrice(uint(priceID)); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// GetGlobalBudget 获取全局预算的使用情况
+// GET /api/v1/usage/budget
+func (h *UsageHandler) GetGlobalBudget(c *gin.Context) {
+	status, err := h.usageService.GlobalBudgetStatus()
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{
+		"status":       status,
+		"global_limit": h.config.Budget.GlobalLimit,
+		"period":       h.config.Budget.GlobalPeriod,
+		"warn_ratios":  h.config.Budget.WarnRatios,
+	})
+}
+
+// UpdateGlobalBudget 更新全局预算配置并写入配置文件
+// PUT /api/v1/usage/budget
+func (h *UsageHandler) UpdateGlobalBudget(c *gin.Context) {
+	var req struct {
+		GlobalLimit  *float64  `json:"global_limit" binding:"omitempty,min=0"`
+		GlobalPeriod *string   `json:"global_period" binding:"omitempty,oneof=month total"`
+		WarnRatios   []float64 `json:"warn_ratios"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	// 更新内存中的配置
+	budget := &h.config.Budget
+	if req.GlobalLimit != nil {
+		budget.GlobalLimit = *req.GlobalLimit
+	}
+	if req.GlobalPeriod != nil {
+		budget.GlobalPeriod = *req.GlobalPeriod
+		if budget.GlobalPeriod == "total" {
+			budget.GlobalPeriod = ""
+		}
+	}
+	if req.WarnRatios != nil {
+		budget.WarnRatios = services.NormalizeWarnRatios(req.WarnRatios)
+	}
+	services.SetBudgetConfig(*budget)
+
+	// 更新配置文件
+	viper.Set("budget.global_limit", budget.GlobalLimit)
+	viper.Set("budget.global_period", budget.GlobalPeriod)
+	viper.Set("budget.warn_ratios", budget.WarnRatios)
+	if err := viper.WriteConfig(); err != nil {
+		h.log.Warnw("Failed to write config file", "error", err)
+		// 即使写入文件失败，内存配置也已更新，仍然可用
+	}
+
+	h.log.Infow("Global budget updated", "global_limit", budget.GlobalLimit, "period", budget.GlobalPeriod, "warn_ratios", budget.WarnRatios)
+	h.GetGlobalBudget(c)
+}
+
+// GetDramaBudget 获取剧本预算的使用情况
+// GET /api/v1/usage/budget/dramas/:drama_id
+func (h *UsageHandler) GetDramaBudget(c *gin.Context) {
+	dramaID, err := strconv.ParseUint(c.Param("drama_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	status, err := h.usageService.DramaBudgetStatus(uint(dramaID))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, status)
+}
+
+// UpdateDramaBudget 设置剧本预算，budget_limit 为 null 时取消限制
+// PUT /api/v1/usage/budget/dramas/:drama_id
+func (h *UsageHandler) UpdateDramaBudget(c *gin.Context) {
+	dramaID, err := strconv.ParseUint(c.Param("drama_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req struct {
+		BudgetLimit *float64 `json:"budget_limit" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	status, err := h.usageService.SetDramaBudget(uint(dramaID), req.BudgetLimit)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, status)
+}
+
+// respondBudgetExceeded 预算用尽时返回 402 和 BUDGET_EXCEEDED 错误码，其他错误返回 false
+func respondBudgetExceeded(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrBudgetExceeded) {
+		return false
+	}
+	response.Error(c, http.StatusPaymentRequired, services.ErrorCodeBudgetExceeded, err.Error())
+	return true
+}
+
+func (h *UsageHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.NotFound(c, "记录不存在")
+		return
+	}
+	if errors.Is(err, services.ErrInvalidUsageGroupBy) || errors.Is(err, services.ErrInvalidUsageInterval) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	h.log.Errorw("Usage request failed", "error", err)
+	response.InternalError(c, err.Error())
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/drama-generator/backend/application/services"
@@ -31,14 +32,22 @@ func (h *VideoGenerationHandler) GenerateVideo(c *gin.Context) {
 		return
 	}
 
-	videoGen, err := h.videoService.GenerateVideo(&req)
+	videoGens, err := h.videoService.GenerateVideoTakes(&req)
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		h.log.Errorw("Failed to generate video", "error", err)
 		response.InternalError(c, err.Error())
 		return
 	}
 
-	response.Success(c, videoGen)
+	// 请求多个候选时返回全部记录，否则保持返回单条记录
+	if req.Candidates > 1 {
+		response.Success(c, videoGens)
+		return
+	}
+	response.Success(c, videoGens[0])
 }
 
 func (h *VideoGenerationHandler) GenerateVideoFromImage(c *gin.Context) {
@@ -51,6 +60,9 @@ func (h *VideoGenerationHandler) GenerateVideoFromImage(c *gin.Context) {
 
 	videoGen, err := h.videoService.GenerateVideoFromImage(uint(imageGenID))
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		h.log.Errorw("Failed to generate video from image", "error", err)
 		response.InternalError(c, err.Error())
 		return
@@ -65,6 +77,9 @@ func (h *VideoGenerationHandler) BatchGenerateForEpisode(c *gin.Context) {
 
 	videos, err := h.videoService.BatchGenerateVideosForEpisode(episodeID)
 	if err != nil {
+		if respondBudgetExceeded(c, err) {
+			return
+		}
 		h.log.Errorw("Failed to batch generate videos", "error", err)
 		response.InternalError(c, err.Error())
 		return
@@ -131,6 +146,32 @@ func (h *VideoGenerationHandler) ListVideoGenerations(c *gin.Context) {
 	response.SuccessWithPagination(c, videos, total, page, pageSize)
 }
 
+// RetryVideoGeneration 使用原参数重新生成失败的视频
+func (h *VideoGenerationHandler) RetryVideoGeneration(c *gin.Context) {
+	videoGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	videoGen, err := h.videoService.RetryVideoGeneration(uint(videoGenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "视频生成记录不存在")
+			return
+		}
+		if errors.Is(err, services.ErrGenerationNotFailed) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Errorw("Failed to retry video generation", "error", err, "id", videoGenID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, videoGen)
+}
+
 func (h *VideoGenerationHandler) DeleteVideoGeneration(c *gin.Context) {
 
 	videoGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+	log            *logger.Logger
+}
+
+func NewWebhookHandler(db *gorm.DB, log *logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: services.NewWebhookService(db, log),
+		log:            log,
+	}
+}
+
+// CreateWebhook 创建 webhook 订阅，响应中的 secret 仅返回这一次
+// POST /api/v1/webhooks
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req services.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	webhook, secret, err := h.webhookService.CreateWebhook(&req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidWebhookEvent) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		h.log.Errorw("Failed to create webhook", "error", err)
+		response.InternalError(c, "创建失败")
+		return
+	}
+
+	response.Created(c, gin.H{"webhook": webhook, "secret": secret})
+}
+
+// ListWebhooks 获取 webhook 订阅列表
+// GET /api/v1/webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	webhooks, err := h.webhookService.ListWebhooks()
+	if err != nil {
+		response.InternalError(c, "获取列表失败")
+		return
+	}
+
+	response.Success(c, webhooks)
+}
+
+// GetWebhook 获取 webhook 订阅详情
+// GET /api/v1/webhooks/:id
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	webhook, err := h.webhookService.GetWebhook(uint(webhookID))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, webhook)
+}
+
+// UpdateWebhook 更新 webhook 订阅
+// PUT /api/v1/webhooks/:id
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req services.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(uint(webhookID), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, webhook)
+}
+
+// DeleteWebhook 删除 webhook 订阅
+// DELETE /api/v1/webhooks/:id
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(uint(webhookID)); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// PingWebhook 发送测试事件
+// POST /api/v1/webhooks/:id/ping
+func (h *WebhookHandler) PingWebhook(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	delivery, err := h.webhookService.Ping(uint(webhookID))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, delivery)
+}
+
+// ListDeliveries 分页查询投递记录，可按 status、event_type 过滤
+// GET /api/v1/webhooks/:id/deliveries
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var query services.WebhookDeliveryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+
+	deliveries, total, err := h.webhookService.ListDeliveries(uint(webhookID), &query)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.SuccessWithPagination(c, deliveries, total, query.Page, query.PageSize)
+}
+
+// Redeliver 重新投递已结束的投递记录
+// POST /api/v1/webhooks/deliveries/:delivery_id/redeliver
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	deliveryID, err := strconv.ParseUint(c.Param("delivery_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(uint(deliveryID))
+	if err != nil {
+		if errors.Is(err, services.ErrWebhookDeliveryInProgress) {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, delivery)
+}
+
+func (h *WebhookHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.NotFound(c, "记录不存在")
+		return
+	}
+	if errors.Is(err, services.ErrInvalidWebhookEvent) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	h.log.Errorw("Webhook request failed", "error", err)
+	response.InternalError(c, err.Error())
+}
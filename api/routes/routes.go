@@ -11,7 +11,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStorage interface{}) *gin.Engine {
+func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStorage interface{}, jobQueue *services2.JobQueue) *gin.Engine {
 	r := gin.New()
 
 	r.Use(gin.Recovery())
@@ -35,6 +35,7 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 	dramaHandler := handlers2.NewDramaHandler(db, cfg, log, nil)
 	aiConfigHandler := handlers2.NewAIConfigHandler(db, cfg, log)
 	scriptGenHandler := handlers2.NewScriptGenerationHandler(db, cfg, log)
+	scriptChatHandler := handlers2.NewScriptChatHandler(db, cfg, log)
 	imageGenService := services2.NewImageGenerationService(db, cfg, transferService, localStoragePtr, log)
 	imageGenHandler := handlers2.NewImageGenerationHandler(db, cfg, log, transferService, localStoragePtr)
 	videoGenHandler := handlers2.NewVideoGenerationHandler(db, transferService, localStoragePtr, aiService, log)
@@ -54,6 +55,20 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 	audioExtractionHandler := handlers2.NewAudioExtractionHandler(log, cfg.Storage.LocalPath)
 	settingsHandler := handlers2.NewSettingsHandler(cfg, log)
 	propHandler := handlers2.NewPropHandler(db, cfg, log, aiService, imageGenService)
+	episodePipelineHandler := handlers2.NewEpisodePipelineHandler(db, cfg, log, transferService, localStoragePtr)
+	webhookHandler := handlers2.NewWebhookHandler(db, log)
+	usageHandler := handlers2.NewUsageHandler(db, cfg, log)
+	aiCacheHandler := handlers2.NewAICacheHandler(db, log)
+	modelCapabilityHandler := handlers2.NewModelCapabilityHandler(db, log)
+
+	// 注册任务队列处理器
+	imageGenService.RegisterJobHandlers(jobQueue)
+	services2.NewVideoGenerationService(db, transferService, localStoragePtr, aiService, log).RegisterJobHandlers(jobQueue)
+	services2.NewStoryboardService(db, cfg, log).RegisterJobHandlers(jobQueue)
+	services2.NewPropService(db, aiService, services2.NewTaskService(db, log), imageGenService, log, cfg).RegisterJobHandlers(jobQueue)
+	services2.NewVideoMergeService(db, nil, cfg.Storage.LocalPath, cfg.Storage.BaseURL, log).RegisterJobHandlers(jobQueue)
+	services2.NewEpisodePipelineService(db, cfg, transferService, localStoragePtr, log).RegisterJobHandlers(jobQueue)
+	services2.NewWebhookService(db, log).RegisterJobHandlers(jobQueue)
 
 	api := r.Group("/api/v1")
 	{
@@ -86,11 +101,33 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			aiConfigs.DELETE("/:id", aiConfigHandler.DeleteConfig)
 		}
 
+		// 服务商与模型能力
+		aiProviders := api.Group("/ai-providers")
+		{
+			aiProviders.GET("", modelCapabilityHandler.ListProviders)
+			aiProviders.GET("/capabilities", modelCapabilityHandler.GetCapabilities)
+			aiProviders.PUT("/:id/models", modelCapabilityHandler.UpsertModel)
+			aiProviders.PUT("/:id/active", modelCapabilityHandler.SetProviderActive)
+			aiProviders.DELETE("/models/:id", modelCapabilityHandler.DeleteModel)
+		}
+
 		generation := api.Group("/generation")
 		{
 			generation.POST("/characters", scriptGenHandler.GenerateCharacters)
 		}
 
+		// 剧本修改对话
+		scriptChats := api.Group("/script-chats")
+		{
+			scriptChats.GET("", scriptChatHandler.ListSessions)
+			scriptChats.POST("", scriptChatHandler.CreateSession)
+			scriptChats.GET("/:id", scriptChatHandler.GetSession)
+			scriptChats.DELETE("/:id", scriptChatHandler.DeleteSession)
+			scriptChats.POST("/:id/messages", scriptChatHandler.SendMessage)
+			scriptChats.GET("/:id/messages/:message_id/diff", scriptChatHandler.GetRevisionDiff)
+			scriptChats.POST("/:id/messages/:message_id/accept", scriptChatHandler.AcceptRevision)
+		}
+
 		// 角色库路由
 		characterLibrary := api.Group("/character-library")
 		{
@@ -136,14 +173,18 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			episodes.POST("/:episode_id/characters/extract", characterLibraryHandler.ExtractCharacters)
 			episodes.GET("/:episode_id/storyboards", sceneHandler.GetStoryboardsForEpisode)
 			episodes.POST("/:episode_id/finalize", dramaHandler.FinalizeEpisode)
+			episodes.POST("/:episode_id/produce", episodePipelineHandler.ProduceEpisode)
 			episodes.GET("/:episode_id/download", dramaHandler.DownloadEpisodeVideo)
+			episodes.GET("/:episode_id/events", taskHandler.StreamEpisodeEvents)
 		}
 
 		// 任务路由
 		tasks := api.Group("/tasks")
 		{
 			tasks.GET("/:task_id", taskHandler.GetTaskStatus)
-			tasks.GET("", taskHandler.GetResourceTasks)
+			tasks.POST("/:task_id/cancel", taskHandler.CancelTask)
+			tasks.GET("/:task_id/events", taskHandler.StreamTaskEvents)
+			tasks.GET("", taskHandler.ListTasks)
 		}
 
 		// 场景路由
@@ -163,6 +204,10 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			images.POST("", imageGenHandler.GenerateImage)
 			images.GET("/:id", imageGenHandler.GetImageGeneration)
 			images.DELETE("/:id", imageGenHandler.DeleteImageGeneration)
+			images.POST("/:id/retry", imageGenHandler.RetryImageGeneration)
+			images.POST("/:id/qa", imageGenHandler.CheckImageQuality)
+			images.POST("/:id/edit", imageGenHandler.EditImage)
+			images.GET("/:id/lineage", imageGenHandler.GetImageLineage)
 			images.POST("/scene/:scene_id", imageGenHandler.GenerateImagesForScene)
 			images.POST("/upload", imageGenHandler.UploadImage)
 			images.GET("/episode/:episode_id/backgrounds", imageGenHandler.GetBackgroundsForEpisode)
@@ -176,6 +221,7 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			videos.POST("", videoGenHandler.GenerateVideo)
 			videos.GET("/:id", videoGenHandler.GetVideoGeneration)
 			videos.DELETE("/:id", videoGenHandler.DeleteVideoGeneration)
+			videos.POST("/:id/retry", videoGenHandler.RetryVideoGeneration)
 			videos.POST("/image/:image_gen_id", videoGenHandler.GenerateVideoFromImage)
 			videos.POST("/episode/:episode_id/batch", videoGenHandler.BatchGenerateForEpisode)
 		}
@@ -205,6 +251,9 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			storyboards.POST("", storyboardHandler.CreateStoryboard)
 			storyboards.PUT("/:id", storyboardHandler.UpdateStoryboard)
 			storyboards.DELETE("/:id", storyboardHandler.DeleteStoryboard)
+			storyboards.GET("/:id/takes", storyboardHandler.GetStoryboardTakes)
+			storyboards.PUT("/:id/selected-image", storyboardHandler.SelectImageTake)
+			storyboards.PUT("/:id/selected-video", storyboardHandler.SelectVideoTake)
 			storyboards.POST("/:id/props", propHandler.AssociateProps)
 			storyboards.POST("/:id/frame-prompt", framePromptHandler.GenerateFramePrompt)
 			storyboards.GET("/:id/frame-prompts", handlers2.GetStoryboardFramePrompts(db, log))
@@ -221,6 +270,44 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			settings.GET("/language", settingsHandler.GetLanguage)
 			settings.PUT("/language", settingsHandler.UpdateLanguage)
 		}
+
+		// Webhook 订阅
+		webhooks := api.Group("/webhooks")
+		{
+			webhooks.GET("", webhookHandler.ListWebhooks)
+			webhooks.POST("", webhookHandler.CreateWebhook)
+			webhooks.GET("/:id", webhookHandler.GetWebhook)
+			webhooks.PUT("/:id", webhookHandler.UpdateWebhook)
+			webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+			webhooks.POST("/:id/ping", webhookHandler.PingWebhook)
+			webhooks.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+			webhooks.POST("/deliveries/:delivery_id/redeliver", webhookHandler.Redeliver)
+		}
+
+		// AI用量与费用
+		usage := api.Group("/usage")
+		{
+			usage.GET("/summary", usageHandler.GetSummary)
+			usage.GET("/timeline", usageHandler.GetTimeline)
+			usage.GET("/records", usageHandler.ListRecords)
+			usage.GET("/prices", usageHandler.ListPrices)
+			usage.PUT("/prices", usageHandler.UpsertPrice)
+			usage.DELETE("/prices/:id", usageHandler.DeletePrice)
+			usage.GET("/budget", usageHandler.GetGlobalBudget)
+			usage.PUT("/budget", usageHandler.UpdateGlobalBudget)
+			usage.GET("/budget/dramas/:drama_id", usageHandler.GetDramaBudget)
+			usage.PUT("/budget/dramas/:drama_id", usageHandler.UpdateDramaBudget)
+		}
+
+		// AI响应缓存
+		aiCache := api.Group("/ai-cache")
+		{
+			aiCache.GET("", aiCacheHandler.ListEntries)
+			aiCache.DELETE("", aiCacheHandler.ClearEntries)
+			aiCache.GET("/stats", aiCacheHandler.GetStats)
+			aiCache.GET("/:id", aiCacheHandler.GetEntry)
+			aiCache.DELETE("/:id", aiCacheHandler.DeleteEntry)
+		}
 	}
 
 	// 前端静态文件服务（放在API路由之后，避免冲突）
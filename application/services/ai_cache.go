@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// defaultAICacheTTL 未配置有效期时缓存保留的时长
+	defaultAICacheTTL = 24 * time.Hour
+	// aiCachePreviewLength 缓存记录中保存的提示词字符数
+	aiCachePreviewLength = 500
+)
+
+// aiCacheSettings 响应缓存配置，启动时设置
+var aiCacheSettings = struct {
+	sync.RWMutex
+	cfg config.AICacheConfig
+}{}
+
+// SetAICacheConfig 设置响应缓存配置
+func SetAICacheConfig(cfg config.AICacheConfig) {
+	aiCacheSettings.Lock()
+	defer aiCacheSettings.Unlock()
+	aiCacheSettings.cfg = cfg
+}
+
+func aiCacheConfig() config.AICacheConfig {
+	aiCacheSettings.RLock()
+	defer aiCacheSettings.RUnlock()
+	return aiCacheSettings.cfg
+}
+
+func aiCacheTTL() time.Duration {
+	if hours := aiCacheConfig().TTLHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultAICacheTTL
+}
+
+type aiCacheBypassKey struct{}
+
+// WithoutAICache ctx 中后续的文本请求不读取缓存，结果仍会写入缓存
+func WithoutAICache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, aiCacheBypassKey{}, true)
+}
+
+func aiCacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(aiCacheBypassKey{}).(bool)
+	return bypass
+}
+
+// aiCacheKey 计算缓存键。请求参数取 options 作用后的请求体（不含消息和模型），
+// 因此温度、max_tokens、结构化输出的 Schema 不同时不会命中
+func aiCacheKey(provider, model, systemPrompt, prompt string, options []func(*ai.ChatCompletionRequest)) string {
+	req := &ai.ChatCompletionRequest{}
+	for _, option := range options {
+		option(req)
+	}
+	params, _ := json.Marshal(req)
+
+	data, _ := json.Marshal(struct {
+		Provider     string          `json:"provider"`
+		Model        string          `json:"model"`
+		SystemPrompt string          `json:"system_prompt"`
+		Prompt       string          `json:"prompt"`
+		Params       json.RawMessage `json:"params"`
+	}{provider, model, systemPrompt, prompt, params})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type AICacheQuery struct {
+	Provider  string `form:"provider"`
+	Model     string `form:"model"`
+	Operation string `form:"operation"`
+	Page      int    `form:"page,default=1"`
+	PageSize  int    `form:"page_size,default=20"`
+}
+
+// AICacheStats 缓存概况
+type AICacheStats struct {
+	Enabled  bool  `json:"enabled"`
+	TTLHours int   `json:"ttl_hours"`
+	Entries  int64 `json:"entries"`
+	Expired  int64 `json:"expired"`
+	Hits     int64 `json:"hits"`
+}
+
+// AICacheService 文本请求响应缓存的读写和管理
+type AICacheService struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+func NewAICacheService(db *gorm.DB, log *logger.Logger) *AICacheService {
+	return &AICacheService{
+		db:  db,
+		log: log,
+	}
+}
+
+// aiCacheCandidate 一个候选配置对应的缓存键
+type aiCacheCandidate struct {
+	config *models.AIServiceConfig
+	model  string
+	key    string
+}
+
+// candidates 为每个候选配置计算缓存键，顺序与故障切换顺序一致
+func (s *AICacheService) candidates(configs []models.AIServiceConfig, modelName, systemPrompt, prompt string, options []func(*ai.ChatCompletionRequest)) []aiCacheCandidate {
+	candidates := make([]aiCacheCandidate, 0, len(configs))
+	for i := range configs {
+		config := &configs[i]
+		model := configModel(config, modelName)
+		candidates = append(candidates, aiCacheCandidate{
+			config: config,
+			model:  model,
+			key:    aiCacheKey(config.Provider, model, systemPrompt, prompt, options),
+		})
+	}
+	return candidates
+}
+
+// lookup 按候选顺序查找未过期的缓存，命中时累加命中次数
+func (s *AICacheService) lookup(candidates []aiCacheCandidate) (*models.AIResponseCache, bool) {
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	keys := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		keys = append(keys, candidate.key)
+	}
+
+	var entries []models.AIResponseCache
+	if err := s.db.Where("cache_key IN ? AND expires_at > ?", keys, time.Now()).Find(&entries).Error; err != nil {
+		s.log.Warnw("Failed to read AI response cache", "error", err)
+		return nil, false
+	}
+	if len(entries) == 0 {
+		return nil, false
+	}
+
+	byKey := make(map[string]*models.AIResponseCache, len(entries))
+	for i := range entries {
+		byKey[entries[i].CacheKey] = &entries[i]
+	}
+	for _, candidate := range candidates {
+		entry, ok := byKey[candidate.key]
+		if !ok {
+			continue
+		}
+		now := time.Now()
+		if err := s.db.Model(entry).Updates(map[string]interface{}{
+			"hit_count":   gorm.Expr("hit_count + 1"),
+			"last_hit_at": now,
+		}).Error; err != nil {
+			s.log.Warnw("Failed to update AI cache hit count", "error", err, "cache_id", entry.ID)
+		}
+		return entry, true
+	}
+	return nil, false
+}
+
+// store 写入缓存，已存在相同键时覆盖响应并重新计算有效期。写入失败只记日志。
+func (s *AICacheService) store(ctx context.Context, candidate aiCacheCandidate, systemPrompt, prompt, response string) {
+	preview := []rune(systemPrompt + "\n" + prompt)
+	if len(preview) > aiCachePreviewLength {
+		preview = preview[:aiCachePreviewLength]
+	}
+
+	entry := &models.AIResponseCache{
+		CacheKey:      candidate.key,
+		ConfigID:      &candidate.config.ID,
+		Provider:      candidate.config.Provider,
+		Model:         candidate.model,
+		Operation:     usageScopeFrom(ctx).Operation,
+		PromptPreview: string(preview),
+		Response:      response,
+		ExpiresAt:     time.Now().Add(aiCacheTTL()),
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"config_id", "operation", "response", "expires_at", "updated_at"}),
+	}).Create(entry).Error; err != nil {
+		s.log.Warnw("Failed to write AI response cache", "error", err, "provider", entry.Provider, "model", entry.Model)
+	}
+}
+
+// evict 删除这些键对应的缓存，用于结果未通过校验时避免再次命中
+func (s *AICacheService) evict(candidates []aiCacheCandidate) {
+	keys := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		keys = append(keys, candidate.key)
+	}
+	if err := s.db.Where("cache_key IN ?", keys).Delete(&models.AIResponseCache{}).Error; err != nil {
+		s.log.Warnw("Failed to evict AI response cache", "error", err)
+	}
+}
+
+func (s *AICacheService) filter(query *AICacheQuery) *gorm.DB {
+	db := s.db.Model(&models.AIResponseCache{})
+	if query.Provider != "" {
+		db = db.Where("provider = ?", query.Provider)
+	}
+	if query.Model != "" {
+		db = db.Where("model = ?", query.Model)
+	}
+	if query.Operation != "" {
+		db = db.Where("operation = ?", query.Operation)
+	}
+	return db
+}
+
+// List 分页查询缓存记录，不返回响应内容
+func (s *AICacheService) List(query *AICacheQuery) ([]models.AIResponseCache, int64, error) {
+	db := s.filter(query)
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.AIResponseCache
+	if err := db.Omit("response").
+		Order("updated_at DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// Get 获取缓存记录及响应内容
+func (s *AICacheService) Get(id uint) (*models.AIResponseCache, error) {
+	var entry models.AIResponseCache
+	if err := s.db.First(&entry, id).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Delete 删除一条缓存
+func (s *AICacheService) Delete(id uint) error {
+	result := s.db.Delete(&models.AIResponseCache{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Clear 按条件清除缓存，expiredOnly 时只清除已过期的记录，返回删除的条数
+func (s *AICacheService) Clear(query *AICacheQuery, expiredOnly bool) (int64, error) {
+	db := s.filter(query)
+	if expiredOnly {
+		db = db.Where("expires_at <= ?", time.Now())
+	} else {
+		db = db.Where("1 = 1")
+	}
+	result := db.Delete(&models.AIResponseCache{})
+	return result.RowsAffected, result.Error
+}
+
+// Stats 获取缓存概况
+func (s *AICacheService) Stats() (*AICacheStats, error) {
+	cfg := aiCacheConfig()
+	stats := &AICacheStats{Enabled: cfg.Enabled, TTLHours: int(aiCacheTTL() / time.Hour)}
+
+	if err := s.db.Model(&models.AIResponseCache{}).Count(&stats.Entries).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.AIResponseCache{}).Where("expires_at <= ?", time.Now()).Count(&stats.Expired).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.AIResponseCache{}).Select("COALESCE(SUM(hit_count), 0)").Scan(&stats.Hits).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/video"
+)
+
+// capabilityEntry 注册表中的一个模型条目
+type capabilityEntry struct {
+	model        string
+	capabilities models.ModelCapabilities
+}
+
+// modelCapabilities 启用的服务商的模型能力，按 服务类型/服务商 分组，启动时和修改后从数据库加载
+var modelCapabilities = struct {
+	sync.RWMutex
+	entries map[string][]capabilityEntry
+}{entries: make(map[string][]capabilityEntry)}
+
+func capabilityKey(serviceType, provider string) string {
+	return serviceType + "/" + capabilityProviderName(provider)
+}
+
+// capabilityProviderName 配置中同一服务商有多种写法，统一为注册表中的名称
+func capabilityProviderName(provider string) string {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	switch provider {
+	case "volces", "doubao", "ark":
+		return "volcengine"
+	case "google":
+		return "gemini"
+	case "dalle", "sora":
+		return "openai"
+	case "automatic1111", "a1111", "stable_diffusion", "sd":
+		return "sdwebui"
+	default:
+		return provider
+	}
+}
+
+// setModelCapabilities 替换注册表内容
+func setModelCapabilities(providers []models.AIServiceProvider) {
+	entries := make(map[string][]capabilityEntry)
+	for _, provider := range providers {
+		key := capabilityKey(provider.ServiceType, provider.Name)
+		for _, model := range provider.Models {
+			entries[key] = append(entries[key], capabilityEntry{model: model.Model, capabilities: model.Capabilities})
+		}
+	}
+
+	modelCapabilities.Lock()
+	defer modelCapabilities.Unlock()
+	modelCapabilities.entries = entries
+}
+
+// lookupModelCapabilities 查找模型能力：完全匹配优先，其次是最长的前缀匹配（以 * 结尾），最后是 *。
+// 返回匹配到的条目名称，未登记时返回 false，调用方不做校验
+func lookupModelCapabilities(serviceType, provider, model string) (models.ModelCapabilities, string, bool) {
+	modelCapabilities.RLock()
+	defer modelCapabilities.RUnlock()
+
+	entries := modelCapabilities.entries[capabilityKey(serviceType, provider)]
+	var best *capabilityEntry
+	bestLength := -1
+	for i := range entries {
+		entry := &entries[i]
+		length := -1
+		switch {
+		case strings.EqualFold(entry.model, model):
+			length = math.MaxInt
+		case strings.HasSuffix(entry.model, "*"):
+			prefix := strings.TrimSuffix(entry.model, "*")
+			if strings.HasPrefix(strings.ToLower(model), strings.ToLower(prefix)) {
+				length = len(prefix)
+			}
+		}
+		if length > bestLength {
+			best, bestLength = entry, length
+		}
+	}
+	if best == nil {
+		return models.ModelCapabilities{}, "", false
+	}
+	return best.capabilities, best.model, true
+}
+
+// adaptVideoOptions 按配置的服务商和模型能力校验视频参数：可以调整的（时长、尾帧、参考图数量）追加覆盖选项并返回说明，
+// 无法满足的（不支持图生视频、参考图、宽高比、分辨率）返回错误。未登记能力的模型原样返回
+func adaptVideoOptions(config *models.AIServiceConfig, model string, imageURL string, opts []video.VideoOption) ([]video.VideoOption, []string, error) {
+	caps, matched, ok := lookupModelCapabilities("video", config.Provider, model)
+	if !ok {
+		return opts, nil, nil
+	}
+
+	options := &video.VideoOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	var notes []string
+	if (imageURL != "" || options.FirstFrameURL != "") && !caps.ImageToVideo {
+		return nil, nil, fmt.Errorf("model %s (%s) does not support image-to-video", model, matched)
+	}
+	if options.LastFrameURL != "" && !caps.LastFrame {
+		opts = append(opts, video.WithLastFrame(""))
+		notes = append(notes, "last frame is not supported, dropped")
+	}
+	if len(options.ReferenceImageURLs) > 0 {
+		if caps.MaxReferenceImages == 0 {
+			return nil, nil, fmt.Errorf("model %s (%s) does not support reference images", model, matched)
+		}
+		if len(options.ReferenceImageURLs) > caps.MaxReferenceImages {
+			opts = append(opts, video.WithReferenceImages(options.ReferenceImageURLs[:caps.MaxReferenceImages]))
+			notes = append(notes, fmt.Sprintf("reference images truncated from %d to %d", len(options.ReferenceImageURLs), caps.MaxReferenceImages))
+		}
+	}
+	if options.Duration > 0 {
+		if duration := supportedDuration(caps, options.Duration); duration != options.Duration {
+			opts = append(opts, video.WithDuration(duration))
+			notes = append(notes, fmt.Sprintf("duration adjusted from %ds to %ds", options.Duration, duration))
+		}
+	}
+	if options.AspectRatio != "" && len(caps.AspectRatios) > 0 && !containsFold(caps.AspectRatios, options.AspectRatio) {
+		return nil, nil, fmt.Errorf("model %s (%s) does not support aspect ratio %s, supported: %s", model, matched, options.AspectRatio, strings.Join(caps.AspectRatios, ", "))
+	}
+	if options.Resolution != "" && len(caps.Resolutions) > 0 && !containsFold(caps.Resolutions, options.Resolution) {
+		return nil, nil, fmt.Errorf("model %s (%s) does not support resolution %s, supported: %s", model, matched, options.Resolution, strings.Join(caps.Resolutions, ", "))
+	}
+	return opts, notes, nil
+}
+
+// adaptImageOptions 按配置的服务商和模型能力调整图片参数：去掉不支持的反向提示词和多余的参考图，
+// 尺寸不受支持时换成宽高比最接近的尺寸。未登记能力的模型原样返回
+func adaptImageOptions(config *models.AIServiceConfig, model string, opts []image.ImageOption) ([]image.ImageOption, []string) {
+	caps, _, ok := lookupModelCapabilities("image", config.Provider, model)
+	if !ok {
+		return opts, nil
+	}
+
+	options := &image.ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	var notes []string
+	if options.NegativePrompt != "" && !caps.NegativePrompt {
+		opts = append(opts, image.WithNegativePrompt(""))
+		notes = append(notes, "negative prompt is not supported, dropped")
+	}
+	if len(options.ReferenceImages) > caps.MaxReferenceImages {
+		opts = append(opts, image.WithReferenceImages(options.ReferenceImages[:caps.MaxReferenceImages]))
+		notes = append(notes, fmt.Sprintf("reference images truncated from %d to %d", len(options.ReferenceImages), caps.MaxReferenceImages))
+	}
+	if options.Size != "" && len(caps.Sizes) > 0 && !containsFold(caps.Sizes, options.Size) {
+		if size := nearestImageSize(caps.Sizes, options.Size); size != "" {
+			opts = append(opts, image.WithSize(size))
+			notes = append(notes, fmt.Sprintf("size adjusted from %s to %s", options.Size, size))
+		}
+	}
+	return opts, notes
+}
+
+// supportedDuration 有离散时长时取最接近的一个，否则限制在范围内
+func supportedDuration(caps models.ModelCapabilities, duration int) int {
+	if len(caps.Durations) > 0 {
+		best := caps.Durations[0]
+		for _, d := range caps.Durations[1:] {
+			if absInt(d-duration) < absInt(best-duration) {
+				best = d
+			}
+		}
+		return best
+	}
+	if caps.MinDuration > 0 && duration < caps.MinDuration {
+		return caps.MinDuration
+	}
+	if caps.MaxDuration > 0 && duration > caps.MaxDuration {
+		return caps.MaxDuration
+	}
+	return duration
+}
+
+// nearestImageSize 选择宽高比最接近、其次面积最接近的尺寸，无法解析请求的尺寸时返回空
+func nearestImageSize(sizes []string, size string) string {
+	var width, height int
+	if _, err := fmt.Sscanf(strings.ToLower(size), "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return ""
+	}
+
+	best := ""
+	bestRatio, bestArea := math.MaxFloat64, math.MaxFloat64
+	for _, candidate := range sizes {
+		var w, h int
+		if _, err := fmt.Sscanf(strings.ToLower(candidate), "%dx%d", &w, &h); err != nil || w <= 0 || h <= 0 {
+			continue
+		}
+		ratio := math.Abs(math.Log(float64(w)/float64(h)) - math.Log(float64(width)/float64(height)))
+		area := math.Abs(float64(w*h - width*height))
+		if ratio < bestRatio-1e-9 || (math.Abs(ratio-bestRatio) <= 1e-9 && area < bestArea) {
+			best, bestRatio, bestArea = candidate, ratio, area
+		}
+	}
+	return best
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// 熔断参数：同一配置连续出现临时错误达到阈值后暂停使用一段时间
+const (
+	breakerFailureThreshold = 3
+	breakerCooldown         = time.Minute
+)
+
+type configBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// configBreakers 记录本进程内各AI配置的健康状态
+var configBreakers = struct {
+	sync.Mutex
+	states map[uint]*configBreaker
+}{states: make(map[uint]*configBreaker)}
+
+// configBenched 判断配置是否处于熔断期
+func configBenched(configID uint) bool {
+	configBreakers.Lock()
+	defer configBreakers.Unlock()
+
+	state, ok := configBreakers.states[configID]
+	return ok && time.Now().Before(state.openUntil)
+}
+
+func recordConfigSuccess(configID uint) {
+	configBreakers.Lock()
+	defer configBreakers.Unlock()
+	delete(configBreakers.states, configID)
+}
+
+// recordConfigFailure 记录一次临时错误，达到阈值时熔断，返回是否刚被熔断
+func recordConfigFailure(configID uint) bool {
+	configBreakers.Lock()
+	defer configBreakers.Unlock()
+
+	state, ok := configBreakers.states[configID]
+	if !ok {
+		state = &configBreaker{}
+		configBreakers.states[configID] = state
+	}
+	state.failures++
+	if state.failures >= breakerFailureThreshold {
+		state.failures = 0
+		state.openUntil = time.Now().Add(breakerCooldown)
+		return true
+	}
+	return false
+}
+
+// failoverStop 包装不应再切换配置的错误（如流式输出已开始），Unwrap 保留原错误供重试判断
+type failoverStop struct {
+	err error
+}
+
+func (e *failoverStop) Error() string { return e.err.Error() }
+func (e *failoverStop) Unwrap() error { return e.err }
+
+// FailoverConfigs 返回按优先级排序的候选配置。指定模型时只使用包含该模型的配置，
+// 没有配置包含该模型时退回全部配置；处于熔断期的配置排在最后，仅在其他配置都失败时尝试。
+func (s *AIService) FailoverConfigs(serviceType string, modelName string) ([]models.AIServiceConfig, error) {
+	var configs []models.AIServiceConfig
+	if err := s.db.Where("service_type = ? AND is_active = ?", serviceType, true).
+		Order("priority DESC, created_at DESC").
+		Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("no active config found")
+	}
+
+	if modelName != "" {
+		var matched []models.AIServiceConfig
+		for _, config := range configs {
+			if configHasModel(&config, modelName) {
+				matched = append(matched, config)
+			}
+		}
+		if len(matched) > 0 {
+			configs = matched
+		} else {
+			s.log.Warnw("No config contains model, using all configs", "service_type", serviceType, "model", modelName)
+		}
+	}
+
+	sort.SliceStable(configs, func(i, j int) bool {
+		return !configBenched(configs[i].ID) && configBenched(configs[j].ID)
+	})
+	return configs, nil
+}
+
+// RunWithFailover 按优先级依次使用候选配置执行 call，遇到临时错误（429、5xx、超时）时切换到下一个配置，
+// 其他错误直接返回。返回实际完成请求的配置。
+// 每次尝试前检查预算，用尽时返回 BudgetExceededError；每次尝试都会记录到用量表，
+// call 应使用传入的 ctx 调用客户端，以便收集客户端通过 ai.ReportUsage 上报的用量。
+func (s *AIService) RunWithFailover(ctx context.Context, serviceType string, modelName string, call func(ctx context.Context, config *models.AIServiceConfig) error) (*models.AIServiceConfig, error) {
+	configs, err := s.FailoverConfigs(serviceType, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	usageService := NewUsageService(s.db, s.log)
+	ctx = usageService.withResolvedScope(ctx)
+
+	var lastErr error
+	for i := range configs {
+		config := &configs[i]
+		if err := s.checkBudgetBeforeCall(ctx, usageService); err != nil {
+			return nil, err
+		}
+
+		var usage ai.Usage
+		start := time.Now()
+		err := call(ai.WithUsageCollector(ctx, usage.Add), config)
+		usageService.RecordCall(ctx, config, configModel(config, modelName), usage, time.Since(start), err)
+
+		if err == nil {
+			recordConfigSuccess(config.ID)
+			s.log.Infow("AI request served",
+				"service_type", serviceType,
+				"config_id", config.ID,
+				"config_name", config.Name,
+				"provider", config.Provider,
+				"failover_attempt", i)
+			return config, nil
+		}
+
+		var stop *failoverStop
+		if errors.As(err, &stop) {
+			return nil, stop.err
+		}
+		if ctx.Err() != nil || !utils.IsTransientError(err) {
+			return nil, err
+		}
+
+		lastErr = err
+		if recordConfigFailure(config.ID) {
+			s.log.Warnw("AI config benched by circuit breaker", "config_id", config.ID, "config_name", config.Name, "cooldown", breakerCooldown)
+		}
+		if i < len(configs)-1 {
+			s.log.Warnw("AI request failed with transient error, failing over",
+				"service_type", serviceType,
+				"config_id", config.ID,
+				"config_name", config.Name,
+				"next_config_id", configs[i+1].ID,
+				"error", err)
+		}
+	}
+
+	return nil, lastErr
+}
+
+// configModel 选择调用配置时使用的模型：指定的模型在配置中存在时使用它，否则使用配置的第一个模型
+func configModel(config *models.AIServiceConfig, modelName string) string {
+	if modelName != "" && (configHasModel(config, modelName) || len(config.Model) == 0) {
+		return modelName
+	}
+	if len(config.Model) > 0 {
+		return config.Model[0]
+	}
+	return modelName
+}
+
+func configHasModel(config *models.AIServiceConfig, modelName string) bool {
+	for _, model := range config.Model {
+		if model == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+// failoverClient 实现 ai.AIClient，每次调用都按优先级在同类型的配置间自动故障切换
+type failoverClient struct {
+	service     *AIService
+	serviceType string
+	modelName   string
+}
+
+func (c *failoverClient) GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	cache, candidates := c.responseCache(prompt, systemPrompt, options)
+	if text, ok := c.cachedResponse(ctx, cache, candidates); ok {
+		return text, nil
+	}
+
+	var text string
+	servedBy, err := c.service.RunWithFailover(ctx, c.serviceType, c.modelName, func(ctx context.Context, config *models.AIServiceConfig) error {
+		client, err := newTextClient(config, configModel(config, c.modelName))
+		if err != nil {
+			return err
+		}
+		text, err = client.GenerateText(ctx, prompt, systemPrompt, options...)
+		return err
+	})
+	if err == nil {
+		c.storeResponse(ctx, cache, candidates, servedBy, prompt, systemPrompt, text)
+	}
+	return text, err
+}
+
+// GenerateTextStream 已开始输出增量后出错时不再切换配置，避免重复回调。命中缓存时一次性回调完整内容
+func (c *failoverClient) GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta ai.StreamHandler, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	cache, candidates := c.responseCache(prompt, systemPrompt, options)
+	if text, ok := c.cachedResponse(ctx, cache, candidates); ok {
+		if onDelta != nil {
+			if err := onDelta(text); err != nil {
+				return "", err
+			}
+		}
+		return text, nil
+	}
+
+	var text string
+	servedBy, err := c.service.RunWithFailover(ctx, c.serviceType, c.modelName, func(ctx context.Context, config *models.AIServiceConfig) error {
+		emitted := false
+		handler := func(delta string) error {
+			emitted = true
+			if onDelta != nil {
+				return onDelta(delta)
+			}
+			return nil
+		}
+
+		client, err := newTextClient(config, configModel(config, c.modelName))
+		if err != nil {
+			return err
+		}
+		text, err = client.GenerateTextStream(ctx, prompt, systemPrompt, handler, options...)
+		if err != nil && emitted {
+			return &failoverStop{err: err}
+		}
+		return err
+	})
+	if err == nil {
+		c.storeResponse(ctx, cache, candidates, servedBy, prompt, systemPrompt, text)
+	}
+	return text, err
+}
+
+// Chat 多轮对话不使用响应缓存
+func (c *failoverClient) Chat(ctx context.Context, messages []ai.ChatMessage, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	var text string
+	_, err := c.service.RunWithFailover(ctx, c.serviceType, c.modelName, func(ctx context.Context, config *models.AIServiceConfig) error {
+		client, err := newTextClient(config, configModel(config, c.modelName))
+		if err != nil {
+			return err
+		}
+		text, err = client.Chat(ctx, messages, options...)
+		return err
+	})
+	return text, err
+}
+
+// responseCache 启用响应缓存时返回缓存服务和各候选配置的缓存键，未启用时返回 nil
+func (c *failoverClient) responseCache(prompt, systemPrompt string, options []func(*ai.ChatCompletionRequest)) (*AICacheService, []aiCacheCandidate) {
+	if c.serviceType != "text" || !aiCacheConfig().Enabled {
+		return nil, nil
+	}
+	configs, err := c.service.FailoverConfigs(c.serviceType, c.modelName)
+	if err != nil {
+		return nil, nil
+	}
+	cache := NewAICacheService(c.service.db, c.service.log)
+	return cache, cache.candidates(configs, c.modelName, systemPrompt, prompt, options)
+}
+
+// cachedResponse 查找缓存，ctx 要求跳过缓存时不读取
+func (c *failoverClient) cachedResponse(ctx context.Context, cache *AICacheService, candidates []aiCacheCandidate) (string, bool) {
+	if cache == nil || aiCacheBypassed(ctx) {
+		return "", false
+	}
+	entry, ok := cache.lookup(candidates)
+	if !ok {
+		return "", false
+	}
+	c.service.log.Infow("AI response served from cache",
+		"cache_id", entry.ID,
+		"provider", entry.Provider,
+		"model", entry.Model,
+		"operation", usageScopeFrom(ctx).Operation)
+	return entry.Response, true
+}
+
+// storeResponse 以实际完成请求的配置写入缓存
+func (c *failoverClient) storeResponse(ctx context.Context, cache *AICacheService, candidates []aiCacheCandidate, servedBy *models.AIServiceConfig, prompt, systemPrompt, text string) {
+	if cache == nil || servedBy == nil {
+		return
+	}
+	for _, candidate := range candidates {
+		if candidate.config.ID == servedBy.ID {
+			cache.store(ctx, candidate, systemPrompt, prompt, text)
+			return
+		}
+	}
+}
+
+// evictCachedResponse 删除这次请求的缓存，用于结果未通过校验时
+func (c *failoverClient) evictCachedResponse(prompt, systemPrompt string, options []func(*ai.ChatCompletionRequest)) {
+	if cache, candidates := c.responseCache(prompt, systemPrompt, options); cache != nil {
+		cache.evict(candidates)
+	}
+}
+
+func (c *failoverClient) GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	var urls []string
+	_, err := c.service.RunWithFailover(ctx, c.serviceType, c.modelName, func(ctx context.Context, config *models.AIServiceConfig) error {
+		client, err := newTextClient(config, configModel(config, c.modelName))
+		if err != nil {
+			return err
+		}
+		urls, err = client.GenerateImage(ctx, prompt, size, n)
+		return err
+	})
+	return urls, err
+}
+
+func (c *failoverClient) TestConnection() error {
+	configs, err := c.service.FailoverConfigs(c.serviceType, c.modelName)
+	if err != nil {
+		return err
+	}
+	config := &configs[0]
+	client, err := newTextClient(config, configModel(config, c.modelName))
+	if err != nil {
+		return err
+	}
+	if err := client.TestConnection(); err != nil {
+		return fmt.Errorf("config %s: %w", config.Name, err)
+	}
+	return nil
+}
+
+// newTextClient 根据配置创建文本客户端，endpoint 为空时按 provider 设置默认值，配置了调用限制时加上限流
+func newTextClient(config *models.AIServiceConfig, model string) (ai.AIClient, error) {
+	apiKey, err := configAPIKey(config)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		switch config.Provider {
+		case "gemini", "google":
+			endpoint = "/v1beta/models/{model}:generateContent"
+		case "anthropic":
+			endpoint = "/v1/messages"
+		default:
+			endpoint = "/chat/completions"
+		}
+	}
+
+	var client ai.AIClient
+	switch config.Provider {
+	case "gemini", "google":
+		client = ai.NewGeminiClient(config.BaseURL, apiKey, model, endpoint)
+	case "anthropic":
+		client = ai.NewAnthropicClient(config.BaseURL, apiKey, model, endpoint)
+	case MockProvider:
+		client = ai.NewMockClient(model, utils.ParseMockSettings(config.Settings))
+	default:
+		// openai, chatfire 等其他厂商都使用 OpenAI 格式
+		client = ai.NewOpenAIClient(config.BaseURL, apiKey, model, endpoint)
+	}
+	return withTextRateLimit(config, client), nil
+}
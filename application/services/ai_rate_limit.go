@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/drama-generator/backend/pkg/video"
+)
+
+// configLimiters 本进程内各AI配置共享的限流器，同一配置的所有客户端使用同一个限流器
+var configLimiters = struct {
+	sync.Mutex
+	limiters map[uint]*utils.RateLimiter
+}{limiters: make(map[uint]*utils.RateLimiter)}
+
+// configLimiter 返回配置的限流器，未设置限制时返回 nil。配置修改后的限制在下次创建客户端时生效
+func configLimiter(config *models.AIServiceConfig) *utils.RateLimiter {
+	limits := utils.ParseRateLimits(config.Settings)
+
+	configLimiters.Lock()
+	defer configLimiters.Unlock()
+
+	limiter, ok := configLimiters.limiters[config.ID]
+	if !limits.Enabled() {
+		if ok {
+			// 已有请求可能在等待，放开限制后由它们自行结束
+			limiter.SetLimits(limits)
+			delete(configLimiters.limiters, config.ID)
+		}
+		return nil
+	}
+	if !ok {
+		limiter = utils.NewRateLimiter(limits)
+		configLimiters.limiters[config.ID] = limiter
+		return limiter
+	}
+	limiter.SetLimits(limits)
+	return limiter
+}
+
+// withTextRateLimit 为文本客户端加上配置的限流，未设置限制时原样返回
+func withTextRateLimit(config *models.AIServiceConfig, client ai.AIClient) ai.AIClient {
+	if limiter := configLimiter(config); limiter != nil {
+		return &limitedTextClient{client: client, limiter: limiter}
+	}
+	return client
+}
+
+// withImageRateLimit 为图片客户端加上配置的限流，未设置限制时原样返回
+func withImageRateLimit(config *models.AIServiceConfig, client image.ImageClient) image.ImageClient {
+	if limiter := configLimiter(config); limiter != nil {
+		return &limitedImageClient{client: client, limiter: limiter}
+	}
+	return client
+}
+
+// withVideoRateLimit 为视频客户端加上配置的限流，未设置限制时原样返回
+func withVideoRateLimit(config *models.AIServiceConfig, client video.VideoClient) video.VideoClient {
+	if limiter := configLimiter(config); limiter != nil {
+		return &limitedVideoClient{client: client, limiter: limiter}
+	}
+	return client
+}
+
+// limitedTextClient 每次调用前等待限流器放行，调用结束后按上报的用量计入 token 限制
+type limitedTextClient struct {
+	client  ai.AIClient
+	limiter *utils.RateLimiter
+}
+
+// acquire 等待放行，返回的 ctx 会统计客户端上报的 token 数并继续上报给外层收集器
+func (c *limitedTextClient) acquire(ctx context.Context) (context.Context, func(), error) {
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens := 0
+	outer := ctx
+	ctx = ai.WithUsageCollector(ctx, func(usage ai.Usage) {
+		tokens += usage.PromptTokens + usage.CompletionTokens
+		ai.ReportUsage(outer, usage)
+	})
+	return ctx, func() { release(tokens) }, nil
+}
+
+func (c *limitedTextClient) GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	ctx, done, err := c.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	return c.client.GenerateText(ctx, prompt, systemPrompt, options...)
+}
+
+func (c *limitedTextClient) GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta ai.StreamHandler, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	ctx, done, err := c.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	return c.client.GenerateTextStream(ctx, prompt, systemPrompt, onDelta, options...)
+}
+
+func (c *limitedTextClient) Chat(ctx context.Context, messages []ai.ChatMessage, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	ctx, done, err := c.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	return c.client.Chat(ctx, messages, options...)
+}
+
+func (c *limitedTextClient) GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	ctx, done, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return c.client.GenerateImage(ctx, prompt, size, n)
+}
+
+// TestConnection 测试连接不受限流
+func (c *limitedTextClient) TestConnection() error {
+	return c.client.TestConnection()
+}
+
+// limitedImageClient 提交任务和查询任务状态都计入请求数与并发数
+type limitedImageClient struct {
+	client  image.ImageClient
+	limiter *utils.RateLimiter
+}
+
+func (c *limitedImageClient) GenerateImage(ctx context.Context, prompt string, opts ...image.ImageOption) (*image.ImageResult, error) {
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release(0)
+	return c.client.GenerateImage(ctx, prompt, opts...)
+}
+
+func (c *limitedImageClient) EditImage(ctx context.Context, prompt string, sourceImage string, opts ...image.ImageOption) (*image.ImageResult, error) {
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release(0)
+	return c.client.EditImage(ctx, prompt, sourceImage, opts...)
+}
+
+func (c *limitedImageClient) GetTaskStatus(ctx context.Context, taskID string) (*image.ImageResult, error) {
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release(0)
+	return c.client.GetTaskStatus(ctx, taskID)
+}
+
+// limitedVideoClient 提交任务和查询任务状态都计入请求数与并发数
+type limitedVideoClient struct {
+	client  video.VideoClient
+	limiter *utils.RateLimiter
+}
+
+func (c *limitedVideoClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...video.VideoOption) (*video.VideoResult, error) {
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release(0)
+	return c.client.GenerateVideo(ctx, imageURL, prompt, opts...)
+}
+
+func (c *limitedVideoClient) GetTaskStatus(ctx context.Context, taskID string) (*video.VideoResult, error) {
+	release, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release(0)
+	return c.client.GetTaskStatus(ctx, taskID)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// apiKeySecrets 加密 API Key 使用的主密钥，启动时设置，未设置时 Key 以明文保存
+var apiKeySecrets = struct {
+	sync.RWMutex
+	box *utils.SecretBox
+}{}
+
+// SetMasterKey 设置加密 API Key 的主密钥，为空时不加密
+func SetMasterKey(masterKey string) error {
+	var box *utils.SecretBox
+	if masterKey != "" {
+		var err error
+		if box, err = utils.NewSecretBox(masterKey); err != nil {
+			return err
+		}
+	}
+
+	apiKeySecrets.Lock()
+	defer apiKeySecrets.Unlock()
+	apiKeySecrets.box = box
+	return nil
+}
+
+func apiKeyBox() *utils.SecretBox {
+	apiKeySecrets.RLock()
+	defer apiKeySecrets.RUnlock()
+	return apiKeySecrets.box
+}
+
+// sealAPIKey 返回要保存的 Key 和脱敏值
+func sealAPIKey(apiKey string) (string, string, error) {
+	box := apiKeyBox()
+	if box == nil {
+		return apiKey, utils.MaskSecret(apiKey), nil
+	}
+	sealed, err := box.Encrypt(apiKey)
+	if err != nil {
+		return "", "", err
+	}
+	return sealed, utils.MaskSecret(apiKey), nil
+}
+
+// configAPIKey 解密配置的 Key，用于创建客户端
+func configAPIKey(config *models.AIServiceConfig) (string, error) {
+	if !utils.IsEncryptedSecret(config.APIKey) {
+		return config.APIKey, nil
+	}
+	box := apiKeyBox()
+	if box == nil {
+		return "", fmt.Errorf("api key of config %s is encrypted but no master key is configured", config.Name)
+	}
+	apiKey, err := box.Decrypt(config.APIKey)
+	if err != nil {
+		return "", fmt.Errorf("config %s: %w", config.Name, err)
+	}
+	return apiKey, nil
+}
+
+// EncryptStoredAPIKeys 加密升级前以明文保存的 Key 并补全脱敏值，启动时调用，返回处理的配置数。
+// 未设置主密钥时只补全脱敏值
+func (s *AIService) EncryptStoredAPIKeys() (int, error) {
+	box := apiKeyBox()
+	var configs []models.AIServiceConfig
+	if err := s.db.Find(&configs).Error; err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, config := range configs {
+		// 加密时已同时保存脱敏值
+		if utils.IsEncryptedSecret(config.APIKey) || (box == nil && config.APIKeyMask != "") {
+			continue
+		}
+
+		updates := map[string]interface{}{"api_key_mask": utils.MaskSecret(config.APIKey)}
+		if box != nil {
+			sealed, err := box.Encrypt(config.APIKey)
+			if err != nil {
+				return updated, err
+			}
+			updates["api_key"] = sealed
+		}
+		if err := s.db.Model(&models.AIServiceConfig{}).Where("id = ?", config.ID).Updates(updates).Error; err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// RotateAPIKeys 用新主密钥重新加密所有配置的 Key。oldMasterKey 为空时表示原来以明文保存，
+// newMasterKey 为空时解密后以明文保存。任一配置解密失败时不做任何修改
+func (s *AIService) RotateAPIKeys(oldMasterKey, newMasterKey string) (int, error) {
+	var oldBox, newBox *utils.SecretBox
+	var err error
+	if oldMasterKey != "" {
+		if oldBox, err = utils.NewSecretBox(oldMasterKey); err != nil {
+			return 0, err
+		}
+	}
+	if newMasterKey != "" {
+		if newBox, err = utils.NewSecretBox(newMasterKey); err != nil {
+			return 0, err
+		}
+	}
+
+	rotated := 0
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var configs []models.AIServiceConfig
+		if err := tx.Find(&configs).Error; err != nil {
+			return err
+		}
+
+		for _, config := range configs {
+			apiKey := config.APIKey
+			if utils.IsEncryptedSecret(apiKey) {
+				if oldBox == nil {
+					return fmt.Errorf("api key of config %d (%s) is encrypted, old master key is required", config.ID, config.Name)
+				}
+				if apiKey, err = oldBox.Decrypt(apiKey); err != nil {
+					return fmt.Errorf("config %d (%s): %w", config.ID, config.Name, err)
+				}
+			}
+
+			sealed := apiKey
+			if newBox != nil {
+				if sealed, err = newBox.Encrypt(apiKey); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&models.AIServiceConfig{}).Where("id = ?", config.ID).Updates(map[string]interface{}{
+				"api_key":      sealed,
+				"api_key_mask": utils.MaskSecret(apiKey),
+			}).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rotated, nil
+}
+
+// storedAPIKey 测试连接时前端提交的是脱敏值，使用已保存配置的 Key
+func (s *AIService) storedAPIKey(configID uint) (string, error) {
+	config, err := s.GetConfig(configID)
+	if err != nil {
+		return "", err
+	}
+	if config.APIKey == "" {
+		return "", errors.New("config has no api key")
+	}
+	return configAPIKey(config)
+}
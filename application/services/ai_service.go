@@ -1,12 +1,14 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/utils"
 	"gorm.io/gorm"
 )
 
@@ -51,6 +53,8 @@ type UpdateAIConfigRequest struct {
 }
 
 type TestConnectionRequest struct {
+	// ConfigID 测试已保存的配置时传入，api_key 为脱敏值时使用该配置保存的 Key
+	ConfigID uint              `json:"config_id"`
 	BaseURL  string            `json:"base_url" binding:"required,url"`
 	APIKey   string            `json:"api_key" binding:"required"`
 	Model    models.ModelField `json:"model" binding:"required"`
@@ -71,6 +75,10 @@ func (s *AIService) CreateConfig(req *CreateAIConfigRequest) (*models.AIServiceC
 			} else if req.ServiceType == "image" {
 				endpoint = "/v1beta/models/{model}:generateContent"
 			}
+		case "anthropic":
+			if req.ServiceType == "text" {
+				endpoint = "/v1/messages"
+			}
 		case "openai":
 			if req.ServiceType == "text" {
 				endpoint = "/chat/completions"
@@ -93,6 +101,8 @@ func (s *AIService) CreateConfig(req *CreateAIConfigRequest) (*models.AIServiceC
 					queryEndpoint = "/video/task/{taskId}"
 				}
 			}
+		case MockProvider:
+			// mock 服务商不调用接口，无需端点
 		case "doubao", "volcengine", "volces":
 			if req.ServiceType == "video" {
 				endpoint = "/contents/generations/tasks"
@@ -110,12 +120,19 @@ func (s *AIService) CreateConfig(req *CreateAIConfigRequest) (*models.AIServiceC
 		}
 	}
 
+	apiKey, apiKeyMask, err := sealAPIKey(req.APIKey)
+	if err != nil {
+		s.log.Errorw("Failed to encrypt API key", "error", err)
+		return nil, err
+	}
+
 	config := &models.AIServiceConfig{
 		ServiceType:   req.ServiceType,
 		Name:          req.Name,
 		Provider:      req.Provider,
 		BaseURL:       req.BaseURL,
-		APIKey:        req.APIKey,
+		APIKey:        apiKey,
+		APIKeyMask:    apiKeyMask,
 		Model:         req.Model,
 		Endpoint:      endpoint,
 		QueryEndpoint: queryEndpoint,
@@ -186,8 +203,16 @@ func (s *AIService) UpdateConfig(configID uint, req *UpdateAIConfigRequest) (*mo
 	if req.BaseURL != "" {
 		updates["base_url"] = req.BaseURL
 	}
-	if req.APIKey != "" {
-		updates["api_key"] = req.APIKey
+	// 前端编辑时原样提交的脱敏值不更新
+	if req.APIKey != "" && !utils.IsMaskedSecret(req.APIKey) {
+		apiKey, apiKeyMask, err := sealAPIKey(req.APIKey)
+		if err != nil {
+			tx.Rollback()
+			s.log.Errorw("Failed to encrypt API key", "error", err)
+			return nil, err
+		}
+		updates["api_key"] = apiKey
+		updates["api_key_mask"] = apiKeyMask
 	}
 	if req.Model != nil && len(*req.Model) > 0 {
 		updates["model"] = *req.Model
@@ -206,6 +231,10 @@ func (s *AIService) UpdateConfig(configID uint, req *UpdateAIConfigRequest) (*mo
 			if serviceType == "text" || serviceType == "image" {
 				updates["endpoint"] = "/v1beta/models/{model}:generateContent"
 			}
+		case "anthropic":
+			if serviceType == "text" {
+				updates["endpoint"] = "/v1/messages"
+			}
 		case "openai":
 			if serviceType == "text" {
 				updates["endpoint"] = "/chat/completions"
@@ -270,6 +299,17 @@ func (s *AIService) DeleteConfig(configID uint) error {
 func (s *AIService) TestConnection(req *TestConnectionRequest) error {
 	s.log.Infow("TestConnection called", "baseURL", req.BaseURL, "provider", req.Provider, "endpoint", req.Endpoint, "modelCount", len(req.Model))
 
+	if utils.IsMaskedSecret(req.APIKey) {
+		if req.ConfigID == 0 {
+			return errors.New("api key is masked, config_id is required to use the saved key")
+		}
+		apiKey, err := s.storedAPIKey(req.ConfigID)
+		if err != nil {
+			return err
+		}
+		req.APIKey = apiKey
+	}
+
 	// 使用第一个模型进行测试
 	model := ""
 	if len(req.Model) > 0 {
@@ -287,6 +327,18 @@ func (s *AIService) TestConnection(req *TestConnectionRequest) error {
 		s.log.Infow("Using Gemini client", "baseURL", req.BaseURL)
 		endpoint = "/v1beta/models/{model}:generateContent"
 		client = ai.NewGeminiClient(req.BaseURL, req.APIKey, model, endpoint)
+	case "anthropic":
+		// Anthropic Messages API
+		s.log.Infow("Using Anthropic client", "baseURL", req.BaseURL)
+		endpoint = req.Endpoint
+		if endpoint == "" {
+			endpoint = "/v1/messages"
+		}
+		client = ai.NewAnthropicClient(req.BaseURL, req.APIKey, model, endpoint)
+	case MockProvider:
+		// 内置 mock，不访问网络
+		s.log.Infow("Using mock client")
+		client = ai.NewMockClient(model, utils.MockSettings{})
 	case "openai", "chatfire":
 		// OpenAI 格式（包括 chatfire 等）
 		s.log.Infow("Using OpenAI-compatible client", "baseURL", req.BaseURL, "provider", req.Provider)
@@ -355,81 +407,48 @@ func (s *AIService) GetConfigForModel(serviceType string, modelName string) (*mo
 	return nil, errors.New("no active config found for model: " + modelName)
 }
 
+// GetAIClient 返回按优先级自动故障切换的客户端：遇到临时错误时依次改用同类型的其他激活配置
 func (s *AIService) GetAIClient(serviceType string) (ai.AIClient, error) {
-	config, err := s.GetDefaultConfig(serviceType)
-	if err != nil {
+	if _, err := s.GetDefaultConfig(serviceType); err != nil {
 		return nil, err
 	}
 
-	// 使用第一个模型
-	model := ""
-	if len(config.Model) > 0 {
-		model = config.Model[0]
-	}
-
-	// 使用数据库配置中的 endpoint，如果为空则根据 provider 设置默认值
-	endpoint := config.Endpoint
-	if endpoint == "" {
-		switch config.Provider {
-		case "gemini", "google":
-			endpoint = "/v1beta/models/{model}:generateContent"
-		default:
-			endpoint = "/chat/completions"
-		}
-	}
-
-	// 根据 provider 创建对应的客户端
-	switch config.Provider {
-	case "gemini", "google":
-		return ai.NewGeminiClient(config.BaseURL, config.APIKey, model, endpoint), nil
-	default:
-		// openai, chatfire 等其他厂商都使用 OpenAI 格式
-		return ai.NewOpenAIClient(config.BaseURL, config.APIKey, model, endpoint), nil
-	}
+	return &failoverClient{service: s, serviceType: serviceType}, nil
 }
 
-// GetAIClientForModel 根据服务类型和模型名称获取对应的AI客户端
+// GetAIClientForModel 根据服务类型和模型名称获取对应的AI客户端，在包含该模型的配置间自动故障切换
 func (s *AIService) GetAIClientForModel(serviceType string, modelName string) (ai.AIClient, error) {
-	config, err := s.GetConfigForModel(serviceType, modelName)
-	if err != nil {
+	if _, err := s.GetConfigForModel(serviceType, modelName); err != nil {
 		return nil, err
 	}
 
-	// 使用数据库配置中的 endpoint，如果为空则根据 provider 设置默认值
-	endpoint := config.Endpoint
-	if endpoint == "" {
-		switch config.Provider {
-		case "gemini", "google":
-			endpoint = "/v1beta/models/{model}:generateContent"
-		default:
-			endpoint = "/chat/completions"
-		}
-	}
+	return &failoverClient{service: s, serviceType: serviceType, modelName: modelName}, nil
+}
 
-	// 根据 provider 创建对应的客户端
-	switch config.Provider {
-	case "gemini", "google":
-		return ai.NewGeminiClient(config.BaseURL, config.APIKey, modelName, endpoint), nil
-	default:
-		// openai, chatfire 等其他厂商都使用 OpenAI 格式
-		return ai.NewOpenAIClient(config.BaseURL, config.APIKey, modelName, endpoint), nil
+func (s *AIService) GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	client, err := s.GetAIClient("text")
+	if err != nil {
+		return "", fmt.Errorf("failed to get AI client: %w", err)
 	}
+
+	return client.GenerateText(ctx, prompt, systemPrompt, options...)
 }
 
-func (s *AIService) GenerateText(prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+// GenerateTextStream 使用默认文本配置流式生成，增量内容通过 onDelta 回调
+func (s *AIService) GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta ai.StreamHandler, options ...func(*ai.ChatCompletionRequest)) (string, error) {
 	client, err := s.GetAIClient("text")
 	if err != nil {
 		return "", fmt.Errorf("failed to get AI client: %w", err)
 	}
 
-	return client.GenerateText(prompt, systemPrompt, options...)
+	return client.GenerateTextStream(ctx, prompt, systemPrompt, onDelta, options...)
 }
 
-func (s *AIService) GenerateImage(prompt string, size string, n int) ([]string, error) {
+func (s *AIService) GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error) {
 	client, err := s.GetAIClient("image")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get AI client for image: %w", err)
 	}
 
-	return client.GenerateImage(prompt, size, n)
+	return client.GenerateImage(ctx, prompt, size, n)
 }
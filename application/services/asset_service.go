@@ -229,13 +229,14 @@ func (s *AssetService) ImportFromImageGen(imageGenID uint) (*models.Asset, error
 
 	dramaID := imageGen.DramaID
 	asset := &models.Asset{
-		Name:       fmt.Sprintf("Image_%d", imageGen.ID),
-		Type:       models.AssetTypeImage,
-		URL:        *imageGen.ImageURL,
-		DramaID:    &dramaID,
-		ImageGenID: &imageGenID,
-		Width:      imageGen.Width,
-		Height:     imageGen.Height,
+		Name:         fmt.Sprintf("Image_%d", imageGen.ID),
+		Type:         models.AssetTypeImage,
+		URL:          *imageGen.ImageURL,
+		DramaID:      &dramaID,
+		ImageGenID:   &imageGenID,
+		Width:        imageGen.Width,
+		Height:       imageGen.Height,
+		ThumbnailURL: imageGen.ThumbnailURL,
 	}
 
 	if err := s.db.Create(asset).Error; err != nil {
@@ -287,5 +288,12 @@ func (s *AssetService) ImportFromVideoGen(videoGenID uint) (*models.Asset, error
 		return nil, fmt.Errorf("failed to create asset: %w", err)
 	}
 
+	// 加入素材库视为选定该视频，成片合成使用同一个视频
+	if videoGen.StoryboardID != nil {
+		if err := pinVideoTake(s.db, &videoGen); err != nil {
+			s.log.Warnw("Failed to select imported video for storyboard", "storyboard_id", *videoGen.StoryboardID, "error", err)
+		}
+	}
+
 	return asset, nil
 }
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"gorm.io/gorm"
+)
+
+// ErrorCodeBudgetExceeded 预算用尽时任务和接口返回的错误码
+const ErrorCodeBudgetExceeded = "BUDGET_EXCEEDED"
+
+// defaultBudgetWarnRatio 未配置预警阈值时使用的比例
+const defaultBudgetWarnRatio = 0.8
+
+// ErrBudgetExceeded 剧本或全局预算已用尽
+var ErrBudgetExceeded = errors.New(ErrorCodeBudgetExceeded)
+
+// BudgetExceededError 预算用尽的详细信息，errors.Is(err, ErrBudgetExceeded) 为 true
+type BudgetExceededError struct {
+	Scope   string // drama, global
+	DramaID uint
+	Spent   float64
+	Limit   float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Scope == "drama" {
+		return fmt.Sprintf("%s: 剧本 #%d 的预算已用尽（已花费 %.4f，上限 %.4f）", ErrorCodeBudgetExceeded, e.DramaID, e.Spent, e.Limit)
+	}
+	return fmt.Sprintf("%s: 全局预算已用尽（已花费 %.4f，上限 %.4f）", ErrorCodeBudgetExceeded, e.Spent, e.Limit)
+}
+
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// errorCode 返回错误对应的错误码，没有时返回空字符串
+func errorCode(err error) string {
+	if errors.Is(err, ErrBudgetExceeded) {
+		return ErrorCodeBudgetExceeded
+	}
+	return ""
+}
+
+// globalBudget 全局预算配置，启动时及通过接口修改后更新
+var globalBudget = struct {
+	sync.RWMutex
+	cfg config.BudgetConfig
+}{}
+
+// SetBudgetConfig 设置全局预算配置
+func SetBudgetConfig(cfg config.BudgetConfig) {
+	globalBudget.Lock()
+	defer globalBudget.Unlock()
+	globalBudget.cfg = cfg
+}
+
+func budgetConfig() config.BudgetConfig {
+	globalBudget.RLock()
+	defer globalBudget.RUnlock()
+	return globalBudget.cfg
+}
+
+// BudgetStatus 预算使用情况
+type BudgetStatus struct {
+	Scope     string     `json:"scope"` // drama, global
+	DramaID   *uint      `json:"drama_id,omitempty"`
+	Limit     *float64   `json:"limit"` // 为空表示不限制
+	Spent     float64    `json:"spent"`
+	Remaining *float64   `json:"remaining,omitempty"`
+	UsedRatio float64    `json:"used_ratio"`
+	WarnRatio float64    `json:"warn_ratio,omitempty"` // 已达到的最高预警阈值
+	Exceeded  bool       `json:"exceeded"`
+	Since     *time.Time `json:"since,omitempty"` // 统计起始时间，为空表示全部用量
+}
+
+func (b *BudgetStatus) evaluate(warnRatios []float64) {
+	if b.Limit == nil {
+		return
+	}
+	remaining := *b.Limit - b.Spent
+	if remaining < 0 {
+		remaining = 0
+	}
+	b.Remaining = &remaining
+	b.Exceeded = b.Spent >= *b.Limit
+	if *b.Limit > 0 {
+		b.UsedRatio = b.Spent / *b.Limit
+	} else if b.Exceeded {
+		b.UsedRatio = 1
+	}
+
+	if len(warnRatios) == 0 {
+		warnRatios = []float64{defaultBudgetWarnRatio}
+	}
+	for _, ratio := range warnRatios {
+		if b.UsedRatio >= ratio && ratio > b.WarnRatio {
+			b.WarnRatio = ratio
+		}
+	}
+}
+
+func (b *BudgetStatus) exceededError() error {
+	if !b.Exceeded {
+		return nil
+	}
+	err := &BudgetExceededError{Scope: b.Scope, Spent: b.Spent, Limit: *b.Limit}
+	if b.DramaID != nil {
+		err.DramaID = *b.DramaID
+	}
+	return err
+}
+
+// warning 达到预警阈值但未用尽时返回提示文字
+func (b *BudgetStatus) warning() string {
+	if b.Exceeded || b.WarnRatio == 0 {
+		return ""
+	}
+	if b.Scope == "drama" {
+		return fmt.Sprintf("预算预警：剧本 #%d 已使用 %.0f%% 的预算（%.4f / %.4f）", *b.DramaID, b.UsedRatio*100, b.Spent, *b.Limit)
+	}
+	return fmt.Sprintf("预算预警：已使用 %.0f%% 的全局预算（%.4f / %.4f）", b.UsedRatio*100, b.Spent, *b.Limit)
+}
+
+// DramaBudgetStatus 获取剧本预算的使用情况
+func (s *UsageService) DramaBudgetStatus(dramaID uint) (*BudgetStatus, error) {
+	var drama models.Drama
+	if err := s.db.Select("id", "budget_limit").First(&drama, dramaID).Error; err != nil {
+		return nil, err
+	}
+
+	status := &BudgetStatus{Scope: "drama", DramaID: &drama.ID, Limit: drama.BudgetLimit}
+	if err := s.db.Model(&models.AIUsageRecord{}).
+		Where("drama_id = ?", dramaID).
+		Select("COALESCE(SUM(cost), 0)").
+		Scan(&status.Spent).Error; err != nil {
+		return nil, err
+	}
+	status.evaluate(budgetConfig().WarnRatios)
+	return status, nil
+}
+
+// GlobalBudgetStatus 获取全局预算的使用情况
+func (s *UsageService) GlobalBudgetStatus() (*BudgetStatus, error) {
+	cfg := budgetConfig()
+	status := &BudgetStatus{Scope: "global"}
+	if cfg.GlobalLimit > 0 {
+		limit := cfg.GlobalLimit
+		status.Limit = &limit
+	}
+
+	db := s.db.Model(&models.AIUsageRecord{})
+	if cfg.GlobalPeriod == "month" {
+		now := time.Now()
+		since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		status.Since = &since
+		db = db.Where("created_at >= ?", since)
+	}
+	if err := db.Select("COALESCE(SUM(cost), 0)").Scan(&status.Spent).Error; err != nil {
+		return nil, err
+	}
+	status.evaluate(cfg.WarnRatios)
+	return status, nil
+}
+
+// CheckBudget 在调用服务商前检查剧本预算和全局预算，任一用尽时返回 BudgetExceededError，
+// 达到预警阈值时返回提示文字
+func (s *UsageService) CheckBudget(dramaID *uint) ([]string, error) {
+	var statuses []*BudgetStatus
+	if dramaID != nil {
+		status, err := s.DramaBudgetStatus(*dramaID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if status != nil {
+			statuses = append(statuses, status)
+		}
+	}
+	if budgetConfig().GlobalLimit > 0 {
+		status, err := s.GlobalBudgetStatus()
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+
+	var warnings []string
+	for _, status := range statuses {
+		if err := status.exceededError(); err != nil {
+			return nil, err
+		}
+		if warning := status.warning(); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings, nil
+}
+
+// SetDramaBudget 设置剧本预算，limit 为空时取消限制
+func (s *UsageService) SetDramaBudget(dramaID uint, limit *float64) (*BudgetStatus, error) {
+	var drama models.Drama
+	if err := s.db.Select("id").First(&drama, dramaID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&drama).Update("budget_limit", limit).Error; err != nil {
+		return nil, err
+	}
+	return s.DramaBudgetStatus(dramaID)
+}
+
+// NormalizeWarnRatios 过滤无效的预警阈值并升序排列
+func NormalizeWarnRatios(ratios []float64) []float64 {
+	normalized := make([]float64, 0, len(ratios))
+	for _, ratio := range ratios {
+		if ratio > 0 && ratio < 1 {
+			normalized = append(normalized, ratio)
+		}
+	}
+	sort.Float64s(normalized)
+	return normalized
+}
+
+// checkBudgetBeforeCall 在每次调用服务商前检查预算，预警信息写入所属任务的状态消息
+func (s *AIService) checkBudgetBeforeCall(ctx context.Context, usageService *UsageService) error {
+	warnings, err := usageService.CheckBudget(usageScopeFrom(ctx).DramaID)
+	if err != nil {
+		return err
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	s.log.Warnw("AI budget warning", "warnings", warnings)
+	if taskID := taskIDFromContext(ctx); taskID != "" {
+		if err := NewTaskService(s.db, s.log).UpdateTaskMessage(taskID, strings.Join(warnings, "；")); err != nil {
+			s.log.Warnw("Failed to update task message with budget warning", "task_id", taskID, "error", err)
+		}
+	}
+	return nil
+}
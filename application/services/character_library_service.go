@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -9,7 +10,6 @@ import (
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
-	"github.com/drama-generator/backend/pkg/utils"
 	"gorm.io/gorm"
 )
 
@@ -498,8 +498,8 @@ func (s *CharacterLibraryService) BatchGenerateCharacterImages(characterIDs []st
 		"total", len(characterIDs))
 }
 
-// ExtractCharactersFromScript 从分集剧本中提取角色
-func (s *CharacterLibraryService) ExtractCharactersFromScript(episodeID uint) (string, error) {
+// ExtractCharactersFromScript 从分集剧本中提取角色，bypassCache 为 true 时不使用缓存的AI响应
+func (s *CharacterLibraryService) ExtractCharactersFromScript(episodeID uint, bypassCache bool) (string, error) {
 	var episode models.Episode
 	if err := s.db.First(&episode, episodeID).Error; err != nil {
 		return "", fmt.Errorf("episode not found")
@@ -514,12 +514,18 @@ func (s *CharacterLibraryService) ExtractCharactersFromScript(episodeID uint) (s
 		return "", fmt.Errorf("创建任务失败: %w", err)
 	}
 
-	go s.processCharacterExtraction(task.ID, episode)
+	go s.processCharacterExtraction(task.ID, episode, bypassCache)
 
 	return task.ID, nil
 }
 
-func (s *CharacterLibraryService) processCharacterExtraction(taskID string, episode models.Episode) {
+func (s *CharacterLibraryService) processCharacterExtraction(taskID string, episode models.Episode, bypassCache bool) {
+	ctx, release := WithTaskContext(context.Background(), taskID)
+	defer release()
+	if bypassCache {
+		ctx = WithoutAICache(ctx)
+	}
+
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在分析剧本...")
 
 	script := ""
@@ -530,30 +536,34 @@ func (s *CharacterLibraryService) processCharacterExtraction(taskID string, epis
 	prompt := s.promptI18n.GetCharacterExtractionPrompt()
 	userPrompt := fmt.Sprintf("【剧本内容】\n%s", script)
 
-	response, err := s.aiService.GenerateText(userPrompt, prompt, ai.WithMaxTokens(3000))
+	var extracted struct {
+		Characters []struct {
+			Name        string `json:"name"`
+			Role        string `json:"role"`
+			Appearance  string `json:"appearance"`
+			Personality string `json:"personality"`
+			Description string `json:"description"`
+		} `json:"characters"`
+	}
+
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "character_extraction", DramaID: &episode.DramaID, EpisodeID: &episode.ID})
+	response, err := s.aiService.GenerateStructured(usageCtx, StructuredRequest{
+		Prompt:       userPrompt,
+		SystemPrompt: prompt,
+		SchemaName:   "characters",
+		Options:      []func(*ai.ChatCompletionRequest){ai.WithMaxTokens(3000)},
+		PromptI18n:   s.promptI18n,
+	}, &extracted)
 	if err != nil {
+		s.log.Errorw("Failed to extract characters", "error", err, "response", response)
 		s.taskService.UpdateTaskError(taskID, err)
 		return
 	}
 
 	s.taskService.UpdateTaskStatus(taskID, "processing", 50, "正在整理角色数据...")
 
-	var extractedCharacters []struct {
-		Name        string `json:"name"`
-		Role        string `json:"role"`
-		Appearance  string `json:"appearance"`
-		Personality string `json:"personality"`
-		Description string `json:"description"`
-	}
-
-	if err := utils.SafeParseAIJSON(response, &extractedCharacters); err != nil {
-		s.log.Errorw("Failed to parse AI response for characters", "error", err, "response", response)
-		s.taskService.UpdateTaskError(taskID, fmt.Errorf("解析AI响应失败"))
-		return
-	}
-
 	var savedCharacters []models.Character
-	for _, charData := range extractedCharacters {
+	for _, charData := range extracted.Characters {
 		// 检查是否已存在同名角色
 		var existingCharacter models.Character
 		err := s.db.Where("drama_id = ? AND name = ?", episode.DramaID, charData.Name).First(&existingCharacter).Error
@@ -0,0 +1,624 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/storage"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// 制作流水线阶段，按顺序执行
+const (
+	PipelineStageCharacters   = "characters"    // 提取角色
+	PipelineStageProps        = "props"         // 提取道具
+	PipelineStageBackgrounds  = "backgrounds"   // 提取场景
+	PipelineStageStoryboards  = "storyboards"   // 生成分镜
+	PipelineStageFramePrompts = "frame_prompts" // 生成首帧提示词
+	PipelineStageImages       = "images"        // 批量生成分镜图片
+	PipelineStageVideos       = "videos"        // 批量生成分镜视频
+	PipelineStageFinalize     = "finalize"      // 合成成片
+)
+
+var pipelineStages = []string{
+	PipelineStageCharacters,
+	PipelineStageProps,
+	PipelineStageBackgrounds,
+	PipelineStageStoryboards,
+	PipelineStageFramePrompts,
+	PipelineStageImages,
+	PipelineStageVideos,
+	PipelineStageFinalize,
+}
+
+// 阶段状态
+const (
+	PipelineStepPending   = "pending"
+	PipelineStepRunning   = "running"
+	PipelineStepCompleted = "completed"
+	PipelineStepFailed    = "failed"
+	PipelineStepSkipped   = "skipped"
+)
+
+// pipelinePollInterval 等待子任务和生成记录完成的轮询间隔
+const pipelinePollInterval = 5 * time.Second
+
+var (
+	ErrInvalidPipelineStage = errors.New("无效的流水线阶段")
+	ErrPipelineRunning      = errors.New("该章节已有进行中的制作任务")
+	ErrPipelineNotResumable = errors.New("只有失败或已取消的制作任务可以恢复")
+)
+
+// PipelineStep 流水线阶段的执行状态，记录子任务和生成记录以便恢复时复用
+type PipelineStep struct {
+	Stage       string     `json:"stage"`
+	Status      string     `json:"status"`
+	TaskIDs     []string   `json:"task_ids,omitempty"`
+	ResourceIDs []string   `json:"resource_ids,omitempty"` // 与 TaskIDs 一一对应，子任务被清理后按此重新启动
+	ImageGenIDs []uint     `json:"image_gen_ids,omitempty"`
+	VideoGenIDs []uint     `json:"video_gen_ids,omitempty"`
+	MergeID     uint       `json:"merge_id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// PipelineState 流水线进度，保存在父任务的 result 字段
+type PipelineState struct {
+	EpisodeID string         `json:"episode_id"`
+	Steps     []PipelineStep `json:"steps"`
+}
+
+// ProduceEpisodeRequest 一键制作请求
+type ProduceEpisodeRequest struct {
+	SkipStages   []string `json:"skip_stages"`
+	Model        string   `json:"model"`
+	Style        string   `json:"style"`
+	ResumeTaskID string   `json:"resume_task_id"` // 从失败的阶段恢复已有任务
+}
+
+// episodeProductionJob 制作任务参数
+type episodeProductionJob struct {
+	EpisodeID  string   `json:"episode_id"`
+	Model      string   `json:"model,omitempty"`
+	Style      string   `json:"style,omitempty"`
+	SkipStages []string `json:"skip_stages,omitempty"`
+}
+
+// EpisodePipelineService 按顺序调用各生成服务完成一集的制作
+type EpisodePipelineService struct {
+	db                 *gorm.DB
+	log                *logger.Logger
+	taskService        *TaskService
+	characterService   *CharacterLibraryService
+	propService        *PropService
+	imageService       *ImageGenerationService
+	storyboardService  *StoryboardService
+	framePromptService *FramePromptService
+	videoService       *VideoGenerationService
+	videoMergeService  *VideoMergeService
+}
+
+func NewEpisodePipelineService(db *gorm.DB, cfg *config.Config, transferService *ResourceTransferService, localStorage *storage.LocalStorage, log *logger.Logger) *EpisodePipelineService {
+	aiService := NewAIService(db, log)
+	taskService := NewTaskService(db, log)
+	imageService := NewImageGenerationService(db, cfg, transferService, localStorage, log)
+
+	return &EpisodePipelineService{
+		db:                 db,
+		log:                log,
+		taskService:        taskService,
+		characterService:   NewCharacterLibraryService(db, log, cfg),
+		propService:        NewPropService(db, aiService, taskService, imageService, log, cfg),
+		imageService:       imageService,
+		storyboardService:  NewStoryboardService(db, cfg, log),
+		framePromptService: NewFramePromptService(db, cfg, log),
+		videoService:       NewVideoGenerationService(db, transferService, localStorage, aiService, log),
+		videoMergeService:  NewVideoMergeService(db, nil, cfg.Storage.LocalPath, cfg.Storage.BaseURL, log),
+	}
+}
+
+// ProduceEpisode 创建一键制作任务，或恢复失败/已取消的制作任务（已完成的阶段不再执行）
+func (s *EpisodePipelineService) ProduceEpisode(episodeID string, req *ProduceEpisodeRequest) (*models.AsyncTask, error) {
+	var episode models.Episode
+	if err := s.db.First(&episode, episodeID).Error; err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool)
+	for _, stage := range req.SkipStages {
+		if !isPipelineStage(stage) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPipelineStage, stage)
+		}
+		skip[stage] = true
+	}
+
+	var running int64
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("type = ? AND resource_id = ? AND status IN ?", JobTypeEpisodeProduction, episodeID,
+			[]string{models.TaskStatusPending, models.TaskStatusProcessing}).
+		Count(&running).Error; err != nil {
+		return nil, err
+	}
+	if running > 0 {
+		return nil, ErrPipelineRunning
+	}
+
+	if req.ResumeTaskID != "" {
+		return s.resumePipeline(episodeID, req.ResumeTaskID, skip)
+	}
+
+	task, err := s.taskService.EnqueueTask(JobTypeEpisodeProduction, episodeID, episodeProductionJob{
+		EpisodeID:  episodeID,
+		Model:      req.Model,
+		Style:      req.Style,
+		SkipStages: req.SkipStages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建任务失败: %w", err)
+	}
+
+	s.log.Infow("Episode production queued", "task_id", task.ID, "episode_id", episodeID, "skip_stages", req.SkipStages)
+	return task, nil
+}
+
+// resumePipeline 将已结束的制作任务重新入队，未完成的阶段按本次的跳过列表重新决定是否执行
+func (s *EpisodePipelineService) resumePipeline(episodeID, taskID string, skip map[string]bool) (*models.AsyncTask, error) {
+	task, err := s.taskService.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Type != JobTypeEpisodeProduction || task.ResourceID != episodeID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	switch task.Status {
+	case models.TaskStatusFailed, models.TaskStatusDeadLetter, models.TaskStatusCancelled:
+	default:
+		return nil, ErrPipelineNotResumable
+	}
+
+	var job episodeProductionJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return nil, err
+	}
+	state := s.loadState(task, &job)
+	for i := range state.Steps {
+		step := &state.Steps[i]
+		if step.Status == PipelineStepCompleted {
+			continue
+		}
+		if skip[step.Stage] {
+			step.Status = PipelineStepSkipped
+		} else {
+			step.Status = PipelineStepPending
+		}
+		step.Error = ""
+	}
+
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	result := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status = ?", task.ID, task.Status).
+		Updates(map[string]interface{}{
+			"status":       models.TaskStatusPending,
+			"attempts":     0,
+			"error":        "",
+			"message":      "任务排队中...",
+			"result":       string(stateJSON),
+			"run_after":    nil,
+			"completed_at": nil,
+			"updated_at":   time.Now(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrPipelineNotResumable
+	}
+
+	publishTaskEvent(s.db, task.ID)
+	s.log.Infow("Episode production resumed", "task_id", task.ID, "episode_id", episodeID)
+	return s.taskService.GetTask(task.ID)
+}
+
+// RegisterJobHandlers 注册制作任务处理器
+func (s *EpisodePipelineService) RegisterJobHandlers(q *JobQueue) {
+	q.Register(JobTypeEpisodeProduction, s.handleEpisodeProductionJob)
+}
+
+// handleEpisodeProductionJob 依次执行各阶段，每个阶段等待其子任务和生成记录全部结束后再进入下一阶段。
+// 阶段状态随时写回任务，服务重启或恢复执行时跳过已完成的阶段，并复用未失败的子任务。
+func (s *EpisodePipelineService) handleEpisodeProductionJob(ctx context.Context, task *models.AsyncTask) error {
+	var job episodeProductionJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	state := s.loadState(task, &job)
+	for i := range state.Steps {
+		step := &state.Steps[i]
+		if step.Status == PipelineStepCompleted || step.Status == PipelineStepSkipped {
+			continue
+		}
+
+		now := time.Now()
+		step.Status = PipelineStepRunning
+		step.Error = ""
+		step.StartedAt = &now
+		step.CompletedAt = nil
+		save := func() { s.saveState(task.ID, state, i) }
+		save()
+
+		if err := s.runStage(ctx, &job, step, save); err != nil {
+			if ctx.Err() != nil {
+				// 取消时一并取消本阶段的子任务；服务停止时保持 running，恢复后继续等待
+				if isTaskCancelled(ctx) {
+					s.cancelChildTasks(step)
+				}
+				return ctx.Err()
+			}
+			step.Status = PipelineStepFailed
+			step.Error = err.Error()
+			save()
+			s.log.Errorw("Episode production stage failed", "task_id", task.ID, "stage", step.Stage, "error", err)
+			return fmt.Errorf("阶段 %s 失败: %w", step.Stage, err)
+		}
+
+		completedAt := time.Now()
+		step.Status = PipelineStepCompleted
+		step.CompletedAt = &completedAt
+		save()
+		s.log.Infow("Episode production stage completed", "task_id", task.ID, "stage", step.Stage)
+	}
+
+	return s.taskService.UpdateTaskResult(task.ID, state)
+}
+
+func (s *EpisodePipelineService) runStage(ctx context.Context, job *episodeProductionJob, step *PipelineStep, save func()) error {
+	episodeID := job.EpisodeID
+
+	switch step.Stage {
+	case PipelineStageCharacters:
+		return s.runTaskStage(ctx, step, save, []string{episodeID}, func(string) (string, error) {
+			epID, _ := strconv.ParseUint(episodeID, 10, 32)
+			return s.characterService.ExtractCharactersFromScript(uint(epID), false)
+		})
+	case PipelineStageProps:
+		return s.runTaskStage(ctx, step, save, []string{episodeID}, func(string) (string, error) {
+			epID, _ := strconv.ParseUint(episodeID, 10, 32)
+			return s.propService.ExtractPropsFromScript(uint(epID), false)
+		})
+	case PipelineStageBackgrounds:
+		return s.runTaskStage(ctx, step, save, []string{episodeID}, func(string) (string, error) {
+			return s.imageService.ExtractBackgroundsForEpisode(episodeID, job.Model, job.Style, false)
+		})
+	case PipelineStageStoryboards:
+		return s.runTaskStage(ctx, step, save, []string{episodeID}, func(string) (string, error) {
+			return s.storyboardService.GenerateStoryboard(episodeID, job.Model)
+		})
+	case PipelineStageFramePrompts:
+		// 恢复执行时也要计算，旧进度没有记录 ResourceIDs 时按顺序补齐
+		var storyboards []models.Storyboard
+		if err := s.db.Select("id").Where("episode_id = ?", episodeID).Order("storyboard_number ASC").Find(&storyboards).Error; err != nil {
+			return err
+		}
+		if len(storyboards) == 0 {
+			return errors.New("章节没有分镜")
+		}
+		var storyboardIDs []string
+		for _, sb := range storyboards {
+			storyboardIDs = append(storyboardIDs, fmt.Sprintf("%d", sb.ID))
+		}
+		return s.runTaskStage(ctx, step, save, storyboardIDs, func(storyboardID string) (string, error) {
+			return s.framePromptService.GenerateFramePrompt(GenerateFramePromptRequest{
+				StoryboardID: storyboardID,
+				FrameType:    FrameTypeFirst,
+			}, job.Model)
+		})
+	case PipelineStageImages:
+		return s.runImageStage(ctx, step, save, episodeID)
+	case PipelineStageVideos:
+		return s.runVideoStage(ctx, step, save, episodeID)
+	case PipelineStageFinalize:
+		return s.runFinalizeStage(ctx, step, save, episodeID)
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidPipelineStage, step.Stage)
+}
+
+// runTaskStage 为每个资源启动一个子任务并等待全部完成。恢复执行时只重新启动失败或已不存在的子任务
+func (s *EpisodePipelineService) runTaskStage(ctx context.Context, step *PipelineStep, save func(), resourceIDs []string, start func(resourceID string) (string, error)) error {
+	if len(step.TaskIDs) == 0 {
+		for _, resourceID := range resourceIDs {
+			taskID, err := start(resourceID)
+			if err != nil {
+				return err
+			}
+			step.TaskIDs = append(step.TaskIDs, taskID)
+			step.ResourceIDs = append(step.ResourceIDs, resourceID)
+		}
+		save()
+	} else {
+		// 旧进度没有记录 ResourceIDs，补齐长度后按下标对应
+		for len(step.ResourceIDs) < len(step.TaskIDs) {
+			step.ResourceIDs = append(step.ResourceIDs, "")
+		}
+		restarted := false
+		for i, taskID := range step.TaskIDs {
+			child, err := s.taskService.GetTask(taskID)
+			if err == nil && !isChildTaskFailed(child.Status) {
+				continue
+			}
+			resourceID := step.ResourceIDs[i]
+			if resourceID == "" && err == nil {
+				resourceID = child.ResourceID
+			}
+			if resourceID == "" && i < len(resourceIDs) {
+				resourceID = resourceIDs[i]
+			}
+			if resourceID == "" {
+				return fmt.Errorf("子任务 %s 无法重新启动：缺少资源 ID", taskID)
+			}
+			newID, err := start(resourceID)
+			if err != nil {
+				return err
+			}
+			step.TaskIDs[i] = newID
+			step.ResourceIDs[i] = resourceID
+			restarted = true
+		}
+		if restarted {
+			save()
+		}
+	}
+
+	return s.waitForTasks(ctx, step.TaskIDs)
+}
+
+// pipelineChildTaskIDs 返回仍存在的流水线父任务记录的全部子任务 ID
+func pipelineChildTaskIDs(db *gorm.DB) ([]string, error) {
+	var results []string
+	if err := db.Model(&models.AsyncTask{}).
+		Where("type = ? AND result <> ''", JobTypeEpisodeProduction).
+		Pluck("result", &results).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, result := range results {
+		var state PipelineState
+		if json.Unmarshal([]byte(result), &state) != nil {
+			continue
+		}
+		for _, step := range state.Steps {
+			ids = append(ids, step.TaskIDs...)
+		}
+	}
+	return ids, nil
+}
+
+// runImageStage 批量生成分镜图片并等待全部结束。恢复执行时只重试失败的图片
+func (s *EpisodePipelineService) runImageStage(ctx context.Context, step *PipelineStep, save func(), episodeID string) error {
+	if len(step.ImageGenIDs) == 0 {
+		imageGens, err := s.imageService.BatchGenerateImagesForEpisode(episodeID)
+		if err != nil {
+			return err
+		}
+		if len(imageGens) == 0 {
+			return errors.New("没有可生成图片的分镜")
+		}
+		for _, imageGen := range imageGens {
+			step.ImageGenIDs = append(step.ImageGenIDs, imageGen.ID)
+		}
+		save()
+	} else {
+		var failed []models.ImageGeneration
+		s.db.Select("id").Where("id IN ? AND status = ?", step.ImageGenIDs, models.ImageStatusFailed).Find(&failed)
+		for _, imageGen := range failed {
+			if _, err := s.imageService.RetryImageGeneration(imageGen.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.waitForRecords(ctx, &models.ImageGeneration{}, step.ImageGenIDs, "图片")
+}
+
+// runVideoStage 为已有图片的分镜批量生成视频并等待全部结束。恢复执行时只重试失败的视频
+func (s *EpisodePipelineService) runVideoStage(ctx context.Context, step *PipelineStep, save func(), episodeID string) error {
+	if len(step.VideoGenIDs) == 0 {
+		videoGens, err := s.videoService.BatchGenerateVideosForEpisode(episodeID)
+		if err != nil {
+			return err
+		}
+		if len(videoGens) == 0 {
+			return errors.New("没有可生成视频的分镜")
+		}
+		for _, videoGen := range videoGens {
+			step.VideoGenIDs = append(step.VideoGenIDs, videoGen.ID)
+		}
+		save()
+	} else {
+		var failed []models.VideoGeneration
+		s.db.Select("id").Where("id IN ? AND status = ?", step.VideoGenIDs, models.VideoStatusFailed).Find(&failed)
+		for _, videoGen := range failed {
+			if _, err := s.videoService.RetryVideoGeneration(videoGen.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.waitForRecords(ctx, &models.VideoGeneration{}, step.VideoGenIDs, "视频")
+}
+
+// runFinalizeStage 按默认分镜顺序合成成片并等待合成结束
+func (s *EpisodePipelineService) runFinalizeStage(ctx context.Context, step *PipelineStep, save func(), episodeID string) error {
+	if step.MergeID != 0 {
+		var merge models.VideoMerge
+		if err := s.db.Select("status").First(&merge, step.MergeID).Error; err != nil || merge.Status == models.VideoMergeStatusFailed {
+			step.MergeID = 0
+		}
+	}
+
+	if step.MergeID == 0 {
+		result, err := s.videoMergeService.FinalizeEpisode(episodeID, nil)
+		if err != nil {
+			return err
+		}
+		mergeID, ok := result["merge_id"].(uint)
+		if !ok {
+			return errors.New("视频合成任务创建失败")
+		}
+		step.MergeID = mergeID
+		save()
+	}
+
+	return s.waitForRecords(ctx, &models.VideoMerge{}, []uint{step.MergeID}, "视频合成")
+}
+
+// waitForTasks 等待子任务全部完成，任一子任务失败即返回错误
+func (s *EpisodePipelineService) waitForTasks(ctx context.Context, taskIDs []string) error {
+	for {
+		var tasks []models.AsyncTask
+		if err := s.db.Select("id", "status", "error", "message").Where("id IN ?", taskIDs).Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) < len(taskIDs) {
+			return errors.New("子任务不存在")
+		}
+
+		completed := 0
+		for _, task := range tasks {
+			if isChildTaskFailed(task.Status) {
+				msg := task.Error
+				if msg == "" {
+					msg = task.Message
+				}
+				return fmt.Errorf("子任务 %s 失败: %s", task.ID, msg)
+			}
+			if task.Status == models.TaskStatusCompleted {
+				completed++
+			}
+		}
+		if completed == len(tasks) {
+			return nil
+		}
+
+		if !sleepContext(ctx, pipelinePollInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// waitForRecords 等待图片/视频/合成记录全部结束，有失败的记录时返回错误
+func (s *EpisodePipelineService) waitForRecords(ctx context.Context, model interface{}, ids []uint, label string) error {
+	for {
+		var records []struct {
+			ID     uint
+			Status string
+		}
+		if err := s.db.Model(model).Select("id", "status").Where("id IN ?", ids).Find(&records).Error; err != nil {
+			return err
+		}
+		if len(records) < len(ids) {
+			return fmt.Errorf("部分%s记录已被删除", label)
+		}
+
+		finished, failed := 0, 0
+		for _, record := range records {
+			switch record.Status {
+			case "completed":
+				finished++
+			case "failed":
+				finished++
+				failed++
+			}
+		}
+		if finished == len(records) {
+			if failed > 0 {
+				return fmt.Errorf("%d/%d个%s生成失败", failed, len(records), label)
+			}
+			return nil
+		}
+
+		if !sleepContext(ctx, pipelinePollInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// cancelChildTasks 取消当前阶段中仍在执行的子任务
+func (s *EpisodePipelineService) cancelChildTasks(step *PipelineStep) {
+	for _, taskID := range step.TaskIDs {
+		if _, err := s.taskService.CancelTask(taskID); err != nil && !errors.Is(err, ErrTaskNotCancellable) {
+			s.log.Warnw("Failed to cancel pipeline child task", "task_id", taskID, "error", err)
+		}
+	}
+}
+
+// loadState 读取任务中保存的流水线进度，首次执行时按任务参数初始化
+func (s *EpisodePipelineService) loadState(task *models.AsyncTask, job *episodeProductionJob) *PipelineState {
+	var state PipelineState
+	if task.Result != "" && json.Unmarshal([]byte(task.Result), &state) == nil && len(state.Steps) > 0 {
+		return &state
+	}
+
+	skip := make(map[string]bool)
+	for _, stage := range job.SkipStages {
+		skip[stage] = true
+	}
+
+	state = PipelineState{EpisodeID: job.EpisodeID}
+	for _, stage := range pipelineStages {
+		status := PipelineStepPending
+		if skip[stage] {
+			status = PipelineStepSkipped
+		}
+		state.Steps = append(state.Steps, PipelineStep{Stage: stage, Status: status})
+	}
+	return &state
+}
+
+// saveState 写回流水线进度，current 为正在执行的阶段下标
+func (s *EpisodePipelineService) saveState(taskID string, state *PipelineState, current int) {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+
+	step := state.Steps[current]
+	message := fmt.Sprintf("[%d/%d] %s: %s", current+1, len(state.Steps), step.Stage, step.Status)
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status = ?", taskID, models.TaskStatusProcessing).
+		Updates(map[string]interface{}{
+			"progress":   current * 100 / len(state.Steps),
+			"message":    message,
+			"result":     string(stateJSON),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		s.log.Warnw("Failed to save pipeline state", "task_id", taskID, "error", err)
+		return
+	}
+	publishTaskEvent(s.db, taskID)
+}
+
+func isPipelineStage(stage string) bool {
+	for _, s := range pipelineStages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+func isChildTaskFailed(status string) bool {
+	return status == models.TaskStatusFailed || status == models.TaskStatusCancelled || status == models.TaskStatusDeadLetter
+}
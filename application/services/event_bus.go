@@ -0,0 +1,228 @@
+package services
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"gorm.io/gorm"
+)
+
+// 进度事件类型
+const (
+	EventTypeTask            = "task"
+	EventTypeImageGeneration = "image_generation"
+	EventTypeVideoGeneration = "video_generation"
+)
+
+// ProgressEvent 推送给前端的任务/生成进度事件
+type ProgressEvent struct {
+	Type      string      `json:"type"`
+	TaskID    string      `json:"task_id,omitempty"`
+	EpisodeID uint        `json:"episode_id,omitempty"`
+	Data      interface{} `json:"data"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+type eventSubscriber struct {
+	ch     chan ProgressEvent
+	filter func(ProgressEvent) bool
+}
+
+// EventBus 进程内的事件发布订阅。订阅者消费过慢时丢弃事件，不阻塞发布方。
+type EventBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]*eventSubscriber
+}
+
+var progressEvents = &EventBus{subs: make(map[int]*eventSubscriber)}
+
+// SubscribeProgressEvents 订阅满足 filter 的进度事件，返回的 unsubscribe 需在连接结束时调用
+func SubscribeProgressEvents(filter func(ProgressEvent) bool) (<-chan ProgressEvent, func()) {
+	return progressEvents.Subscribe(filter)
+}
+
+func (b *EventBus) Subscribe(filter func(ProgressEvent) bool) (<-chan ProgressEvent, func()) {
+	sub := &eventSubscriber{
+		ch:     make(chan ProgressEvent, 64),
+		filter: filter,
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+		})
+	}
+}
+
+func (b *EventBus) Publish(event ProgressEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subs {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *EventBus) hasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0
+}
+
+// publishTaskEvent 推送任务的最新状态；没有订阅者时不查询数据库
+func publishTaskEvent(db *gorm.DB, taskID string) {
+	if !progressEvents.hasSubscribers() {
+		return
+	}
+
+	var task models.AsyncTask
+	if err := db.Where("id = ?", taskID).First(&task).Error; err != nil {
+		return
+	}
+
+	progressEvents.Publish(ProgressEvent{
+		Type:      EventTypeTask,
+		TaskID:    task.ID,
+		EpisodeID: taskEpisodeID(db, &task),
+		Data:      &task,
+	})
+}
+
+// publishImageGenerationEvent 推送图片生成记录的状态变化
+func publishImageGenerationEvent(db *gorm.DB, imageGenID uint) {
+	if !progressEvents.hasSubscribers() {
+		return
+	}
+
+	var imageGen models.ImageGeneration
+	if err := db.First(&imageGen, imageGenID).Error; err != nil {
+		return
+	}
+
+	progressEvents.Publish(ProgressEvent{
+		Type:      EventTypeImageGeneration,
+		EpisodeID: generationEpisodeID(db, imageGen.StoryboardID, imageGen.SceneID),
+		Data:      imageGenerationEventData(&imageGen),
+	})
+}
+
+// publishVideoGenerationEvent 推送视频生成记录的状态变化
+func publishVideoGenerationEvent(db *gorm.DB, videoGenID uint) {
+	if !progressEvents.hasSubscribers() {
+		return
+	}
+
+	var videoGen models.VideoGeneration
+	if err := db.First(&videoGen, videoGenID).Error; err != nil {
+		return
+	}
+
+	progressEvents.Publish(ProgressEvent{
+		Type:      EventTypeVideoGeneration,
+		EpisodeID: generationEpisodeID(db, videoGen.StoryboardID, nil),
+		Data:      videoGenerationEventData(&videoGen),
+	})
+}
+
+// imageGenerationEventData 图片生成记录对外推送的字段
+func imageGenerationEventData(imageGen *models.ImageGeneration) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            imageGen.ID,
+		"drama_id":      imageGen.DramaID,
+		"storyboard_id": imageGen.StoryboardID,
+		"scene_id":      imageGen.SceneID,
+		"character_id":  imageGen.CharacterID,
+		"prop_id":       imageGen.PropID,
+		"image_type":    imageGen.ImageType,
+		"frame_type":    imageGen.FrameType,
+		"status":        imageGen.Status,
+		"image_url":     imageGen.ImageURL,
+		"local_path":    imageGen.LocalPath,
+		"error_msg":     imageGen.ErrorMsg,
+		"qa_status":     imageGen.QAStatus,
+		"qa_score":      imageGen.QAScore,
+	}
+}
+
+// videoGenerationEventData 视频生成记录对外推送的字段
+func videoGenerationEventData(videoGen *models.VideoGeneration) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            videoGen.ID,
+		"drama_id":      videoGen.DramaID,
+		"storyboard_id": videoGen.StoryboardID,
+		"status":        videoGen.Status,
+		"video_url":     videoGen.VideoURL,
+		"local_path":    videoGen.LocalPath,
+		"duration":      videoGen.Duration,
+		"error_msg":     videoGen.ErrorMsg,
+	}
+}
+
+// taskEpisodeID 推断任务所属的章节：章节级任务的 resource_id 即章节ID，其他任务通过关联记录查询
+func taskEpisodeID(db *gorm.DB, task *models.AsyncTask) uint {
+	switch task.Type {
+	case JobTypeStoryboardGenerate, JobTypeEpisodeProduction, "background_extraction", "prop_extraction":
+		id, _ := strconv.ParseUint(task.ResourceID, 10, 32)
+		return uint(id)
+	case JobTypeImageGeneration:
+		var imageGen models.ImageGeneration
+		if err := db.Select("storyboard_id", "scene_id").Where("id = ?", task.ResourceID).First(&imageGen).Error; err == nil {
+			return generationEpisodeID(db, imageGen.StoryboardID, imageGen.SceneID)
+		}
+	case JobTypeVideoGeneration:
+		var videoGen models.VideoGeneration
+		if err := db.Select("storyboard_id").Where("id = ?", task.ResourceID).First(&videoGen).Error; err == nil {
+			return generationEpisodeID(db, videoGen.StoryboardID, nil)
+		}
+	case JobTypeVideoMerge:
+		var merge models.VideoMerge
+		if err := db.Select("episode_id").Where("id = ?", task.ResourceID).First(&merge).Error; err == nil {
+			return merge.EpisodeID
+		}
+	case "frame_prompt_generation":
+		id, err := strconv.ParseUint(task.ResourceID, 10, 32)
+		if err == nil {
+			storyboardID := uint(id)
+			return generationEpisodeID(db, &storyboardID, nil)
+		}
+	}
+	return 0
+}
+
+// generationEpisodeID 通过分镜或场景查询生成记录所属的章节
+func generationEpisodeID(db *gorm.DB, storyboardID, sceneID *uint) uint {
+	if storyboardID != nil {
+		var storyboard models.Storyboard
+		if err := db.Select("episode_id").Where("id = ?", *storyboardID).First(&storyboard).Error; err == nil {
+			return storyboard.EpisodeID
+		}
+	}
+	if sceneID != nil {
+		var scene models.Scene
+		if err := db.Select("episode_id").Where("id = ?", *sceneID).First(&scene).Error; err == nil && scene.EpisodeID != nil {
+			return *scene.EpisodeID
+		}
+	}
+	return 0
+}
@@ -1,38 +1,32 @@
 package services
 
 import (
-	"encoding/json"
-	"regexp"
+	"context"
+	"fmt"
 	"strings"
 )
 
-// parseFramePromptJSON 解析AI返回的JSON格式提示词
-func (s *FramePromptService) parseFramePromptJSON(aiResponse string) *SingleFramePrompt {
-	// 清理可能的markdown代码块标记
-	cleaned := strings.TrimSpace(aiResponse)
-
-	// 移除 ```json 和 ``` 标记
-	re := regexp.MustCompile("(?s)```json\\s*(.+?)\\s*```")
-	if matches := re.FindStringSubmatch(cleaned); len(matches) > 1 {
-		cleaned = strings.TrimSpace(matches[1])
-	} else {
-		// 移除单独的 ``` 标记
-		cleaned = strings.Trim(cleaned, "`")
-		cleaned = strings.TrimSpace(cleaned)
+// generateFramePrompt 调用AI按 SingleFramePrompt 的 Schema 生成帧提示词
+func (s *FramePromptService) generateFramePrompt(ctx context.Context, model string, systemPrompt string, userPrompt string) (*SingleFramePrompt, error) {
+	client, err := s.aiService.GetTextClientForModel(model)
+	if err != nil {
+		return nil, err
 	}
 
-	// 尝试解析JSON
 	var result SingleFramePrompt
-	if err := json.Unmarshal([]byte(cleaned), &result); err != nil {
-		s.log.Warnw("Failed to parse JSON", "error", err, "cleaned_response", cleaned)
-		return nil
+	if _, err := s.aiService.GenerateStructured(ctx, StructuredRequest{
+		Client:       client,
+		Prompt:       userPrompt,
+		SystemPrompt: systemPrompt,
+		SchemaName:   "frame_prompt",
+		PromptI18n:   s.promptI18n,
+	}, &result); err != nil {
+		return nil, err
 	}
 
 	// 验证必需字段
-	if result.Prompt == "" {
-		s.log.Warnw("Parsed JSON missing prompt field", "response", cleaned)
-		return nil
+	if strings.TrimSpace(result.Prompt) == "" {
+		return nil, fmt.Errorf("AI返回的prompt为空")
 	}
-
-	return &result
+	return &result, nil
 }
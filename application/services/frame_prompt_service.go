@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -94,6 +95,9 @@ func (s *FramePromptService) GenerateFramePrompt(req GenerateFramePromptRequest,
 
 // processFramePromptGeneration 异步处理帧提示词生成
 func (s *FramePromptService) processFramePromptGeneration(taskID string, req GenerateFramePromptRequest, model string) {
+	ctx, release := WithTaskContext(context.Background(), taskID)
+	defer release()
+
 	// 更新任务状态为处理中
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在生成帧提示词...")
 
@@ -118,40 +122,41 @@ func (s *FramePromptService) processFramePromptGeneration(taskID string, req Gen
 	response := &FramePromptResponse{
 		FrameType: req.FrameType,
 	}
+	ctx = WithUsageScope(ctx, UsageScope{Operation: "frame_prompt", StoryboardID: &storyboard.ID})
 
 	// 生成提示词
 	switch req.FrameType {
 	case FrameTypeFirst:
-		response.SingleFrame = s.generateFirstFrame(storyboard, scene, model)
+		response.SingleFrame = s.generateFirstFrame(ctx, storyboard, scene, model)
 		// 保存单帧提示词
-		s.saveFramePrompt(req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
+		s.saveFramePrompt(ctx, req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
 	case FrameTypeKey:
-		response.SingleFrame = s.generateKeyFrame(storyboard, scene, model)
-		s.saveFramePrompt(req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
+		response.SingleFrame = s.generateKeyFrame(ctx, storyboard, scene, model)
+		s.saveFramePrompt(ctx, req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
 	case FrameTypeLast:
-		response.SingleFrame = s.generateLastFrame(storyboard, scene, model)
-		s.saveFramePrompt(req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
+		response.SingleFrame = s.generateLastFrame(ctx, storyboard, scene, model)
+		s.saveFramePrompt(ctx, req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
 	case FrameTypePanel:
 		count := req.PanelCount
 		if count == 0 {
 			count = 3
 		}
-		response.MultiFrame = s.generatePanelFrames(storyboard, scene, count, model)
+		response.MultiFrame = s.generatePanelFrames(ctx, storyboard, scene, count, model)
 		// 保存多帧提示词（合并为一条记录）
 		var prompts []string
 		for _, frame := range response.MultiFrame.Frames {
 			prompts = append(prompts, frame.Prompt)
 		}
 		combinedPrompt := strings.Join(prompts, "\n---\n")
-		s.saveFramePrompt(req.StoryboardID, string(req.FrameType), combinedPrompt, "分镜板组合提示词", response.MultiFrame.Layout)
+		s.saveFramePrompt(ctx, req.StoryboardID, string(req.FrameType), combinedPrompt, "分镜板组合提示词", response.MultiFrame.Layout)
 	case FrameTypeAction:
-		response.MultiFrame = s.generateActionSequence(storyboard, scene, model)
+		response.MultiFrame = s.generateActionSequence(ctx, storyboard, scene, model)
 		var prompts []string
 		for _, frame := range response.MultiFrame.Frames {
 			prompts = append(prompts, frame.Prompt)
 		}
 		combinedPrompt := strings.Join(prompts, "\n---\n")
-		s.saveFramePrompt(req.StoryboardID, string(req.FrameType), combinedPrompt, "动作序列组合提示词", response.MultiFrame.Layout)
+		s.saveFramePrompt(ctx, req.StoryboardID, string(req.FrameType), combinedPrompt, "动作序列组合提示词", response.MultiFrame.Layout)
 	default:
 		s.log.Errorw("Unsupported frame type during frame prompt generation", "frame_type", req.FrameType, "task_id", taskID)
 		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "不支持的帧类型")
@@ -168,8 +173,12 @@ func (s *FramePromptService) processFramePromptGeneration(taskID string, req Gen
 	s.log.Infow("Frame prompt generation completed", "task_id", taskID, "storyboard_id", req.StoryboardID, "frame_type", req.FrameType)
 }
 
-// saveFramePrompt 保存帧提示词到数据库
-func (s *FramePromptService) saveFramePrompt(storyboardID, frameType, prompt, description, layout string) {
+// saveFramePrompt 保存帧提示词到数据库，任务已取消时不再写入
+func (s *FramePromptService) saveFramePrompt(ctx context.Context, storyboardID, frameType, prompt, description, layout string) {
+	if ctx.Err() != nil {
+		return
+	}
+
 	framePrompt := models.FramePrompt{
 		StoryboardID: uint(mustParseUint(storyboardID)),
 		FrameType:    frameType,
@@ -200,7 +209,7 @@ func mustParseUint(s string) uint64 {
 }
 
 // generateFirstFrame 生成首帧提示词
-func (s *FramePromptService) generateFirstFrame(sb models.Storyboard, scene *models.Scene, model string) *SingleFramePrompt {
+func (s *FramePromptService) generateFirstFrame(ctx context.Context, sb models.Storyboard, scene *models.Scene, model string) *SingleFramePrompt {
 	// 构建上下文信息
 	contextInfo := s.buildStoryboardContext(sb, scene)
 
@@ -208,35 +217,11 @@ func (s *FramePromptService) generateFirstFrame(sb models.Storyboard, scene *mod
 	systemPrompt := s.promptI18n.GetFirstFramePrompt()
 	userPrompt := s.promptI18n.FormatUserPrompt("frame_info", contextInfo)
 
-	// 调用AI生成（如果指定了模型则使用指定的模型）
-	var aiResponse string
-	var err error
-	if model != "" {
-		client, getErr := s.aiService.GetAIClientForModel("text", model)
-		if getErr != nil {
-			s.log.Warnw("Failed to get client for specified model, using default", "model", model, "error", getErr)
-			aiResponse, err = s.aiService.GenerateText(userPrompt, systemPrompt)
-		} else {
-			aiResponse, err = client.GenerateText(userPrompt, systemPrompt)
-		}
-	} else {
-		aiResponse, err = s.aiService.GenerateText(userPrompt, systemPrompt)
-	}
+	// 调用AI生成（如果指定了模型则使用指定的模型），按 Schema 要求结构化输出
+	result, err := s.generateFramePrompt(ctx, model, systemPrompt, userPrompt)
 	if err != nil {
-		s.log.Warnw("AI generation failed, using fallback", "error", err)
-		// 降级方案：使用简单拼接
-		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "first frame, static shot")
-		return &SingleFramePrompt{
-			Prompt:      fallbackPrompt,
-			Description: "镜头开始的静态画面，展示初始状态",
-		}
-	}
-
-	// 解析AI返回的JSON
-	result := s.parseFramePromptJSON(aiResponse)
-	if result == nil {
-		// JSON解析失败，使用降级方案
-		s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "response", aiResponse)
+		// 生成失败或输出不符合格式，使用降级方案
+		s.log.Warnw("AI generation failed, using fallback", "storyboard_id", sb.ID, "error", err)
 		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "first frame, static shot")
 		return &SingleFramePrompt{
 			Prompt:      fallbackPrompt,
@@ -248,7 +233,7 @@ func (s *FramePromptService) generateFirstFrame(sb models.Storyboard, scene *mod
 }
 
 // generateKeyFrame 生成关键帧提示词
-func (s *FramePromptService) generateKeyFrame(sb models.Storyboard, scene *models.Scene, model string) *SingleFramePrompt {
+func (s *FramePromptService) generateKeyFrame(ctx context.Context, sb models.Storyboard, scene *models.Scene, model string) *SingleFramePrompt {
 	// 构建上下文信息
 	contextInfo := s.buildStoryboardContext(sb, scene)
 
@@ -256,34 +241,11 @@ func (s *FramePromptService) generateKeyFrame(sb models.Storyboard, scene *model
 	systemPrompt := s.promptI18n.GetKeyFramePrompt()
 	userPrompt := s.promptI18n.FormatUserPrompt("key_frame_info", contextInfo)
 
-	// 调用AI生成（如果指定了模型则使用指定的模型）
-	var aiResponse string
-	var err error
-	if model != "" {
-		client, getErr := s.aiService.GetAIClientForModel("text", model)
-		if getErr != nil {
-			s.log.Warnw("Failed to get client for specified model, using default", "model", model, "error", getErr)
-			aiResponse, err = s.aiService.GenerateText(userPrompt, systemPrompt)
-		} else {
-			aiResponse, err = client.GenerateText(userPrompt, systemPrompt)
-		}
-	} else {
-		aiResponse, err = s.aiService.GenerateText(userPrompt, systemPrompt)
-	}
+	// 调用AI生成（如果指定了模型则使用指定的模型），按 Schema 要求结构化输出
+	result, err := s.generateFramePrompt(ctx, model, systemPrompt, userPrompt)
 	if err != nil {
-		s.log.Warnw("AI generation failed, using fallback", "error", err)
-		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "key frame, dynamic action")
-		return &SingleFramePrompt{
-			Prompt:      fallbackPrompt,
-			Description: "动作高潮瞬间，展示关键动作",
-		}
-	}
-
-	// 解析AI返回的JSON
-	result := s.parseFramePromptJSON(aiResponse)
-	if result == nil {
-		// JSON解析失败，使用降级方案
-		s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "response", aiResponse)
+		// 生成失败或输出不符合格式，使用降级方案
+		s.log.Warnw("AI generation failed, using fallback", "storyboard_id", sb.ID, "error", err)
 		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "key frame, dynamic action")
 		return &SingleFramePrompt{
 			Prompt:      fallbackPrompt,
@@ -295,7 +257,7 @@ func (s *FramePromptService) generateKeyFrame(sb models.Storyboard, scene *model
 }
 
 // generateLastFrame 生成尾帧提示词
-func (s *FramePromptService) generateLastFrame(sb models.Storyboard, scene *models.Scene, model string) *SingleFramePrompt {
+func (s *FramePromptService) generateLastFrame(ctx context.Context, sb models.Storyboard, scene *models.Scene, model string) *SingleFramePrompt {
 	// 构建上下文信息
 	contextInfo := s.buildStoryboardContext(sb, scene)
 
@@ -303,34 +265,11 @@ func (s *FramePromptService) generateLastFrame(sb models.Storyboard, scene *mode
 	systemPrompt := s.promptI18n.GetLastFramePrompt()
 	userPrompt := s.promptI18n.FormatUserPrompt("last_frame_info", contextInfo)
 
-	// 调用AI生成（如果指定了模型则使用指定的模型）
-	var aiResponse string
-	var err error
-	if model != "" {
-		client, getErr := s.aiService.GetAIClientForModel("text", model)
-		if getErr != nil {
-			s.log.Warnw("Failed to get client for specified model, using default", "model", model, "error", getErr)
-			aiResponse, err = s.aiService.GenerateText(userPrompt, systemPrompt)
-		} else {
-			aiResponse, err = client.GenerateText(userPrompt, systemPrompt)
-		}
-	} else {
-		aiResponse, err = s.aiService.GenerateText(userPrompt, systemPrompt)
-	}
+	// 调用AI生成（如果指定了模型则使用指定的模型），按 Schema 要求结构化输出
+	result, err := s.generateFramePrompt(ctx, model, systemPrompt, userPrompt)
 	if err != nil {
-		s.log.Warnw("AI generation failed, using fallback", "error", err)
-		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "last frame, final state")
-		return &SingleFramePrompt{
-			Prompt:      fallbackPrompt,
-			Description: "镜头结束画面，展示最终状态和结果",
-		}
-	}
-
-	// 解析AI返回的JSON
-	result := s.parseFramePromptJSON(aiResponse)
-	if result == nil {
-		// JSON解析失败，使用降级方案
-		s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "response", aiResponse)
+		// 生成失败或输出不符合格式，使用降级方案
+		s.log.Warnw("AI generation failed, using fallback", "storyboard_id", sb.ID, "error", err)
 		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "last frame, final state")
 		return &SingleFramePrompt{
 			Prompt:      fallbackPrompt,
@@ -342,27 +281,27 @@ func (s *FramePromptService) generateLastFrame(sb models.Storyboard, scene *mode
 }
 
 // generatePanelFrames 生成分镜板（多格组合）
-func (s *FramePromptService) generatePanelFrames(sb models.Storyboard, scene *models.Scene, count int, model string) *MultiFramePrompt {
+func (s *FramePromptService) generatePanelFrames(ctx context.Context, sb models.Storyboard, scene *models.Scene, count int, model string) *MultiFramePrompt {
 	layout := fmt.Sprintf("horizontal_%d", count)
 
 	frames := make([]SingleFramePrompt, count)
 
 	// 固定生成：首帧 -> 关键帧 -> 尾帧
 	if count == 3 {
-		frames[0] = *s.generateFirstFrame(sb, scene, model)
+		frames[0] = *s.generateFirstFrame(ctx, sb, scene, model)
 		frames[0].Description = "第1格：初始状态"
 
-		frames[1] = *s.generateKeyFrame(sb, scene, model)
+		frames[1] = *s.generateKeyFrame(ctx, sb, scene, model)
 		frames[1].Description = "第2格：动作高潮"
 
-		frames[2] = *s.generateLastFrame(sb, scene, model)
+		frames[2] = *s.generateLastFrame(ctx, sb, scene, model)
 		frames[2].Description = "第3格：最终状态"
 	} else if count == 4 {
 		// 4格：首帧 -> 中间帧1 -> 中间帧2 -> 尾帧
-		frames[0] = *s.generateFirstFrame(sb, scene, model)
-		frames[1] = *s.generateKeyFrame(sb, scene, model)
-		frames[2] = *s.generateKeyFrame(sb, scene, model)
-		frames[3] = *s.generateLastFrame(sb, scene, model)
+		frames[0] = *s.generateFirstFrame(ctx, sb, scene, model)
+		frames[1] = *s.generateKeyFrame(ctx, sb, scene, model)
+		frames[2] = *s.generateKeyFrame(ctx, sb, scene, model)
+		frames[3] = *s.generateLastFrame(ctx, sb, scene, model)
 	}
 
 	return &MultiFramePrompt{
@@ -372,16 +311,16 @@ func (s *FramePromptService) generatePanelFrames(sb models.Storyboard, scene *mo
 }
 
 // generateActionSequence 生成动作序列（5-8格）
-func (s *FramePromptService) generateActionSequence(sb models.Storyboard, scene *models.Scene, model string) *MultiFramePrompt {
+func (s *FramePromptService) generateActionSequence(ctx context.Context, sb models.Storyboard, scene *models.Scene, model string) *MultiFramePrompt {
 	// 将动作分解为5个步骤
 	frames := make([]SingleFramePrompt, 5)
 
 	// 简化实现：均匀分布从首帧到尾帧
-	frames[0] = *s.generateFirstFrame(sb, scene, model)
-	frames[1] = *s.generateKeyFrame(sb, scene, model)
-	frames[2] = *s.generateKeyFrame(sb, scene, model)
-	frames[3] = *s.generateKeyFrame(sb, scene, model)
-	frames[4] = *s.generateLastFrame(sb, scene, model)
+	frames[0] = *s.generateFirstFrame(ctx, sb, scene, model)
+	frames[1] = *s.generateKeyFrame(ctx, sb, scene, model)
+	frames[2] = *s.generateKeyFrame(ctx, sb, scene, model)
+	frames[3] = *s.generateKeyFrame(ctx, sb, scene, model)
+	frames[4] = *s.generateLastFrame(ctx, sb, scene, model)
 
 	return &MultiFramePrompt{
 		Layout: "horizontal_5",
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -87,15 +89,28 @@ type GenerateImageRequest struct {
 	Seed            *int64   `json:"seed"`
 	Width           *int     `json:"width"`
 	Height          *int     `json:"height"`
-	ImageLocalPath  *string  `json:"image_local_path"` // 本地图片路径，用于图生图
-	ReferenceImages []string `json:"reference_images"` // 参考图片URL列表
+	ImageLocalPath  *string  `json:"image_local_path"`                           // 本地图片路径，用于图生图
+	ReferenceImages []string `json:"reference_images"`                           // 参考图片URL列表
+	Candidates      int      `json:"candidates" binding:"omitempty,min=1,max=4"` // 候选数量，一次生成多张供挑选
 }
 
 func (s *ImageGenerationService) GenerateImage(request *GenerateImageRequest) (*models.ImageGeneration, error) {
+	imageGens, err := s.GenerateImageTakes(request)
+	if err != nil {
+		return nil, err
+	}
+	return imageGens[0], nil
+}
+
+// GenerateImageTakes 按 candidates 创建多条生成记录，每条作为分镜的一个候选
+func (s *ImageGenerationService) GenerateImageTakes(request *GenerateImageRequest) ([]*models.ImageGeneration, error) {
 	var drama models.Drama
 	if err := s.db.Where("id = ? ", request.DramaID).First(&drama).Error; err != nil {
 		return nil, fmt.Errorf("drama not found")
 	}
+	if _, err := NewUsageService(s.db, s.log).CheckBudget(&drama.ID); err != nil {
+		return nil, err
+	}
 	// 注意：SceneID可能指向Scene或Storyboard表，调用方已经做过权限验证，这里不再重复验证
 
 	provider := request.Provider
@@ -121,49 +136,283 @@ func (s *ImageGenerationService) GenerateImage(request *GenerateImageRequest) (*
 		imageType = string(models.ImageTypeStoryboard)
 	}
 
+	var imageGens []*models.ImageGeneration
+	for i := 0; i < takeCandidates(request.Candidates); i++ {
+		imageGen := &models.ImageGeneration{
+			StoryboardID:    request.StoryboardID,
+			DramaID:         uint(dramaIDParsed),
+			SceneID:         request.SceneID,
+			CharacterID:     request.CharacterID,
+			PropID:          request.PropID,
+			ImageType:       imageType,
+			FrameType:       request.FrameType,
+			Provider:        provider,
+			Prompt:          request.Prompt,
+			NegPrompt:       request.NegativePrompt,
+			Model:           request.Model,
+			Size:            request.Size,
+			ReferenceImages: referenceImagesJSON,
+			Quality:         request.Quality,
+			Style:           request.Style,
+			Steps:           request.Steps,
+			CfgScale:        request.CfgScale,
+			Seed:            candidateSeed(request.Seed, i),
+			Width:           request.Width,
+			Height:          request.Height,
+			LocalPath:       request.ImageLocalPath,
+			Status:          models.ImageStatusPending,
+		}
+
+		if err := s.db.Create(imageGen).Error; err != nil {
+			return nil, fmt.Errorf("failed to create record: %w", err)
+		}
+
+		if _, err := s.taskService.EnqueueTask(JobTypeImageGeneration, fmt.Sprintf("%d", imageGen.ID), imageGenerationJob{ImageGenID: imageGen.ID}); err != nil {
+			s.updateImageGenError(imageGen.ID, err.Error())
+			return nil, err
+		}
+		imageGens = append(imageGens, imageGen)
+	}
+
+	return imageGens, nil
+}
+
+// ErrGenerationNotFailed 仅失败的生成记录允许重试
+var ErrGenerationNotFailed = errors.New("只有失败的记录可以重试")
+
+// RetryImageGeneration 使用记录中保存的参数重新生成失败的图片
+func (s *ImageGenerationService) RetryImageGeneration(imageGenID uint) (*models.ImageGeneration, error) {
+	var imageGen models.ImageGeneration
+	if err := s.db.First(&imageGen, imageGenID).Error; err != nil {
+		return nil, err
+	}
+	if imageGen.Status != models.ImageStatusFailed {
+		return nil, ErrGenerationNotFailed
+	}
+
+	if err := s.db.Model(&imageGen).Updates(map[string]interface{}{
+		"status":       models.ImageStatusPending,
+		"task_id":      nil,
+		"error_msg":    nil,
+		"completed_at": nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to reset record: %w", err)
+	}
+	publishImageGenerationEvent(s.db, imageGen.ID)
+
+	if _, err := s.taskService.EnqueueTask(JobTypeImageGeneration, fmt.Sprintf("%d", imageGen.ID), imageGenerationJob{ImageGenID: imageGen.ID}); err != nil {
+		s.updateImageGenError(imageGen.ID, err.Error())
+		return nil, err
+	}
+
+	s.log.Infow("Image generation retry queued", "id", imageGen.ID)
+	return s.GetImageGeneration(imageGen.ID)
+}
+
+// ErrImageNotEditable 只有已完成的图片可以编辑
+var ErrImageNotEditable = errors.New("只有已完成的图片可以编辑")
+
+type EditImageRequest struct {
+	Prompt string `json:"prompt" binding:"required,min=1,max=2000"` // 修改要求
+	Mask   string `json:"mask"`                                     // 可选，黑白蒙版（白色重绘）的 URL 或 data URI
+	Model  string `json:"model"`                                    // 为空时沿用原图的模型
+}
+
+// EditImage 在已完成的图片基础上按提示词修改，创建关联到原图的新记录，原记录保持不变
+func (s *ImageGenerationService) EditImage(parentID uint, req *EditImageRequest) (*models.ImageGeneration, error) {
+	var parent models.ImageGeneration
+	if err := s.db.First(&parent, parentID).Error; err != nil {
+		return nil, err
+	}
+	if parent.Status != models.ImageStatusCompleted {
+		return nil, ErrImageNotEditable
+	}
+	if _, err := NewUsageService(s.db, s.log).CheckBudget(&parent.DramaID); err != nil {
+		return nil, err
+	}
+
+	model := parent.Model
+	if req.Model != "" {
+		model = req.Model
+	}
 	imageGen := &models.ImageGeneration{
-		StoryboardID:    request.StoryboardID,
-		DramaID:         uint(dramaIDParsed),
-		SceneID:         request.SceneID,
-		CharacterID:     request.CharacterID,
-		PropID:          request.PropID,
-		ImageType:       imageType,
-		FrameType:       request.FrameType,
-		Provider:        provider,
-		Prompt:          request.Prompt,
-		NegPrompt:       request.NegativePrompt,
-		Model:           request.Model,
-		Size:            request.Size,
-		ReferenceImages: referenceImagesJSON,
-		Quality:         request.Quality,
-		Style:           request.Style,
-		Steps:           request.Steps,
-		CfgScale:        request.CfgScale,
-		Seed:            request.Seed,
-		Width:           request.Width,
-		Height:          request.Height,
-		LocalPath:       request.ImageLocalPath,
-		Status:          models.ImageStatusPending,
+		StoryboardID: parent.StoryboardID,
+		DramaID:      parent.DramaID,
+		SceneID:      parent.SceneID,
+		CharacterID:  parent.CharacterID,
+		PropID:       parent.PropID,
+		ImageType:    parent.ImageType,
+		FrameType:    parent.FrameType,
+		Provider:     parent.Provider,
+		Prompt:       req.Prompt,
+		NegPrompt:    parent.NegPrompt,
+		Model:        model,
+		Size:         parent.Size,
+		Quality:      parent.Quality,
+		Style:        parent.Style,
+		Steps:        parent.Steps,
+		CfgScale:     parent.CfgScale,
+		Width:        parent.Width,
+		Height:       parent.Height,
+		Status:       models.ImageStatusPending,
+		ParentID:     &parent.ID,
+	}
+	if req.Mask != "" {
+		imageGen.MaskImage = &req.Mask
 	}
 
 	if err := s.db.Create(imageGen).Error; err != nil {
 		return nil, fmt.Errorf("failed to create record: %w", err)
 	}
+	if _, err := s.taskService.EnqueueTask(JobTypeImageGeneration, fmt.Sprintf("%d", imageGen.ID), imageGenerationJob{ImageGenID: imageGen.ID}); err != nil {
+		s.updateImageGenError(imageGen.ID, err.Error())
+		return nil, err
+	}
 
-	go s.ProcessImageGeneration(imageGen.ID)
-
+	s.log.Infow("Image edit queued", "id", imageGen.ID, "parent_id", parent.ID, "has_mask", req.Mask != "")
 	return imageGen, nil
 }
 
-func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
+// ImageLineage 图片的编辑链：从最初的图片到当前图片，以及直接基于当前图片的编辑
+type ImageLineage struct {
+	Ancestors []models.ImageGeneration `json:"ancestors"`
+	Current   models.ImageGeneration   `json:"current"`
+	Edits     []models.ImageGeneration `json:"edits"`
+}
+
+// imageLineageMaxDepth 向上查找编辑链的最大层数
+const imageLineageMaxDepth = 50
+
+// GetImageLineage 获取图片的编辑链
+func (s *ImageGenerationService) GetImageLineage(imageGenID uint) (*ImageLineage, error) {
+	lineage := &ImageLineage{Ancestors: []models.ImageGeneration{}, Edits: []models.ImageGeneration{}}
+	if err := s.db.First(&lineage.Current, imageGenID).Error; err != nil {
+		return nil, err
+	}
+
+	parentID := lineage.Current.ParentID
+	for depth := 0; parentID != nil && depth < imageLineageMaxDepth; depth++ {
+		var parent models.ImageGeneration
+		if err := s.db.First(&parent, *parentID).Error; err != nil {
+			break
+		}
+		lineage.Ancestors = append([]models.ImageGeneration{parent}, lineage.Ancestors...)
+		parentID = parent.ParentID
+	}
+
+	if err := s.db.Where("parent_id = ?", imageGenID).Order("created_at ASC").Find(&lineage.Edits).Error; err != nil {
+		return nil, err
+	}
+	return lineage, nil
+}
+
+// imageGenerationJob 图片生成任务参数
+type imageGenerationJob struct {
+	ImageGenID uint `json:"image_gen_id"`
+}
+
+// RegisterJobHandlers 注册图片生成任务处理器，并为队列之外遗留的进行中任务补建队列任务
+func (s *ImageGenerationService) RegisterJobHandlers(q *JobQueue) {
+	q.Register(JobTypeImageGeneration, s.handleImageGenerationJob)
+	q.Register(JobTypeImageQA, s.handleImageQAJob)
+	s.RecoverPendingTasks()
+}
+
+// RecoverPendingTasks 为已提交到厂商（有 task_id）但没有对应队列任务的进行中图片补建任务，由队列恢复轮询
+func (s *ImageGenerationService) RecoverPendingTasks() {
+	var pendingImages []models.ImageGeneration
+	if err := s.db.Where("status = ? AND task_id IS NOT NULL AND task_id != ''", models.ImageStatusProcessing).Find(&pendingImages).Error; err != nil {
+		s.log.Errorw("Failed to load pending image tasks", "error", err)
+		return
+	}
+
+	recovered := 0
+	for _, imageGen := range pendingImages {
+		resourceID := fmt.Sprintf("%d", imageGen.ID)
+		var count int64
+		s.db.Model(&models.AsyncTask{}).
+			Where("type = ? AND resource_id = ? AND status IN ?", JobTypeImageGeneration, resourceID,
+				[]string{models.TaskStatusPending, models.TaskStatusProcessing}).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		if _, err := s.taskService.EnqueueTask(JobTypeImageGeneration, resourceID, imageGenerationJob{ImageGenID: imageGen.ID}); err != nil {
+			s.log.Errorw("Failed to enqueue pending image task", "error", err, "id", imageGen.ID)
+			continue
+		}
+		recovered++
+	}
+
+	s.log.Infow("Recovering pending image generation tasks", "count", recovered)
+}
+
+// handleImageGenerationJob 执行图片生成任务。任务可能在服务重启后被重新执行：
+// 已结束的记录直接跳过，已提交到厂商的异步任务只恢复轮询，避免重复提交。
+func (s *ImageGenerationService) handleImageGenerationJob(ctx context.Context, task *models.AsyncTask) error {
+	var job imageGenerationJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	var imageGen models.ImageGeneration
+	if err := s.db.First(&imageGen, job.ImageGenID).Error; err != nil {
+		return fmt.Errorf("image generation not found: %w", err)
+	}
+
+	switch {
+	case imageGen.Status == models.ImageStatusCompleted || imageGen.Status == models.ImageStatusFailed:
+		s.log.Infow("Image generation already finished, skipping job", "id", imageGen.ID, "status", imageGen.Status)
+	case imageGen.Status == models.ImageStatusProcessing && imageGen.TaskID != nil && *imageGen.TaskID != "":
+		s.log.Infow("Resuming image generation polling", "id", imageGen.ID, "task_id", *imageGen.TaskID)
+		client, err := s.imageClientForRecord(&imageGen)
+		if err != nil {
+			s.updateImageGenError(imageGen.ID, err.Error())
+			break
+		}
+		s.pollTaskStatus(ctx, imageGen.ID, client, *imageGen.TaskID)
+	default:
+		if err := s.ProcessImageGeneration(ctx, imageGen.ID); err != nil {
+			if canRetry(task, err) {
+				s.log.Warnw("Image generation hit transient error, waiting for retry", "id", imageGen.ID, "attempt", task.Attempts, "error", err)
+				s.db.Model(&models.ImageGeneration{}).Where("id = ?", imageGen.ID).Update("status", models.ImageStatusPending)
+				publishImageGenerationEvent(s.db, imageGen.ID)
+			} else {
+				s.updateImageGenError(imageGen.ID, err.Error())
+			}
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err := s.db.First(&imageGen, job.ImageGenID).Error; err != nil {
+		return err
+	}
+	if imageGen.Status == models.ImageStatusFailed {
+		if imageGen.ErrorMsg != nil {
+			return errors.New(*imageGen.ErrorMsg)
+		}
+		return errors.New("image generation failed")
+	}
+	return nil
+}
+
+// ProcessImageGeneration 提交图片生成并等待结果。提交时遇到临时错误（超时、429、5xx）
+// 不标记失败而是返回错误，由调用方决定重试或放弃；其他错误直接写入记录。
+func (s *ImageGenerationService) ProcessImageGeneration(ctx context.Context, imageGenID uint) error {
 	var imageGen models.ImageGeneration
 	imageRatio := s.config.Style.DefaultImageRatio
 	if err := s.db.First(&imageGen, imageGenID).Error; err != nil {
 		s.log.Errorw("Failed to load image generation", "error", err, "id", imageGenID)
-		return
+		return nil
 	}
 
 	s.db.Model(&imageGen).Update("status", models.ImageStatusProcessing)
+	publishImageGenerationEvent(s.db, imageGenID)
 
 	// 如果关联了background，同步更新background为generating状态
 	if imageGen.StoryboardID != nil {
@@ -174,13 +423,6 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 		}
 	}
 
-	client, err := s.getImageClientWithModel(imageGen.Provider, imageGen.Model)
-	if err != nil {
-		s.log.Errorw("Failed to get image client", "error", err, "provider", imageGen.Provider, "model", imageGen.Model)
-		s.updateImageGenError(imageGenID, err.Error())
-		return
-	}
-
 	// 解析参考图片
 	var referenceImagePaths []string
 	if len(imageGen.ReferenceImages) > 0 {
@@ -256,37 +498,103 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 		opts = append(opts, image.WithReferenceImages(referenceImages))
 	}
 
+	// 编辑图片时以父记录的图片为原图，提示词即修改要求，不再追加画面比例
+	var sourceImage string
+	if imageGen.ParentID != nil {
+		var parent models.ImageGeneration
+		if err := s.db.First(&parent, *imageGen.ParentID).Error; err != nil {
+			s.updateImageGenError(imageGenID, fmt.Sprintf("source image not found: %v", err))
+			return nil
+		}
+		source, err := s.imageDataURI(&parent)
+		if err != nil {
+			s.updateImageGenError(imageGenID, fmt.Sprintf("failed to load source image: %v", err))
+			return nil
+		}
+		sourceImage = source
+		if imageGen.MaskImage != nil && *imageGen.MaskImage != "" {
+			opts = append(opts, image.WithMask(*imageGen.MaskImage))
+		}
+	}
+
 	prompt := imageGen.Prompt
-	prompt += ", imageRatio:" + imageRatio
-	result, err := client.GenerateImage(prompt, opts...)
+	if sourceImage == "" {
+		prompt += ", imageRatio:" + imageRatio
+	}
+
+	// 按优先级在图片配置间故障切换，记住实际提交任务的客户端用于轮询
+	var client image.ImageClient
+	var result *image.ImageResult
+	// 图片客户端不上报用量，提交成功按一张图片计
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "image", DramaID: &imageGen.DramaID, StoryboardID: imageGen.StoryboardID})
+	servedBy, err := s.aiService.RunWithFailover(usageCtx, "image", imageGen.Model, func(ctx context.Context, config *models.AIServiceConfig) error {
+		model := configModel(config, imageGen.Model)
+		var genErr error
+		if client, genErr = newImageClient(config, imageGen.Provider, model); genErr != nil {
+			return genErr
+		}
+		// 按模型能力调整不支持的参数
+		callOpts, notes := adaptImageOptions(config, model, opts)
+		if len(notes) > 0 {
+			s.log.Warnw("Image options adapted to model capabilities", "id", imageGenID, "config_id", config.ID, "model", model, "changes", notes)
+		}
+		if sourceImage != "" {
+			result, genErr = client.EditImage(ctx, prompt, sourceImage, callOpts...)
+		} else {
+			result, genErr = client.GenerateImage(ctx, prompt, callOpts...)
+		}
+		if genErr == nil {
+			ai.ReportUsage(ctx, ai.Usage{Images: 1})
+		}
+		return genErr
+	})
 	if err != nil {
+		if ctx.Err() != nil {
+			// 服务停止时保留记录状态以便恢复；任务取消时记录已由 CancelTask 标记
+			s.log.Infow("Image generation interrupted", "id", imageGenID, "error", err)
+			return nil
+		}
 		s.log.Errorw("Image generation API call failed", "error", err, "id", imageGenID, "prompt", imageGen.Prompt)
+		if utils.IsTransientError(err) {
+			return err
+		}
 		s.updateImageGenError(imageGenID, err.Error())
-		return
+		if errors.Is(err, ErrBudgetExceeded) {
+			// 预算用尽时任务同样失败，并带上 BUDGET_EXCEEDED 错误码
+			return err
+		}
+		return nil
 	}
 
 	s.log.Infow("Image generation API call completed", "id", imageGenID, "completed", result.Completed, "has_url", result.ImageURL != "")
 
 	if !result.Completed {
 		s.db.Model(&imageGen).Updates(map[string]interface{}{
-			"status":  models.ImageStatusProcessing,
-			"task_id": result.TaskID,
+			"status":       models.ImageStatusProcessing,
+			"task_id":      result.TaskID,
+			"ai_config_id": servedBy.ID,
 		})
-		go s.pollTaskStatus(imageGenID, client, result.TaskID)
-		return
+		publishImageGenerationEvent(s.db, imageGenID)
+		s.pollTaskStatus(ctx, imageGenID, client, result.TaskID)
+		return nil
 	}
 
 	s.completeImageGeneration(imageGenID, result)
+	return nil
 }
 
-func (s *ImageGenerationService) pollTaskStatus(imageGenID uint, client image.ImageClient, taskID string) {
+// pollTaskStatus 轮询异步图片任务，ctx 取消时直接返回，保留 processing 状态以便重启后恢复
+func (s *ImageGenerationService) pollTaskStatus(ctx context.Context, imageGenID uint, client image.ImageClient, taskID string) {
 	maxAttempts := 60
 	pollInterval := 5 * time.Second
 
 	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(pollInterval)
+		if !sleepContext(ctx, pollInterval) {
+			s.log.Infow("Image polling interrupted", "id", imageGenID, "task_id", taskID)
+			return
+		}
 
-		result, err := client.GetTaskStatus(taskID)
+		result, err := client.GetTaskStatus(ctx, taskID)
 		if err != nil {
 			s.log.Errorw("Failed to get task status", "error", err, "task_id", taskID)
 			continue
@@ -354,6 +662,25 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 		return
 	}
 
+	// 按比例裁剪、缩放并生成缩略图，处理后的交付图片替换原图同步到各处，失败时保留原图
+	imageURL := result.ImageURL
+	if processed, err := s.postProcessImage(&imageGen, result.ImageURL, localPath); err != nil {
+		s.log.Warnw("Failed to post-process image, keeping original", "error", err, "id", imageGenID)
+	} else if processed != nil {
+		imageURL = processed.URL
+		localPath = &processed.LocalPath
+		updates["image_url"] = imageURL
+		updates["local_path"] = localPath
+		updates["width"] = processed.Width
+		updates["height"] = processed.Height
+		updates["thumbnail_url"] = processed.ThumbnailURL
+		s.log.Infow("Image post-processed",
+			"id", imageGenID,
+			"local_path", processed.LocalPath,
+			"width", processed.Width,
+			"height", processed.Height)
+	}
+
 	// 使用 Updates 更新基本字段
 	if err := s.db.Model(&models.ImageGeneration{}).Where("id = ?", imageGenID).Updates(updates).Error; err != nil {
 		s.log.Errorw("Failed to update image generation", "error", err, "id", imageGenID)
@@ -366,15 +693,17 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 	}
 
 	s.log.Infow("Image generation completed", "id", imageGenID)
+	publishImageGenerationEvent(s.db, imageGenID)
+	dispatchImageGenerationWebhook(s.db, s.log, imageGenID)
 
-	// 如果关联了storyboard，同步更新storyboard的composed_image
+	// 如果关联了storyboard且成为选定的图片，同步更新storyboard的composed_image
 	if imageGen.StoryboardID != nil {
-		if err := s.db.Model(&models.Storyboard{}).Where("id = ?", *imageGen.StoryboardID).Update("composed_image", result.ImageURL).Error; err != nil {
+		if adopted, err := adoptImageTake(s.db, &imageGen, imageURL); err != nil {
 			s.log.Errorw("Failed to update storyboard composed_image", "error", err, "storyboard_id", *imageGen.StoryboardID)
-		} else {
+		} else if adopted {
 			s.log.Infow("Storyboard updated with composed image",
 				"storyboard_id", *imageGen.StoryboardID,
-				"composed_image", truncateImageURL(result.ImageURL))
+				"composed_image", truncateImageURL(imageURL))
 		}
 	}
 
@@ -382,7 +711,7 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 	if imageGen.SceneID != nil && imageGen.ImageType == string(models.ImageTypeScene) {
 		sceneUpdates := map[string]interface{}{
 			"status":    "generated",
-			"image_url": result.ImageURL,
+			"image_url": imageURL,
 		}
 		if localPath != nil {
 			sceneUpdates["local_path"] = localPath
@@ -392,7 +721,7 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 		} else {
 			s.log.Infow("Scene updated with generated image",
 				"scene_id", *imageGen.SceneID,
-				"image_url", truncateImageURL(result.ImageURL),
+				"image_url", truncateImageURL(imageURL),
 				"local_path", localPath)
 		}
 	}
@@ -400,7 +729,7 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 	// 如果关联了角色，同步更新角色的image_url和local_path
 	if imageGen.CharacterID != nil {
 		characterUpdates := map[string]interface{}{
-			"image_url": result.ImageURL,
+			"image_url": imageURL,
 		}
 		if localPath != nil {
 			characterUpdates["local_path"] = localPath
@@ -410,7 +739,7 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 		} else {
 			s.log.Infow("Character updated with generated image",
 				"character_id", *imageGen.CharacterID,
-				"image_url", truncateImageURL(result.ImageURL),
+				"image_url", truncateImageURL(imageURL),
 				"local_path", localPath)
 		}
 	}
@@ -418,7 +747,7 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 	// 如果关联了道具，同步更新道具的image_url和local_path
 	if imageGen.PropID != nil {
 		propUpdates := map[string]interface{}{
-			"image_url": result.ImageURL,
+			"image_url": imageURL,
 		}
 		if localPath != nil {
 			propUpdates["local_path"] = localPath
@@ -428,10 +757,14 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 		} else {
 			s.log.Infow("Prop updated with generated image",
 				"prop_id", *imageGen.PropID,
-				"image_url", truncateImageURL(result.ImageURL),
+				"image_url", truncateImageURL(imageURL),
 				"local_path", localPath)
 		}
 	}
+
+	imageGen.Status = models.ImageStatusCompleted
+	imageGen.ImageURL = &imageURL
+	s.enqueueAutoImageQA(&imageGen)
 }
 
 func (s *ImageGenerationService) updateImageGenError(imageGenID uint, errorMsg string) {
@@ -448,6 +781,8 @@ func (s *ImageGenerationService) updateImageGenError(imageGenID uint, errorMsg s
 		"error_msg": errorMsg,
 	})
 	s.log.Errorw("Image generation failed", "id", imageGenID, "error", errorMsg)
+	publishImageGenerationEvent(s.db, imageGenID)
+	dispatchImageGenerationWebhook(s.db, s.log, imageGenID)
 
 	// 如果关联了scene，同步更新scene为失败状态
 	if imageGen.SceneID != nil {
@@ -468,34 +803,7 @@ func (s *ImageGenerationService) getImageClient(provider string) (image.ImageCli
 		model = config.Model[0]
 	}
 
-	// 使用配置中的 provider，如果没有则使用传入的 provider
-	actualProvider := config.Provider
-	if actualProvider == "" {
-		actualProvider = provider
-	}
-
-	// 根据 provider 自动设置默认端点
-	var endpoint string
-	var queryEndpoint string
-
-	switch actualProvider {
-	case "openai", "dalle":
-		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
-	case "chatfire":
-		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
-	case "volcengine", "volces", "doubao":
-		endpoint = "/images/generations"
-		queryEndpoint = ""
-		return image.NewVolcEngineImageClient(config.BaseURL, config.APIKey, model, endpoint, queryEndpoint), nil
-	case "gemini", "google":
-		endpoint = "/v1beta/models/{model}:generateContent"
-		return image.NewGeminiImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
-	default:
-		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
-	}
+	return newImageClient(config, provider, model)
 }
 
 // getImageClientWithModel 根据模型名称获取图片客户端
@@ -526,7 +834,28 @@ func (s *ImageGenerationService) getImageClientWithModel(provider string, modelN
 		model = config.Model[0]
 	}
 
-	// 使用配置中的 provider，如果没有则使用传入的 provider
+	return newImageClient(config, provider, model)
+}
+
+// imageClientForRecord 获取轮询异步任务用的客户端：优先使用实际提交任务的配置
+func (s *ImageGenerationService) imageClientForRecord(imageGen *models.ImageGeneration) (image.ImageClient, error) {
+	if imageGen.AIConfigID != nil {
+		config, err := s.aiService.GetConfig(*imageGen.AIConfigID)
+		if err == nil {
+			return newImageClient(config, imageGen.Provider, configModel(config, imageGen.Model))
+		}
+		s.log.Warnw("AI config of image generation not found, using model config", "id", imageGen.ID, "config_id", *imageGen.AIConfigID, "error", err)
+	}
+	return s.getImageClientWithModel(imageGen.Provider, imageGen.Model)
+}
+
+// newImageClient 根据配置创建图片客户端，配置中没有 provider 时使用传入的 provider
+func newImageClient(config *models.AIServiceConfig, provider string, model string) (image.ImageClient, error) {
+	apiKey, err := configAPIKey(config)
+	if err != nil {
+		return nil, err
+	}
+
 	actualProvider := config.Provider
 	if actualProvider == "" {
 		actualProvider = provider
@@ -536,24 +865,33 @@ func (s *ImageGenerationService) getImageClientWithModel(provider string, modelN
 	var endpoint string
 	var queryEndpoint string
 
+	var client image.ImageClient
 	switch actualProvider {
 	case "openai", "dalle":
 		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		client = image.NewOpenAIImageClient(config.BaseURL, apiKey, model, endpoint)
 	case "chatfire":
 		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		client = image.NewOpenAIImageClient(config.BaseURL, apiKey, model, endpoint)
 	case "volcengine", "volces", "doubao":
 		endpoint = "/images/generations"
 		queryEndpoint = ""
-		return image.NewVolcEngineImageClient(config.BaseURL, config.APIKey, model, endpoint, queryEndpoint), nil
+		client = image.NewVolcEngineImageClient(config.BaseURL, apiKey, model, endpoint, queryEndpoint)
 	case "gemini", "google":
 		endpoint = "/v1beta/models/{model}:generateContent"
-		return image.NewGeminiImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		client = image.NewGeminiImageClient(config.BaseURL, apiKey, model, endpoint)
+	case "sdwebui", "automatic1111", "a1111", "stable_diffusion", "sd":
+		client = image.NewSDWebUIImageClient(config.BaseURL, apiKey, model, image.ParseLocalDiffusionSettings(config.Settings))
+	case "comfyui":
+		client = image.NewComfyUIImageClient(config.BaseURL, apiKey, model, image.ParseLocalDiffusionSettings(config.Settings))
+	case MockProvider:
+		outputDir, baseURL := mockStorage()
+		client = image.NewMockImageClient(model, outputDir, baseURL, utils.ParseMockSettings(config.Settings))
 	default:
 		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		client = image.NewOpenAIImageClient(config.BaseURL, apiKey, model, endpoint)
 	}
+	return withImageRateLimit(config, client), nil
 }
 
 func (s *ImageGenerationService) GetImageGeneration(imageGenID uint) (*models.ImageGeneration, error) {
@@ -609,6 +947,9 @@ func (s *ImageGenerationService) DeleteImageGeneration(imageGenID uint) error {
 	if result.RowsAffected == 0 {
 		return fmt.Errorf("image generation not found")
 	}
+	// 删除的是选定的图片时取消选定，下一张完成的图片会重新成为选定
+	s.db.Model(&models.Storyboard{}).Where("selected_image_id = ?", imageGenID).
+		Updates(map[string]interface{}{"selected_image_id": nil, "image_take_pinned": false})
 	return nil
 }
 
@@ -717,6 +1058,10 @@ func (s *ImageGenerationService) BatchGenerateImagesForEpisode(episodeID string)
 	if err := s.db.Preload("Drama").Where("id = ?", episodeID).First(&ep).Error; err != nil {
 		return nil, fmt.Errorf("episode not found")
 	}
+	// 预算已用尽时整批拒绝，避免逐条创建失败记录
+	if _, err := NewUsageService(s.db, s.log).CheckBudget(&ep.DramaID); err != nil {
+		return nil, err
+	}
 	// 从数据库读取已保存的场景
 	var scenes []models.Storyboard
 	if err := s.db.Where("episode_id = ?", episodeID).Find(&scenes).Error; err != nil {
@@ -783,8 +1128,8 @@ func (s *ImageGenerationService) GetScencesForEpisode(episodeID string) ([]*mode
 	return scenes, nil
 }
 
-// ExtractBackgroundsForEpisode 从剧本内容中提取场景并保存到项目级别数据库
-func (s *ImageGenerationService) ExtractBackgroundsForEpisode(episodeID string, model string, style string) (string, error) {
+// ExtractBackgroundsForEpisode 从剧本内容中提取场景并保存到项目级别数据库，bypassCache 为 true 时不使用缓存的AI响应
+func (s *ImageGenerationService) ExtractBackgroundsForEpisode(episodeID string, model string, style string, bypassCache bool) (string, error) {
 	var episode models.Episode
 	if err := s.db.Preload("Storyboards").First(&episode, episodeID).Error; err != nil {
 		return "", fmt.Errorf("episode not found")
@@ -803,14 +1148,20 @@ func (s *ImageGenerationService) ExtractBackgroundsForEpisode(episodeID string,
 	}
 
 	// 异步处理场景提取
-	go s.processBackgroundExtraction(task.ID, episodeID, model, style)
+	go s.processBackgroundExtraction(task.ID, episodeID, model, style, bypassCache)
 
 	s.log.Infow("Background extraction task created", "task_id", task.ID, "episode_id", episodeID)
 	return task.ID, nil
 }
 
 // processBackgroundExtraction 异步处理场景提取
-func (s *ImageGenerationService) processBackgroundExtraction(taskID string, episodeID string, model string, style string) {
+func (s *ImageGenerationService) processBackgroundExtraction(taskID string, episodeID string, model string, style string, bypassCache bool) {
+	ctx, release := WithTaskContext(context.Background(), taskID)
+	defer release()
+	if bypassCache {
+		ctx = WithoutAICache(ctx)
+	}
+
 	// 更新任务状态为处理中
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在提取场景信息...")
 
@@ -831,7 +1182,8 @@ func (s *ImageGenerationService) processBackgroundExtraction(taskID string, epis
 	dramaID := episode.DramaID
 
 	// 使用AI从剧本内容中提取场景
-	backgroundsInfo, err := s.extractBackgroundsFromScript(*episode.ScriptContent, dramaID, model, style)
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "background_extraction", DramaID: &dramaID, EpisodeID: &episode.ID})
+	backgroundsInfo, err := s.extractBackgroundsFromScript(usageCtx, *episode.ScriptContent, dramaID, model, style)
 	if err != nil {
 		s.log.Errorw("Failed to extract backgrounds from script", "error", err, "task_id", taskID)
 		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "AI提取场景失败: "+err.Error())
@@ -899,7 +1251,7 @@ func (s *ImageGenerationService) processBackgroundExtraction(taskID string, epis
 }
 
 // extractBackgroundsFromScript 从剧本内容中使用AI提取场景信息
-func (s *ImageGenerationService) extractBackgroundsFromScript(scriptContent string, dramaID uint, model string, style string) ([]BackgroundInfo, error) {
+func (s *ImageGenerationService) extractBackgroundsFromScript(ctx context.Context, scriptContent string, dramaID uint, model string, style string) ([]BackgroundInfo, error) {
 	if scriptContent == "" {
 		return []BackgroundInfo{}, nil
 	}
@@ -1018,34 +1370,40 @@ Please strictly follow the JSON format and ensure all fields use English.`
 		"prompt_length", len(prompt),
 		"full_prompt", prompt)
 
-	response, err := client.GenerateText(prompt, "", ai.WithTemperature(0.7))
-	if err != nil {
-		s.log.Errorw("Failed to extract backgrounds with AI", "error", err)
-		return nil, fmt.Errorf("AI提取场景失败: %w", err)
+	var result struct {
+		Backgrounds []struct {
+			Location   string `json:"location"`
+			Time       string `json:"time"`
+			Atmosphere string `json:"atmosphere"`
+			Prompt     string `json:"prompt"`
+		} `json:"backgrounds"`
 	}
+	response, err := s.aiService.GenerateStructured(ctx, StructuredRequest{
+		Client:     client,
+		Prompt:     prompt,
+		SchemaName: "backgrounds",
+		Options:    []func(*ai.ChatCompletionRequest){ai.WithTemperature(0.7)},
+		PromptI18n: s.promptI18n,
+	}, &result)
 
 	// 打印AI返回的原始响应
 	s.log.Infow("=== AI Response for Background Extraction (extractBackgroundsFromScript) ===",
 		"response_length", len(response),
 		"raw_response", response)
 
-	// 解析AI返回的JSON
-	var backgrounds []BackgroundInfo
+	if err != nil {
+		s.log.Errorw("Failed to extract backgrounds with AI", "error", err)
+		return nil, fmt.Errorf("AI提取场景失败: %w", err)
+	}
 
-	// 先尝试解析为数组格式
-	if err := utils.SafeParseAIJSON(response, &backgrounds); err == nil {
-		s.log.Infow("Parsed backgrounds as array format", "count", len(backgrounds))
-	} else {
-		// 尝试解析为对象格式
-		var result struct {
-			Backgrounds []BackgroundInfo `json:"backgrounds"`
-		}
-		if err := utils.SafeParseAIJSON(response, &result); err != nil {
-			s.log.Errorw("Failed to parse AI response in both formats", "error", err, "response", response[:min(len(response), 500)])
-			return nil, fmt.Errorf("解析AI响应失败: %w", err)
-		}
-		backgrounds = result.Backgrounds
-		s.log.Infow("Parsed backgrounds as object format", "count", len(backgrounds))
+	backgrounds := make([]BackgroundInfo, 0, len(result.Backgrounds))
+	for _, bg := range result.Backgrounds {
+		backgrounds = append(backgrounds, BackgroundInfo{
+			Location:   bg.Location,
+			Time:       bg.Time,
+			Atmosphere: bg.Atmosphere,
+			Prompt:     bg.Prompt,
+		})
 	}
 
 	s.log.Infow("Extracted backgrounds from script",
@@ -1056,7 +1414,7 @@ Please strictly follow the JSON format and ensure all fields use English.`
 }
 
 // extractBackgroundsWithAI 使用AI智能分析场景并提取唯一背景
-func (s *ImageGenerationService) extractBackgroundsWithAI(storyboards []models.Storyboard, style string) ([]BackgroundInfo, error) {
+func (s *ImageGenerationService) extractBackgroundsWithAI(ctx context.Context, storyboards []models.Storyboard, style string) ([]BackgroundInfo, error) {
 	if len(storyboards) == 0 {
 		return []BackgroundInfo{}, nil
 	}
@@ -1178,29 +1536,28 @@ Please strictly follow the JSON format and ensure:
 		"prompt_length", len(prompt),
 		"full_prompt", prompt)
 
-	// 调用AI服务
-	text, err := s.aiService.GenerateText(prompt, "")
-	if err != nil {
-		return nil, fmt.Errorf("AI analysis failed: %w", err)
-	}
-
-	// 打印AI返回的原始响应
-	s.log.Infow("=== AI Response for Background Extraction ===",
-		"response_length", len(text),
-		"raw_response", text)
-
-	// 解析AI返回的JSON
+	// 调用AI服务，按 Schema 要求结构化输出
 	var result struct {
 		Scenes []struct {
 			Location         string `json:"location"`
 			Time             string `json:"time"`
 			Prompt           string `json:"prompt"`
-			StoryboardNumber []int  `json:"storyboard_number"`
+			StoryboardNumber []int  `json:"scene_numbers"`
 		} `json:"backgrounds"`
 	}
+	text, err := s.aiService.GenerateStructured(ctx, StructuredRequest{
+		Prompt:     prompt,
+		SchemaName: "backgrounds",
+		PromptI18n: s.promptI18n,
+	}, &result)
 
-	if err := utils.SafeParseAIJSON(text, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %w", err)
+	// 打印AI返回的原始响应
+	s.log.Infow("=== AI Response for Background Extraction ===",
+		"response_length", len(text),
+		"raw_response", text)
+
+	if err != nil {
+		return nil, fmt.Errorf("AI analysis failed: %w", err)
 	}
 
 	// 构建场景编号到场景ID的映射
@@ -1278,6 +1635,22 @@ func (s *ImageGenerationService) extractUniqueBackgrounds(scenes []models.Storyb
 	return backgrounds
 }
 
+// imageDataURI 以 data URI 形式读取生成的图片，优先使用本地文件
+func (s *ImageGenerationService) imageDataURI(imageGen *models.ImageGeneration) (string, error) {
+	if imageGen.LocalPath != nil && *imageGen.LocalPath != "" {
+		if data, err := s.loadImageAsBase64(*imageGen.LocalPath); err == nil {
+			return data, nil
+		}
+	}
+	if imageGen.ImageURL == nil || *imageGen.ImageURL == "" {
+		return "", errors.New("image has no url or local file")
+	}
+	if strings.HasPrefix(*imageGen.ImageURL, "data:") {
+		return *imageGen.ImageURL, nil
+	}
+	return utils.ImageToBase64(*imageGen.ImageURL)
+}
+
 // loadImageAsBase64 读取本地图片文件并转换为 base64 格式的 data URI
 func (s *ImageGenerationService) loadImageAsBase64(localPath string) (string, error) {
 	// 构建完整的文件路径
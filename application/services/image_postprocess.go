@@ -0,0 +1,140 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// defaultThumbnailSize 未配置缩略图尺寸时使用的长边像素
+const defaultThumbnailSize = 320
+
+// processedImage 后处理得到的交付图片和缩略图
+type processedImage struct {
+	URL          string
+	LocalPath    string
+	ThumbnailURL string
+	Width        int
+	Height       int
+}
+
+// imageRatioFor 按图片类型取配置的比例，未配置时使用分镜图片比例
+func (s *ImageGenerationService) imageRatioFor(imageType string) string {
+	style := s.config.Style
+	ratio := ""
+	switch models.ImageType(imageType) {
+	case models.ImageTypeScene:
+		ratio = style.DefaultSceneRatio
+	case models.ImageTypeCharacter:
+		ratio = style.DefaultRoleRatio
+	case models.ImageTypeProp:
+		ratio = style.DefaultPropRatio
+	}
+	if ratio == "" {
+		ratio = style.DefaultImageRatio
+	}
+	return ratio
+}
+
+// postProcessImage 把下载到本地的图片（或 data URI）裁剪/补边到配置的比例、缩放到交付尺寸并生成缩略图。
+// 交付图片和缩略图都保存成功后才删除下载的原图。未开启或没有本地存储时返回 nil
+func (s *ImageGenerationService) postProcessImage(imageGen *models.ImageGeneration, imageURL string, localPath *string) (*processedImage, error) {
+	cfg := s.config.Style.ImageProcessing
+	if !cfg.Enabled || s.localStorage == nil {
+		return nil, nil
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case localPath != nil:
+		data, err = os.ReadFile(s.localStorage.GetAbsolutePath(*localPath))
+	case strings.HasPrefix(imageURL, "data:"):
+		_, encoded, _ := strings.Cut(imageURL, ",")
+		data, err = base64.StdEncoding.DecodeString(encoded)
+	default:
+		return nil, fmt.Errorf("image has no local copy")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read image: %w", err)
+	}
+
+	src, format, err := utils.DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 比例无法解析时保持原图比例
+	bounds := src.Bounds()
+	ratioW, ratioH := bounds.Dx(), bounds.Dy()
+	if w, h, ok := utils.ParseAspectRatio(s.imageRatioFor(imageGen.ImageType)); ok {
+		ratioW, ratioH = w, h
+		if cfg.Fit == "pad" {
+			src = utils.PadToRatio(src, ratioW, ratioH, parsePadColor(cfg.PadColor))
+		} else {
+			src = utils.CropToRatio(src, ratioW, ratioH)
+		}
+	}
+
+	// 交付尺寸固定，原图较小时同样放大
+	delivery := src
+	if cfg.DeliverySize > 0 {
+		width, height := utils.RatioSize(ratioW, ratioH, cfg.DeliverySize)
+		delivery = utils.ResizeImage(src, width, height)
+	}
+	deliveryData, ext, err := utils.EncodeImage(delivery, format)
+	if err != nil {
+		return nil, err
+	}
+	thumbnailSize := cfg.ThumbnailSize
+	if thumbnailSize <= 0 {
+		thumbnailSize = defaultThumbnailSize
+	}
+	thumbWidth, thumbHeight := utils.RatioSize(ratioW, ratioH, thumbnailSize)
+	thumbData, thumbExt, err := utils.EncodeImage(utils.ResizeImage(src, thumbWidth, thumbHeight), "jpeg")
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.localStorage.SaveWithPath(deliveryData, ext, "images")
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, err := s.localStorage.SaveWithPath(thumbData, thumbExt, "thumbnails")
+	if err != nil {
+		// 调用方会保留原图，清理已写入的交付图片
+		os.Remove(saved.AbsolutePath)
+		return nil, err
+	}
+
+	// 全部输出保存成功后才删除下载的原图
+	if localPath != nil {
+		if err := os.Remove(s.localStorage.GetAbsolutePath(*localPath)); err != nil && !os.IsNotExist(err) {
+			s.log.Warnw("Failed to remove original image", "error", err, "local_path", *localPath)
+		}
+	}
+
+	return &processedImage{
+		URL:          saved.URL,
+		LocalPath:    saved.RelativePath,
+		ThumbnailURL: thumbnail.URL,
+		Width:        delivery.Bounds().Dx(),
+		Height:       delivery.Bounds().Dy(),
+	}, nil
+}
+
+// parsePadColor 解析 #RRGGBB，格式错误时使用黑色
+func parsePadColor(value string) color.Color {
+	hex := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.Black
+	}
+	return color.NRGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}
+}
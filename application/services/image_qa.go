@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+)
+
+// JobTypeImageQA 分镜图片生成后的画面质检
+const JobTypeImageQA = "image_qa"
+
+// defaultImageQAMinScore 未配置合格分数时使用的默认值
+const defaultImageQAMinScore = 60
+
+// ErrImageQANotApplicable 只有已完成且关联了分镜的图片可以质检
+var ErrImageQANotApplicable = errors.New("只有已完成的分镜图片可以质检")
+
+// imageQAJob 画面质检任务参数
+type imageQAJob struct {
+	ImageGenID uint `json:"image_gen_id"`
+}
+
+// imageQAVerdict 视觉模型给出的质检结论，原样保存到 qa_verdict
+type imageQAVerdict struct {
+	Score             int      `json:"score"`
+	CharactersPresent []string `json:"characters_present"`
+	MissingCharacters []string `json:"missing_characters"`
+	TimeOfDayMatch    bool     `json:"time_of_day_match"`
+	LocationMatch     bool     `json:"location_match"`
+	ActionMatch       bool     `json:"action_match"`
+	Issues            []string `json:"issues"`
+	Summary           string   `json:"summary"`
+}
+
+func (s *ImageGenerationService) imageQAMinScore() int {
+	if s.config.AI.ImageQA.MinScore > 0 {
+		return s.config.AI.ImageQA.MinScore
+	}
+	return defaultImageQAMinScore
+}
+
+func imageQAApplicable(imageGen *models.ImageGeneration) bool {
+	return imageGen.Status == models.ImageStatusCompleted &&
+		imageGen.ImageType == string(models.ImageTypeStoryboard) &&
+		imageGen.StoryboardID != nil
+}
+
+// enqueueAutoImageQA 开启质检时，分镜图片生成完成后加入质检任务
+func (s *ImageGenerationService) enqueueAutoImageQA(imageGen *models.ImageGeneration) {
+	if !s.config.AI.ImageQA.Enabled || !imageQAApplicable(imageGen) {
+		return
+	}
+	if _, err := s.taskService.EnqueueTask(JobTypeImageQA, fmt.Sprintf("%d", imageGen.ID), imageQAJob{ImageGenID: imageGen.ID}); err != nil {
+		s.log.Errorw("Failed to enqueue image QA", "error", err, "id", imageGen.ID)
+	}
+}
+
+// CheckImageQuality 手动对分镜图片重新质检，不受 ai.image_qa.enabled 限制
+func (s *ImageGenerationService) CheckImageQuality(imageGenID uint) (*models.ImageGeneration, error) {
+	var imageGen models.ImageGeneration
+	if err := s.db.First(&imageGen, imageGenID).Error; err != nil {
+		return nil, err
+	}
+	if !imageQAApplicable(&imageGen) {
+		return nil, ErrImageQANotApplicable
+	}
+
+	if _, err := s.taskService.EnqueueTask(JobTypeImageQA, fmt.Sprintf("%d", imageGen.ID), imageQAJob{ImageGenID: imageGen.ID}); err != nil {
+		return nil, err
+	}
+	return &imageGen, nil
+}
+
+// handleImageQAJob 执行画面质检。临时错误返回给队列重试，其他错误记录到 qa_error
+func (s *ImageGenerationService) handleImageQAJob(ctx context.Context, task *models.AsyncTask) error {
+	var job imageQAJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	var imageGen models.ImageGeneration
+	if err := s.db.First(&imageGen, job.ImageGenID).Error; err != nil {
+		return fmt.Errorf("image generation not found: %w", err)
+	}
+	if !imageQAApplicable(&imageGen) {
+		s.log.Infow("Image is not a completed storyboard image, skipping QA", "id", imageGen.ID)
+		return nil
+	}
+
+	verdict, err := s.runImageQA(ctx, &imageGen)
+	if err != nil {
+		if canRetry(task, err) {
+			s.log.Warnw("Image QA hit transient error, waiting for retry", "id", imageGen.ID, "attempt", task.Attempts, "error", err)
+			return err
+		}
+		s.db.Model(&models.ImageGeneration{}).Where("id = ?", imageGen.ID).Updates(map[string]interface{}{
+			"qa_status":     models.ImageQAStatusError,
+			"qa_error":      err.Error(),
+			"qa_checked_at": time.Now(),
+		})
+		publishImageGenerationEvent(s.db, imageGen.ID)
+		return err
+	}
+
+	status := models.ImageQAStatusPassed
+	if verdict.Score < s.imageQAMinScore() {
+		status = models.ImageQAStatusFailed
+	}
+	verdictJSON, _ := json.Marshal(verdict)
+	if err := s.db.Model(&models.ImageGeneration{}).Where("id = ?", imageGen.ID).Updates(map[string]interface{}{
+		"qa_status":     status,
+		"qa_score":      verdict.Score,
+		"qa_verdict":    verdictJSON,
+		"qa_error":      nil,
+		"qa_checked_at": time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to save QA result: %w", err)
+	}
+	s.log.Infow("Image QA completed", "id", imageGen.ID, "score", verdict.Score, "status", status)
+	publishImageGenerationEvent(s.db, imageGen.ID)
+
+	// 自动重新生成的图片不再重新生成，避免循环；手动重新质检时已重新生成过的也不再生成
+	if status == models.ImageQAStatusFailed && s.config.AI.ImageQA.AutoRegenerate && imageGen.RegeneratedFromID == nil {
+		var regenerated int64
+		if err := s.db.Model(&models.ImageGeneration{}).Where("regenerated_from_id = ?", imageGen.ID).Count(&regenerated).Error; err != nil {
+			s.log.Errorw("Failed to check QA regeneration", "error", err, "id", imageGen.ID)
+		} else if regenerated == 0 {
+			s.regenerateAfterQA(&imageGen)
+		}
+	}
+	return nil
+}
+
+// runImageQA 把图片和分镜的动作、地点、时间、角色发给视觉模型，返回结构化的结论
+func (s *ImageGenerationService) runImageQA(ctx context.Context, imageGen *models.ImageGeneration) (*imageQAVerdict, error) {
+	var storyboard models.Storyboard
+	if err := s.db.Preload("Characters").First(&storyboard, *imageGen.StoryboardID).Error; err != nil {
+		return nil, fmt.Errorf("storyboard not found: %w", err)
+	}
+
+	imageData, err := s.imageDataURI(imageGen)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.aiService.GetTextClientForModel(s.config.AI.ImageQA.Model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI client: %w", err)
+	}
+
+	names := make([]string, 0, len(storyboard.Characters))
+	for _, character := range storyboard.Characters {
+		names = append(names, character.Name)
+	}
+	characters := s.promptI18n.FormatUserPrompt("image_qa_no_characters")
+	if len(names) > 0 {
+		characters = strings.Join(names, ", ")
+	}
+	prompt := s.promptI18n.FormatUserPrompt("image_qa_request",
+		getString(storyboard.Action), getString(storyboard.Location), getString(storyboard.Time), characters)
+
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "image_qa", DramaID: &imageGen.DramaID, EpisodeID: &storyboard.EpisodeID, StoryboardID: &storyboard.ID})
+	var verdict imageQAVerdict
+	if _, err := s.aiService.GenerateStructured(usageCtx, StructuredRequest{
+		Client:       client,
+		Prompt:       prompt,
+		SystemPrompt: s.promptI18n.GetImageQASystemPrompt(),
+		SchemaName:   "image_qa",
+		Options:      []func(*ai.ChatCompletionRequest){ai.WithTemperature(0.2)},
+		Images:       []string{imageData},
+		PromptI18n:   s.promptI18n,
+	}, &verdict); err != nil {
+		return nil, err
+	}
+
+	if verdict.Score < 0 {
+		verdict.Score = 0
+	} else if verdict.Score > 100 {
+		verdict.Score = 100
+	}
+	return &verdict, nil
+}
+
+// regenerateAfterQA 用原记录的参数重新生成一次，不沿用固定的 seed，否则会得到同样的图片。
+// 编辑生成的图片同时沿用原图和蒙版，重新执行同一次编辑
+func (s *ImageGenerationService) regenerateAfterQA(imageGen *models.ImageGeneration) {
+	if _, err := NewUsageService(s.db, s.log).CheckBudget(&imageGen.DramaID); err != nil {
+		s.log.Warnw("Skipping QA regeneration", "id", imageGen.ID, "error", err)
+		return
+	}
+
+	regenerated := &models.ImageGeneration{
+		StoryboardID:      imageGen.StoryboardID,
+		DramaID:           imageGen.DramaID,
+		SceneID:           imageGen.SceneID,
+		CharacterID:       imageGen.CharacterID,
+		PropID:            imageGen.PropID,
+		ImageType:         imageGen.ImageType,
+		FrameType:         imageGen.FrameType,
+		Provider:          imageGen.Provider,
+		Prompt:            imageGen.Prompt,
+		NegPrompt:         imageGen.NegPrompt,
+		Model:             imageGen.Model,
+		Size:              imageGen.Size,
+		Quality:           imageGen.Quality,
+		Style:             imageGen.Style,
+		Steps:             imageGen.Steps,
+		CfgScale:          imageGen.CfgScale,
+		Width:             imageGen.Width,
+		Height:            imageGen.Height,
+		ReferenceImages:   imageGen.ReferenceImages,
+		Status:            models.ImageStatusPending,
+		RegeneratedFromID: &imageGen.ID,
+		ParentID:          imageGen.ParentID,
+		MaskImage:         imageGen.MaskImage,
+	}
+	if err := s.db.Create(regenerated).Error; err != nil {
+		s.log.Errorw("Failed to create QA regeneration", "error", err, "id", imageGen.ID)
+		return
+	}
+
+	if _, err := s.taskService.EnqueueTask(JobTypeImageGeneration, fmt.Sprintf("%d", regenerated.ID), imageGenerationJob{ImageGenID: regenerated.ID}); err != nil {
+		s.updateImageGenError(regenerated.ID, err.Error())
+		return
+	}
+	s.log.Infow("Image failed QA, regeneration queued", "id", imageGen.ID, "regenerated_id", regenerated.ID)
+	publishImageGenerationEvent(s.db, regenerated.ID)
+}
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 由任务队列调度的任务类型
+const (
+	JobTypeImageGeneration     = "image_generation"
+	JobTypeVideoGeneration     = "video_generation"
+	JobTypeStoryboardGenerate  = "storyboard_generation"
+	JobTypePropImageGeneration = "prop_image_generation"
+	JobTypeVideoMerge          = "video_merge"
+	JobTypeEpisodeProduction   = "episode_production"
+	JobTypeWebhookDelivery     = "webhook_delivery"
+)
+
+// JobHandler 任务处理函数。ctx 在队列停止或任务被取消时结束，处理函数应尽快返回；
+// 因队列停止而未完成的任务会在下次启动时重新执行，因此处理函数需要保证可重入。
+type JobHandler func(ctx context.Context, task *models.AsyncTask) error
+
+type jobWorker struct {
+	handler JobHandler
+	slots   chan struct{}
+}
+
+// JobQueue 基于 async_tasks 表的持久化任务队列
+// 每种任务类型有独立的并发上限；执行中的任务通过租约+心跳标记归属，
+// 进程崩溃或重启后，租约过期的任务会被重新放回队列继续执行。
+// 处理函数返回临时错误（超时、429、5xx）时按指数退避重新排队，次数耗尽后进入 dead_letter。
+type JobQueue struct {
+	db       *gorm.DB
+	log      *logger.Logger
+	workerID string
+
+	pollInterval       time.Duration
+	leaseDuration      time.Duration
+	defaultConcurrency int
+	concurrency        map[string]int
+	maxAttempts        int
+	retryBaseDelay     time.Duration
+	retryMaxDelay      time.Duration
+
+	mu      sync.RWMutex
+	workers map[string]*jobWorker
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+}
+
+func NewJobQueue(db *gorm.DB, cfg *config.Config, log *logger.Logger) *JobQueue {
+	jobsCfg := cfg.Jobs
+
+	pollInterval := time.Duration(jobsCfg.PollInterval) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	leaseDuration := time.Duration(jobsCfg.LeaseSeconds) * time.Second
+	if leaseDuration <= 0 {
+		leaseDuration = 60 * time.Second
+	}
+	defaultConcurrency := jobsCfg.DefaultConcurrency
+	if defaultConcurrency <= 0 {
+		defaultConcurrency = 2
+	}
+	retryBaseDelay := time.Duration(jobsCfg.RetryBaseDelay) * time.Second
+	if retryBaseDelay <= 0 {
+		retryBaseDelay = 10 * time.Second
+	}
+	retryMaxDelay := time.Duration(jobsCfg.RetryMaxDelay) * time.Second
+	if retryMaxDelay < retryBaseDelay {
+		retryMaxDelay = 5 * time.Minute
+	}
+
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &JobQueue{
+		db:                 db,
+		log:                log,
+		workerID:           fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8]),
+		pollInterval:       pollInterval,
+		leaseDuration:      leaseDuration,
+		defaultConcurrency: defaultConcurrency,
+		concurrency:        jobsCfg.Concurrency,
+		maxAttempts:        jobsCfg.MaxAttempts,
+		retryBaseDelay:     retryBaseDelay,
+		retryMaxDelay:      retryMaxDelay,
+		workers:            make(map[string]*jobWorker),
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+}
+
+// Register 注册任务类型的处理函数，需在 Start 之前调用
+func (q *JobQueue) Register(jobType string, handler JobHandler) {
+	limit := q.defaultConcurrency
+	if n, ok := q.concurrency[jobType]; ok && n > 0 {
+		limit = n
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.workers[jobType] = &jobWorker{
+		handler: handler,
+		slots:   make(chan struct{}, limit),
+	}
+	q.log.Infow("Job handler registered", "type", jobType, "concurrency", limit)
+}
+
+// Start 启动调度循环
+func (q *JobQueue) Start() {
+	if q.running {
+		q.log.Warn("Job queue already running")
+		return
+	}
+	q.running = true
+
+	// 启动时先回收上次运行遗留的过期租约
+	q.requeueExpired()
+
+	q.wg.Add(1)
+	go q.dispatchLoop()
+
+	q.log.Infow("Job queue started", "worker_id", q.workerID, "poll_interval", q.pollInterval, "lease", q.leaseDuration)
+}
+
+// Stop 停止调度并等待执行中的任务退出；超时后仍未退出的任务会释放租约，留待下次启动继续执行
+func (q *JobQueue) Stop(ctx context.Context) {
+	if !q.running {
+		return
+	}
+
+	q.log.Info("Stopping job queue...")
+	q.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.log.Warn("Job queue stop timed out, releasing remaining leases")
+	}
+
+	q.releaseOwned()
+	q.running = false
+	q.log.Info("Job queue stopped")
+}
+
+func (q *JobQueue) dispatchLoop() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	lastRecovery := time.Now()
+	for {
+		q.dispatch()
+
+		if time.Since(lastRecovery) >= q.leaseDuration/2 {
+			q.requeueExpired()
+			lastRecovery = time.Now()
+		}
+
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch 为每种任务类型领取不超过空闲并发数的待执行任务
+func (q *JobQueue) dispatch() {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	for jobType, worker := range q.workers {
+		free := cap(worker.slots) - len(worker.slots)
+		if free <= 0 {
+			continue
+		}
+
+		tasks, err := q.claim(jobType, free)
+		if err != nil {
+			q.log.Errorw("Failed to claim jobs", "type", jobType, "error", err)
+			continue
+		}
+
+		for i := range tasks {
+			task := tasks[i]
+			worker.slots <- struct{}{}
+			q.wg.Add(1)
+			go q.run(worker, &task)
+		}
+	}
+}
+
+// claim 领取待执行任务。先查询候选任务（跳过仍在退避中的重试），再以 status=pending 为条件逐条抢占，
+// 保证多个实例同时运行时同一任务只会被一个 worker 领取。
+func (q *JobQueue) claim(jobType string, limit int) ([]models.AsyncTask, error) {
+	var candidates []models.AsyncTask
+	if err := q.db.Where("type = ? AND status = ? AND payload IS NOT NULL AND payload != ''", jobType, models.TaskStatusPending).
+		Where("run_after IS NULL OR run_after <= ?", time.Now()).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var claimed []models.AsyncTask
+	for _, task := range candidates {
+		now := time.Now()
+		leaseExpiresAt := now.Add(q.leaseDuration)
+		updates := map[string]interface{}{
+			"status":           models.TaskStatusProcessing,
+			"attempts":         gorm.Expr("attempts + 1"),
+			"lease_owner":      q.workerID,
+			"lease_expires_at": leaseExpiresAt,
+			"heartbeat_at":     now,
+			"started_at":       now,
+			"run_after":        nil,
+			"updated_at":       now,
+		}
+		// 首次执行时按配置写入最大执行次数
+		if task.Attempts == 0 && q.maxAttempts > 0 {
+			updates["max_attempts"] = q.maxAttempts
+			task.MaxAttempts = q.maxAttempts
+		}
+
+		result := q.db.Model(&models.AsyncTask{}).
+			Where("id = ? AND status = ?", task.ID, models.TaskStatusPending).
+			Updates(updates)
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		task.Status = models.TaskStatusProcessing
+		task.Attempts++
+		task.LeaseOwner = q.workerID
+		task.LeaseExpiresAt = &leaseExpiresAt
+		claimed = append(claimed, task)
+		publishTaskEvent(q.db, task.ID)
+	}
+
+	return claimed, nil
+}
+
+func (q *JobQueue) run(worker *jobWorker, task *models.AsyncTask) {
+	defer q.wg.Done()
+	defer func() { <-worker.slots }()
+
+	ctx, release := WithTaskContext(q.ctx, task.ID)
+	defer release()
+
+	heartbeatDone := make(chan struct{})
+	go q.heartbeat(task.ID, heartbeatDone)
+
+	q.log.Infow("Job started", "task_id", task.ID, "type", task.Type, "attempt", task.Attempts)
+
+	err := q.invoke(ctx, worker.handler, task)
+	close(heartbeatDone)
+
+	q.finish(ctx, task, err)
+}
+
+// invoke 执行处理函数并将 panic 转换为错误
+func (q *JobQueue) invoke(ctx context.Context, handler JobHandler, task *models.AsyncTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, task)
+}
+
+// heartbeat 定期续约，直到任务结束。任务在其他实例上被取消、超时重新排队或租约被回收时，
+// 续约会落空，此时中断本地执行。
+func (q *JobQueue) heartbeat(taskID string, done <-chan struct{}) {
+	ticker := time.NewTicker(q.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			result := q.db.Model(&models.AsyncTask{}).
+				Where("id = ? AND lease_owner = ? AND status = ?", taskID, q.workerID, models.TaskStatusProcessing).
+				Updates(map[string]interface{}{
+					"heartbeat_at":     now,
+					"lease_expires_at": now.Add(q.leaseDuration),
+				})
+			if result.Error != nil {
+				q.log.Warnw("Failed to renew job lease", "task_id", taskID, "error", result.Error)
+				continue
+			}
+			if result.RowsAffected == 0 {
+				var task models.AsyncTask
+				if err := q.db.Select("status", "lease_owner").Where("id = ?", taskID).First(&task).Error; err != nil {
+					continue
+				}
+				// 租约仍属于本 worker 说明处理函数已自行写入 completed/failed，等待其返回即可
+				if task.Status == models.TaskStatusCancelled {
+					cancelRunningTask(taskID)
+				} else if task.LeaseOwner != q.workerID {
+					interruptRunningTask(taskID, errTaskLeaseLost)
+				}
+			}
+		}
+	}
+}
+
+// finish 根据处理结果收尾。处理函数可能已自行写入 completed/failed 状态，
+// 任务也可能已被取消，因此这里只更新仍处于 processing 的任务。
+func (q *JobQueue) finish(ctx context.Context, task *models.AsyncTask, jobErr error) {
+	now := time.Now()
+	base := q.db.Model(&models.AsyncTask{}).Where("id = ? AND lease_owner = ?", task.ID, q.workerID)
+
+	// 队列停止导致的中断不计入失败，释放租约后由下次启动继续执行
+	if q.ctx.Err() != nil {
+		if err := base.Where("status = ?", models.TaskStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":           models.TaskStatusPending,
+				"attempts":         gorm.Expr("attempts - 1"),
+				"message":          "服务停止，任务等待恢复执行",
+				"lease_owner":      "",
+				"lease_expires_at": nil,
+			}).Error; err != nil {
+			q.log.Errorw("Failed to release interrupted job", "task_id", task.ID, "error", err)
+		}
+		q.log.Infow("Job interrupted by shutdown", "task_id", task.ID, "type", task.Type)
+		return
+	}
+
+	// 本次收尾写入了终态时通知 webhook 订阅方
+	var finished bool
+	if isTaskCancelled(ctx) {
+		q.log.Infow("Job cancelled", "task_id", task.ID, "type", task.Type)
+	} else if ctx.Err() != nil {
+		// 超时或租约失效：任务已由看门狗或其他实例重新调度，不再改动其状态和租约
+		q.log.Warnw("Job interrupted", "task_id", task.ID, "type", task.Type, "cause", context.Cause(ctx))
+		return
+	} else if canRetry(task, jobErr) {
+		delay := q.retryDelay(task.Attempts)
+		q.log.Warnw("Job failed with transient error, scheduling retry",
+			"task_id", task.ID, "type", task.Type, "attempt", task.Attempts, "delay", delay, "error", jobErr)
+		q.db.Model(&models.AsyncTask{}).
+			Where("id = ? AND status = ?", task.ID, models.TaskStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":    models.TaskStatusPending,
+				"error":     jobErr.Error(),
+				"message":   fmt.Sprintf("第%d次执行失败，%d秒后自动重试", task.Attempts, int(delay.Seconds())),
+				"run_after": now.Add(delay),
+			})
+	} else if jobErr != nil && utils.IsTransientError(jobErr) {
+		q.log.Errorw("Job exhausted retries, moved to dead letter", "task_id", task.ID, "type", task.Type, "attempts", task.Attempts, "error", jobErr)
+		result := q.db.Model(&models.AsyncTask{}).
+			Where("id = ? AND status = ?", task.ID, models.TaskStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":       models.TaskStatusDeadLetter,
+				"error":        jobErr.Error(),
+				"message":      fmt.Sprintf("已执行%d次仍失败，等待人工处理", task.Attempts),
+				"completed_at": &now,
+			})
+		finished = result.Error == nil && result.RowsAffected > 0
+	} else if jobErr != nil {
+		q.log.Errorw("Job failed", "task_id", task.ID, "type", task.Type, "error", jobErr)
+		result := q.db.Model(&models.AsyncTask{}).
+			Where("id = ? AND status = ?", task.ID, models.TaskStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":       models.TaskStatusFailed,
+				"error":        jobErr.Error(),
+				"error_code":   errorCode(jobErr),
+				"completed_at": &now,
+			})
+		finished = result.Error == nil && result.RowsAffected > 0
+	} else {
+		q.log.Infow("Job completed", "task_id", task.ID, "type", task.Type)
+		result := q.db.Model(&models.AsyncTask{}).
+			Where("id = ? AND status = ?", task.ID, models.TaskStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":       models.TaskStatusCompleted,
+				"progress":     100,
+				"completed_at": &now,
+			})
+		finished = result.Error == nil && result.RowsAffected > 0
+	}
+
+	if err := q.db.Model(&models.AsyncTask{}).Where("id = ? AND lease_owner = ?", task.ID, q.workerID).
+		Updates(map[string]interface{}{
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		}).Error; err != nil {
+		q.log.Warnw("Failed to clear job lease", "task_id", task.ID, "error", err)
+	}
+
+	publishTaskEvent(q.db, task.ID)
+	if finished {
+		dispatchTaskWebhook(q.db, q.log, task.ID)
+	}
+}
+
+// retryDelay 计算第 attempt 次执行失败后的退避时长：初始间隔逐次翻倍，不超过最大间隔
+func (q *JobQueue) retryDelay(attempt int) time.Duration {
+	delay := q.retryBaseDelay
+	for i := 1; i < attempt && delay < q.retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.retryMaxDelay {
+		delay = q.retryMaxDelay
+	}
+	return delay
+}
+
+// requeueExpired 将租约过期的任务重新放回队列，超过最大执行次数的任务标记为失败
+func (q *JobQueue) requeueExpired() {
+	now := time.Now()
+
+	exhausted := q.db.Model(&models.AsyncTask{}).
+		Where("status = ? AND lease_expires_at IS NOT NULL AND lease_expires_at < ? AND attempts >= max_attempts",
+			models.TaskStatusProcessing, now).
+		Updates(map[string]interface{}{
+			"status":           models.TaskStatusFailed,
+			"error":            "任务多次中断，已超过最大执行次数",
+			"completed_at":     &now,
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if exhausted.Error != nil {
+		q.log.Errorw("Failed to fail exhausted jobs", "error", exhausted.Error)
+	} else if exhausted.RowsAffected > 0 {
+		q.log.Warnw("Jobs exceeded max attempts after lease expiry", "count", exhausted.RowsAffected)
+	}
+
+	requeued := q.db.Model(&models.AsyncTask{}).
+		Where("status = ? AND lease_expires_at IS NOT NULL AND lease_expires_at < ?", models.TaskStatusProcessing, now).
+		Updates(map[string]interface{}{
+			"status":           models.TaskStatusPending,
+			"message":          "任务中断，已重新排队",
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if requeued.Error != nil {
+		q.log.Errorw("Failed to requeue expired jobs", "error", requeued.Error)
+	} else if requeued.RowsAffected > 0 {
+		q.log.Infow("Requeued jobs with expired lease", "count", requeued.RowsAffected)
+	}
+}
+
+// releaseOwned 释放本 worker 仍持有的租约，使任务在下次启动时立即可被领取
+func (q *JobQueue) releaseOwned() {
+	result := q.db.Model(&models.AsyncTask{}).
+		Where("status = ? AND lease_owner = ?", models.TaskStatusProcessing, q.workerID).
+		Updates(map[string]interface{}{
+			"status":           models.TaskStatusPending,
+			"attempts":         gorm.Expr("attempts - 1"),
+			"message":          "服务停止，任务等待恢复执行",
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if result.Error != nil {
+		q.log.Errorw("Failed to release job leases", "error", result.Error)
+	} else if result.RowsAffected > 0 {
+		q.log.Infow("Released job leases on shutdown", "count", result.RowsAffected)
+	}
+}
+
+// canRetry 判断处理函数返回的错误是否会被队列自动重试。
+// 处理函数据此决定关联记录是等待重试还是直接标记为失败。
+func canRetry(task *models.AsyncTask, err error) bool {
+	return utils.IsTransientError(err) && task.Attempts < task.MaxAttempts
+}
+
+// decodeJobPayload 解析任务参数
+func decodeJobPayload(task *models.AsyncTask, v interface{}) error {
+	if err := json.Unmarshal([]byte(task.Payload), v); err != nil {
+		return fmt.Errorf("invalid job payload: %w", err)
+	}
+	return nil
+}
+
+// sleepContext 等待指定时长，ctx 取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
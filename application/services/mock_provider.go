@@ -0,0 +1,40 @@
+package services
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/drama-generator/backend/pkg/config"
+)
+
+// MockProvider 内置的离线服务商，文本、图片、视频均不访问网络，行为由配置的 settings 控制
+const MockProvider = "mock"
+
+// mockOutput mock 服务商生成的图片和视频的存放位置，启动时根据存储配置设置
+var mockOutput = struct {
+	sync.RWMutex
+	dir     string
+	baseURL string
+}{}
+
+// SetMockStorage 将 mock 生成的文件放在本地存储的 mock 目录下，通过静态文件地址访问
+func SetMockStorage(cfg config.StorageConfig) {
+	mockOutput.Lock()
+	defer mockOutput.Unlock()
+	if cfg.LocalPath == "" {
+		mockOutput.dir, mockOutput.baseURL = "", ""
+		return
+	}
+	mockOutput.dir = filepath.Join(cfg.LocalPath, "mock")
+	mockOutput.baseURL = ""
+	if cfg.BaseURL != "" {
+		mockOutput.baseURL = strings.TrimRight(cfg.BaseURL, "/") + "/mock"
+	}
+}
+
+func mockStorage() (string, string) {
+	mockOutput.RLock()
+	defer mockOutput.RUnlock()
+	return mockOutput.dir, mockOutput.baseURL
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ModelCapabilityService 服务商和模型能力登记，生成图片/视频前按登记的能力校验参数
+type ModelCapabilityService struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+func NewModelCapabilityService(db *gorm.DB, log *logger.Logger) *ModelCapabilityService {
+	return &ModelCapabilityService{
+		db:  db,
+		log: log,
+	}
+}
+
+type UpsertModelCapabilityRequest struct {
+	Model        string                   `json:"model" binding:"required,max=100"`
+	Capabilities models.ModelCapabilities `json:"capabilities"`
+}
+
+// ResolvedModelCapabilities 某个服务商/模型实际使用的能力条目
+type ResolvedModelCapabilities struct {
+	ServiceType  string                   `json:"service_type"`
+	Provider     string                   `json:"provider"`
+	Model        string                   `json:"model"`
+	MatchedModel string                   `json:"matched_model"`
+	Capabilities models.ModelCapabilities `json:"capabilities"`
+}
+
+// SeedDefaults 写入内置的服务商和模型能力，已存在的记录不覆盖（保留手动修改），完成后加载注册表
+func (s *ModelCapabilityService) SeedDefaults() error {
+	created := 0
+	for _, seed := range defaultProviders {
+		provider := models.AIServiceProvider{
+			Name:        seed.name,
+			ServiceType: seed.serviceType,
+			DisplayName: seed.displayName,
+			DefaultURL:  seed.defaultURL,
+			IsActive:    true,
+		}
+		if err := s.db.Where("name = ? AND service_type = ?", seed.name, seed.serviceType).
+			FirstOrCreate(&provider).Error; err != nil {
+			return err
+		}
+
+		for _, model := range seed.models {
+			capability := models.AIModelCapability{ProviderID: provider.ID, Model: model.model, Capabilities: model.capabilities}
+			result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&capability)
+			if result.Error != nil {
+				return result.Error
+			}
+			created += int(result.RowsAffected)
+		}
+	}
+	if created > 0 {
+		s.log.Infow("Default model capabilities seeded", "count", created)
+	}
+	return s.Reload()
+}
+
+// Reload 从数据库重新加载启用的服务商的模型能力
+func (s *ModelCapabilityService) Reload() error {
+	var providers []models.AIServiceProvider
+	if err := s.db.Preload("Models").Where("is_active = ?", true).Find(&providers).Error; err != nil {
+		return err
+	}
+	setModelCapabilities(providers)
+	return nil
+}
+
+// ListProviders 获取服务商及其模型能力，serviceType 为空时返回全部
+func (s *ModelCapabilityService) ListProviders(serviceType string) ([]models.AIServiceProvider, error) {
+	query := s.db.Preload("Models", func(db *gorm.DB) *gorm.DB {
+		return db.Order("model ASC")
+	})
+	if serviceType != "" {
+		query = query.Where("service_type = ?", serviceType)
+	}
+
+	var providers []models.AIServiceProvider
+	if err := query.Order("service_type ASC, id ASC").Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+// Resolve 查询服务商/模型生成时使用的能力，未登记时返回 gorm.ErrRecordNotFound
+func (s *ModelCapabilityService) Resolve(serviceType, provider, model string) (*ResolvedModelCapabilities, error) {
+	caps, matched, ok := lookupModelCapabilities(serviceType, provider, model)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &ResolvedModelCapabilities{
+		ServiceType:  serviceType,
+		Provider:     capabilityProviderName(provider),
+		Model:        model,
+		MatchedModel: matched,
+		Capabilities: caps,
+	}, nil
+}
+
+// UpsertModel 新增或修改服务商下某个模型的能力
+func (s *ModelCapabilityService) UpsertModel(providerID uint, req *UpsertModelCapabilityRequest) (*models.AIModelCapability, error) {
+	var provider models.AIServiceProvider
+	if err := s.db.First(&provider, providerID).Error; err != nil {
+		return nil, err
+	}
+
+	capability := &models.AIModelCapability{
+		ProviderID:   providerID,
+		Model:        strings.TrimSpace(req.Model),
+		Capabilities: req.Capabilities,
+	}
+	if capability.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "provider_id"}, {Name: "model"}},
+		DoUpdates: clause.AssignmentColumns([]string{"capabilities", "updated_at"}),
+	}).Create(capability).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("provider_id = ? AND model = ?", providerID, capability.Model).First(capability).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	s.log.Infow("Model capability updated", "provider", provider.Name, "service_type", provider.ServiceType, "model", capability.Model)
+	return capability, nil
+}
+
+// DeleteModel 删除模型能力，删除后该模型生成时按前缀或 * 条目校验，没有匹配时不校验
+func (s *ModelCapabilityService) DeleteModel(capabilityID uint) error {
+	result := s.db.Delete(&models.AIModelCapability{}, capabilityID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return s.Reload()
+}
+
+// SetProviderActive 启用或停用服务商，停用后其模型能力不再参与校验
+func (s *ModelCapabilityService) SetProviderActive(providerID uint, active bool) error {
+	result := s.db.Model(&models.AIServiceProvider{}).Where("id = ?", providerID).Update("is_active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return s.Reload()
+}
+
+type modelSeed struct {
+	model        string
+	capabilities models.ModelCapabilities
+}
+
+type providerSeed struct {
+	name        string
+	serviceType string
+	displayName string
+	defaultURL  string
+	models      []modelSeed
+}
+
+// 即梦（Seedance）系列视频模型，火山引擎和 Chatfire 共用
+var seedanceRatios = []string{"16:9", "4:3", "1:1", "3:4", "9:16", "21:9", "adaptive"}
+
+var seedanceModels = []modelSeed{
+	{model: "doubao-seedance-1-5-pro*", capabilities: models.ModelCapabilities{
+		ImageToVideo: true, LastFrame: true, MinDuration: 4, MaxDuration: 12,
+		AspectRatios: seedanceRatios, Resolutions: []string{"480p", "720p", "1080p"},
+	}},
+	{model: "doubao-seedance-1-0-pro*", capabilities: models.ModelCapabilities{
+		ImageToVideo: true, MinDuration: 2, MaxDuration: 12,
+		AspectRatios: seedanceRatios, Resolutions: []string{"480p", "720p", "1080p"},
+	}},
+	{model: "doubao-seedance-1-0-lite-i2v*", capabilities: models.ModelCapabilities{
+		ImageToVideo: true, LastFrame: true, MinDuration: 2, MaxDuration: 12, MaxReferenceImages: 4,
+		AspectRatios: seedanceRatios, Resolutions: []string{"480p", "720p", "1080p"},
+	}},
+	{model: "doubao-seedance-1-0-lite-t2v*", capabilities: models.ModelCapabilities{
+		MinDuration: 2, MaxDuration: 12,
+		AspectRatios: seedanceRatios, Resolutions: []string{"480p", "720p", "1080p"},
+	}},
+}
+
+var soraModels = []modelSeed{
+	{model: "sora-2*", capabilities: models.ModelCapabilities{ImageToVideo: true, Durations: []int{4, 8, 12}}},
+}
+
+// 即梦（Seedream）系列图片模型
+var seedreamModels = []modelSeed{
+	{model: "doubao-seedream-4*", capabilities: models.ModelCapabilities{MaxReferenceImages: 10}},
+	{model: "doubao-seedream-3*", capabilities: models.ModelCapabilities{}},
+}
+
+var geminiImageModels = []modelSeed{
+	{model: "gemini-3-pro-image*", capabilities: models.ModelCapabilities{MaxReferenceImages: 14}},
+	{model: "gemini-2.5-flash-image*", capabilities: models.ModelCapabilities{MaxReferenceImages: 3}},
+}
+
+// defaultProviders 内置的服务商和模型能力，名称与AI配置中的 provider 一致（别名见 capabilityProviderName）
+var defaultProviders = []providerSeed{
+	{name: "openai", serviceType: "text", displayName: "OpenAI", defaultURL: "https://api.openai.com/v1"},
+	{name: "chatfire", serviceType: "text", displayName: "Chatfire", defaultURL: "https://api.chatfire.site/v1"},
+	{name: "gemini", serviceType: "text", displayName: "Google Gemini", defaultURL: "https://generativelanguage.googleapis.com"},
+	{name: "anthropic", serviceType: "text", displayName: "Anthropic", defaultURL: "https://api.anthropic.com"},
+	{name: MockProvider, serviceType: "text", displayName: "Mock（离线测试）"},
+
+	{name: "volcengine", serviceType: "image", displayName: "火山引擎", defaultURL: "https://ark.cn-beijing.volces.com/api/v3", models: seedreamModels},
+	{name: "chatfire", serviceType: "image", displayName: "Chatfire", defaultURL: "https://api.chatfire.site/v1", models: append([]modelSeed{
+		{model: "nano-banana-pro", capabilities: models.ModelCapabilities{MaxReferenceImages: 14}},
+		{model: "nano-banana*", capabilities: models.ModelCapabilities{MaxReferenceImages: 3}},
+	}, seedreamModels...)},
+	{name: "gemini", serviceType: "image", displayName: "Google Gemini", defaultURL: "https://generativelanguage.googleapis.com", models: geminiImageModels},
+	{name: "openai", serviceType: "image", displayName: "OpenAI", defaultURL: "https://api.openai.com/v1", models: []modelSeed{
+		{model: "dall-e-3", capabilities: models.ModelCapabilities{Sizes: []string{"1024x1024", "1792x1024", "1024x1792"}}},
+		{model: "dall-e-2", capabilities: models.ModelCapabilities{Sizes: []string{"256x256", "512x512", "1024x1024"}}},
+		{model: "gpt-image-1*", capabilities: models.ModelCapabilities{Sizes: []string{"1024x1024", "1536x1024", "1024x1536"}}},
+	}},
+	{name: "sdwebui", serviceType: "image", displayName: "Stable Diffusion WebUI（自托管）", defaultURL: "http://127.0.0.1:7860", models: []modelSeed{
+		{model: "*", capabilities: models.ModelCapabilities{NegativePrompt: true, MaxReferenceImages: 1}},
+	}},
+	{name: "comfyui", serviceType: "image", displayName: "ComfyUI（自托管）", defaultURL: "http://127.0.0.1:8188", models: []modelSeed{
+		{model: "*", capabilities: models.ModelCapabilities{NegativePrompt: true, MaxReferenceImages: 1}},
+	}},
+	{name: MockProvider, serviceType: "image", displayName: "Mock（离线测试）", models: []modelSeed{
+		{model: "*", capabilities: models.ModelCapabilities{NegativePrompt: true, MaxReferenceImages: 10}},
+	}},
+
+	{name: "volcengine", serviceType: "video", displayName: "火山引擎", defaultURL: "https://ark.cn-beijing.volces.com/api/v3", models: seedanceModels},
+	{name: "chatfire", serviceType: "video", displayName: "Chatfire", defaultURL: "https://api.chatfire.site/v1", models: append(append([]modelSeed{}, seedanceModels...), soraModels...)},
+	{name: "minimax", serviceType: "video", displayName: "MiniMax 海螺", defaultURL: "https://api.minimaxi.com/v1", models: []modelSeed{
+		{model: "MiniMax-Hailuo-02", capabilities: models.ModelCapabilities{ImageToVideo: true, LastFrame: true, Durations: []int{6, 10}}},
+		{model: "MiniMax-Hailuo-2.3*", capabilities: models.ModelCapabilities{ImageToVideo: true, Durations: []int{6, 10}}},
+	}},
+	{name: "openai", serviceType: "video", displayName: "OpenAI", defaultURL: "https://api.openai.com/v1", models: soraModels},
+	{name: MockProvider, serviceType: "video", displayName: "Mock（离线测试）", models: []modelSeed{
+		{model: "*", capabilities: models.ModelCapabilities{ImageToVideo: true, LastFrame: true, MinDuration: 1, MaxDuration: 20, MaxReferenceImages: 4}},
+	}},
+}
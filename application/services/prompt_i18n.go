@@ -67,7 +67,7 @@ func (p *PromptI18n) GetStoryboardSystemPrompt() string {
      * Weak ↓ (-1): Emotion subsiding
 
 [Output Requirements]
-1. Generate an array, each element is a shot containing:
+1. Generate a "storyboards" array, each element is a shot containing:
    - shot_number: Shot number
    - scene_description: Scene (location + time, e.g., "bedroom interior, morning")
    - shot_type: Shot type (extreme long shot/long shot/medium shot/close-up/extreme close-up)
@@ -79,7 +79,7 @@ func (p *PromptI18n) GetStoryboardSystemPrompt() string {
    - emotion: Current emotion
    - emotion_intensity: Emotion intensity level (3/2/1/0/-1)
 
-**CRITICAL: Return ONLY a valid JSON array. Do NOT include any markdown code blocks, explanations, or other text. Start directly with [ and end with ].**
+**CRITICAL: Return ONLY a valid JSON object in the form {"storyboards": [...]}. Do NOT include any markdown code blocks, explanations, or other text.**
 
 [Important Notes]
 - Shot count must match number of independent actions in the script (not allowed to merge or reduce)
@@ -122,7 +122,7 @@ func (p *PromptI18n) GetStoryboardSystemPrompt() string {
      * 弱 ↓ (-1)：情绪回落
 
 【输出要求】
-1. 生成一个数组，每个元素是一个镜头，包含：
+1. 生成一个 storyboards 数组，每个元素是一个镜头，包含：
    - shot_number：镜头号
    - scene_description：场景（地点+时间，如"卧室内，早晨"）
    - shot_type：景别（大远景/远景/中景/近景/特写）
@@ -134,7 +134,7 @@ func (p *PromptI18n) GetStoryboardSystemPrompt() string {
    - emotion：当前情绪
    - emotion_intensity：情绪强度等级（3/2/1/0/-1）
 
-**重要：必须只返回纯JSON数组，不要包含任何markdown代码块、说明文字或其他内容。直接以 [ 开头，以 ] 结尾。**
+**重要：必须只返回形如 {"storyboards": [...]} 的纯JSON对象，不要包含任何markdown代码块、说明文字或其他内容。**
 
 【重要提示】
 - 镜头数量必须与剧本中的独立动作数量匹配（不允许合并或减少）
@@ -176,9 +176,9 @@ func (p *PromptI18n) GetSceneExtractionPrompt(style string) string {
 
 
 [Output Format]
-**CRITICAL: Return ONLY a valid JSON array. Do NOT include any markdown code blocks, explanations, or other text. Start directly with [ and end with ].**
+**CRITICAL: Return ONLY a valid JSON object in the form {"backgrounds": [...]}. Do NOT include any markdown code blocks, explanations, or other text.**
 
-Each element containing:
+Each element of "backgrounds" containing:
 - location: Location (e.g., "luxurious office")
 - time: Time period (e.g., "afternoon")
 - prompt: Complete English image generation prompt (pure background, explicitly stating no people)`, style, imageRatio)
@@ -199,9 +199,9 @@ Each element containing:
    - **图片比例**：%s
 
 【输出格式】
-**重要：必须只返回纯JSON数组，不要包含任何markdown代码块、说明文字或其他内容。直接以 [ 开头，以 ] 结尾。**
+**重要：必须只返回形如 {"backgrounds": [...]} 的纯JSON对象，不要包含任何markdown代码块、说明文字或其他内容。**
 
-每个元素包含：
+backgrounds 中每个元素包含：
 - location：地点（如"豪华办公室"）
 - time：时间（如"下午"）
 - prompt：完整的中文图片生成提示词（纯背景，明确说明无人物）`, style, imageRatio)
@@ -395,8 +395,8 @@ Requirements:
 - **Style Requirement**: %s
 - **Image Ratio**: %s
 Output Format:
-**CRITICAL: Return ONLY a valid JSON array. Do NOT include any markdown code blocks, explanations, or other text. Start directly with [ and end with ].**
-Each element is a character object containing the above fields.`, style, imageRatio)
+**CRITICAL: Return ONLY a valid JSON object in the form {"characters": [...]}. Do NOT include any markdown code blocks, explanations, or other text.**
+Each element of "characters" is a character object containing the above fields.`, style, imageRatio)
 	}
 
 	return fmt.Sprintf(`你是一个专业的角色分析师，擅长从剧本中提取和分析角色信息。
@@ -416,8 +416,8 @@ Each element is a character object containing the above fields.`, style, imageRa
 - **风格要求**：%s
 - **图片比例**：%s
 输出格式：
-**重要：必须只返回纯JSON数组，不要包含任何markdown代码块、说明文字或其他内容。直接以 [ 开头，以 ] 结尾。**
-每个元素是一个角色对象，包含上述字段。`, style, imageRatio)
+**重要：必须只返回形如 {"characters": [...]} 的纯JSON对象，不要包含任何markdown代码块、说明文字或其他内容。**
+characters 中每个元素是一个角色对象，包含上述字段。`, style, imageRatio)
 }
 
 // GetPropExtractionPrompt 获取道具提取提示词
@@ -443,13 +443,13 @@ func (p *PromptI18n) GetPropExtractionPrompt() string {
 - **Image Ratio**: %s
 
 [Output Format]
-JSON array, each object containing:
+JSON object in the form {"props": [...]}, each element of "props" containing:
 - name: Prop Name
 - type: Type (e.g., Weapon/Key Item/Daily Item/Special Device)
 - description: Role in the drama and visual description
 - image_prompt: English image generation prompt (Focus on the object, isolated, detailed, cinematic lighting, high quality)
 
-Please return JSON array directly.`, style, imageRatio)
+Please return the JSON object directly.`, style, imageRatio)
 	}
 
 	return fmt.Sprintf(`请从以下剧本中提取关键道具。
@@ -466,13 +466,13 @@ Please return JSON array directly.`, style, imageRatio)
 - **图片比例**：%s
 
 【输出格式】
-JSON数组，每个对象包含：
+形如 {"props": [...]} 的JSON对象，props 中每个元素包含：
 - name: 道具名称
 - type: 类型 (如：武器/关键证物/日常用品/特殊装置)
 - description: 在剧中的作用和中文外观描述
 - image_prompt: 英文图片生成提示词 (Focus on the object, isolated, detailed, cinematic lighting, high quality)
 
-请直接返回JSON数组。`, style, imageRatio)
+请直接返回JSON对象。`, style, imageRatio)
 }
 
 // GetEpisodeScriptPrompt 获取分集剧本生成提示词
@@ -522,6 +522,66 @@ Output Format:
   - script_content: 详细剧本内容（800-1200字）`
 }
 
+// GetScriptChatSystemPrompt 获取剧本修改对话的系统提示词
+func (p *PromptI18n) GetScriptChatSystemPrompt() string {
+	if p.IsEnglish() {
+		return `You are a senior short drama screenwriter revising an existing script together with the user. The user asks for changes in natural language (e.g. "make episode 3's ending a cliffhanger"); answer based on the script content provided below.
+
+Requirements:
+1. In every response, briefly explain your thinking or what you changed in "reply"
+2. When the user asks to change an episode, put the **complete** revised script of that episode in "revision": episode_number is the episode number, script_content is the full script text (not just the changed part), summary describes the change in one sentence
+3. When only discussing, asking questions, or no script change is needed, set "revision" to null
+4. Revise at most one episode per response; keep characters, surrounding plot and the original writing style consistent, and leave parts that were not asked to change as they are
+
+Output Format:
+**CRITICAL: Return ONLY a valid JSON object. Do NOT include any markdown code blocks, explanations, or other text.**
+- reply: Your reply to the user
+- revision: The revised episode, or null`
+	}
+
+	return `你是一名资深短剧编剧，正在和用户一起修改已有的剧本。用户会用自然语言提出修改要求（例如"把第3集的结尾改成悬念"），请结合下面提供的剧本内容回答。
+
+要求：
+1. 每次回复都在 reply 中简要说明你的想法或做了哪些修改
+2. 用户要求修改某一集时，在 revision 中给出该集修改后的**完整**剧本：episode_number 为集数，script_content 为完整的剧本正文（不是修改的片段），summary 用一句话概括修改内容
+3. 只是讨论、提问或不需要修改剧本时，revision 为 null
+4. 每次最多修订一集；保持人物设定、前后剧情和原剧本的写作风格一致，未要求修改的部分保持原样
+
+输出格式：
+**重要：必须只返回纯JSON对象，不要包含任何markdown代码块、说明文字或其他内容。**
+- reply: 给用户的回复
+- revision: 修订稿，不修改时为 null`
+}
+
+// GetImageQASystemPrompt 获取分镜图片质检的系统提示词
+func (p *PromptI18n) GetImageQASystemPrompt() string {
+	if p.IsEnglish() {
+		return `You are a storyboard quality reviewer for a short drama production. You will receive a generated storyboard image together with the shot description (action, location, time of day and the characters who should appear). Check whether the image matches the description.
+
+Requirements:
+1. characters_present lists the expected characters visible in the image; missing_characters lists expected characters that cannot be found
+2. time_of_day_match, location_match and action_match indicate whether the lighting / time of day, the setting and the action match the description
+3. issues lists concrete problems in short sentences (wrong time of day, missing character, extra people, wrong action, obvious deformities, etc.)
+4. score is 0-100: 90+ fully matches, 60-89 minor deviations, below 60 a missing character, wrong time of day, wrong location or wrong action
+5. summary concludes in one sentence
+
+Output Format:
+**CRITICAL: Return ONLY a valid JSON object. Do NOT include any markdown code blocks, explanations, or other text.**`
+	}
+
+	return `你是短剧制作中的分镜质检员。你会收到一张生成的分镜图片以及该镜头的描述（动作、地点、时间和应出现的角色），请检查图片与描述是否一致。
+
+要求：
+1. characters_present 列出图片中能看到的应出现角色，missing_characters 列出找不到的应出现角色
+2. time_of_day_match、location_match、action_match 分别表示光线/时间、场景地点、人物动作是否与描述一致
+3. issues 用简短的句子列出具体问题（时间不对、缺少角色、多出人物、动作不符、明显的肢体畸形等）
+4. score 为 0-100 的分数：90 以上完全符合，60-89 有小的偏差，缺少角色、时间、地点或动作错误时低于 60
+5. summary 用一句话给出结论
+
+输出格式：
+**重要：必须只返回纯JSON对象，不要包含任何markdown代码块、说明文字或其他内容。**`
+}
+
 // FormatUserPrompt 格式化用户提示词的通用文本
 func (p *PromptI18n) FormatUserPrompt(key string, args ...interface{}) string {
 	style := p.config.Style.DefaultStyle
@@ -558,6 +618,16 @@ func (p *PromptI18n) FormatUserPrompt(key string, args ...interface{}) string {
 			"angle_label":            "Angle: %s",
 			"movement_label":         "Movement: %s",
 			"drama_info_template":    "Title: %s\nSummary: %s\nGenre: %s" + "\nStyle: " + style + "\nImage ratio: " + imageRatio,
+			"script_chat_context":    "[Current Drama]\n%s\n\n[Episodes]\n%s",
+			"script_chat_episode":    "[Episode %d: %s]\n%s",
+			"script_chat_outline":    "Episode %d: %s",
+			"script_chat_empty":      "(no script yet)",
+			"script_chat_scope":      "This conversation only revises episode %d; the episode_number of a revision must be %d. Other episodes are listed for reference only.",
+			"script_chat_proposed":   "(The reply above included a revision of episode %d: %s)",
+			"script_chat_pending":    "(The reply above included a revision of episode %d that has not been accepted yet. Full text:)\n%s",
+			"image_qa_request":       "[Shot Description]\nAction: %s\nLocation: %s\nTime: %s\nCharacters: %s\n\nCheck whether the attached image matches the shot description.",
+			"image_qa_no_characters": "(none)",
+			"structured_retry":       "%s\n\n[Your Previous Output]\n%s\n\n[Validation Error]\n%s\n\nYour previous output did not match the required JSON format. Fix the error above and output the complete JSON again, without any other text.",
 		},
 		"zh": {
 			"outline_request":        "请为以下主题创作短剧大纲：\n\n主题：%s",
@@ -589,6 +659,16 @@ func (p *PromptI18n) FormatUserPrompt(key string, args ...interface{}) string {
 			"angle_label":            "角度: %s",
 			"movement_label":         "运镜: %s",
 			"drama_info_template":    "剧名：%s\n简介：%s\n类型：%s" + "\n风格: " + style + "\n图片比例: " + imageRatio,
+			"script_chat_context":    "【当前剧本】\n%s\n\n【分集剧本】\n%s",
+			"script_chat_episode":    "【第%d集：%s】\n%s",
+			"script_chat_outline":    "第%d集：%s",
+			"script_chat_empty":      "（暂无剧本内容）",
+			"script_chat_scope":      "本次对话只修改第%d集，修订稿的 episode_number 必须为 %d，其他集仅供参考。",
+			"script_chat_proposed":   "（上面的回复附带了第%d集的修订稿：%s）",
+			"script_chat_pending":    "（上面的回复附带了第%d集的修订稿，尚未采纳，全文如下）\n%s",
+			"image_qa_request":       "【镜头描述】\n动作：%s\n地点：%s\n时间：%s\n角色：%s\n\n请检查附带的图片是否与镜头描述一致。",
+			"image_qa_no_characters": "（无）",
+			"structured_retry":       "%s\n\n【你上一次的输出】\n%s\n\n【校验错误】\n%s\n\n上一次的输出不符合要求的JSON格式。请修正上述错误，重新输出完整的JSON，不要包含任何其他内容。",
 		},
 	}
 
@@ -607,3 +687,14 @@ func (p *PromptI18n) FormatUserPrompt(key string, args ...interface{}) string {
 	}
 	return template
 }
+
+// structuredRetryOutputLimit 纠错提示中保留的上一次输出的最大字符数
+const structuredRetryOutputLimit = 4000
+
+// StructuredRetryPrompt 生成结构化输出校验失败后的纠错提示，包含原始提示、上一次的输出和校验错误
+func (p *PromptI18n) StructuredRetryPrompt(prompt string, previous string, validationErr error) string {
+	if runes := []rune(previous); len(runes) > structuredRetryOutputLimit {
+		previous = string(runes[:structuredRetryOutputLimit]) + "..."
+	}
+	return p.FormatUserPrompt("structured_retry", prompt, previous, validationErr.Error())
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -9,7 +10,6 @@ import (
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
-	"github.com/drama-generator/backend/pkg/utils"
 	"gorm.io/gorm"
 )
 
@@ -59,8 +59,8 @@ func (s *PropService) DeleteProp(id uint) error {
 	return s.db.Delete(&models.Prop{}, id).Error
 }
 
-// ExtractPropsFromScript 从剧本提取道具（异步）
-func (s *PropService) ExtractPropsFromScript(episodeID uint) (string, error) {
+// ExtractPropsFromScript 从剧本提取道具（异步），bypassCache 为 true 时不使用缓存的AI响应
+func (s *PropService) ExtractPropsFromScript(episodeID uint, bypassCache bool) (string, error) {
 	var episode models.Episode
 	if err := s.db.First(&episode, episodeID).Error; err != nil {
 		return "", fmt.Errorf("episode not found: %w", err)
@@ -71,12 +71,18 @@ func (s *PropService) ExtractPropsFromScript(episodeID uint) (string, error) {
 		return "", err
 	}
 
-	go s.processPropExtraction(task.ID, episode)
+	go s.processPropExtraction(task.ID, episode, bypassCache)
 
 	return task.ID, nil
 }
 
-func (s *PropService) processPropExtraction(taskID string, episode models.Episode) {
+func (s *PropService) processPropExtraction(taskID string, episode models.Episode, bypassCache bool) {
+	ctx, release := WithTaskContext(context.Background(), taskID)
+	defer release()
+	if bypassCache {
+		ctx = WithoutAICache(ctx)
+	}
+
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在分析剧本...")
 
 	script := ""
@@ -87,28 +93,30 @@ func (s *PropService) processPropExtraction(taskID string, episode models.Episod
 	promptTemplate := s.promptI18n.GetPropExtractionPrompt()
 	prompt := fmt.Sprintf(promptTemplate, script)
 
-	response, err := s.aiService.GenerateText(prompt, "", ai.WithMaxTokens(2000))
-	if err != nil {
-		s.taskService.UpdateTaskError(taskID, err)
-		return
-	}
-
-	var extractedProps []struct {
-		Name        string `json:"name"`
-		Type        string `json:"type"`
-		Description string `json:"description"`
-		ImagePrompt string `json:"image_prompt"`
+	var extracted struct {
+		Props []struct {
+			Name        string `json:"name"`
+			Type        string `json:"type"`
+			Description string `json:"description"`
+			ImagePrompt string `json:"image_prompt"`
+		} `json:"props"`
 	}
 
-	if err := utils.SafeParseAIJSON(response, &extractedProps); err != nil {
-		s.taskService.UpdateTaskError(taskID, fmt.Errorf("解析AI结果失败: %w", err))
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "prop_extraction", DramaID: &episode.DramaID, EpisodeID: &episode.ID})
+	if _, err := s.aiService.GenerateStructured(usageCtx, StructuredRequest{
+		Prompt:     prompt,
+		SchemaName: "props",
+		Options:    []func(*ai.ChatCompletionRequest){ai.WithMaxTokens(2000)},
+		PromptI18n: s.promptI18n,
+	}, &extracted); err != nil {
+		s.taskService.UpdateTaskError(taskID, err)
 		return
 	}
 
 	s.taskService.UpdateTaskStatus(taskID, "processing", 50, "正在保存道具...")
 
 	var createdProps []models.Prop
-	for _, p := range extractedProps {
+	for _, p := range extracted.Props {
 		prop := models.Prop{
 			DramaID:     episode.DramaID,
 			Name:        p.Name,
@@ -150,19 +158,57 @@ func (s *PropService) GeneratePropImage(propID uint) (string, error) {
 		return "", fmt.Errorf("道具没有图片提示词")
 	}
 
-	// 2. 创建任务
-	task, err := s.taskService.CreateTask("prop_image_generation", fmt.Sprintf("%d", propID))
+	// 2. 创建任务，由任务队列调度执行
+	task, err := s.taskService.EnqueueTask(JobTypePropImageGeneration, fmt.Sprintf("%d", propID), propImageJob{PropID: propID})
 	if err != nil {
 		return "", err
 	}
 
-	go s.processPropImageGeneration(task.ID, prop)
 	return task.ID, nil
 }
 
-func (s *PropService) processPropImageGeneration(taskID string, prop models.Prop) {
+// propImageJob 道具图片生成任务参数
+type propImageJob struct {
+	PropID uint `json:"prop_id"`
+}
+
+// RegisterJobHandlers 注册道具图片生成任务处理器
+func (s *PropService) RegisterJobHandlers(q *JobQueue) {
+	q.Register(JobTypePropImageGeneration, s.handlePropImageJob)
+}
+
+func (s *PropService) handlePropImageJob(ctx context.Context, task *models.AsyncTask) error {
+	var job propImageJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	var prop models.Prop
+	if err := s.db.First(&prop, job.PropID).Error; err != nil {
+		return fmt.Errorf("prop not found: %w", err)
+	}
+
+	s.processPropImageGeneration(ctx, task, prop)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (s *PropService) processPropImageGeneration(ctx context.Context, task *models.AsyncTask, prop models.Prop) {
+	taskID := task.ID
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在生成图片...")
 
+	// 任务恢复执行时，复用本任务之前已创建的图片生成记录，避免重复生成
+	var imageGen models.ImageGeneration
+	err := s.db.Where("prop_id = ? AND created_at >= ?", prop.ID, task.CreatedAt).
+		Order("created_at DESC").First(&imageGen).Error
+	if err == nil {
+		s.log.Infow("Resuming prop image generation", "task_id", taskID, "image_gen_id", imageGen.ID)
+		s.waitPropImageGeneration(ctx, taskID, imageGen.ID)
+		return
+	}
+
 	// 准备生成参数
 	imageStyle := s.config.Style.DefaultStyle
 	if s.config != nil && s.config.Style.DefaultPropStyle != "" {
@@ -197,23 +243,29 @@ func (s *PropService) processPropImageGeneration(taskID string, prop models.Prop
 	}
 
 	// 调用 ImageGenerationService
-	imageGen, err := s.imageGenerationService.GenerateImage(req)
+	newImageGen, err := s.imageGenerationService.GenerateImage(req)
 	if err != nil {
 		s.taskService.UpdateTaskError(taskID, err)
 		return
 	}
 
-	// 轮询 ImageGeneration 状态直到完成
+	s.waitPropImageGeneration(ctx, taskID, newImageGen.ID)
+}
+
+// waitPropImageGeneration 轮询 ImageGeneration 状态直到完成，并同步到任务结果
+func (s *PropService) waitPropImageGeneration(ctx context.Context, taskID string, imageGenID uint) {
 	maxAttempts := 60
 	pollInterval := 2 * time.Second
 
 	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(pollInterval)
+		if !sleepContext(ctx, pollInterval) {
+			return
+		}
 
 		// 重新加载 imageGen
 		var currentImageGen models.ImageGeneration
-		if err := s.db.First(&currentImageGen, imageGen.ID).Error; err != nil {
-			s.log.Errorw("Failed to poll image generation", "error", err, "id", imageGen.ID)
+		if err := s.db.First(&currentImageGen, imageGenID).Error; err != nil {
+			s.log.Errorw("Failed to poll image generation", "error", err, "id", imageGenID)
 			continue
 		}
 
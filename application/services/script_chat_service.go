@@ -0,0 +1,472 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// scriptChatHistoryLimit 每次请求带上的历史消息数
+	scriptChatHistoryLimit = 20
+	// scriptChatTitleLength 未指定标题时取第一条消息的前若干个字
+	scriptChatTitleLength = 30
+	// scriptRevisionDiffContext 差异文本中每处修改前后保留的行数
+	scriptRevisionDiffContext = 3
+)
+
+var (
+	// ErrNoScriptRevision 消息没有附带修订稿
+	ErrNoScriptRevision = errors.New("该消息没有修订稿")
+	// ErrScriptRevisionAccepted 修订稿已经采纳过
+	ErrScriptRevisionAccepted = errors.New("修订稿已采纳")
+	// ErrScriptRevisionConflict 提出修订后该集剧本已被修改，需要确认差异后强制采纳
+	ErrScriptRevisionConflict = errors.New("提出修订后该集剧本已被修改，请确认差异后强制采纳")
+)
+
+// ScriptChatService 多轮对话修改剧本，助手提出的修订稿确认后写入分集剧本
+type ScriptChatService struct {
+	db         *gorm.DB
+	aiService  *AIService
+	log        *logger.Logger
+	promptI18n *PromptI18n
+}
+
+func NewScriptChatService(db *gorm.DB, cfg *config.Config, log *logger.Logger) *ScriptChatService {
+	return &ScriptChatService{
+		db:         db,
+		aiService:  NewAIService(db, log),
+		log:        log,
+		promptI18n: NewPromptI18n(cfg),
+	}
+}
+
+type CreateScriptChatSessionRequest struct {
+	DramaID   uint   `json:"drama_id" binding:"required"`
+	EpisodeID *uint  `json:"episode_id"`
+	Title     string `json:"title" binding:"max=200"`
+	Model     string `json:"model" binding:"max=100"` // 指定使用的文本模型
+}
+
+type SendScriptChatMessageRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+type AcceptScriptRevisionRequest struct {
+	Force bool `json:"force"` // 剧本在提出修订后被修改过时仍然采纳
+}
+
+// ScriptRevisionDiff 修订稿与该集当前剧本的差异
+type ScriptRevisionDiff struct {
+	MessageID     uint             `json:"message_id"`
+	EpisodeID     uint             `json:"episode_id"`
+	EpisodeNumber int              `json:"episode_number"`
+	Status        string           `json:"status"`
+	Stale         bool             `json:"stale"` // 提出修订后该集剧本已被修改
+	Stats         utils.DiffStats  `json:"stats"`
+	Unified       string           `json:"unified"`
+	Lines         []utils.DiffLine `json:"lines"`
+}
+
+// ScriptChatReply 发送消息的结果
+type ScriptChatReply struct {
+	UserMessage      models.ScriptChatMessage `json:"user_message"`
+	AssistantMessage models.ScriptChatMessage `json:"assistant_message"`
+	Diff             *ScriptRevisionDiff      `json:"diff,omitempty"`
+}
+
+// scriptChatOutput 助手回复的结构
+type scriptChatOutput struct {
+	Reply    string                  `json:"reply"`
+	Revision *scriptRevisionProposal `json:"revision"`
+}
+
+type scriptRevisionProposal struct {
+	EpisodeNumber int    `json:"episode_number"`
+	ScriptContent string `json:"script_content"`
+	Summary       string `json:"summary"`
+}
+
+// CreateSession 创建对话，指定分集时该集必须属于剧本
+func (s *ScriptChatService) CreateSession(req *CreateScriptChatSessionRequest) (*models.ScriptChatSession, error) {
+	var drama models.Drama
+	if err := s.db.First(&drama, req.DramaID).Error; err != nil {
+		return nil, err
+	}
+	if req.EpisodeID != nil {
+		var episode models.Episode
+		if err := s.db.Where("id = ? AND drama_id = ?", *req.EpisodeID, req.DramaID).First(&episode).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	session := &models.ScriptChatSession{
+		DramaID:   req.DramaID,
+		EpisodeID: req.EpisodeID,
+		Title:     strings.TrimSpace(req.Title),
+		Model:     strings.TrimSpace(req.Model),
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListSessions 获取剧本的对话，episodeID 不为空时只返回该集的对话
+func (s *ScriptChatService) ListSessions(dramaID uint, episodeID *uint) ([]models.ScriptChatSession, error) {
+	query := s.db.Where("drama_id = ?", dramaID)
+	if episodeID != nil {
+		query = query.Where("episode_id = ?", *episodeID)
+	}
+
+	var sessions []models.ScriptChatSession
+	if err := query.Order("updated_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetSession 获取对话及全部消息
+func (s *ScriptChatService) GetSession(sessionID uint) (*models.ScriptChatSession, error) {
+	var session models.ScriptChatSession
+	if err := s.db.Preload("Messages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).First(&session, sessionID).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteSession 删除对话，已采纳的修订不受影响
+func (s *ScriptChatService) DeleteSession(sessionID uint) error {
+	result := s.db.Delete(&models.ScriptChatSession{}, sessionID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SendMessage 带着剧本内容和对话历史请求助手回复，请求成功后才保存用户消息和回复
+func (s *ScriptChatService) SendMessage(ctx context.Context, sessionID uint, req *SendScriptChatMessageRequest) (*ScriptChatReply, error) {
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		return nil, errors.New("content is required")
+	}
+
+	var session models.ScriptChatSession
+	if err := s.db.First(&session, sessionID).Error; err != nil {
+		return nil, err
+	}
+	var drama models.Drama
+	if err := s.db.First(&drama, session.DramaID).Error; err != nil {
+		return nil, err
+	}
+	var episodes []models.Episode
+	if err := s.db.Where("drama_id = ?", session.DramaID).Order("episode_number ASC").Find(&episodes).Error; err != nil {
+		return nil, err
+	}
+
+	var history []models.ScriptChatMessage
+	if err := s.db.Where("session_id = ?", session.ID).Order("id DESC").Limit(scriptChatHistoryLimit).Find(&history).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	messages := append([]ai.ChatMessage{{Role: "system", Content: s.systemPrompt(&session, &drama, episodes)}}, s.historyMessages(history)...)
+	messages = append(messages, ai.ChatMessage{Role: "user", Content: content})
+
+	client, err := s.aiService.GetTextClientForModel(session.Model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI client: %w", err)
+	}
+	ctx = WithUsageScope(ctx, UsageScope{Operation: "script_chat", DramaID: &session.DramaID, EpisodeID: session.EpisodeID})
+
+	output, err := s.chat(ctx, client, messages, content)
+	if err != nil {
+		return nil, err
+	}
+
+	userMessage := models.ScriptChatMessage{SessionID: session.ID, Role: "user", Content: content}
+	assistantMessage := models.ScriptChatMessage{SessionID: session.ID, Role: "assistant", Content: strings.TrimSpace(output.Reply)}
+	var revisionEpisode *models.Episode
+	if output.Revision != nil && strings.TrimSpace(output.Revision.ScriptContent) != "" {
+		revisionEpisode = revisionTarget(&session, episodes, output.Revision.EpisodeNumber)
+		if revisionEpisode == nil {
+			s.log.Warnw("Script revision targets unknown episode, ignored", "session_id", session.ID, "episode_number", output.Revision.EpisodeNumber)
+		} else {
+			script := output.Revision.ScriptContent
+			assistantMessage.EpisodeID = &revisionEpisode.ID
+			assistantMessage.ProposedScript = &script
+			assistantMessage.RevisionSummary = strings.TrimSpace(output.Revision.Summary)
+			assistantMessage.RevisionStatus = models.RevisionStatusPending
+			assistantMessage.BaseScriptHash = scriptHash(revisionEpisode.ScriptContent)
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&userMessage).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&assistantMessage).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"updated_at": time.Now()}
+		if session.Title == "" {
+			updates["title"] = truncateRunes(content, scriptChatTitleLength)
+		}
+		return tx.Model(&models.ScriptChatSession{}).Where("id = ?", session.ID).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &ScriptChatReply{UserMessage: userMessage, AssistantMessage: assistantMessage}
+	if revisionEpisode != nil {
+		reply.Diff = buildRevisionDiff(&assistantMessage, revisionEpisode)
+		s.log.Infow("Script revision proposed",
+			"session_id", session.ID,
+			"message_id", assistantMessage.ID,
+			"episode_id", revisionEpisode.ID,
+			"added", reply.Diff.Stats.Added,
+			"removed", reply.Diff.Stats.Removed)
+	}
+	return reply, nil
+}
+
+// chat 请求助手回复并按 Schema 校验，未通过时把错误发回模型重新生成一次
+func (s *ScriptChatService) chat(ctx context.Context, client ai.AIClient, messages []ai.ChatMessage, content string) (*scriptChatOutput, error) {
+	var output scriptChatOutput
+	schema := utils.SchemaFor(&output)
+	options := []func(*ai.ChatCompletionRequest){ai.WithResponseSchema("script_chat", schema), ai.WithTemperature(0.7)}
+
+	for attempt := 0; ; attempt++ {
+		text, err := client.Chat(ctx, messages, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		output = scriptChatOutput{}
+		validationErr := utils.ParseAIJSONWithSchema(text, schema, &output)
+		if validationErr == nil {
+			return &output, nil
+		}
+		if attempt >= structuredOutputRetries {
+			return nil, fmt.Errorf("AI输出不符合格式要求: %w", validationErr)
+		}
+
+		s.log.Warnw("Script chat output failed validation, asking model to correct it", "attempt", attempt+1, "error", validationErr)
+		messages = append(messages[:len(messages)-1], ai.ChatMessage{Role: "user", Content: s.promptI18n.StructuredRetryPrompt(content, text, validationErr)})
+	}
+}
+
+// systemPrompt 系统提示词附带剧本信息和分集剧本，对话关联到某一集时其他集只列出标题
+func (s *ScriptChatService) systemPrompt(session *models.ScriptChatSession, drama *models.Drama, episodes []models.Episode) string {
+	var description, genre string
+	if drama.Description != nil {
+		description = *drama.Description
+	}
+	if drama.Genre != nil {
+		genre = *drama.Genre
+	}
+	dramaInfo := s.promptI18n.FormatUserPrompt("drama_info_template", drama.Title, description, genre)
+
+	blocks := make([]string, 0, len(episodes)+1)
+	for _, episode := range episodes {
+		if session.EpisodeID != nil && *session.EpisodeID != episode.ID {
+			blocks = append(blocks, s.promptI18n.FormatUserPrompt("script_chat_outline", episode.EpisodeNum, episode.Title))
+			continue
+		}
+		script := s.promptI18n.FormatUserPrompt("script_chat_empty")
+		if episode.ScriptContent != nil && strings.TrimSpace(*episode.ScriptContent) != "" {
+			script = *episode.ScriptContent
+		}
+		blocks = append(blocks, s.promptI18n.FormatUserPrompt("script_chat_episode", episode.EpisodeNum, episode.Title, script))
+		if session.EpisodeID != nil {
+			blocks = append(blocks, s.promptI18n.FormatUserPrompt("script_chat_scope", episode.EpisodeNum, episode.EpisodeNum))
+		}
+	}
+
+	return s.promptI18n.GetScriptChatSystemPrompt() + "\n\n" +
+		s.promptI18n.FormatUserPrompt("script_chat_context", dramaInfo, strings.Join(blocks, "\n\n"))
+}
+
+// historyMessages 转换历史消息。修订稿只标注集数和概要，最近一份未采纳的修订稿附带全文，便于继续修改
+func (s *ScriptChatService) historyMessages(history []models.ScriptChatMessage) []ai.ChatMessage {
+	latestPending := -1
+	for i, message := range history {
+		if message.ProposedScript != nil && message.RevisionStatus == models.RevisionStatusPending {
+			latestPending = i
+		}
+	}
+
+	episodeNumbers := make(map[uint]int)
+	var episodeIDs []uint
+	for _, message := range history {
+		if message.EpisodeID != nil {
+			episodeIDs = append(episodeIDs, *message.EpisodeID)
+		}
+	}
+	if len(episodeIDs) > 0 {
+		var episodes []models.Episode
+		s.db.Select("id", "episode_number").Where("id IN ?", episodeIDs).Find(&episodes)
+		for _, episode := range episodes {
+			episodeNumbers[episode.ID] = episode.EpisodeNum
+		}
+	}
+
+	messages := make([]ai.ChatMessage, 0, len(history))
+	for i, message := range history {
+		content := message.Content
+		if message.ProposedScript != nil && message.EpisodeID != nil {
+			number := episodeNumbers[*message.EpisodeID]
+			if i == latestPending {
+				content += "\n\n" + s.promptI18n.FormatUserPrompt("script_chat_pending", number, *message.ProposedScript)
+			} else {
+				content += "\n\n" + s.promptI18n.FormatUserPrompt("script_chat_proposed", number, message.RevisionSummary)
+			}
+		}
+		messages = append(messages, ai.ChatMessage{Role: message.Role, Content: content})
+	}
+	return messages
+}
+
+// GetRevisionDiff 获取修订稿与该集当前剧本的差异
+func (s *ScriptChatService) GetRevisionDiff(sessionID, messageID uint) (*ScriptRevisionDiff, error) {
+	message, episode, err := s.loadRevision(s.db, sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return buildRevisionDiff(message, episode), nil
+}
+
+// AcceptRevision 将修订稿写入分集剧本，返回采纳前后的差异。提出修订后剧本被修改过时，
+// 除非 force 为 true，否则返回 ErrScriptRevisionConflict 和当前的差异
+func (s *ScriptChatService) AcceptRevision(sessionID, messageID uint, req *AcceptScriptRevisionRequest) (*ScriptRevisionDiff, error) {
+	var diff *ScriptRevisionDiff
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		message, episode, err := s.loadRevision(tx, sessionID, messageID)
+		if err != nil {
+			return err
+		}
+		if message.RevisionStatus == models.RevisionStatusAccepted {
+			return ErrScriptRevisionAccepted
+		}
+
+		diff = buildRevisionDiff(message, episode)
+		if diff.Stale && !req.Force {
+			return ErrScriptRevisionConflict
+		}
+
+		if err := tx.Model(&models.Episode{}).Where("id = ?", episode.ID).Update("script_content", *message.ProposedScript).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&models.ScriptChatMessage{}).Where("id = ?", message.ID).Updates(map[string]interface{}{
+			"revision_status": models.RevisionStatusAccepted,
+			"accepted_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+		diff.Status = models.RevisionStatusAccepted
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrScriptRevisionConflict) {
+			return diff, err
+		}
+		return nil, err
+	}
+
+	s.log.Infow("Script revision accepted",
+		"session_id", sessionID,
+		"message_id", messageID,
+		"episode_id", diff.EpisodeID,
+		"forced", diff.Stale,
+		"added", diff.Stats.Added,
+		"removed", diff.Stats.Removed)
+	return diff, nil
+}
+
+// loadRevision 加载对话中附带修订稿的消息及对应的分集
+func (s *ScriptChatService) loadRevision(db *gorm.DB, sessionID, messageID uint) (*models.ScriptChatMessage, *models.Episode, error) {
+	var message models.ScriptChatMessage
+	if err := db.Where("id = ? AND session_id = ?", messageID, sessionID).First(&message).Error; err != nil {
+		return nil, nil, err
+	}
+	if message.ProposedScript == nil || message.EpisodeID == nil {
+		return nil, nil, ErrNoScriptRevision
+	}
+
+	var episode models.Episode
+	if err := db.First(&episode, *message.EpisodeID).Error; err != nil {
+		return nil, nil, err
+	}
+	return &message, &episode, nil
+}
+
+func buildRevisionDiff(message *models.ScriptChatMessage, episode *models.Episode) *ScriptRevisionDiff {
+	current := ""
+	if episode.ScriptContent != nil {
+		current = *episode.ScriptContent
+	}
+	lines := utils.DiffLines(current, *message.ProposedScript)
+	name := fmt.Sprintf("episode-%d", episode.EpisodeNum)
+	return &ScriptRevisionDiff{
+		MessageID:     message.ID,
+		EpisodeID:     episode.ID,
+		EpisodeNumber: episode.EpisodeNum,
+		Status:        message.RevisionStatus,
+		Stale:         message.RevisionStatus == models.RevisionStatusPending && scriptHash(episode.ScriptContent) != message.BaseScriptHash,
+		Stats:         utils.CountDiff(lines),
+		Unified:       utils.UnifiedDiff(name, name+"-revised", lines, scriptRevisionDiffContext),
+		Lines:         lines,
+	}
+}
+
+// revisionTarget 确定修订的分集：对话关联到某一集时总是该集，否则按集数查找
+func revisionTarget(session *models.ScriptChatSession, episodes []models.Episode, episodeNumber int) *models.Episode {
+	for i := range episodes {
+		if session.EpisodeID != nil {
+			if episodes[i].ID == *session.EpisodeID {
+				return &episodes[i]
+			}
+			continue
+		}
+		if episodes[i].EpisodeNum == episodeNumber {
+			return &episodes[i]
+		}
+	}
+	return nil
+}
+
+func scriptHash(script *string) string {
+	if script == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(*script))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncateRunes(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > limit {
+		return string(runes[:limit]) + "..."
+	}
+	return text
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 
@@ -63,6 +65,9 @@ func (s *ScriptGenerationService) GenerateCharacters(req *GenerateCharactersRequ
 
 // processCharacterGeneration 异步处理角色生成
 func (s *ScriptGenerationService) processCharacterGeneration(taskID string, req *GenerateCharactersRequest) {
+	ctx, release := WithTaskContext(context.Background(), taskID)
+	defer release()
+
 	// 更新任务状态为处理中
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在生成角色...")
 
@@ -91,48 +96,41 @@ func (s *ScriptGenerationService) processCharacterGeneration(taskID string, req
 		temperature = 0.7
 	}
 
-	// 如果指定了模型，使用指定的模型；否则使用默认配置
-	var text string
-	var err error
+	// 如果指定了模型，使用指定的模型；否则使用默认配置。流式生成，进度按已接收的 token 数推进
+	stream := newTextStreamProgress(s.taskService, s.log, taskID, 0, 80, 0, "正在生成角色")
+	stream.partial = partialCharacters
+
 	if req.Model != "" {
 		s.log.Infow("Using specified model for character generation", "model", req.Model, "task_id", taskID)
-		client, getErr := s.aiService.GetAIClientForModel("text", req.Model)
-		if getErr != nil {
-			s.log.Warnw("Failed to get client for specified model, using default", "model", req.Model, "error", getErr, "task_id", taskID)
-			text, err = s.aiService.GenerateText(userPrompt, systemPrompt, ai.WithTemperature(temperature))
-		} else {
-			text, err = client.GenerateText(userPrompt, systemPrompt, ai.WithTemperature(temperature))
-		}
-	} else {
-		text, err = s.aiService.GenerateText(userPrompt, systemPrompt, ai.WithTemperature(temperature))
 	}
-
+	client, err := s.aiService.GetTextClientForModel(req.Model)
 	if err != nil {
-		s.log.Errorw("Failed to generate characters", "error", err, "task_id", taskID)
+		s.log.Errorw("Failed to get AI client", "error", err, "task_id", taskID)
 		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "AI生成失败: "+err.Error())
 		return
 	}
 
-	s.log.Infow("AI response received for character generation", "length", len(text), "preview", text[:minInt(200, len(text))], "task_id", taskID)
-
-	// AI直接返回数组格式
-	var result []struct {
-		Name        string `json:"name"`
-		Role        string `json:"role"`
-		Description string `json:"description"`
-		Personality string `json:"personality"`
-		Appearance  string `json:"appearance"`
-		VoiceStyle  string `json:"voice_style"`
-	}
-
-	if err := utils.SafeParseAIJSON(text, &result); err != nil {
-		s.log.Errorw("Failed to parse characters JSON", "error", err, "raw_response", text[:minInt(500, len(text))], "task_id", taskID)
-		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "解析AI返回结果失败")
+	var result characterOutput
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "character", DramaID: parseUsageID(req.DramaID)})
+	text, err := s.aiService.GenerateStructured(usageCtx, StructuredRequest{
+		Client:       client,
+		Prompt:       userPrompt,
+		SystemPrompt: systemPrompt,
+		SchemaName:   "characters",
+		Options:      []func(*ai.ChatCompletionRequest){ai.WithTemperature(temperature)},
+		Stream:       stream,
+		PromptI18n:   s.promptI18n,
+	}, &result)
+	if err != nil {
+		s.log.Errorw("Failed to generate characters", "error", err, "raw_response", text[:minInt(500, len(text))], "task_id", taskID)
+		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "AI生成失败: "+err.Error())
 		return
 	}
 
+	s.log.Infow("AI response received for character generation", "length", len(text), "count", len(result.Characters), "task_id", taskID)
+
 	var characters []models.Character
-	for _, char := range result {
+	for _, char := range result.Characters {
 		// 检查角色是否已存在
 		var existingChar models.Character
 		err := s.db.Where("drama_id = ? AND name = ?", req.DramaID, char.Name).First(&existingChar).Error
@@ -191,6 +189,37 @@ func (s *ScriptGenerationService) processCharacterGeneration(taskID string, req
 // GenerateScenesForEpisode 已废弃，使用 StoryboardService.GenerateStoryboard 替代
 // ParseScript 已废弃，使用 GenerateCharacters 替代
 
+// partialCharacters 统计流式生成中已完整输出的角色，供任务进度展示
+func partialCharacters(text string) (interface{}, string) {
+	items := utils.ExtractCompleteArrayItems(text)
+	if len(items) == 0 {
+		return nil, ""
+	}
+
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		var char struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(item), &char); err == nil && char.Name != "" {
+			names = append(names, char.Name)
+		}
+	}
+	return map[string]interface{}{"names": names, "partial": true}, fmt.Sprintf("已生成%d个角色", len(names))
+}
+
+// characterOutput AI返回的角色结构，用于生成结构化输出的 Schema
+type characterOutput struct {
+	Characters []struct {
+		Name        string `json:"name"`
+		Role        string `json:"role"`
+		Description string `json:"description"`
+		Personality string `json:"personality"`
+		Appearance  string `json:"appearance"`
+		VoiceStyle  string `json:"voice_style"`
+	} `json:"characters"`
+}
+
 // minInt 返回两个整数中较小的一个
 func minInt(a, b int) int {
 	if a < b {
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// StaleTaskWatchdog 定期检查长时间停留在 processing 的任务和生成记录。
+// 队列任务未用完执行次数时重新排队，否则标记失败；队列之外的任务直接标记失败。
+// 生成记录若已提交到厂商且没有对应的队列任务，则补建任务恢复轮询，否则标记失败。
+type StaleTaskWatchdog struct {
+	db          *gorm.DB
+	log         *logger.Logger
+	taskService *TaskService
+
+	interval          time.Duration
+	taskTimeout       time.Duration
+	taskTimeouts      map[string]int
+	generationTimeout time.Duration
+
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	running bool
+}
+
+func NewStaleTaskWatchdog(db *gorm.DB, cfg *config.Config, log *logger.Logger) *StaleTaskWatchdog {
+	jobsCfg := cfg.Jobs
+
+	taskTimeout := time.Duration(jobsCfg.StaleTaskTimeout) * time.Second
+	if taskTimeout <= 0 {
+		taskTimeout = time.Hour
+	}
+	generationTimeout := time.Duration(jobsCfg.StaleGenerationTimeout) * time.Second
+	if generationTimeout <= 0 {
+		generationTimeout = time.Hour
+	}
+
+	return &StaleTaskWatchdog{
+		db:                db,
+		log:               log,
+		taskService:       NewTaskService(db, log),
+		interval:          time.Duration(jobsCfg.WatchdogInterval) * time.Second,
+		taskTimeout:       taskTimeout,
+		taskTimeouts:      jobsCfg.StaleTaskTimeouts,
+		generationTimeout: generationTimeout,
+		stop:              make(chan struct{}),
+	}
+}
+
+// Start 启动检查循环，未配置 watchdog_interval 时不启用
+func (w *StaleTaskWatchdog) Start() {
+	if w.running {
+		return
+	}
+	if w.interval <= 0 {
+		w.log.Info("Stale task watchdog disabled")
+		return
+	}
+	w.running = true
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.Check()
+			}
+		}
+	}()
+
+	w.log.Infow("Stale task watchdog started", "interval", w.interval, "task_timeout", w.taskTimeout, "generation_timeout", w.generationTimeout)
+}
+
+// Stop 停止检查循环
+func (w *StaleTaskWatchdog) Stop() {
+	if !w.running {
+		return
+	}
+	close(w.stop)
+	w.wg.Wait()
+	w.running = false
+}
+
+// Check 执行一次检查
+func (w *StaleTaskWatchdog) Check() {
+	w.checkTasks()
+	w.checkImageGenerations()
+	w.checkVideoGenerations()
+}
+
+// taskDeadline 返回任务类型的超时时长，0 表示不检查
+func (w *StaleTaskWatchdog) taskDeadline(taskType string) time.Duration {
+	if seconds, ok := w.taskTimeouts[taskType]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	// 整集制作任务只是等待子任务，执行时长取决于整集的规模，子任务各自受检查，未单独配置时不检查
+	if taskType == JobTypeEpisodeProduction {
+		return 0
+	}
+	return w.taskTimeout
+}
+
+func (w *StaleTaskWatchdog) checkTasks() {
+	var tasks []models.AsyncTask
+	if err := w.db.Select("id", "type", "payload", "attempts", "max_attempts", "started_at", "updated_at").
+		Where("status = ?", models.TaskStatusProcessing).
+		Find(&tasks).Error; err != nil {
+		w.log.Errorw("Failed to load processing tasks", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, task := range tasks {
+		timeout := w.taskDeadline(task.Type)
+		if timeout <= 0 {
+			continue
+		}
+
+		// 队列任务从本次领取时开始计时；队列之外的任务以最近一次进度更新为准
+		since := task.UpdatedAt
+		if task.Payload != "" && task.StartedAt != nil {
+			since = *task.StartedAt
+		}
+		if now.Sub(since) < timeout {
+			continue
+		}
+
+		// 以执行次数为条件，避免误处理期间已被重新领取的任务
+		query := w.db.Model(&models.AsyncTask{}).
+			Where("id = ? AND status = ? AND attempts = ?", task.ID, models.TaskStatusProcessing, task.Attempts)
+
+		requeue := task.Payload != "" && task.Attempts < task.MaxAttempts
+		var updates map[string]interface{}
+		if requeue {
+			updates = map[string]interface{}{
+				"status":           models.TaskStatusPending,
+				"message":          fmt.Sprintf("执行超过%d秒，已重新排队", int(timeout.Seconds())),
+				"lease_owner":      "",
+				"lease_expires_at": nil,
+				"run_after":        nil,
+			}
+		} else {
+			updates = map[string]interface{}{
+				"status":           models.TaskStatusFailed,
+				"error":            ErrTaskTimeout.Error(),
+				"message":          fmt.Sprintf("执行超过%d秒，已标记失败", int(timeout.Seconds())),
+				"completed_at":     &now,
+				"lease_owner":      "",
+				"lease_expires_at": nil,
+			}
+		}
+
+		result := query.Updates(updates)
+		if result.Error != nil {
+			w.log.Errorw("Failed to handle stale task", "task_id", task.ID, "error", result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		interruptRunningTask(task.ID, ErrTaskTimeout)
+		publishTaskEvent(w.db, task.ID)
+		if !requeue {
+			dispatchTaskWebhook(w.db, w.log, task.ID)
+		}
+		w.log.Warnw("Stale task detected", "task_id", task.ID, "type", task.Type, "since", since, "requeued", requeue)
+	}
+}
+
+func (w *StaleTaskWatchdog) checkImageGenerations() {
+	var imageGens []models.ImageGeneration
+	if err := w.db.Select("id", "task_id", "scene_id").
+		Where("status = ? AND updated_at < ?", models.ImageStatusProcessing, time.Now().Add(-w.generationTimeout)).
+		Find(&imageGens).Error; err != nil {
+		w.log.Errorw("Failed to load stale image generations", "error", err)
+		return
+	}
+
+	for _, imageGen := range imageGens {
+		if w.hasActiveJob(JobTypeImageGeneration, imageGen.ID) {
+			continue
+		}
+
+		if imageGen.TaskID != nil && *imageGen.TaskID != "" {
+			if _, err := w.taskService.EnqueueTask(JobTypeImageGeneration, fmt.Sprintf("%d", imageGen.ID), imageGenerationJob{ImageGenID: imageGen.ID}); err != nil {
+				w.log.Errorw("Failed to requeue stale image generation", "id", imageGen.ID, "error", err)
+				continue
+			}
+			w.log.Warnw("Stale image generation requeued for polling", "id", imageGen.ID, "task_id", *imageGen.TaskID)
+			continue
+		}
+
+		result := w.db.Model(&models.ImageGeneration{}).
+			Where("id = ? AND status = ?", imageGen.ID, models.ImageStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":    models.ImageStatusFailed,
+				"error_msg": "生成超时",
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		if imageGen.SceneID != nil {
+			w.db.Model(&models.Scene{}).Where("id = ?", *imageGen.SceneID).Update("status", "failed")
+		}
+		publishImageGenerationEvent(w.db, imageGen.ID)
+		dispatchImageGenerationWebhook(w.db, w.log, imageGen.ID)
+		w.log.Warnw("Stale image generation marked as failed", "id", imageGen.ID)
+	}
+}
+
+func (w *StaleTaskWatchdog) checkVideoGenerations() {
+	var videoGens []models.VideoGeneration
+	if err := w.db.Select("id", "task_id").
+		Where("status = ? AND updated_at < ?", models.VideoStatusProcessing, time.Now().Add(-w.generationTimeout)).
+		Find(&videoGens).Error; err != nil {
+		w.log.Errorw("Failed to load stale video generations", "error", err)
+		return
+	}
+
+	for _, videoGen := range videoGens {
+		if w.hasActiveJob(JobTypeVideoGeneration, videoGen.ID) {
+			continue
+		}
+
+		if videoGen.TaskID != nil && *videoGen.TaskID != "" {
+			if _, err := w.taskService.EnqueueTask(JobTypeVideoGeneration, fmt.Sprintf("%d", videoGen.ID), videoGenerationJob{VideoGenID: videoGen.ID}); err != nil {
+				w.log.Errorw("Failed to requeue stale video generation", "id", videoGen.ID, "error", err)
+				continue
+			}
+			w.log.Warnw("Stale video generation requeued for polling", "id", videoGen.ID, "task_id", *videoGen.TaskID)
+			continue
+		}
+
+		result := w.db.Model(&models.VideoGeneration{}).
+			Where("id = ? AND status = ?", videoGen.ID, models.VideoStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":    models.VideoStatusFailed,
+				"error_msg": "生成超时",
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		publishVideoGenerationEvent(w.db, videoGen.ID)
+		dispatchVideoGenerationWebhook(w.db, w.log, videoGen.ID)
+		w.log.Warnw("Stale video generation marked as failed", "id", videoGen.ID)
+	}
+}
+
+// hasActiveJob 判断生成记录是否仍有排队中或执行中的队列任务
+func (w *StaleTaskWatchdog) hasActiveJob(jobType string, id uint) bool {
+	var count int64
+	w.db.Model(&models.AsyncTask{}).
+		Where("type = ? AND resource_id = ? AND status IN ?", jobType, fmt.Sprintf("%d", id),
+			[]string{models.TaskStatusPending, models.TaskStatusProcessing}).
+		Count(&count)
+	return count > 0
+}
@@ -63,6 +63,8 @@ type SceneCompositionInfo struct {
 	SceneID               *uint                `json:"scene_id"`
 	ComposedImage         *string              `json:"composed_image,omitempty"`
 	VideoURL              *string              `json:"video_url,omitempty"`
+	SelectedImageID       *uint                `json:"selected_image_id,omitempty"`
+	SelectedVideoID       *uint                `json:"selected_video_id,omitempty"`
 	ImageGenerationID     *uint                `json:"image_generation_id,omitempty"`
 	ImageGenerationStatus *string              `json:"image_generation_status,omitempty"`
 	VideoGenerationID     *uint                `json:"video_generation_id,omitempty"`
@@ -124,26 +126,32 @@ func (s *StoryboardCompositionService) GetScenesForEpisode(episodeID string) ([]
 
 	// 获取分镜的合成图片（从 image_generations 表）
 	storyboardIDs := make([]uint, len(storyboards))
+	selectedImageIDs := make(map[uint]uint) // storyboard_id -> selected image_generation id
 	for i, storyboard := range storyboards {
 		storyboardIDs[i] = storyboard.ID
+		if storyboard.SelectedImageID != nil {
+			selectedImageIDs[storyboard.ID] = *storyboard.SelectedImageID
+		}
 	}
 
 	imageGenMap := make(map[uint]string)                      // storyboard_id -> image_url
 	imageGenTaskMap := make(map[uint]*models.ImageGeneration) // storyboard_id -> processing task
 	if len(storyboardIDs) > 0 {
 		var imageGens []models.ImageGeneration
-		// 查询已完成的图片生成记录，每个镜头只取最新的一条
+		// 查询已完成的图片生成记录，每个镜头取选定的一条，未选定时取最新的一条
 		if err := s.db.Where("storyboard_id IN ? AND status = ?", storyboardIDs, models.ImageStatusCompleted).
 			Order("created_at DESC").
 			Find(&imageGens).Error; err == nil {
-			// 为每个镜头保留最新的一条记录
 			for _, ig := range imageGens {
-				if ig.StoryboardID != nil {
-					if _, exists := imageGenMap[*ig.StoryboardID]; !exists {
-						if ig.ImageURL != nil {
-							imageGenMap[*ig.StoryboardID] = *ig.ImageURL
-						}
-					}
+				if ig.StoryboardID == nil || ig.ImageURL == nil {
+					continue
+				}
+				if selectedID, ok := selectedImageIDs[*ig.StoryboardID]; ok && selectedID == ig.ID {
+					imageGenMap[*ig.StoryboardID] = *ig.ImageURL
+					continue
+				}
+				if _, exists := imageGenMap[*ig.StoryboardID]; !exists {
+					imageGenMap[*ig.StoryboardID] = *ig.ImageURL
 				}
 			}
 		}
@@ -205,6 +213,8 @@ func (s *StoryboardCompositionService) GetScenesForEpisode(episodeID string) ([]
 			ImagePrompt:      storyboard.ImagePrompt,
 			VideoPrompt:      storyboard.VideoPrompt,
 			SceneID:          storyboard.SceneID,
+			SelectedImageID:  storyboard.SelectedImageID,
+			SelectedVideoID:  storyboard.SelectedVideoID,
 		}
 
 		// 直接使用关联的角色信息
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"strconv"
 
 	"fmt"
@@ -56,6 +58,11 @@ type Storyboard struct {
 	IsPrimary   bool   `json:"is_primary"`   // 是否主镜
 }
 
+// storyboardOutput AI返回的分镜结构，用于生成结构化输出的 Schema
+type storyboardOutput struct {
+	Storyboards []Storyboard `json:"storyboards"`
+}
+
 type GenerateStoryboardResult struct {
 	Storyboards []Storyboard `json:"storyboards"`
 	Total       int          `json:"total"`
@@ -320,8 +327,12 @@ func (s *StoryboardService) GenerateStoryboard(episodeID string, model string) (
 - 为视频生成AI提供足够的画面构建信息
 - 避免抽象词汇，使用具象的视觉化描述`, systemPrompt, scriptLabel, scriptContent, taskLabel, taskInstruction, charListLabel, characterList, charConstraint, sceneListLabel, sceneList, sceneConstraint)
 
-	// 创建异步任务
-	task, err := s.taskService.CreateTask("storyboard_generation", episodeID)
+	// 创建异步任务，由任务队列调度执行
+	task, err := s.taskService.EnqueueTask(JobTypeStoryboardGenerate, episodeID, storyboardGenerationJob{
+		EpisodeID: episodeID,
+		Model:     model,
+		Prompt:    prompt,
+	})
 	if err != nil {
 		s.log.Errorw("Failed to create task", "error", err)
 		return "", fmt.Errorf("创建任务失败: %w", err)
@@ -337,15 +348,46 @@ func (s *StoryboardService) GenerateStoryboard(episodeID string, model string) (
 		"scene_count", len(scenes),
 		"scenes", sceneList)
 
-	// 启动后台goroutine处理AI调用和后续逻辑
-	go s.processStoryboardGeneration(task.ID, episodeID, model, prompt)
-
 	// 立即返回任务ID
 	return task.ID, nil
 }
 
+// storyboardGenerationJob 分镜生成任务参数
+type storyboardGenerationJob struct {
+	EpisodeID string `json:"episode_id"`
+	Model     string `json:"model"`
+	Prompt    string `json:"prompt"`
+}
+
+// RegisterJobHandlers 注册分镜生成任务处理器
+func (s *StoryboardService) RegisterJobHandlers(q *JobQueue) {
+	q.Register(JobTypeStoryboardGenerate, s.handleStoryboardGenerationJob)
+}
+
+func (s *StoryboardService) handleStoryboardGenerationJob(ctx context.Context, task *models.AsyncTask) error {
+	var job storyboardGenerationJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	s.processStoryboardGeneration(ctx, task.ID, job.EpisodeID, job.Model, job.Prompt)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// processStoryboardGeneration 会自行写入最终状态，仍为 processing 说明中途异常退出
+	current, err := s.taskService.GetTask(task.ID)
+	if err != nil {
+		return err
+	}
+	if current.Status == models.TaskStatusProcessing {
+		return fmt.Errorf("storyboard generation exited unexpectedly")
+	}
+	return nil
+}
+
 // processStoryboardGeneration 后台处理故事板生成
-func (s *StoryboardService) processStoryboardGeneration(taskID, episodeID, model, prompt string) {
+func (s *StoryboardService) processStoryboardGeneration(ctx context.Context, taskID, episodeID, model, prompt string) {
 	// 更新任务状态为处理中
 	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 10, "开始生成分镜头..."); err != nil {
 		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
@@ -354,63 +396,62 @@ func (s *StoryboardService) processStoryboardGeneration(taskID, episodeID, model
 
 	s.log.Infow("Processing storyboard generation", "task_id", taskID, "episode_id", episodeID)
 
-	// 调用AI服务生成（如果指定了模型则使用指定的模型）
-	// 设置较大的max_tokens以确保完整返回所有分镜的JSON
-	var text string
-	var err error
+	// 调用AI服务流式生成（如果指定了模型则使用指定的模型）
+	// 设置较大的max_tokens以确保完整返回所有分镜的JSON；进度按已接收的 token 数推进，
+	// 已完整输出的分镜会写入任务结果供前端逐条展示
+	const maxTokens = 16000
+	stream := newTextStreamProgress(s.taskService, s.log, taskID, 10, 50, maxTokens, "正在生成分镜头")
+	stream.partial = partialStoryboards
+
 	if model != "" {
 		s.log.Infow("Using specified model for storyboard generation", "model", model, "task_id", taskID)
-		client, getErr := s.aiService.GetAIClientForModel("text", model)
-		if getErr != nil {
-			s.log.Warnw("Failed to get client for specified model, using default", "model", model, "error", getErr, "task_id", taskID)
-			text, err = s.aiService.GenerateText(prompt, "", ai.WithMaxTokens(16000))
-		} else {
-			text, err = client.GenerateText(prompt, "", ai.WithMaxTokens(16000))
+	}
+	client, err := s.aiService.GetTextClientForModel(model)
+	if err != nil {
+		s.log.Errorw("Failed to get AI client", "error", err, "task_id", taskID)
+		if updateErr := s.taskService.UpdateTaskError(taskID, fmt.Errorf("生成分镜头失败: %w", err)); updateErr != nil {
+			s.log.Errorw("Failed to update task error", "error", updateErr, "task_id", taskID)
 		}
-	} else {
-		text, err = s.aiService.GenerateText(prompt, "", ai.WithMaxTokens(16000))
+		return
 	}
 
+	// 按 storyboardOutput 的 Schema 要求结构化输出，校验失败会带着错误重新生成一次
+	var output storyboardOutput
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "storyboard", EpisodeID: parseUsageID(episodeID)})
+	text, err := s.aiService.GenerateStructured(usageCtx, StructuredRequest{
+		Client:     client,
+		Prompt:     prompt,
+		SchemaName: "storyboards",
+		Options:    []func(*ai.ChatCompletionRequest){ai.WithMaxTokens(maxTokens)},
+		Stream:     stream,
+		PromptI18n: s.promptI18n,
+	}, &output)
+
 	if err != nil {
-		s.log.Errorw("Failed to generate storyboard", "error", err, "task_id", taskID)
+		if ctx.Err() != nil {
+			// 服务停止或任务取消，不写入失败状态
+			s.log.Infow("Storyboard generation interrupted", "task_id", taskID, "error", err)
+			return
+		}
+		s.log.Errorw("Failed to generate storyboard", "error", err, "response", text[:min(500, len(text))], "task_id", taskID)
 		if updateErr := s.taskService.UpdateTaskError(taskID, fmt.Errorf("生成分镜头失败: %w", err)); updateErr != nil {
 			s.log.Errorw("Failed to update task error", "error", updateErr, "task_id", taskID)
 		}
 		return
 	}
 
+	result := GenerateStoryboardResult{
+		Storyboards: output.Storyboards,
+		Total:       len(output.Storyboards),
+	}
+	s.log.Infow("Parsed storyboard result", "count", result.Total, "task_id", taskID)
+
 	// 更新任务进度
-	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 50, "分镜头生成完成，正在解析结果..."); err != nil {
+	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 50, "分镜头生成完成，正在整理结果..."); err != nil {
 		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
 		return
 	}
 
-	// 解析JSON结果
-	// AI可能返回两种格式：
-	// 1. 数组格式: [{...}, {...}]
-	// 2. 对象格式: {"storyboards": [{...}, {...}]}
-	var result GenerateStoryboardResult
-
-	// 先尝试解析为数组格式
-	var storyboards []Storyboard
-	if err := utils.SafeParseAIJSON(text, &storyboards); err == nil {
-		// 成功解析为数组，包装为对象
-		result.Storyboards = storyboards
-		result.Total = len(storyboards)
-		s.log.Infow("Parsed storyboard as array format", "count", len(storyboards), "task_id", taskID)
-	} else {
-		// 尝试解析为对象格式
-		if err := utils.SafeParseAIJSON(text, &result); err != nil {
-			s.log.Errorw("Failed to parse storyboard JSON in both formats", "error", err, "response", text[:min(500, len(text))], "task_id", taskID)
-			if updateErr := s.taskService.UpdateTaskError(taskID, fmt.Errorf("解析分镜头结果失败: %w", err)); updateErr != nil {
-				s.log.Errorw("Failed to update task error", "error", updateErr, "task_id", taskID)
-			}
-			return
-		}
-		result.Total = len(result.Storyboards)
-		s.log.Infow("Parsed storyboard as object format", "count", len(result.Storyboards), "task_id", taskID)
-	}
-
 	// 计算总时长（所有分镜时长之和）
 	totalDuration := 0
 	for _, sb := range result.Storyboards {
@@ -473,6 +514,29 @@ func (s *StoryboardService) processStoryboardGeneration(taskID, episodeID, model
 	s.log.Infow("Storyboard generation completed", "task_id", taskID, "episode_id", episodeID)
 }
 
+// partialStoryboards 解析流式生成中已完整输出的分镜
+func partialStoryboards(text string) (interface{}, string) {
+	items := utils.ExtractCompleteArrayItems(text)
+	if len(items) == 0 {
+		return nil, ""
+	}
+
+	storyboards := make([]Storyboard, 0, len(items))
+	for _, item := range items {
+		var sb Storyboard
+		if err := json.Unmarshal([]byte(item), &sb); err != nil {
+			continue
+		}
+		storyboards = append(storyboards, sb)
+	}
+	if len(storyboards) == 0 {
+		return nil, ""
+	}
+
+	return gin.H{"storyboards": storyboards, "total": len(storyboards), "partial": true},
+		fmt.Sprintf("已生成%d个镜头", len(storyboards))
+}
+
 // generateImagePrompt 生成专门用于图片生成的提示词（首帧静态画面）
 func (s *StoryboardService) generateImagePrompt(sb Storyboard) string {
 	var parts []string
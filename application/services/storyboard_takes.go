@@ -0,0 +1,221 @@
+package services
+
+import (
+	"errors"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"gorm.io/gorm"
+)
+
+// maxTakeCandidates 一次请求最多生成的候选数量
+const maxTakeCandidates = 4
+
+var (
+	// ErrTakeNotInStoryboard 只能选择属于该分镜的生成记录
+	ErrTakeNotInStoryboard = errors.New("生成记录不属于该分镜")
+	// ErrTakeNotCompleted 只能选择已完成的生成记录
+	ErrTakeNotCompleted = errors.New("只能选择已完成的生成记录")
+)
+
+// takeCandidates 请求的候选数量，限制在 1 到 maxTakeCandidates 之间
+func takeCandidates(candidates int) int {
+	if candidates < 1 {
+		return 1
+	}
+	return min(candidates, maxTakeCandidates)
+}
+
+// candidateSeed 固定 seed 时每个候选使用不同的 seed，否则会得到相同的结果
+func candidateSeed(seed *int64, index int) *int64 {
+	if seed == nil || index == 0 {
+		return seed
+	}
+	value := *seed + int64(index)
+	return &value
+}
+
+// StoryboardTakes 分镜的全部图片和视频候选，以及当前选定的记录
+type StoryboardTakes struct {
+	StoryboardID    uint                     `json:"storyboard_id"`
+	SelectedImageID *uint                    `json:"selected_image_id"`
+	SelectedVideoID *uint                    `json:"selected_video_id"`
+	ImageTakePinned bool                     `json:"image_take_pinned"`
+	VideoTakePinned bool                     `json:"video_take_pinned"`
+	Images          []models.ImageGeneration `json:"images"`
+	Videos          []models.VideoGeneration `json:"videos"`
+}
+
+// GetStoryboardTakes 按生成顺序列出分镜的图片和视频候选
+func (s *StoryboardService) GetStoryboardTakes(storyboardID uint) (*StoryboardTakes, error) {
+	var storyboard models.Storyboard
+	if err := s.db.First(&storyboard, storyboardID).Error; err != nil {
+		return nil, err
+	}
+
+	takes := &StoryboardTakes{
+		StoryboardID:    storyboard.ID,
+		SelectedImageID: storyboard.SelectedImageID,
+		SelectedVideoID: storyboard.SelectedVideoID,
+		ImageTakePinned: storyboard.ImageTakePinned,
+		VideoTakePinned: storyboard.VideoTakePinned,
+		Images:          []models.ImageGeneration{},
+		Videos:          []models.VideoGeneration{},
+	}
+	if err := s.db.Where("storyboard_id = ?", storyboard.ID).Order("created_at ASC").Find(&takes.Images).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("storyboard_id = ?", storyboard.ID).Order("created_at ASC").Find(&takes.Videos).Error; err != nil {
+		return nil, err
+	}
+	return takes, nil
+}
+
+// SelectImageTake 把已完成的图片设为分镜选定的图片，并同步 composed_image
+func (s *StoryboardService) SelectImageTake(storyboardID uint, imageGenID uint) (*models.Storyboard, error) {
+	var storyboard models.Storyboard
+	if err := s.db.First(&storyboard, storyboardID).Error; err != nil {
+		return nil, err
+	}
+	var imageGen models.ImageGeneration
+	if err := s.db.First(&imageGen, imageGenID).Error; err != nil {
+		return nil, err
+	}
+	if imageGen.StoryboardID == nil || *imageGen.StoryboardID != storyboard.ID {
+		return nil, ErrTakeNotInStoryboard
+	}
+	if imageGen.Status != models.ImageStatusCompleted || imageGen.ImageURL == nil {
+		return nil, ErrTakeNotCompleted
+	}
+
+	if err := pinImageTake(s.db, &imageGen); err != nil {
+		return nil, err
+	}
+	s.log.Infow("Storyboard image take selected", "storyboard_id", storyboard.ID, "image_gen_id", imageGen.ID)
+	if err := s.db.First(&storyboard, storyboard.ID).Error; err != nil {
+		return nil, err
+	}
+	return &storyboard, nil
+}
+
+// SelectVideoTake 把已完成的视频设为分镜选定的视频，并同步 video_url 和 duration
+func (s *StoryboardService) SelectVideoTake(storyboardID uint, videoGenID uint) (*models.Storyboard, error) {
+	var storyboard models.Storyboard
+	if err := s.db.First(&storyboard, storyboardID).Error; err != nil {
+		return nil, err
+	}
+	var videoGen models.VideoGeneration
+	if err := s.db.First(&videoGen, videoGenID).Error; err != nil {
+		return nil, err
+	}
+	if videoGen.StoryboardID == nil || *videoGen.StoryboardID != storyboard.ID {
+		return nil, ErrTakeNotInStoryboard
+	}
+	if videoGen.Status != models.VideoStatusCompleted || videoGen.VideoURL == nil {
+		return nil, ErrTakeNotCompleted
+	}
+
+	if err := pinVideoTake(s.db, &videoGen); err != nil {
+		return nil, err
+	}
+	s.log.Infow("Storyboard video take selected", "storyboard_id", storyboard.ID, "video_gen_id", videoGen.ID)
+	if err := s.db.First(&storyboard, storyboard.ID).Error; err != nil {
+		return nil, err
+	}
+	return &storyboard, nil
+}
+
+// pinImageTake 用户手动选定图片：同步 composed_image，之后新完成的图片不再自动替换
+func pinImageTake(db *gorm.DB, imageGen *models.ImageGeneration) error {
+	return db.Model(&models.Storyboard{}).Where("id = ?", *imageGen.StoryboardID).Updates(map[string]interface{}{
+		"selected_image_id": imageGen.ID,
+		"composed_image":    *imageGen.ImageURL,
+		"image_take_pinned": true,
+	}).Error
+}
+
+// pinVideoTake 用户手动选定视频：同步 video_url 和 duration，之后新完成的视频不再自动替换
+func pinVideoTake(db *gorm.DB, videoGen *models.VideoGeneration) error {
+	updates := map[string]interface{}{
+		"selected_video_id": videoGen.ID,
+		"video_url":         *videoGen.VideoURL,
+		"video_take_pinned": true,
+	}
+	if videoGen.Duration != nil {
+		updates["duration"] = *videoGen.Duration
+	}
+	return db.Model(&models.Storyboard{}).Where("id = ?", *videoGen.StoryboardID).Updates(updates).Error
+}
+
+// adoptImageTake 用户没有手动选定过图片时，新完成的图片成为选定的图片（最新完成的优先）；
+// 手动选定后，只有由选定图片编辑、重新生成而来的图片会替换它。返回是否已设为选定
+func adoptImageTake(db *gorm.DB, imageGen *models.ImageGeneration, imageURL string) (bool, error) {
+	query := db.Model(&models.Storyboard{}).Where("id = ?", *imageGen.StoryboardID)
+	var sources []uint
+	for _, id := range []*uint{imageGen.ParentID, imageGen.RegeneratedFromID} {
+		if id != nil {
+			sources = append(sources, *id)
+		}
+	}
+	if len(sources) > 0 {
+		query = query.Where("(image_take_pinned = ? OR selected_image_id IN ?)", false, sources)
+	} else {
+		query = query.Where("image_take_pinned = ?", false)
+	}
+
+	result := query.Updates(map[string]interface{}{
+		"selected_image_id": imageGen.ID,
+		"composed_image":    imageURL,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// adoptVideoTake 用户没有手动选定过视频时，新完成的视频成为选定的视频。返回是否已设为选定
+func adoptVideoTake(db *gorm.DB, videoGen *models.VideoGeneration, videoURL string, duration *int) (bool, error) {
+	updates := map[string]interface{}{
+		"selected_video_id": videoGen.ID,
+		"video_url":         videoURL,
+	}
+	if duration != nil {
+		updates["duration"] = *duration
+	}
+	result := db.Model(&models.Storyboard{}).
+		Where("id = ? AND video_take_pinned = ?", *videoGen.StoryboardID, false).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// selectedImageTake 返回分镜选定的图片，未选定或选定记录已不可用时使用最新完成的图片
+func selectedImageTake(db *gorm.DB, storyboard *models.Storyboard) (*models.ImageGeneration, error) {
+	if storyboard.SelectedImageID != nil {
+		var selected models.ImageGeneration
+		if err := db.Where("id = ? AND storyboard_id = ? AND status = ?", *storyboard.SelectedImageID, storyboard.ID, models.ImageStatusCompleted).
+			First(&selected).Error; err == nil {
+			return &selected, nil
+		}
+	}
+
+	var latest models.ImageGeneration
+	if err := db.Where("storyboard_id = ? AND status = ?", storyboard.ID, models.ImageStatusCompleted).
+		Order("created_at DESC").First(&latest).Error; err != nil {
+		return nil, err
+	}
+	return &latest, nil
+}
+
+// selectedVideoTake 返回分镜选定的视频，未选定或选定记录已不可用时使用最新完成的视频
+func selectedVideoTake(db *gorm.DB, storyboard *models.Storyboard) (*models.VideoGeneration, error) {
+	if storyboard.SelectedVideoID != nil {
+		var selected models.VideoGeneration
+		if err := db.Where("id = ? AND storyboard_id = ? AND status = ?", *storyboard.SelectedVideoID, storyboard.ID, models.VideoStatusCompleted).
+			First(&selected).Error; err == nil {
+			return &selected, nil
+		}
+	}
+
+	var latest models.VideoGeneration
+	if err := db.Where("storyboard_id = ? AND status = ?", storyboard.ID, models.VideoStatusCompleted).
+		Order("created_at DESC").First(&latest).Error; err != nil {
+		return nil, err
+	}
+	return &latest, nil
+}
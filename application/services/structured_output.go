@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// structuredOutputRetries 输出未通过 Schema 校验时，带着错误信息重新请求的次数
+const structuredOutputRetries = 1
+
+// StructuredRequest 结构化输出请求
+type StructuredRequest struct {
+	Client       ai.AIClient // 为空时使用默认文本配置
+	Prompt       string
+	SystemPrompt string
+	SchemaName   string
+	Options      []func(*ai.ChatCompletionRequest)
+	// Stream 非空时流式生成，重新请求前会清空已接收的内容
+	Stream *textStreamProgress
+	// Images 随提示发送的图片（URL 或 data URI），需要模型支持图片输入，不能与 Stream 同时使用
+	Images []string
+	// PromptI18n 用于生成纠错提示
+	PromptI18n *PromptI18n
+}
+
+// GenerateStructured 根据 v 的类型生成 JSON Schema，要求模型按 Schema 输出并校验结果，通过后解析到 v。
+// 校验失败时把错误连同上一次的输出发回模型重新生成一次，仍失败则返回错误。返回最后一次的原始输出。
+func (s *AIService) GenerateStructured(ctx context.Context, req StructuredRequest, v interface{}) (string, error) {
+	client := req.Client
+	if client == nil {
+		var err error
+		client, err = s.GetAIClient("text")
+		if err != nil {
+			return "", fmt.Errorf("failed to get AI client: %w", err)
+		}
+	}
+
+	schema := utils.SchemaFor(v)
+	options := append([]func(*ai.ChatCompletionRequest){ai.WithResponseSchema(req.SchemaName, schema)}, req.Options...)
+
+	prompt := req.Prompt
+	var text string
+	for attempt := 0; ; attempt++ {
+		var err error
+		if req.Stream != nil {
+			if attempt > 0 {
+				req.Stream.Reset()
+			}
+			text, err = client.GenerateTextStream(ctx, prompt, req.SystemPrompt, req.Stream.OnDelta, options...)
+		} else if len(req.Images) > 0 {
+			messages := []ai.ChatMessage{{Role: "user", Content: prompt, Images: req.Images}}
+			if req.SystemPrompt != "" {
+				messages = append([]ai.ChatMessage{{Role: "system", Content: req.SystemPrompt}}, messages...)
+			}
+			text, err = client.Chat(ctx, messages, options...)
+		} else {
+			text, err = client.GenerateText(ctx, prompt, req.SystemPrompt, options...)
+		}
+		if err != nil {
+			return text, err
+		}
+
+		// 清空上一次可能写入了一半的结果
+		target := reflect.ValueOf(v).Elem()
+		target.Set(reflect.Zero(target.Type()))
+
+		validationErr := utils.ParseAIJSONWithSchema(text, schema, v)
+		if validationErr == nil {
+			return text, nil
+		}
+		// 未通过校验的结果不能留在缓存中，否则相同请求会再次得到它
+		if fc, ok := client.(*failoverClient); ok {
+			fc.evictCachedResponse(prompt, req.SystemPrompt, options)
+		}
+		if attempt >= structuredOutputRetries {
+			return text, fmt.Errorf("AI输出不符合格式要求: %w", validationErr)
+		}
+
+		s.log.Warnw("Structured output failed validation, asking model to correct it",
+			"schema", req.SchemaName,
+			"attempt", attempt+1,
+			"error", validationErr)
+		prompt = req.PromptI18n.StructuredRetryPrompt(req.Prompt, text, validationErr)
+	}
+}
+
+// GetTextClientForModel 返回指定模型的文本客户端，未指定模型或没有配置包含该模型时使用默认配置
+func (s *AIService) GetTextClientForModel(model string) (ai.AIClient, error) {
+	if model != "" {
+		client, err := s.GetAIClientForModel("text", model)
+		if err == nil {
+			return client, nil
+		}
+		s.log.Warnw("Failed to get client for specified model, using default", "model", model, "error", err)
+	}
+	return s.GetAIClient("text")
+}
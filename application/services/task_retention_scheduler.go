@@ -0,0 +1,83 @@
+package services
+
+import (
+	"time"
+
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// TaskRetentionScheduler 按 jobs.retention_cron 定时清理过期任务，避免 async_tasks 无限增长
+type TaskRetentionScheduler struct {
+	cron        *cron.Cron
+	taskService *TaskService
+	config      config.JobsConfig
+	log         *logger.Logger
+	running     bool
+}
+
+func NewTaskRetentionScheduler(db *gorm.DB, cfg *config.Config, log *logger.Logger) *TaskRetentionScheduler {
+	return &TaskRetentionScheduler{
+		cron:        cron.New(cron.WithSeconds()),
+		taskService: NewTaskService(db, log),
+		config:      cfg.Jobs,
+		log:         log,
+	}
+}
+
+// Start 启动定时清理，未配置 retention_cron 时不启用
+func (s *TaskRetentionScheduler) Start() error {
+	if s.running {
+		return nil
+	}
+	if s.config.RetentionCron == "" {
+		s.log.Info("Task retention disabled")
+		return nil
+	}
+
+	if _, err := s.cron.AddFunc(s.config.RetentionCron, s.purge); err != nil {
+		return err
+	}
+
+	s.cron.Start()
+	s.running = true
+	s.log.Infow("Task retention scheduler started",
+		"cron", s.config.RetentionCron,
+		"result_retention_days", s.config.ResultRetentionDays,
+		"task_retention_days", s.config.TaskRetentionDays)
+	return nil
+}
+
+// Stop 停止定时清理，等待执行中的清理结束
+func (s *TaskRetentionScheduler) Stop() {
+	if !s.running {
+		return
+	}
+
+	ctx := s.cron.Stop()
+	<-ctx.Done()
+	s.running = false
+	s.log.Info("Task retention scheduler stopped")
+}
+
+func (s *TaskRetentionScheduler) purge() {
+	var resultBefore, deleteBefore time.Time
+	if s.config.ResultRetentionDays > 0 {
+		resultBefore = time.Now().AddDate(0, 0, -s.config.ResultRetentionDays)
+	}
+	if s.config.TaskRetentionDays > 0 {
+		deleteBefore = time.Now().AddDate(0, 0, -s.config.TaskRetentionDays)
+	}
+	if resultBefore.IsZero() && deleteBefore.IsZero() {
+		return
+	}
+
+	cleared, deleted, err := s.taskService.PurgeExpiredTasks(resultBefore, deleteBefore)
+	if err != nil {
+		s.log.Errorw("Task retention cleanup failed", "error", err, "results_cleared", cleared, "tasks_deleted", deleted)
+		return
+	}
+	s.log.Infow("Task retention cleanup completed", "results_cleared", cleared, "tasks_deleted", deleted)
+}
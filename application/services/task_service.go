@@ -1,8 +1,12 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/drama-generator/backend/domain/models"
@@ -11,6 +15,23 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrTaskCancelled 任务被取消时作为 ctx 的取消原因，用于区分服务停止导致的中断
+	ErrTaskCancelled = errors.New("任务已取消")
+	// ErrTaskNotCancellable 任务已结束，无法取消
+	ErrTaskNotCancellable = errors.New("任务已结束，无法取消")
+	// ErrTaskTimeout 任务执行超过看门狗期限
+	ErrTaskTimeout = errors.New("任务执行超时")
+	// errTaskLeaseLost 任务租约已被回收并重新调度，本地执行需中断
+	errTaskLeaseLost = errors.New("任务租约已失效")
+)
+
+// runningTasks 记录本进程内执行中任务的取消函数
+var runningTasks = struct {
+	sync.Mutex
+	cancels map[string]context.CancelCauseFunc
+}{cancels: make(map[string]context.CancelCauseFunc)}
+
 type TaskService struct {
 	db  *gorm.DB
 	log *logger.Logger
@@ -37,10 +58,36 @@ func (s *TaskService) CreateTask(taskType, resourceID string) (*models.AsyncTask
 		return nil, fmt.Errorf("failed to create task: %w", err)
 	}
 
+	publishTaskEvent(s.db, task.ID)
+	return task, nil
+}
+
+// EnqueueTask 创建由任务队列调度执行的任务，payload 会序列化为 JSON 供处理器读取
+func (s *TaskService) EnqueueTask(taskType, resourceID string, payload interface{}) (*models.AsyncTask, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := &models.AsyncTask{
+		ID:         uuid.New().String(),
+		Type:       taskType,
+		Status:     models.TaskStatusPending,
+		Progress:   0,
+		Message:    "任务排队中...",
+		ResourceID: resourceID,
+		Payload:    string(payloadJSON),
+	}
+
+	if err := s.db.Create(task).Error; err != nil {
+		return nil, fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	publishTaskEvent(s.db, task.ID)
 	return task, nil
 }
 
-// UpdateTaskStatus 更新任务状态
+// UpdateTaskStatus 更新任务状态（已取消的任务不再更新，下同）
 func (s *TaskService) UpdateTaskStatus(taskID, status string, progress int, message string) error {
 	updates := map[string]interface{}{
 		"status":     status,
@@ -49,28 +96,85 @@ func (s *TaskService) UpdateTaskStatus(taskID, status string, progress int, mess
 		"updated_at": time.Now(),
 	}
 
-	if status == "completed" || status == "failed" {
+	terminal := status == "completed" || status == "failed"
+	if terminal {
 		now := time.Now()
 		updates["completed_at"] = &now
 	}
 
-	return s.db.Model(&models.AsyncTask{}).
-		Where("id = ?", taskID).
-		Updates(updates).Error
+	result := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status <> ?", taskID, models.TaskStatusCancelled).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	publishTaskEvent(s.db, taskID)
+	if terminal && result.RowsAffected > 0 {
+		dispatchTaskWebhook(s.db, s.log, taskID)
+	}
+	return nil
+}
+
+// UpdateTaskProgress 更新执行中任务的进度，partialResult 不为 nil 时写入 result 供前端展示阶段性结果
+func (s *TaskService) UpdateTaskProgress(taskID string, progress int, message string, partialResult interface{}) error {
+	updates := map[string]interface{}{
+		"progress":   progress,
+		"message":    message,
+		"updated_at": time.Now(),
+	}
+	if partialResult != nil {
+		resultJSON, err := json.Marshal(partialResult)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result: %w", err)
+		}
+		updates["result"] = string(resultJSON)
+	}
+
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status = ?", taskID, models.TaskStatusProcessing).
+		Updates(updates).Error; err != nil {
+		return err
+	}
+
+	publishTaskEvent(s.db, taskID)
+	return nil
 }
 
 // UpdateTaskError 更新任务错误
 func (s *TaskService) UpdateTaskError(taskID string, err error) error {
 	now := time.Now()
-	return s.db.Model(&models.AsyncTask{}).
-		Where("id = ?", taskID).
+	if dbErr := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status <> ?", taskID, models.TaskStatusCancelled).
 		Updates(map[string]interface{}{
 			"status":       "failed",
 			"error":        err.Error(),
+			"error_code":   errorCode(err),
 			"progress":     0,
 			"completed_at": &now,
 			"updated_at":   time.Now(),
-		}).Error
+		}).Error; dbErr != nil {
+		return dbErr
+	}
+
+	publishTaskEvent(s.db, taskID)
+	dispatchTaskWebhook(s.db, s.log, taskID)
+	return nil
+}
+
+// UpdateTaskMessage 只更新执行中任务的状态消息，不改变进度
+func (s *TaskService) UpdateTaskMessage(taskID, message string) error {
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status = ?", taskID, models.TaskStatusProcessing).
+		Updates(map[string]interface{}{
+			"message":    message,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+
+	publishTaskEvent(s.db, taskID)
+	return nil
 }
 
 // UpdateTaskResult 更新任务结果
@@ -81,15 +185,181 @@ func (s *TaskService) UpdateTaskResult(taskID string, result interface{}) error
 	}
 
 	now := time.Now()
-	return s.db.Model(&models.AsyncTask{}).
-		Where("id = ?", taskID).
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status <> ?", taskID, models.TaskStatusCancelled).
 		Updates(map[string]interface{}{
 			"status":       "completed",
 			"progress":     100,
 			"result":       string(resultJSON),
 			"completed_at": &now,
 			"updated_at":   time.Now(),
-		}).Error
+		}).Error; err != nil {
+		return err
+	}
+
+	publishTaskEvent(s.db, taskID)
+	dispatchTaskWebhook(s.db, s.log, taskID)
+	return nil
+}
+
+// CancelTask 取消排队中或执行中的任务。本进程内执行中的任务会立即中断，
+// 其他实例上执行的任务由 JobQueue 心跳检测到取消状态后中断
+func (s *TaskService) CancelTask(taskID string) (*models.AsyncTask, error) {
+	task, err := s.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status IN ?", taskID, []string{models.TaskStatusPending, models.TaskStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":       models.TaskStatusCancelled,
+			"message":      ErrTaskCancelled.Error(),
+			"completed_at": &now,
+			"updated_at":   now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotCancellable
+	}
+
+	cancelRunningTask(taskID)
+	s.cancelJobResource(task)
+	s.log.Infow("Task cancelled", "task_id", taskID, "type", task.Type, "previous_status", task.Status)
+	publishTaskEvent(s.db, taskID)
+
+	return s.GetTask(taskID)
+}
+
+// cancelJobResource 将队列任务关联的生成记录标记为失败，避免记录停留在 pending/processing
+func (s *TaskService) cancelJobResource(task *models.AsyncTask) {
+	if task.Payload == "" {
+		return
+	}
+
+	var model interface{}
+	var id uint
+	switch task.Type {
+	case JobTypeImageGeneration:
+		var job imageGenerationJob
+		if decodeJobPayload(task, &job) != nil {
+			return
+		}
+		model, id = &models.ImageGeneration{}, job.ImageGenID
+	case JobTypeVideoGeneration:
+		var job videoGenerationJob
+		if decodeJobPayload(task, &job) != nil {
+			return
+		}
+		model, id = &models.VideoGeneration{}, job.VideoGenID
+	case JobTypeVideoMerge:
+		var job videoMergeJob
+		if decodeJobPayload(task, &job) != nil {
+			return
+		}
+		model, id = &models.VideoMerge{}, job.MergeID
+	case JobTypePropImageGeneration:
+		// 道具图片任务本身没有生成记录，取消它创建的图片生成记录
+		var job propImageJob
+		if decodeJobPayload(task, &job) != nil {
+			return
+		}
+		var imageGen models.ImageGeneration
+		if err := s.db.Select("id").Where("prop_id = ? AND created_at >= ?", job.PropID, task.CreatedAt).
+			Order("created_at DESC").First(&imageGen).Error; err != nil {
+			return
+		}
+		model, id = &models.ImageGeneration{}, imageGen.ID
+	default:
+		return
+	}
+
+	if err := s.db.Model(model).
+		Where("id = ? AND status IN ?", id, []string{"pending", "processing"}).
+		Updates(map[string]interface{}{
+			"status":    "failed",
+			"error_msg": ErrTaskCancelled.Error(),
+		}).Error; err != nil {
+		s.log.Warnw("Failed to mark cancelled job resource", "task_id", task.ID, "type", task.Type, "error", err)
+		return
+	}
+
+	switch task.Type {
+	case JobTypeImageGeneration:
+		publishImageGenerationEvent(s.db, id)
+	case JobTypePropImageGeneration:
+		publishImageGenerationEvent(s.db, id)
+		s.cancelResourceTasks(JobTypeImageGeneration, fmt.Sprintf("%d", id))
+	case JobTypeVideoGeneration:
+		publishVideoGenerationEvent(s.db, id)
+	}
+}
+
+// cancelResourceTasks 取消资源上排队中或执行中的指定类型任务
+func (s *TaskService) cancelResourceTasks(taskType, resourceID string) {
+	var ids []string
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("type = ? AND resource_id = ? AND status IN ?", taskType, resourceID,
+			[]string{models.TaskStatusPending, models.TaskStatusProcessing}).
+		Pluck("id", &ids).Error; err != nil {
+		s.log.Warnw("Failed to find resource tasks", "type", taskType, "resource_id", resourceID, "error", err)
+		return
+	}
+	for _, id := range ids {
+		if _, err := s.CancelTask(id); err != nil && !errors.Is(err, ErrTaskNotCancellable) {
+			s.log.Warnw("Failed to cancel resource task", "task_id", id, "error", err)
+		}
+	}
+}
+
+// WithTaskContext 为任务创建可取消的 ctx，任务被取消时 ctx 以 ErrTaskCancelled 为原因结束。
+// 任务结束后需调用返回的 release 函数
+func WithTaskContext(parent context.Context, taskID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.WithValue(parent, taskIDKey{}, taskID))
+
+	runningTasks.Lock()
+	runningTasks.cancels[taskID] = cancel
+	runningTasks.Unlock()
+
+	return ctx, func() {
+		runningTasks.Lock()
+		delete(runningTasks.cancels, taskID)
+		runningTasks.Unlock()
+		cancel(nil)
+	}
+}
+
+type taskIDKey struct{}
+
+// taskIDFromContext 返回 WithTaskContext 绑定的任务ID
+func taskIDFromContext(ctx context.Context) string {
+	taskID, _ := ctx.Value(taskIDKey{}).(string)
+	return taskID
+}
+
+// cancelRunningTask 取消本进程内执行中的任务
+func cancelRunningTask(taskID string) bool {
+	return interruptRunningTask(taskID, ErrTaskCancelled)
+}
+
+// interruptRunningTask 以 cause 为原因中断本进程内执行中的任务
+func interruptRunningTask(taskID string, cause error) bool {
+	runningTasks.Lock()
+	cancel, ok := runningTasks.cancels[taskID]
+	runningTasks.Unlock()
+
+	if ok {
+		cancel(cause)
+	}
+	return ok
+}
+
+// isTaskCancelled 判断 ctx 是否因任务被取消而结束
+func isTaskCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrTaskCancelled)
 }
 
 // GetTask 获取任务信息
@@ -101,6 +371,106 @@ func (s *TaskService) GetTask(taskID string) (*models.AsyncTask, error) {
 	return &task, nil
 }
 
+// TaskListQuery 任务列表查询条件
+type TaskListQuery struct {
+	Page          int       `form:"page,default=1"`
+	PageSize      int       `form:"page_size,default=20"`
+	Type          string    `form:"type"`
+	Status        string    `form:"status"` // 多个状态用逗号分隔，如 failed,dead_letter
+	ResourceID    string    `form:"resource_id"`
+	CreatedAfter  time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// ListTasks 按条件分页查询任务，按创建时间倒序
+func (s *TaskService) ListTasks(query *TaskListQuery) ([]models.AsyncTask, int64, error) {
+	db := s.db.Model(&models.AsyncTask{})
+
+	if query.Type != "" {
+		db = db.Where("type = ?", query.Type)
+	}
+	if query.Status != "" {
+		db = db.Where("status IN ?", strings.Split(query.Status, ","))
+	}
+	if query.ResourceID != "" {
+		db = db.Where("resource_id = ?", query.ResourceID)
+	}
+	if !query.CreatedAfter.IsZero() {
+		db = db.Where("created_at >= ?", query.CreatedAfter)
+	}
+	if !query.CreatedBefore.IsZero() {
+		db = db.Where("created_at < ?", query.CreatedBefore)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tasks []models.AsyncTask
+	offset := (query.Page - 1) * query.PageSize
+	if err := db.Order("created_at DESC").
+		Offset(offset).
+		Limit(query.PageSize).
+		Find(&tasks).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return tasks, total, nil
+}
+
+// PurgeExpiredTasks 清理过期任务：清空早于 resultBefore 完成的任务结果，删除早于 deleteBefore 结束的已完成/已取消任务。
+// 零值时间表示跳过对应的清理，返回清空结果和删除的任务数
+func (s *TaskService) PurgeExpiredTasks(resultBefore, deleteBefore time.Time) (int64, int64, error) {
+	var cleared, deleted int64
+
+	if !resultBefore.IsZero() {
+		result := s.db.Model(&models.AsyncTask{}).
+			Where("status = ? AND completed_at < ? AND result <> ''", models.TaskStatusCompleted, resultBefore).
+			Update("result", "")
+		if result.Error != nil {
+			return 0, 0, fmt.Errorf("failed to clear task results: %w", result.Error)
+		}
+		cleared = result.RowsAffected
+	}
+
+	if !deleteBefore.IsZero() {
+		// 流水线父任务还在时保留它的子任务，恢复执行需要读取子任务状态
+		keep, err := pipelineChildTaskIDs(s.db)
+		if err != nil {
+			return cleared, 0, fmt.Errorf("failed to find pipeline child tasks: %w", err)
+		}
+
+		// 分批删除，避免长时间锁表
+		for {
+			var ids []string
+			query := s.db.Unscoped().Model(&models.AsyncTask{}).
+				Where("status IN ? AND completed_at < ?",
+					[]string{models.TaskStatusCompleted, models.TaskStatusCancelled}, deleteBefore)
+			if len(keep) > 0 {
+				query = query.Where("id NOT IN ?", keep)
+			}
+			if err := query.Limit(500).Pluck("id", &ids).Error; err != nil {
+				return cleared, deleted, fmt.Errorf("failed to find expired tasks: %w", err)
+			}
+			if len(ids) == 0 {
+				break
+			}
+
+			result := s.db.Unscoped().Where("id IN ?", ids).Delete(&models.AsyncTask{})
+			if result.Error != nil {
+				return cleared, deleted, fmt.Errorf("failed to delete expired tasks: %w", result.Error)
+			}
+			deleted += result.RowsAffected
+			if len(ids) < 500 {
+				break
+			}
+		}
+	}
+
+	return cleared, deleted, nil
+}
+
 // GetTasksByResource 获取资源相关的所有任务
 func (s *TaskService) GetTasksByResource(resourceID string) ([]*models.AsyncTask, error) {
 	var tasks []*models.AsyncTask
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+// streamProgressInterval 流式生成时写入任务进度的最小间隔，避免每个 token 都写库
+const streamProgressInterval = time.Second
+
+// textStreamProgress 将流式生成已接收的 token 数换算为任务进度（from~to 区间），
+// 并可将已生成的部分文本解析为阶段性结果写入任务
+type textStreamProgress struct {
+	taskService    *TaskService
+	log            *logger.Logger
+	taskID         string
+	from, to       int
+	expectedTokens int
+	label          string
+	// partial 解析已接收的文本，返回 nil 表示暂无可展示的结果
+	partial func(text string) (result interface{}, summary string)
+
+	text       strings.Builder
+	tokens     int
+	lastReport time.Time
+}
+
+func newTextStreamProgress(taskService *TaskService, log *logger.Logger, taskID string, from, to, expectedTokens int, label string) *textStreamProgress {
+	if expectedTokens <= 0 {
+		expectedTokens = 4000
+	}
+	return &textStreamProgress{
+		taskService:    taskService,
+		log:            log,
+		taskID:         taskID,
+		from:           from,
+		to:             to,
+		expectedTokens: expectedTokens,
+		label:          label,
+		lastReport:     time.Now(),
+	}
+}
+
+// OnDelta 作为 ai.StreamHandler 使用。流式接口每个增量通常对应一个 token，以增量数近似 token 数。
+func (p *textStreamProgress) OnDelta(delta string) error {
+	p.text.WriteString(delta)
+	p.tokens++
+
+	if time.Since(p.lastReport) < streamProgressInterval {
+		return nil
+	}
+	p.lastReport = time.Now()
+
+	received := p.tokens
+	if received > p.expectedTokens {
+		received = p.expectedTokens
+	}
+	// 生成结束前不会到达 to，留给后续步骤更新
+	progress := p.from + (p.to-p.from-1)*received/p.expectedTokens
+
+	message := fmt.Sprintf("%s，已接收约%d tokens", p.label, p.tokens)
+	var result interface{}
+	if p.partial != nil {
+		var summary string
+		result, summary = p.partial(p.text.String())
+		if summary != "" {
+			message += "，" + summary
+		}
+	}
+
+	if err := p.taskService.UpdateTaskProgress(p.taskID, progress, message, result); err != nil {
+		p.log.Warnw("Failed to update stream progress", "task_id", p.taskID, "error", err)
+	}
+	return nil
+}
+
+// Reset 清空已接收的文本，用于重新请求时只解析新的输出；token 数继续累计，进度不会回退
+func (p *textStreamProgress) Reset() {
+	p.text.Reset()
+}
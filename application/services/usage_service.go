@@ -0,0 +1,416 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// usageErrorMaxLength 用量记录中错误信息的最大长度
+const usageErrorMaxLength = 1000
+
+var (
+	// ErrInvalidUsageGroupBy 不支持的分组维度
+	ErrInvalidUsageGroupBy = errors.New("不支持的分组维度")
+	// ErrInvalidUsageInterval 不支持的时间粒度
+	ErrInvalidUsageInterval = errors.New("不支持的时间粒度，可选 day、week、month")
+)
+
+// usageGroupColumns 汇总支持的分组维度及对应的列
+var usageGroupColumns = map[string]string{
+	"drama":        "drama_id",
+	"episode":      "episode_id",
+	"storyboard":   "storyboard_id",
+	"provider":     "provider",
+	"config":       "config_id",
+	"model":        "model",
+	"service_type": "service_type",
+	"operation":    "operation",
+}
+
+// UsageScope 调用所属的业务对象，通过 context 传给故障切换逻辑记录到用量表
+type UsageScope struct {
+	Operation    string
+	DramaID      *uint
+	EpisodeID    *uint
+	StoryboardID *uint
+}
+
+type usageScopeKey struct{}
+
+// WithUsageScope 为 ctx 中后续的AI调用标记所属的业务对象
+func WithUsageScope(ctx context.Context, scope UsageScope) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+func usageScopeFrom(ctx context.Context) UsageScope {
+	scope, _ := ctx.Value(usageScopeKey{}).(UsageScope)
+	return scope
+}
+
+// parseUsageID 转换字符串形式的ID，无法解析时返回 nil
+func parseUsageID(id string) *uint {
+	value, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || value == 0 {
+		return nil
+	}
+	result := uint(value)
+	return &result
+}
+
+type UsageQuery struct {
+	DramaID     uint      `form:"drama_id"`
+	EpisodeID   uint      `form:"episode_id"`
+	Provider    string    `form:"provider"`
+	Model       string    `form:"model"`
+	ServiceType string    `form:"service_type"`
+	Operation   string    `form:"operation"`
+	From        time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To          time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+type UsageRecordQuery struct {
+	UsageQuery
+	Page     int   `form:"page,default=1"`
+	PageSize int   `form:"page_size,default=20"`
+	Success  *bool `form:"success"`
+}
+
+// UsageTotals 用量合计
+type UsageTotals struct {
+	Requests         int64   `json:"requests"`
+	Failures         int64   `json:"failures"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Images           int64   `json:"images"`
+	VideoSeconds     int64   `json:"video_seconds"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t *UsageTotals) add(record *models.AIUsageRecord) {
+	t.Requests++
+	if !record.Success {
+		t.Failures++
+	}
+	t.PromptTokens += int64(record.PromptTokens)
+	t.CompletionTokens += int64(record.CompletionTokens)
+	t.TotalTokens += int64(record.TotalTokens)
+	t.Images += int64(record.Images)
+	t.VideoSeconds += int64(record.VideoSeconds)
+	t.Cost += record.Cost
+}
+
+// UsageSummary 按分组维度汇总的用量，只填充分组对应的字段。不同币种分别汇总。
+type UsageSummary struct {
+	DramaID      *uint  `json:"drama_id,omitempty"`
+	EpisodeID    *uint  `json:"episode_id,omitempty"`
+	StoryboardID *uint  `json:"storyboard_id,omitempty"`
+	ConfigID     *uint  `json:"config_id,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	Model        string `json:"model,omitempty"`
+	ServiceType  string `json:"service_type,omitempty"`
+	Operation    string `json:"operation,omitempty"`
+	Currency     string `json:"currency"`
+	UsageTotals
+}
+
+// UsageTimelinePoint 时间段内的用量
+type UsageTimelinePoint struct {
+	Period   string `json:"period"` // 时间段起始日期，月粒度为 2006-01
+	Currency string `json:"currency"`
+	UsageTotals
+}
+
+type UpsertModelPriceRequest struct {
+	Model           string  `json:"model" binding:"required,max=100"`
+	PromptPer1K     float64 `json:"prompt_per_1k" binding:"min=0"`
+	CompletionPer1K float64 `json:"completion_per_1k" binding:"min=0"`
+	PerImage        float64 `json:"per_image" binding:"min=0"`
+	PerVideoSecond  float64 `json:"per_video_second" binding:"min=0"`
+	Currency        string  `json:"currency" binding:"max=10"`
+}
+
+// UsageService 记录每次AI调用的用量和费用，并按剧本、分集、服务商等维度统计
+type UsageService struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+func NewUsageService(db *gorm.DB, log *logger.Logger) *UsageService {
+	return &UsageService{
+		db:  db,
+		log: log,
+	}
+}
+
+// RecordCall 记录一次对服务商的调用，业务对象取自 ctx 中的 UsageScope，费用按当前价格表计算。
+// 记录失败只写日志，不影响调用结果。
+func (s *UsageService) RecordCall(ctx context.Context, config *models.AIServiceConfig, model string, usage ai.Usage, latency time.Duration, callErr error) {
+	scope := usageScopeFrom(ctx)
+	s.resolveScope(&scope)
+
+	record := &models.AIUsageRecord{
+		ConfigID:         &config.ID,
+		ConfigName:       config.Name,
+		Provider:         config.Provider,
+		ServiceType:      config.ServiceType,
+		Model:            model,
+		Operation:        scope.Operation,
+		DramaID:          scope.DramaID,
+		EpisodeID:        scope.EpisodeID,
+		StoryboardID:     scope.StoryboardID,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.PromptTokens + usage.CompletionTokens,
+		Images:           usage.Images,
+		VideoSeconds:     usage.VideoSeconds,
+		LatencyMs:        latency.Milliseconds(),
+		Success:          callErr == nil,
+	}
+	if callErr != nil {
+		record.Error = truncateUsageError(callErr.Error())
+	}
+
+	var price models.AIModelPrice
+	if err := s.db.Where("model = ?", model).First(&price).Error; err == nil {
+		record.Cost = usageCost(&price, record)
+		record.Currency = price.Currency
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.log.Warnw("Failed to load model price", "model", model, "error", err)
+	}
+
+	if err := s.db.Create(record).Error; err != nil {
+		s.log.Errorw("Failed to record AI usage", "error", err, "config_id", config.ID, "model", model)
+	}
+}
+
+// withResolvedScope 补全 ctx 中 UsageScope 所属的分集和剧本，供预算检查和用量记录使用
+func (s *UsageService) withResolvedScope(ctx context.Context) context.Context {
+	scope := usageScopeFrom(ctx)
+	s.resolveScope(&scope)
+	return WithUsageScope(ctx, scope)
+}
+
+// resolveScope 只指定了分镜或分集时补全所属的分集和剧本
+func (s *UsageService) resolveScope(scope *UsageScope) {
+	if scope.StoryboardID != nil && scope.EpisodeID == nil {
+		var storyboard models.Storyboard
+		if err := s.db.Select("id", "episode_id").First(&storyboard, *scope.StoryboardID).Error; err == nil {
+			scope.EpisodeID = &storyboard.EpisodeID
+		}
+	}
+	if scope.EpisodeID != nil && scope.DramaID == nil {
+		var episode models.Episode
+		if err := s.db.Select("id", "drama_id").First(&episode, *scope.EpisodeID).Error; err == nil {
+			scope.DramaID = &episode.DramaID
+		}
+	}
+}
+
+func usageCost(price *models.AIModelPrice, record *models.AIUsageRecord) float64 {
+	return float64(record.PromptTokens)/1000*price.PromptPer1K +
+		float64(record.CompletionTokens)/1000*price.CompletionPer1K +
+		float64(record.Images)*price.PerImage +
+		float64(record.VideoSeconds)*price.PerVideoSecond
+}
+
+func truncateUsageError(msg string) string {
+	if len(msg) > usageErrorMaxLength {
+		return msg[:usageErrorMaxLength] + "..."
+	}
+	return msg
+}
+
+func (s *UsageService) filter(query *UsageQuery) *gorm.DB {
+	db := s.db.Model(&models.AIUsageRecord{})
+	if query.DramaID != 0 {
+		db = db.Where("drama_id = ?", query.DramaID)
+	}
+	if query.EpisodeID != 0 {
+		db = db.Where("episode_id = ?", query.EpisodeID)
+	}
+	if query.Provider != "" {
+		db = db.Where("provider = ?", query.Provider)
+	}
+	if query.Model != "" {
+		db = db.Where("model = ?", query.Model)
+	}
+	if query.ServiceType != "" {
+		db = db.Where("service_type = ?", query.ServiceType)
+	}
+	if query.Operation != "" {
+		db = db.Where("operation = ?", query.Operation)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at < ?", query.To)
+	}
+	return db
+}
+
+// Summary 按 groupBy 维度汇总用量，按费用倒序
+func (s *UsageService) Summary(query *UsageQuery, groupBy string) ([]UsageSummary, error) {
+	column, ok := usageGroupColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidUsageGroupBy, groupBy)
+	}
+
+	summaries := []UsageSummary{}
+	err := s.filter(query).
+		Select(column + ", currency, " +
+			"COUNT(*) AS requests, " +
+			"SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failures, " +
+			"SUM(prompt_tokens) AS prompt_tokens, " +
+			"SUM(completion_tokens) AS completion_tokens, " +
+			"SUM(total_tokens) AS total_tokens, " +
+			"SUM(images) AS images, " +
+			"SUM(video_seconds) AS video_seconds, " +
+			"SUM(cost) AS cost").
+		Group(column + ", currency").
+		Order("cost DESC").
+		Scan(&summaries).Error
+	return summaries, err
+}
+
+// Timeline 按天、周（周一起）或月统计用量，未指定起始时间时统计最近 30 天
+func (s *UsageService) Timeline(query *UsageQuery, interval string) ([]UsageTimelinePoint, error) {
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		return nil, ErrInvalidUsageInterval
+	}
+
+	q := *query
+	if q.From.IsZero() {
+		q.From = time.Now().AddDate(0, 0, -30)
+	}
+
+	// 各数据库的日期函数不同，取出明细后在内存中分桶
+	var records []models.AIUsageRecord
+	if err := s.filter(&q).
+		Select("created_at", "currency", "success", "prompt_tokens", "completion_tokens", "total_tokens", "images", "video_seconds", "cost").
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	points := make(map[string]*UsageTimelinePoint)
+	for i := range records {
+		record := &records[i]
+		period := usagePeriod(record.CreatedAt, interval)
+		key := period + "|" + record.Currency
+		point, ok := points[key]
+		if !ok {
+			point = &UsageTimelinePoint{Period: period, Currency: record.Currency}
+			points[key] = point
+		}
+		point.add(record)
+	}
+
+	timeline := make([]UsageTimelinePoint, 0, len(points))
+	for _, point := range points {
+		timeline = append(timeline, *point)
+	}
+	sort.Slice(timeline, func(i, j int) bool {
+		if timeline[i].Period != timeline[j].Period {
+			return timeline[i].Period < timeline[j].Period
+		}
+		return timeline[i].Currency < timeline[j].Currency
+	})
+	return timeline, nil
+}
+
+func usagePeriod(t time.Time, interval string) string {
+	t = t.Local()
+	switch interval {
+	case "month":
+		return t.Format("2006-01")
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset).Format("2006-01-02")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// ListRecords 分页查询用量明细，按时间倒序
+func (s *UsageService) ListRecords(query *UsageRecordQuery) ([]models.AIUsageRecord, int64, error) {
+	db := s.filter(&query.UsageQuery)
+	if query.Success != nil {
+		db = db.Where("success = ?", *query.Success)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []models.AIUsageRecord
+	if err := db.Order("created_at DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// ListPrices 获取价格表
+func (s *UsageService) ListPrices() ([]models.AIModelPrice, error) {
+	var prices []models.AIModelPrice
+	err := s.db.Order("model ASC").Find(&prices).Error
+	return prices, err
+}
+
+// UpsertPrice 设置模型单价，只影响之后的用量记录
+func (s *UsageService) UpsertPrice(req *UpsertModelPriceRequest) (*models.AIModelPrice, error) {
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = "USD"
+	}
+
+	price := &models.AIModelPrice{
+		Model:           strings.TrimSpace(req.Model),
+		PromptPer1K:     req.PromptPer1K,
+		CompletionPer1K: req.CompletionPer1K,
+		PerImage:        req.PerImage,
+		PerVideoSecond:  req.PerVideoSecond,
+		Currency:        currency,
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "model"}},
+		DoUpdates: clause.AssignmentColumns([]string{"prompt_per_1k", "completion_per_1k", "per_image", "per_video_second", "currency", "updated_at"}),
+	}).Create(price).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Where("model = ?", price.Model).First(price).Error; err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// DeletePrice 删除模型单价
+func (s *UsageService) DeletePrice(priceID uint) error {
+	result := s.db.Delete(&models.AIModelPrice{}, priceID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,6 +12,7 @@ import (
 	models "github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/infrastructure/external/ffmpeg"
 	"github.com/drama-generator/backend/infrastructure/storage"
+	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/logger"
 	"github.com/drama-generator/backend/pkg/utils"
 	"github.com/drama-generator/backend/pkg/video"
@@ -22,22 +25,20 @@ type VideoGenerationService struct {
 	log             *logger.Logger
 	localStorage    *storage.LocalStorage
 	aiService       *AIService
+	taskService     *TaskService
 	ffmpeg          *ffmpeg.FFmpeg
 }
 
 func NewVideoGenerationService(db *gorm.DB, transferService *ResourceTransferService, localStorage *storage.LocalStorage, aiService *AIService, log *logger.Logger) *VideoGenerationService {
-	service := &VideoGenerationService{
+	return &VideoGenerationService{
 		db:              db,
 		localStorage:    localStorage,
 		transferService: transferService,
 		aiService:       aiService,
+		taskService:     NewTaskService(db, log),
 		log:             log,
 		ffmpeg:          ffmpeg.NewFFmpeg(log),
 	}
-
-	go service.RecoverPendingTasks()
-
-	return service
 }
 
 type GenerateVideoRequest struct {
@@ -71,9 +72,19 @@ type GenerateVideoRequest struct {
 	MotionLevel  *int    `json:"motion_level"`
 	CameraMotion *string `json:"camera_motion"`
 	Seed         *int64  `json:"seed"`
+	Candidates   int     `json:"candidates" binding:"omitempty,min=1,max=4"` // 候选数量，一次生成多个供挑选
 }
 
 func (s *VideoGenerationService) GenerateVideo(request *GenerateVideoRequest) (*models.VideoGeneration, error) {
+	videoGens, err := s.GenerateVideoTakes(request)
+	if err != nil {
+		return nil, err
+	}
+	return videoGens[0], nil
+}
+
+// GenerateVideoTakes 按 candidates 创建多条生成记录，每条作为分镜的一个候选
+func (s *VideoGenerationService) GenerateVideoTakes(request *GenerateVideoRequest) ([]*models.VideoGeneration, error) {
 	if request.StoryboardID != nil {
 		var storyboard models.Storyboard
 		if err := s.db.Preload("Episode").Where("id = ?", *request.StoryboardID).First(&storyboard).Error; err != nil {
@@ -97,6 +108,10 @@ func (s *VideoGenerationService) GenerateVideo(request *GenerateVideoRequest) (*
 	}
 
 	dramaID, _ := strconv.ParseUint(request.DramaID, 10, 32)
+	budgetDramaID := uint(dramaID)
+	if _, err := NewUsageService(s.db, s.log).CheckBudget(&budgetDramaID); err != nil {
+		return nil, err
+	}
 
 	videoGen := &models.VideoGeneration{
 		StoryboardID: request.StoryboardID,
@@ -173,30 +188,128 @@ func (s *VideoGenerationService) GenerateVideo(request *GenerateVideoRequest) (*
 		}
 	}
 
-	if err := s.db.Create(videoGen).Error; err != nil {
-		return nil, fmt.Errorf("failed to create record: %w", err)
+	var videoGens []*models.VideoGeneration
+	for i := 0; i < takeCandidates(request.Candidates); i++ {
+		take := *videoGen
+		take.Seed = candidateSeed(request.Seed, i)
+		if err := s.db.Create(&take).Error; err != nil {
+			return nil, fmt.Errorf("failed to create record: %w", err)
+		}
+
+		if _, err := s.taskService.EnqueueTask(JobTypeVideoGeneration, fmt.Sprintf("%d", take.ID), videoGenerationJob{VideoGenID: take.ID}); err != nil {
+			s.updateVideoGenError(take.ID, err.Error())
+			return nil, err
+		}
+		videoGens = append(videoGens, &take)
+	}
+
+	return videoGens, nil
+}
+
+// RetryVideoGeneration 使用记录中保存的参数重新生成失败的视频
+func (s *VideoGenerationService) RetryVideoGeneration(videoGenID uint) (*models.VideoGeneration, error) {
+	var videoGen models.VideoGeneration
+	if err := s.db.First(&videoGen, videoGenID).Error; err != nil {
+		return nil, err
+	}
+	if videoGen.Status != models.VideoStatusFailed {
+		return nil, ErrGenerationNotFailed
 	}
 
-	go s.ProcessVideoGeneration(videoGen.ID)
+	if err := s.db.Model(&videoGen).Updates(map[string]interface{}{
+		"status":       models.VideoStatusPending,
+		"task_id":      nil,
+		"error_msg":    nil,
+		"completed_at": nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to reset record: %w", err)
+	}
+	publishVideoGenerationEvent(s.db, videoGen.ID)
+
+	if _, err := s.taskService.EnqueueTask(JobTypeVideoGeneration, fmt.Sprintf("%d", videoGen.ID), videoGenerationJob{VideoGenID: videoGen.ID}); err != nil {
+		s.updateVideoGenError(videoGen.ID, err.Error())
+		return nil, err
+	}
 
-	return videoGen, nil
+	s.log.Infow("Video generation retry queued", "id", videoGen.ID)
+	return s.GetVideoGeneration(videoGen.ID)
 }
 
-func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
+// videoGenerationJob 视频生成任务参数
+type videoGenerationJob struct {
+	VideoGenID uint `json:"video_gen_id"`
+}
+
+// RegisterJobHandlers 注册视频生成任务处理器，并为队列之外遗留的进行中任务补建队列任务
+func (s *VideoGenerationService) RegisterJobHandlers(q *JobQueue) {
+	q.Register(JobTypeVideoGeneration, s.handleVideoGenerationJob)
+	s.RecoverPendingTasks()
+}
+
+// handleVideoGenerationJob 执行视频生成任务。已提交到厂商的任务只恢复轮询，避免重复提交和重复计费。
+func (s *VideoGenerationService) handleVideoGenerationJob(ctx context.Context, task *models.AsyncTask) error {
+	var job videoGenerationJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	var videoGen models.VideoGeneration
+	if err := s.db.First(&videoGen, job.VideoGenID).Error; err != nil {
+		return fmt.Errorf("video generation not found: %w", err)
+	}
+
+	switch {
+	case videoGen.Status == models.VideoStatusCompleted || videoGen.Status == models.VideoStatusFailed:
+		s.log.Infow("Video generation already finished, skipping job", "id", videoGen.ID, "status", videoGen.Status)
+	case videoGen.Status == models.VideoStatusProcessing && videoGen.TaskID != nil && *videoGen.TaskID != "":
+		s.log.Infow("Resuming video generation polling", "id", videoGen.ID, "task_id", *videoGen.TaskID)
+		client, err := s.videoClientForRecord(&videoGen)
+		if err != nil {
+			s.log.Errorw("Failed to get video client for polling", "error", err)
+			s.updateVideoGenError(videoGen.ID, "failed to get video client")
+			break
+		}
+		s.pollTaskStatus(ctx, videoGen.ID, client, *videoGen.TaskID)
+	default:
+		if err := s.ProcessVideoGeneration(ctx, videoGen.ID); err != nil {
+			if canRetry(task, err) {
+				s.log.Warnw("Video generation hit transient error, waiting for retry", "id", videoGen.ID, "attempt", task.Attempts, "error", err)
+				s.db.Model(&models.VideoGeneration{}).Where("id = ?", videoGen.ID).Update("status", models.VideoStatusPending)
+				publishVideoGenerationEvent(s.db, videoGen.ID)
+			} else {
+				s.updateVideoGenError(videoGen.ID, err.Error())
+			}
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err := s.db.First(&videoGen, job.VideoGenID).Error; err != nil {
+		return err
+	}
+	if videoGen.Status == models.VideoStatusFailed {
+		if videoGen.ErrorMsg != nil {
+			return errors.New(*videoGen.ErrorMsg)
+		}
+		return errors.New("video generation failed")
+	}
+	return nil
+}
+
+// ProcessVideoGeneration 提交视频生成并等待结果。提交时遇到临时错误（超时、429、5xx）
+// 不标记失败而是返回错误，由调用方决定重试或放弃；其他错误直接写入记录。
+func (s *VideoGenerationService) ProcessVideoGeneration(ctx context.Context, videoGenID uint) error {
 	var videoGen models.VideoGeneration
 	if err := s.db.First(&videoGen, videoGenID).Error; err != nil {
 		s.log.Errorw("Failed to load video generation", "error", err, "id", videoGenID)
-		return
+		return nil
 	}
 
 	s.db.Model(&videoGen).Update("status", models.VideoStatusProcessing)
-
-	client, err := s.getVideoClient(videoGen.Provider, videoGen.Model)
-	if err != nil {
-		s.log.Errorw("Failed to get video client", "error", err, "provider", videoGen.Provider, "model", videoGen.Model)
-		s.updateVideoGenError(videoGenID, err.Error())
-		return
-	}
+	publishVideoGenerationEvent(s.db, videoGenID)
 
 	s.log.Infow("Starting video generation", "id", videoGenID, "prompt", videoGen.Prompt, "provider", videoGen.Provider)
 
@@ -283,43 +396,89 @@ func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
 		}
 	}
 
-	result, err := client.GenerateVideo(imageURL, videoGen.Prompt, opts...)
+	// 按优先级在视频配置间故障切换，记住实际提交任务的客户端用于轮询
+	var client video.VideoClient
+	var result *video.VideoResult
+	// 视频客户端不上报用量，提交成功按请求的时长计，同步返回结果时使用实际时长
+	usageCtx := WithUsageScope(ctx, UsageScope{Operation: "video", DramaID: &videoGen.DramaID, StoryboardID: videoGen.StoryboardID})
+	servedBy, err := s.aiService.RunWithFailover(usageCtx, "video", videoGen.Model, func(ctx context.Context, config *models.AIServiceConfig) error {
+		model := configModel(config, videoGen.Model)
+		var clientErr error
+		client, clientErr = newVideoClient(config, videoGen.Provider, model)
+		if clientErr != nil {
+			return clientErr
+		}
+		// 按模型能力调整或拒绝不支持的参数
+		callOpts, notes, capErr := adaptVideoOptions(config, model, imageURL, opts)
+		if capErr != nil {
+			return capErr
+		}
+		if len(notes) > 0 {
+			s.log.Warnw("Video options adapted to model capabilities", "id", videoGenID, "config_id", config.ID, "model", model, "changes", notes)
+		}
+		var genErr error
+		result, genErr = client.GenerateVideo(ctx, imageURL, videoGen.Prompt, callOpts...)
+		if genErr == nil {
+			seconds := result.Duration
+			if seconds == 0 {
+				requested := &video.VideoOptions{}
+				for _, opt := range callOpts {
+					opt(requested)
+				}
+				seconds = requested.Duration
+			}
+			ai.ReportUsage(ctx, ai.Usage{VideoSeconds: seconds})
+		}
+		return genErr
+	})
 	if err != nil {
+		if ctx.Err() != nil {
+			// 服务停止时保留记录状态以便恢复；任务取消时记录已由 CancelTask 标记
+			s.log.Infow("Video generation interrupted", "id", videoGenID, "error", err)
+			return nil
+		}
 		s.log.Errorw("Video generation API call failed", "error", err, "id", videoGenID)
+		if utils.IsTransientError(err) {
+			return err
+		}
 		s.updateVideoGenError(videoGenID, err.Error())
-		return
+		if errors.Is(err, ErrBudgetExceeded) {
+			// 预算用尽时任务同样失败，并带上 BUDGET_EXCEEDED 错误码
+			return err
+		}
+		return nil
 	}
 
 	if result.TaskID != "" {
 		s.db.Model(&videoGen).Updates(map[string]interface{}{
-			"task_id": result.TaskID,
-			"status":  models.VideoStatusProcessing,
+			"task_id":      result.TaskID,
+			"status":       models.VideoStatusProcessing,
+			"ai_config_id": servedBy.ID,
 		})
-		go s.pollTaskStatus(videoGenID, result.TaskID, videoGen.Provider, videoGen.Model)
-		return
+		publishVideoGenerationEvent(s.db, videoGenID)
+		s.pollTaskStatus(ctx, videoGenID, client, result.TaskID)
+		return nil
 	}
 
 	if result.VideoURL != "" {
 		s.completeVideoGeneration(videoGenID, result.VideoURL, &result.Duration, &result.Width, &result.Height, nil)
-		return
+		return nil
 	}
 
 	s.updateVideoGenError(videoGenID, "no task ID or video URL returned")
+	return nil
 }
 
-func (s *VideoGenerationService) pollTaskStatus(videoGenID uint, taskID string, provider string, model string) {
-	client, err := s.getVideoClient(provider, model)
-	if err != nil {
-		s.log.Errorw("Failed to get video client for polling", "error", err)
-		s.updateVideoGenError(videoGenID, "failed to get video client")
-		return
-	}
-
+// pollTaskStatus 轮询异步视频任务，ctx 取消时直接返回，保留 processing 状态以便重启后恢复
+func (s *VideoGenerationService) pollTaskStatus(ctx context.Context, videoGenID uint, client video.VideoClient, taskID string) {
 	maxAttempts := 300
 	interval := 10 * time.Second
 
 	for attempt := 0; attempt < maxAttempts; attempt++ {
-		time.Sleep(interval)
+		if !sleepContext(ctx, interval) {
+			s.log.Infow("Video polling interrupted", "id", videoGenID, "task_id", taskID)
+			return
+		}
 
 		var videoGen models.VideoGeneration
 		if err := s.db.First(&videoGen, videoGenID).Error; err != nil {
@@ -332,7 +491,7 @@ func (s *VideoGenerationService) pollTaskStatus(videoGenID uint, taskID string,
 			return
 		}
 
-		result, err := client.GetTaskStatus(taskID)
+		result, err := client.GetTaskStatus(ctx, taskID)
 		if err != nil {
 			s.log.Errorw("Failed to get task status", "error", err, "task_id", taskID)
 			continue
@@ -455,22 +614,18 @@ func (s *VideoGenerationService) completeVideoGeneration(videoGenID uint, videoU
 	var videoGen models.VideoGeneration
 	if err := s.db.First(&videoGen, videoGenID).Error; err == nil {
 		if videoGen.StoryboardID != nil {
-			// 更新 Storyboard 的 video_url 和 duration
-			storyboardUpdates := map[string]interface{}{
-				"video_url": videoURL,
-			}
-			if duration != nil {
-				storyboardUpdates["duration"] = *duration
-			}
-			if err := s.db.Model(&models.Storyboard{}).Where("id = ?", *videoGen.StoryboardID).Updates(storyboardUpdates).Error; err != nil {
+			// 成为选定的视频时更新 Storyboard 的 video_url 和 duration
+			if adopted, err := adoptVideoTake(s.db, &videoGen, videoURL, duration); err != nil {
 				s.log.Warnw("Failed to update storyboard", "storyboard_id", *videoGen.StoryboardID, "error", err)
-			} else {
+			} else if adopted {
 				s.log.Infow("Updated storyboard with video info", "storyboard_id", *videoGen.StoryboardID, "duration", duration)
 			}
 		}
 	}
 
 	s.log.Infow("Video generation completed", "id", videoGenID, "url", videoURL, "duration", duration)
+	publishVideoGenerationEvent(s.db, videoGenID)
+	dispatchVideoGenerationWebhook(s.db, s.log, videoGenID)
 }
 
 func (s *VideoGenerationService) updateVideoGenError(videoGenID uint, errorMsg string) {
@@ -479,7 +634,10 @@ func (s *VideoGenerationService) updateVideoGenError(videoGenID uint, errorMsg s
 		"error_msg": errorMsg,
 	}).Error; err != nil {
 		s.log.Errorw("Failed to update video generation error", "error", err, "id", videoGenID)
+		return
 	}
+	publishVideoGenerationEvent(s.db, videoGenID)
+	dispatchVideoGenerationWebhook(s.db, s.log, videoGenID)
 }
 
 func (s *VideoGenerationService) getVideoClient(provider string, modelName string) (video.VideoClient, error) {
@@ -503,41 +661,66 @@ func (s *VideoGenerationService) getVideoClient(provider string, modelName strin
 		}
 	}
 
-	// 使用配置中的信息创建客户端
-	baseURL := config.BaseURL
-	apiKey := config.APIKey
 	model := modelName
 	if model == "" && len(config.Model) > 0 {
 		model = config.Model[0]
 	}
 
-	// 根据配置中的 provider 创建对应的客户端
+	return newVideoClient(config, provider, model)
+}
+
+// videoClientForRecord 获取轮询异步任务用的客户端：优先使用实际提交任务的配置
+func (s *VideoGenerationService) videoClientForRecord(videoGen *models.VideoGeneration) (video.VideoClient, error) {
+	if videoGen.AIConfigID != nil {
+		config, err := s.aiService.GetConfig(*videoGen.AIConfigID)
+		if err == nil {
+			return newVideoClient(config, videoGen.Provider, configModel(config, videoGen.Model))
+		}
+		s.log.Warnw("AI config of video generation not found, using model config", "id", videoGen.ID, "config_id", *videoGen.AIConfigID, "error", err)
+	}
+	return s.getVideoClient(videoGen.Provider, videoGen.Model)
+}
+
+// newVideoClient 根据配置中的 provider 创建视频客户端
+func newVideoClient(config *models.AIServiceConfig, provider string, model string) (video.VideoClient, error) {
+	baseURL := config.BaseURL
+	apiKey, err := configAPIKey(config)
+	if err != nil {
+		return nil, err
+	}
+
 	var endpoint string
 	var queryEndpoint string
 
+	var client video.VideoClient
 	switch config.Provider {
 	case "chatfire":
 		endpoint = "/video/generations"
 		queryEndpoint = "/video/task/{taskId}"
-		return video.NewChatfireClient(baseURL, apiKey, model, endpoint, queryEndpoint), nil
+		client = video.NewChatfireClient(baseURL, apiKey, model, endpoint, queryEndpoint)
 	case "doubao", "volcengine", "volces":
 		endpoint = "/contents/generations/tasks"
 		queryEndpoint = "/contents/generations/tasks/{taskId}"
-		return video.NewVolcesArkClient(baseURL, apiKey, model, endpoint, queryEndpoint), nil
+		client = video.NewVolcesArkClient(baseURL, apiKey, model, endpoint, queryEndpoint)
 	case "openai":
 		// OpenAI Sora 使用 /v1/videos 端点
-		return video.NewOpenAISoraClient(baseURL, apiKey, model), nil
+		client = video.NewOpenAISoraClient(baseURL, apiKey, model)
 	case "runway":
-		return video.NewRunwayClient(baseURL, apiKey, model), nil
+		client = video.NewRunwayClient(baseURL, apiKey, model)
 	case "pika":
-		return video.NewPikaClient(baseURL, apiKey, model), nil
+		client = video.NewPikaClient(baseURL, apiKey, model)
 	case "minimax":
-		return video.NewMinimaxClient(baseURL, apiKey, model), nil
+		client = video.NewMinimaxClient(baseURL, apiKey, model)
+	case MockProvider:
+		outputDir, outputURL := mockStorage()
+		client = video.NewMockClient(model, outputDir, outputURL, utils.ParseMockSettings(config.Settings))
 	default:
 		return nil, fmt.Errorf("unsupported video provider: %s", provider)
 	}
+	return withVideoRateLimit(config, client), nil
 }
 
+// RecoverPendingTasks 为没有对应队列任务的进行中视频补建任务（如升级前提交的任务），由队列恢复轮询
 func (s *VideoGenerationService) RecoverPendingTasks() {
 	var pendingVideos []models.VideoGeneration
 	if err := s.db.Where("status = ? AND task_id != ''", models.VideoStatusProcessing).Find(&pendingVideos).Error; err != nil {
@@ -545,11 +728,26 @@ func (s *VideoGenerationService) RecoverPendingTasks() {
 		return
 	}
 
-	s.log.Infow("Recovering pending video generation tasks", "count", len(pendingVideos))
-
+	recovered := 0
 	for _, videoGen := range pendingVideos {
-		go s.pollTaskStatus(videoGen.ID, *videoGen.TaskID, videoGen.Provider, videoGen.Model)
+		resourceID := fmt.Sprintf("%d", videoGen.ID)
+		var count int64
+		s.db.Model(&models.AsyncTask{}).
+			Where("type = ? AND resource_id = ? AND status IN ?", JobTypeVideoGeneration, resourceID,
+				[]string{models.TaskStatusPending, models.TaskStatusProcessing}).
+			Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		if _, err := s.taskService.EnqueueTask(JobTypeVideoGeneration, resourceID, videoGenerationJob{VideoGenID: videoGen.ID}); err != nil {
+			s.log.Errorw("Failed to enqueue pending video task", "error", err, "id", videoGen.ID)
+			continue
+		}
+		recovered++
 	}
+
+	s.log.Infow("Recovering pending video generation tasks", "count", recovered)
 }
 
 func (s *VideoGenerationService) GetVideoGeneration(id uint) (*models.VideoGeneration, error) {
@@ -627,6 +825,10 @@ func (s *VideoGenerationService) BatchGenerateVideosForEpisode(episodeID string)
 	if err := s.db.Preload("Storyboards").Where("id = ?", episodeID).First(&episode).Error; err != nil {
 		return nil, fmt.Errorf("episode not found")
 	}
+	// 预算已用尽时整批拒绝，避免逐条创建失败记录
+	if _, err := NewUsageService(s.db, s.log).CheckBudget(&episode.DramaID); err != nil {
+		return nil, err
+	}
 
 	var results []*models.VideoGeneration
 	for _, storyboard := range episode.Storyboards {
@@ -634,9 +836,9 @@ func (s *VideoGenerationService) BatchGenerateVideosForEpisode(episodeID string)
 			continue
 		}
 
-		var imageGen models.ImageGeneration
-		if err := s.db.Where("storyboard_id = ? AND status = ?", storyboard.ID, models.ImageStatusCompleted).
-			Order("created_at DESC").First(&imageGen).Error; err != nil {
+		// 使用分镜选定的图片
+		imageGen, err := selectedImageTake(s.db, &storyboard)
+		if err != nil {
 			s.log.Warnw("No completed image for storyboard", "storyboard_id", storyboard.ID)
 			continue
 		}
@@ -654,7 +856,12 @@ func (s *VideoGenerationService) BatchGenerateVideosForEpisode(episodeID string)
 }
 
 func (s *VideoGenerationService) DeleteVideoGeneration(id uint) error {
-	return s.db.Delete(&models.VideoGeneration{}, id).Error
+	if err := s.db.Delete(&models.VideoGeneration{}, id).Error; err != nil {
+		return err
+	}
+	// 删除的是选定的视频时取消选定，下一个完成的视频会重新成为选定
+	return s.db.Model(&models.Storyboard{}).Where("selected_video_id = ?", id).
+		Updates(map[string]interface{}{"selected_video_id": nil, "video_take_pinned": false}).Error
 }
 
 // convertImageToBase64 将图片转换为base64格式
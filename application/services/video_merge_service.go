@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,6 +21,7 @@ import (
 type VideoMergeService struct {
 	db              *gorm.DB
 	aiService       *AIService
+	taskService     *TaskService
 	transferService *ResourceTransferService
 	ffmpeg          *ffmpeg.FFmpeg
 	storagePath     string
@@ -30,6 +33,7 @@ func NewVideoMergeService(db *gorm.DB, transferService *ResourceTransferService,
 	return &VideoMergeService{
 		db:              db,
 		aiService:       NewAIService(db, log),
+		taskService:     NewTaskService(db, log),
 		transferService: transferService,
 		ffmpeg:          ffmpeg.NewFFmpeg(log),
 		storagePath:     storagePath,
@@ -93,12 +97,66 @@ func (s *VideoMergeService) MergeVideos(req *MergeVideoRequest) (*models.VideoMe
 		return nil, fmt.Errorf("failed to create merge record: %w", err)
 	}
 
-	go s.processMergeVideo(videoMerge.ID)
+	if _, err := s.taskService.EnqueueTask(JobTypeVideoMerge, fmt.Sprintf("%d", videoMerge.ID), videoMergeJob{MergeID: videoMerge.ID}); err != nil {
+		s.updateMergeError(videoMerge.ID, err.Error())
+		return nil, err
+	}
 
 	return videoMerge, nil
 }
 
-func (s *VideoMergeService) processMergeVideo(mergeID uint) {
+// videoMergeJob 视频合成任务参数
+type videoMergeJob struct {
+	MergeID uint `json:"merge_id"`
+}
+
+// RegisterJobHandlers 注册视频合成任务处理器
+func (s *VideoMergeService) RegisterJobHandlers(q *JobQueue) {
+	q.Register(JobTypeVideoMerge, s.handleVideoMergeJob)
+}
+
+func (s *VideoMergeService) handleVideoMergeJob(ctx context.Context, task *models.AsyncTask) error {
+	var job videoMergeJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	var videoMerge models.VideoMerge
+	if err := s.db.First(&videoMerge, job.MergeID).Error; err != nil {
+		return fmt.Errorf("video merge not found: %w", err)
+	}
+
+	switch {
+	case videoMerge.Status == models.VideoMergeStatusCompleted || videoMerge.Status == models.VideoMergeStatusFailed:
+		s.log.Infow("Video merge already finished, skipping job", "id", videoMerge.ID, "status", videoMerge.Status)
+	case videoMerge.Status == models.VideoMergeStatusProcessing && videoMerge.TaskID != nil && *videoMerge.TaskID != "":
+		client, err := s.getVideoClient(videoMerge.Provider)
+		if err != nil {
+			s.updateMergeError(videoMerge.ID, err.Error())
+			break
+		}
+		s.pollMergeStatus(ctx, videoMerge.ID, client, *videoMerge.TaskID)
+	default:
+		s.processMergeVideo(ctx, videoMerge.ID)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err := s.db.First(&videoMerge, job.MergeID).Error; err != nil {
+		return err
+	}
+	if videoMerge.Status == models.VideoMergeStatusFailed {
+		if videoMerge.ErrorMsg != nil {
+			return errors.New(*videoMerge.ErrorMsg)
+		}
+		return errors.New("video merge failed")
+	}
+	return nil
+}
+
+func (s *VideoMergeService) processMergeVideo(ctx context.Context, mergeID uint) {
 	var videoMerge models.VideoMerge
 	if err := s.db.First(&videoMerge, mergeID).Error; err != nil {
 		s.log.Errorw("Failed to load video merge", "error", err, "id", mergeID)
@@ -120,8 +178,12 @@ func (s *VideoMergeService) processMergeVideo(mergeID uint) {
 		return
 	}
 
-	// 调用视频合并API
-	result, err := s.mergeVideoClips(client, scenes)
+	// 调用视频合并API，任务取消时 ffmpeg 进程随 ctx 结束
+	result, err := s.mergeVideoClips(ctx, client, scenes)
+	if isTaskCancelled(ctx) {
+		s.log.Infow("Video merge cancelled", "id", mergeID)
+		return
+	}
 	if err != nil {
 		s.updateMergeError(mergeID, err.Error())
 		return
@@ -132,14 +194,14 @@ func (s *VideoMergeService) processMergeVideo(mergeID uint) {
 			"status":  models.VideoMergeStatusProcessing,
 			"task_id": result.TaskID,
 		})
-		go s.pollMergeStatus(mergeID, client, result.TaskID)
+		s.pollMergeStatus(ctx, mergeID, client, result.TaskID)
 		return
 	}
 
 	s.completeMerge(mergeID, result)
 }
 
-func (s *VideoMergeService) mergeVideoClips(client video.VideoClient, scenes []models.SceneClip) (*video.VideoResult, error) {
+func (s *VideoMergeService) mergeVideoClips(ctx context.Context, client video.VideoClient, scenes []models.SceneClip) (*video.VideoResult, error) {
 	if len(scenes) == 0 {
 		return nil, fmt.Errorf("no scenes to merge")
 	}
@@ -193,7 +255,7 @@ func (s *VideoMergeService) mergeVideoClips(client video.VideoClient, scenes []m
 	outputPath := filepath.Join(videoDir, fileName)
 
 	// 使用FFmpeg合成视频
-	mergedPath, err := s.ffmpeg.MergeVideos(&ffmpeg.MergeOptions{
+	mergedPath, err := s.ffmpeg.MergeVideos(ctx, &ffmpeg.MergeOptions{
 		OutputPath: outputPath,
 		Clips:      clips,
 	})
@@ -216,14 +278,16 @@ func (s *VideoMergeService) mergeVideoClips(client video.VideoClient, scenes []m
 	return result, nil
 }
 
-func (s *VideoMergeService) pollMergeStatus(mergeID uint, client video.VideoClient, taskID string) {
+func (s *VideoMergeService) pollMergeStatus(ctx context.Context, mergeID uint, client video.VideoClient, taskID string) {
 	maxAttempts := 240
 	pollInterval := 5 * time.Second
 
 	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(pollInterval)
+		if !sleepContext(ctx, pollInterval) {
+			return
+		}
 
-		result, err := client.GetTaskStatus(taskID)
+		result, err := client.GetTaskStatus(ctx, taskID)
 		if err != nil {
 			s.log.Errorw("Failed to get merge task status", "error", err, "task_id", taskID)
 			continue
@@ -280,6 +344,7 @@ func (s *VideoMergeService) completeMerge(mergeID uint, result *video.VideoResul
 	}
 
 	s.log.Infow("Video merge completed", "id", mergeID, "url", finalVideoURL)
+	dispatchVideoMergeWebhook(s.db, s.log, mergeID)
 }
 
 func (s *VideoMergeService) updateMergeError(mergeID uint, errorMsg string) {
@@ -288,6 +353,7 @@ func (s *VideoMergeService) updateMergeError(mergeID uint, errorMsg string) {
 		"error_msg": errorMsg,
 	})
 	s.log.Errorw("Video merge failed", "id", mergeID, "error", errorMsg)
+	dispatchVideoMergeWebhook(s.db, s.log, mergeID)
 }
 
 func (s *VideoMergeService) getVideoClient(provider string) (video.VideoClient, error) {
@@ -302,32 +368,39 @@ func (s *VideoMergeService) getVideoClient(provider string) (video.VideoClient,
 		model = config.Model[0]
 	}
 
+	apiKey, err := configAPIKey(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// 根据配置中的 provider 创建对应的客户端
 	var endpoint string
 	var queryEndpoint string
 
+	var client video.VideoClient
 	switch config.Provider {
 	case "runway":
-		return video.NewRunwayClient(config.BaseURL, config.APIKey, model), nil
+		client = video.NewRunwayClient(config.BaseURL, apiKey, model)
 	case "pika":
-		return video.NewPikaClient(config.BaseURL, config.APIKey, model), nil
+		client = video.NewPikaClient(config.BaseURL, apiKey, model)
 	case "openai", "sora":
-		return video.NewOpenAISoraClient(config.BaseURL, config.APIKey, model), nil
+		client = video.NewOpenAISoraClient(config.BaseURL, apiKey, model)
 	case "minimax":
-		return video.NewMinimaxClient(config.BaseURL, config.APIKey, model), nil
+		client = video.NewMinimaxClient(config.BaseURL, apiKey, model)
 	case "chatfire":
 		endpoint = "/video/generations"
 		queryEndpoint = "/video/task/{taskId}"
-		return video.NewChatfireClient(config.BaseURL, config.APIKey, model, endpoint, queryEndpoint), nil
+		client = video.NewChatfireClient(config.BaseURL, apiKey, model, endpoint, queryEndpoint)
 	case "doubao", "volces", "ark":
 		endpoint = "/contents/generations/tasks"
 		queryEndpoint = "/generations/tasks/{taskId}"
-		return video.NewVolcesArkClient(config.BaseURL, config.APIKey, model, endpoint, queryEndpoint), nil
+		client = video.NewVolcesArkClient(config.BaseURL, apiKey, model, endpoint, queryEndpoint)
 	default:
 		endpoint = "/contents/generations/tasks"
 		queryEndpoint = "/generations/tasks/{taskId}"
-		return video.NewVolcesArkClient(config.BaseURL, config.APIKey, model, endpoint, queryEndpoint), nil
+		client = video.NewVolcesArkClient(config.BaseURL, apiKey, model, endpoint, queryEndpoint)
 	}
+	return withVideoRateLimit(config, client), nil
 }
 
 func (s *VideoMergeService) GetMerge(mergeID uint) (*models.VideoMerge, error) {
@@ -402,6 +475,26 @@ func getAssetIDString(assetID interface{}) string {
 	}
 }
 
+// selectedTakeVideoURL 分镜选定视频的地址，优先使用本地文件，没有生成记录时回退到 storyboard 的 video_url
+func (s *VideoMergeService) selectedTakeVideoURL(scene *models.Storyboard) string {
+	if videoGen, err := selectedVideoTake(s.db, scene); err == nil {
+		if videoGen.LocalPath != nil && *videoGen.LocalPath != "" {
+			// 检查是否已经是完整路径
+			if filepath.IsAbs(*videoGen.LocalPath) || filepath.HasPrefix(*videoGen.LocalPath, s.storagePath) {
+				return *videoGen.LocalPath
+			}
+			return filepath.Join(s.storagePath, *videoGen.LocalPath)
+		}
+		if videoGen.VideoURL != nil && *videoGen.VideoURL != "" {
+			return *videoGen.VideoURL
+		}
+	}
+	if scene.VideoURL != nil {
+		return *scene.VideoURL
+	}
+	return ""
+}
+
 // FinalizeEpisodeRequest 完成剧集制作请求
 type FinalizeEpisodeRequest struct {
 	EpisodeID string         `json:"episode_id"`
@@ -471,29 +564,10 @@ func (s *VideoMergeService) FinalizeEpisode(episodeID string, timelineData *Fina
 					continue
 				}
 
-				// 查找关联的 video_generation 记录以获取 local_path
-				var videoGen models.VideoGeneration
-				if err := s.db.Where("storyboard_id = ? AND status = ?", scene.ID, "completed").Order("created_at DESC").First(&videoGen).Error; err == nil {
-					if videoGen.LocalPath != nil && *videoGen.LocalPath != "" {
-						// 检查是否已经是完整路径
-						if filepath.IsAbs(*videoGen.LocalPath) || filepath.HasPrefix(*videoGen.LocalPath, s.storagePath) {
-							videoURL = *videoGen.LocalPath
-						} else {
-							videoURL = filepath.Join(s.storagePath, *videoGen.LocalPath)
-						}
-						sceneID = scene.ID
-						s.log.Infow("Using local video from video_generation", "storyboard_id", clip.StoryboardID, "local_path", videoURL)
-					} else if scene.VideoURL != nil && *scene.VideoURL != "" {
-						// 回退到远程 URL
-						videoURL = *scene.VideoURL
-						sceneID = scene.ID
-						s.log.Infow("Using remote video from storyboard", "storyboard_id", clip.StoryboardID, "video_url", videoURL)
-					}
-				} else if scene.VideoURL != nil && *scene.VideoURL != "" {
-					// 如果没有找到 video_generation，直接使用 storyboard 的 video_url
-					videoURL = *scene.VideoURL
+				// 使用分镜选定的视频
+				if videoURL = s.selectedTakeVideoURL(&scene); videoURL != "" {
 					sceneID = scene.ID
-					s.log.Infow("Using video from storyboard (no video_generation found)", "storyboard_id", clip.StoryboardID, "video_url", videoURL)
+					s.log.Infow("Using selected video take", "storyboard_id", clip.StoryboardID, "video_url", videoURL)
 				}
 			}
 
@@ -533,10 +607,14 @@ func (s *VideoMergeService) FinalizeEpisode(episodeID string, timelineData *Fina
 
 		order := 0
 		for _, scene := range episode.Storyboards {
-			// 优先从素材库查找该分镜关联的视频
-			var videoURL string
+			// 使用分镜选定的视频，分镜没有可用的视频时再从素材库查找该分镜关联的视频
+			videoURL := s.selectedTakeVideoURL(&scene)
 			var asset models.Asset
-			if err := s.db.Where("storyboard_id = ? AND type = ? AND episode_id = ?",
+			if videoURL != "" {
+				s.log.Infow("Using selected video take for storyboard",
+					"storyboard_id", scene.ID,
+					"video_url", videoURL)
+			} else if err := s.db.Where("storyboard_id = ? AND type = ? AND episode_id = ?",
 				scene.ID, models.AssetTypeVideo, episode.ID).
 				Order("created_at DESC").
 				First(&asset).Error; err == nil {
@@ -559,33 +637,6 @@ func (s *VideoMergeService) FinalizeEpisode(episodeID string, timelineData *Fina
 						"asset_id", asset.ID,
 						"video_url", videoURL)
 				}
-			} else {
-				// 如果素材库没有，查找 video_generation 记录
-				var videoGen models.VideoGeneration
-				if err := s.db.Where("storyboard_id = ? AND status = ?", scene.ID, "completed").Order("created_at DESC").First(&videoGen).Error; err == nil {
-					if videoGen.LocalPath != nil && *videoGen.LocalPath != "" {
-						// 检查是否已经是完整路径
-						if filepath.IsAbs(*videoGen.LocalPath) || filepath.HasPrefix(*videoGen.LocalPath, s.storagePath) {
-							videoURL = *videoGen.LocalPath
-						} else {
-							videoURL = filepath.Join(s.storagePath, *videoGen.LocalPath)
-						}
-						s.log.Infow("Using local video from video_generation for storyboard",
-							"storyboard_id", scene.ID,
-							"local_path", videoURL)
-					} else if scene.VideoURL != nil && *scene.VideoURL != "" {
-						videoURL = *scene.VideoURL
-						s.log.Infow("Using remote video from storyboard",
-							"storyboard_id", scene.ID,
-							"video_url", videoURL)
-					}
-				} else if scene.VideoURL != nil && *scene.VideoURL != "" {
-					// 最后回退到 storyboard 的 video_url
-					videoURL = *scene.VideoURL
-					s.log.Infow("Using fallback video from storyboard",
-						"storyboard_id", scene.ID,
-						"video_url", videoURL)
-				}
 			}
 
 			// 跳过没有视频的场景
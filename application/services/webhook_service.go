@@ -0,0 +1,576 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	webhookRequestTimeout  = 15 * time.Second
+	webhookResponseMaxSize = 4096
+)
+
+var (
+	// ErrInvalidWebhookEvent 订阅了不支持的事件类型
+	ErrInvalidWebhookEvent = errors.New("不支持的事件类型")
+	// ErrWebhookDeliveryInProgress 投递仍在进行中，无需重新投递
+	ErrWebhookDeliveryInProgress = errors.New("投递进行中，无法重新投递")
+)
+
+// webhookEventTypes 可订阅的事件类型
+var webhookEventTypes = map[string]bool{
+	models.WebhookEventImageCompleted:        true,
+	models.WebhookEventImageFailed:           true,
+	models.WebhookEventVideoCompleted:        true,
+	models.WebhookEventVideoFailed:           true,
+	models.WebhookEventEpisodeFinalized:      true,
+	models.WebhookEventEpisodeFinalizeFailed: true,
+	models.WebhookEventTaskCompleted:         true,
+	models.WebhookEventTaskFailed:            true,
+	models.WebhookEventAll:                   true,
+}
+
+// WebhookEvent 投递给订阅方的请求体
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type webhookDeliveryJob struct {
+	DeliveryID uint `json:"delivery_id"`
+}
+
+type CreateWebhookRequest struct {
+	Name        string   `json:"name" binding:"max=100"`
+	URL         string   `json:"url" binding:"required,url"`
+	Secret      string   `json:"secret"` // 为空时自动生成
+	Events      []string `json:"events" binding:"required,min=1"`
+	Description string   `json:"description"`
+}
+
+type UpdateWebhookRequest struct {
+	Name        *string  `json:"name" binding:"omitempty,max=100"`
+	URL         *string  `json:"url" binding:"omitempty,url"`
+	Secret      *string  `json:"secret"`
+	Events      []string `json:"events"`
+	IsActive    *bool    `json:"is_active"`
+	Description *string  `json:"description"`
+}
+
+type WebhookDeliveryQuery struct {
+	Page      int    `form:"page,default=1"`
+	PageSize  int    `form:"page_size,default=20"`
+	Status    string `form:"status"`
+	EventType string `form:"event_type"`
+}
+
+// WebhookService 管理 webhook 订阅，并通过任务队列投递事件。
+// 投递失败时（网络错误、408/429/5xx）由队列按指数退避重试，每条投递的结果记录在 webhook_deliveries。
+type WebhookService struct {
+	db          *gorm.DB
+	log         *logger.Logger
+	taskService *TaskService
+	client      *http.Client
+}
+
+func NewWebhookService(db *gorm.DB, log *logger.Logger) *WebhookService {
+	return &WebhookService{
+		db:          db,
+		log:         log,
+		taskService: NewTaskService(db, log),
+		client:      &http.Client{Timeout: webhookRequestTimeout},
+	}
+}
+
+// RegisterJobHandlers 注册 webhook 投递任务处理器
+func (s *WebhookService) RegisterJobHandlers(queue *JobQueue) {
+	queue.Register(JobTypeWebhookDelivery, s.processDeliveryJob)
+}
+
+// CreateWebhook 创建订阅，返回的 secret 仅在创建时可见
+func (s *WebhookService) CreateWebhook(req *CreateWebhookRequest) (*models.Webhook, string, error) {
+	events, err := marshalWebhookEvents(req.Events)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = generateWebhookSecret(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	webhook := &models.Webhook{
+		Name:        req.Name,
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      events,
+		IsActive:    true,
+		Description: req.Description,
+	}
+	if err := s.db.Create(webhook).Error; err != nil {
+		return nil, "", err
+	}
+
+	s.log.Infow("Webhook created", "webhook_id", webhook.ID, "url", webhook.URL)
+	return webhook, secret, nil
+}
+
+func (s *WebhookService) ListWebhooks() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := s.db.Order("created_at DESC").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetWebhook(webhookID uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := s.db.First(&webhook, webhookID).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookService) UpdateWebhook(webhookID uint, req *UpdateWebhookRequest) (*models.Webhook, error) {
+	webhook, err := s.GetWebhook(webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.URL != nil {
+		updates["url"] = *req.URL
+	}
+	if req.Secret != nil && *req.Secret != "" {
+		updates["secret"] = *req.Secret
+	}
+	if req.Events != nil {
+		events, err := marshalWebhookEvents(req.Events)
+		if err != nil {
+			return nil, err
+		}
+		updates["events"] = events
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(webhook).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return s.GetWebhook(webhookID)
+}
+
+func (s *WebhookService) DeleteWebhook(webhookID uint) error {
+	result := s.db.Delete(&models.Webhook{}, webhookID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListDeliveries 分页查询订阅的投递记录，按创建时间倒序
+func (s *WebhookService) ListDeliveries(webhookID uint, query *WebhookDeliveryQuery) ([]models.WebhookDelivery, int64, error) {
+	if _, err := s.GetWebhook(webhookID); err != nil {
+		return nil, 0, err
+	}
+
+	db := s.db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.EventType != "" {
+		db = db.Where("event_type = ?", query.EventType)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := db.Order("created_at DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// Redeliver 重新投递已结束的投递记录
+func (s *WebhookService) Redeliver(deliveryID uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := s.db.First(&delivery, deliveryID).Error; err != nil {
+		return nil, err
+	}
+	if delivery.Status == models.WebhookDeliveryPending || delivery.Status == models.WebhookDeliveryRetrying {
+		return nil, ErrWebhookDeliveryInProgress
+	}
+
+	if err := enqueueWebhookDelivery(s.db, s.log, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Ping 向订阅地址发送测试事件
+func (s *WebhookService) Ping(webhookID uint) (*models.WebhookDelivery, error) {
+	webhook, err := s.GetWebhook(webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := deliverWebhookEvent(s.db, s.log, []models.Webhook{*webhook}, models.WebhookEventPing, map[string]interface{}{
+		"webhook_id": webhook.ID,
+	})
+	if len(deliveries) == 0 {
+		return nil, fmt.Errorf("failed to create ping delivery")
+	}
+	return &deliveries[0], nil
+}
+
+func (s *WebhookService) processDeliveryJob(ctx context.Context, task *models.AsyncTask) error {
+	var job webhookDeliveryJob
+	if err := decodeJobPayload(task, &job); err != nil {
+		return err
+	}
+
+	var delivery models.WebhookDelivery
+	if err := s.db.First(&delivery, job.DeliveryID).Error; err != nil {
+		return fmt.Errorf("delivery not found: %w", err)
+	}
+
+	var webhook models.Webhook
+	if err := s.db.First(&webhook, delivery.WebhookID).Error; err != nil {
+		s.updateDelivery(delivery.ID, map[string]interface{}{
+			"status": models.WebhookDeliveryFailed,
+			"error":  "订阅已删除",
+		})
+		return nil
+	}
+	if !webhook.IsActive && delivery.EventType != models.WebhookEventPing {
+		s.updateDelivery(delivery.ID, map[string]interface{}{
+			"status": models.WebhookDeliveryFailed,
+			"error":  "订阅已停用",
+		})
+		return nil
+	}
+
+	statusCode, body, err := s.send(ctx, &webhook, &delivery)
+	if ctx.Err() != nil {
+		// 队列停止或任务被取消，投递记录保持原状态，由队列决定是否继续
+		return ctx.Err()
+	}
+
+	updates := map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"response_status": statusCode,
+		"response_body":   body,
+	}
+	if err == nil {
+		now := time.Now()
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["error"] = ""
+		updates["delivered_at"] = &now
+		s.log.Infow("Webhook delivered", "delivery_id", delivery.ID, "webhook_id", webhook.ID, "event", delivery.EventType, "status", statusCode)
+	} else {
+		updates["error"] = err.Error()
+		if canRetry(task, err) {
+			updates["status"] = models.WebhookDeliveryRetrying
+		} else {
+			updates["status"] = models.WebhookDeliveryFailed
+		}
+		s.log.Warnw("Webhook delivery failed", "delivery_id", delivery.ID, "webhook_id", webhook.ID, "event", delivery.EventType, "error", err)
+	}
+	s.updateDelivery(delivery.ID, updates)
+
+	return err
+}
+
+// send 发送签名后的事件，非 2xx 响应作为 APIError 返回，由队列判断是否重试
+func (s *WebhookService) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, string, error) {
+	payload := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DramaGenerator-Webhook/1.0")
+	req.Header.Set("X-Webhook-Id", strconv.FormatUint(uint64(webhook.ID), 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", delivery.EventID)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", utils.SignWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseMaxSize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), utils.NewAPIError(resp.StatusCode, string(respBody))
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+func (s *WebhookService) updateDelivery(deliveryID uint, updates map[string]interface{}) {
+	if err := s.db.Model(&models.WebhookDelivery{}).Where("id = ?", deliveryID).Updates(updates).Error; err != nil {
+		s.log.Errorw("Failed to update webhook delivery", "delivery_id", deliveryID, "error", err)
+	}
+}
+
+// marshalWebhookEvents 校验并序列化订阅的事件类型
+func marshalWebhookEvents(events []string) (datatypes.JSON, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: 至少订阅一个事件", ErrInvalidWebhookEvent)
+	}
+	for _, event := range events {
+		if !webhookEventTypes[event] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, event)
+		}
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// subscribedWebhooks 返回订阅了该事件的启用中的 webhook
+func subscribedWebhooks(db *gorm.DB, eventType string) []models.Webhook {
+	var webhooks []models.Webhook
+	if err := db.Where("is_active = ?", true).Find(&webhooks).Error; err != nil {
+		return nil
+	}
+
+	var matched []models.Webhook
+	for _, webhook := range webhooks {
+		var events []string
+		if err := json.Unmarshal(webhook.Events, &events); err != nil {
+			continue
+		}
+		for _, event := range events {
+			if event == eventType || event == models.WebhookEventAll {
+				matched = append(matched, webhook)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// deliverWebhookEvent 为每个订阅创建投递记录并加入任务队列
+func deliverWebhookEvent(db *gorm.DB, log *logger.Logger, webhooks []models.Webhook, eventType string, data interface{}) []models.WebhookDelivery {
+	event := WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Errorw("Failed to marshal webhook event", "event", eventType, "error", err)
+		return nil
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		delivery := models.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: eventType,
+			Payload:   string(payload),
+			Status:    models.WebhookDeliveryPending,
+		}
+		if err := db.Create(&delivery).Error; err != nil {
+			log.Errorw("Failed to create webhook delivery", "webhook_id", webhook.ID, "event", eventType, "error", err)
+			continue
+		}
+		if err := enqueueWebhookDelivery(db, log, &delivery); err != nil {
+			log.Errorw("Failed to enqueue webhook delivery", "delivery_id", delivery.ID, "error", err)
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
+
+func enqueueWebhookDelivery(db *gorm.DB, log *logger.Logger, delivery *models.WebhookDelivery) error {
+	task, err := NewTaskService(db, log).EnqueueTask(JobTypeWebhookDelivery, fmt.Sprintf("%d", delivery.ID), webhookDeliveryJob{DeliveryID: delivery.ID})
+	if err != nil {
+		return err
+	}
+
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.TaskID = task.ID
+	delivery.Error = ""
+	return db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":  delivery.Status,
+		"task_id": delivery.TaskID,
+		"error":   "",
+	}).Error
+}
+
+// dispatchImageGenerationWebhook 图片生成完成或失败时通知订阅方
+func dispatchImageGenerationWebhook(db *gorm.DB, log *logger.Logger, imageGenID uint) {
+	var imageGen models.ImageGeneration
+	if err := db.First(&imageGen, imageGenID).Error; err != nil {
+		return
+	}
+
+	var eventType string
+	switch imageGen.Status {
+	case models.ImageStatusCompleted:
+		eventType = models.WebhookEventImageCompleted
+	case models.ImageStatusFailed:
+		eventType = models.WebhookEventImageFailed
+	default:
+		return
+	}
+
+	webhooks := subscribedWebhooks(db, eventType)
+	if len(webhooks) == 0 {
+		return
+	}
+
+	data := imageGenerationEventData(&imageGen)
+	data["episode_id"] = generationEpisodeID(db, imageGen.StoryboardID, imageGen.SceneID)
+	deliverWebhookEvent(db, log, webhooks, eventType, data)
+}
+
+// dispatchVideoGenerationWebhook 视频生成完成或失败时通知订阅方
+func dispatchVideoGenerationWebhook(db *gorm.DB, log *logger.Logger, videoGenID uint) {
+	var videoGen models.VideoGeneration
+	if err := db.First(&videoGen, videoGenID).Error; err != nil {
+		return
+	}
+
+	var eventType string
+	switch videoGen.Status {
+	case models.VideoStatusCompleted:
+		eventType = models.WebhookEventVideoCompleted
+	case models.VideoStatusFailed:
+		eventType = models.WebhookEventVideoFailed
+	default:
+		return
+	}
+
+	webhooks := subscribedWebhooks(db, eventType)
+	if len(webhooks) == 0 {
+		return
+	}
+
+	data := videoGenerationEventData(&videoGen)
+	data["episode_id"] = generationEpisodeID(db, videoGen.StoryboardID, nil)
+	deliverWebhookEvent(db, log, webhooks, eventType, data)
+}
+
+// dispatchVideoMergeWebhook 章节成片合成完成或失败时通知订阅方
+func dispatchVideoMergeWebhook(db *gorm.DB, log *logger.Logger, mergeID uint) {
+	var merge models.VideoMerge
+	if err := db.First(&merge, mergeID).Error; err != nil {
+		return
+	}
+
+	var eventType string
+	switch merge.Status {
+	case models.VideoMergeStatusCompleted:
+		eventType = models.WebhookEventEpisodeFinalized
+	case models.VideoMergeStatusFailed:
+		eventType = models.WebhookEventEpisodeFinalizeFailed
+	default:
+		return
+	}
+
+	webhooks := subscribedWebhooks(db, eventType)
+	if len(webhooks) == 0 {
+		return
+	}
+
+	deliverWebhookEvent(db, log, webhooks, eventType, map[string]interface{}{
+		"merge_id":   merge.ID,
+		"episode_id": merge.EpisodeID,
+		"drama_id":   merge.DramaID,
+		"title":      merge.Title,
+		"status":     merge.Status,
+		"merged_url": merge.MergedURL,
+		"duration":   merge.Duration,
+		"error_msg":  merge.ErrorMsg,
+	})
+}
+
+// dispatchTaskWebhook 任务完成或失败时通知订阅方。webhook 投递任务本身不触发事件，避免循环投递。
+func dispatchTaskWebhook(db *gorm.DB, log *logger.Logger, taskID string) {
+	var task models.AsyncTask
+	if err := db.Where("id = ?", taskID).First(&task).Error; err != nil {
+		return
+	}
+	if task.Type == JobTypeWebhookDelivery {
+		return
+	}
+
+	var eventType string
+	switch task.Status {
+	case models.TaskStatusCompleted:
+		eventType = models.WebhookEventTaskCompleted
+	case models.TaskStatusFailed, models.TaskStatusDeadLetter:
+		eventType = models.WebhookEventTaskFailed
+	default:
+		return
+	}
+
+	webhooks := subscribedWebhooks(db, eventType)
+	if len(webhooks) == 0 {
+		return
+	}
+
+	data := map[string]interface{}{
+		"task":       &task,
+		"episode_id": taskEpisodeID(db, &task),
+	}
+	deliverWebhookEvent(db, log, webhooks, eventType, data)
+}
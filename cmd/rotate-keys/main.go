@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/infrastructure/database"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+// 更换加密服务商 API Key 的主密钥：用旧主密钥解密所有配置的 Key，再用新主密钥加密。
+// 旧主密钥默认取当前配置（security.master_key 或 DRAMA_MASTER_KEY），新主密钥建议通过环境变量 DRAMA_NEW_MASTER_KEY 传入。
+// 完成后将新主密钥写入配置再启动服务。
+func main() {
+	oldKey := flag.String("old-key", "", "旧主密钥，默认使用当前配置中的主密钥")
+	newKey := flag.String("new-key", "", "新主密钥，默认读取环境变量 DRAMA_NEW_MASTER_KEY")
+	decrypt := flag.Bool("decrypt", false, "解密后以明文保存，不再使用主密钥")
+	flag.Parse()
+
+	logr := logger.NewLogger(false)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logr.Fatalw("加载配置失败", "error", err)
+	}
+
+	if *oldKey == "" {
+		*oldKey = cfg.Security.MasterKey
+	}
+	if *newKey == "" {
+		*newKey = os.Getenv("DRAMA_NEW_MASTER_KEY")
+	}
+	if *newKey == "" && !*decrypt {
+		fmt.Fprintln(os.Stderr, "缺少新主密钥：使用 -new-key 或环境变量 DRAMA_NEW_MASTER_KEY 指定，或使用 -decrypt 改为明文保存")
+		os.Exit(2)
+	}
+	if *decrypt {
+		*newKey = ""
+	}
+
+	db, err := database.NewDatabase(cfg.Database)
+	if err != nil {
+		logr.Fatalw("数据库连接失败", "error", err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		logr.Fatalw("数据库迁移失败", "error", err)
+	}
+
+	count, err := services.NewAIService(db, logr).RotateAPIKeys(*oldKey, *newKey)
+	if err != nil {
+		logr.Fatalw("更换主密钥失败，未修改任何配置", "error", err)
+	}
+
+	fmt.Printf("已更新 %d 个AI配置的 API Key\n", count)
+	if *newKey != "" {
+		fmt.Println("请将新主密钥写入 security.master_key 或环境变量 DRAMA_MASTER_KEY 后重启服务")
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// AIResponseCache 文本请求的响应缓存，CacheKey 为服务商、模型、提示词和请求参数的哈希
+type AIResponseCache struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CacheKey      string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"cache_key"`
+	ConfigID      *uint      `gorm:"index" json:"config_id,omitempty"`
+	Provider      string     `gorm:"type:varchar(50);index" json:"provider"`
+	Model         string     `gorm:"type:varchar(100);index" json:"model"`
+	Operation     string     `gorm:"type:varchar(50);index" json:"operation,omitempty"`
+	PromptPreview string     `gorm:"type:text" json:"prompt_preview"` // 提示词开头部分，便于查看
+	Response      string     `gorm:"type:longtext" json:"response,omitempty"`
+	HitCount      int        `gorm:"default:0" json:"hit_count"`
+	LastHitAt     *time.Time `json:"last_hit_at,omitempty"`
+	ExpiresAt     time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt     time.Time  `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"not null;autoUpdateTime" json:"updated_at"`
+}
+
+func (c *AIResponseCache) TableName() string {
+	return "ai_response_cache"
+}
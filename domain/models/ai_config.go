@@ -13,14 +13,15 @@ type AIServiceConfig struct {
 	Provider      string     `gorm:"type:varchar(50)" json:"provider"`              // openai, gemini, volcengine, etc.
 	Name          string     `gorm:"type:varchar(100);not null" json:"name"`
 	BaseURL       string     `gorm:"type:varchar(255);not null" json:"base_url"`
-	APIKey        string     `gorm:"type:varchar(255);not null" json:"api_key"`
+	APIKey        string     `gorm:"type:text;not null" json:"-"`     // 配置主密钥后加密存储，仅在创建客户端时解密
+	APIKeyMask    string     `gorm:"type:varchar(64)" json:"api_key"` // 脱敏后的 Key，如 sk-****abcd
 	Model         ModelField `gorm:"type:text" json:"model"`
 	Endpoint      string     `gorm:"type:varchar(255)" json:"endpoint"`
 	QueryEndpoint string     `gorm:"type:varchar(255)" json:"query_endpoint"`
 	Priority      int        `gorm:"default:0" json:"priority"` // 优先级，数值越大优先级越高
 	IsDefault     bool       `gorm:"default:false" json:"is_default"`
 	IsActive      bool       `gorm:"default:true" json:"is_active"`
-	Settings      string     `gorm:"type:text" json:"settings"`
+	Settings      string     `gorm:"type:text" json:"settings"` // JSON，如 {"requests_per_minute":60,"max_concurrent":4,"tokens_per_minute":100000}
 	CreatedAt     time.Time  `gorm:"not null;autoCreateTime" json:"created_at"`
 	UpdatedAt     time.Time  `gorm:"not null;autoUpdateTime" json:"updated_at"`
 }
@@ -29,22 +30,82 @@ func (c *AIServiceConfig) TableName() string {
 	return "ai_service_configs"
 }
 
+// AIServiceProvider 服务商，同一服务商按服务类型分别登记，Models 为各模型支持的参数
 type AIServiceProvider struct {
-	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name        string    `gorm:"type:varchar(100);not null;uniqueIndex" json:"name"`
-	DisplayName string    `gorm:"type:varchar(100);not null" json:"display_name"`
-	ServiceType string    `gorm:"type:varchar(50);not null" json:"service_type"`
-	DefaultURL  string    `gorm:"type:varchar(255)" json:"default_url"`
-	Description string    `gorm:"type:text" json:"description"`
-	IsActive    bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt   time.Time `gorm:"not null;autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"not null;autoUpdateTime" json:"updated_at"`
+	ID          uint                `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string              `gorm:"type:varchar(100);not null;uniqueIndex:idx_provider_name_type" json:"name"`
+	DisplayName string              `gorm:"type:varchar(100);not null" json:"display_name"`
+	ServiceType string              `gorm:"type:varchar(50);not null;uniqueIndex:idx_provider_name_type" json:"service_type"`
+	DefaultURL  string              `gorm:"type:varchar(255)" json:"default_url"`
+	Description string              `gorm:"type:text" json:"description"`
+	IsActive    bool                `gorm:"default:true" json:"is_active"`
+	Models      []AIModelCapability `gorm:"foreignKey:ProviderID" json:"models,omitempty"`
+	CreatedAt   time.Time           `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time           `gorm:"not null;autoUpdateTime" json:"updated_at"`
 }
 
 func (p *AIServiceProvider) TableName() string {
 	return "ai_service_providers"
 }
 
+// AIModelCapability 服务商下某个模型支持的参数，生成前按此校验或调整请求
+type AIModelCapability struct {
+	ID           uint              `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProviderID   uint              `gorm:"not null;uniqueIndex:idx_capability_provider_model" json:"provider_id"`
+	Model        string            `gorm:"type:varchar(100);not null;uniqueIndex:idx_capability_provider_model" json:"model"` // 以 * 结尾时按前缀匹配，* 表示服务商下的其他模型
+	Capabilities ModelCapabilities `gorm:"type:text" json:"capabilities"`
+	CreatedAt    time.Time         `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time         `gorm:"not null;autoUpdateTime" json:"updated_at"`
+}
+
+func (c *AIModelCapability) TableName() string {
+	return "ai_model_capabilities"
+}
+
+// ModelCapabilities 模型支持的生成参数，列表为空表示不限制
+type ModelCapabilities struct {
+	// 视频：是否支持单图/首帧生成、尾帧
+	ImageToVideo bool `json:"image_to_video"`
+	LastFrame    bool `json:"last_frame"`
+	// 视频时长范围（秒），0 表示不限制；Durations 非空时只支持其中的时长
+	MinDuration  int      `json:"min_duration"`
+	MaxDuration  int      `json:"max_duration"`
+	Durations    []int    `json:"durations,omitempty"`
+	AspectRatios []string `json:"aspect_ratios,omitempty"`
+	Resolutions  []string `json:"resolutions,omitempty"`
+	// 图片：支持的尺寸（如 1024x1024）、是否支持反向提示词
+	Sizes          []string `json:"sizes,omitempty"`
+	NegativePrompt bool     `json:"negative_prompt"`
+	// 最多参考图数量，0 表示不支持参考图
+	MaxReferenceImages int `json:"max_reference_images"`
+}
+
+// Value 实现 driver.Valuer 接口，以 JSON 存储
+func (c ModelCapabilities) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan 实现 sql.Scanner 接口
+func (c *ModelCapabilities) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*c = ModelCapabilities{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for ModelCapabilities")
+	}
+	return json.Unmarshal(data, c)
+}
+
 // ModelField 自定义类型，支持字符串或字符串数组
 type ModelField []string
 
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// AIUsageRecord 每次调用AI服务商的用量记录，故障切换时每个尝试的配置各记一条
+type AIUsageRecord struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConfigID         *uint     `gorm:"index" json:"config_id,omitempty"`
+	ConfigName       string    `gorm:"type:varchar(100)" json:"config_name"`
+	Provider         string    `gorm:"type:varchar(50);index" json:"provider"`
+	ServiceType      string    `gorm:"type:varchar(50);index" json:"service_type"` // text, image, video
+	Model            string    `gorm:"type:varchar(100);index" json:"model"`
+	Operation        string    `gorm:"type:varchar(50)" json:"operation,omitempty"` // storyboard, character, image 等
+	DramaID          *uint     `gorm:"index" json:"drama_id,omitempty"`
+	EpisodeID        *uint     `gorm:"index" json:"episode_id,omitempty"`
+	StoryboardID     *uint     `gorm:"index" json:"storyboard_id,omitempty"`
+	PromptTokens     int       `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int       `gorm:"default:0" json:"completion_tokens"`
+	TotalTokens      int       `gorm:"default:0" json:"total_tokens"`
+	Images           int       `gorm:"default:0" json:"images"`
+	VideoSeconds     int       `gorm:"default:0" json:"video_seconds"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Success          bool      `gorm:"index" json:"success"`
+	Error            string    `gorm:"type:text" json:"error,omitempty"`
+	Cost             float64   `gorm:"default:0" json:"cost"` // 按记录时的价格计算
+	Currency         string    `gorm:"type:varchar(10)" json:"currency,omitempty"`
+	CreatedAt        time.Time `gorm:"not null;autoCreateTime;index" json:"created_at"`
+}
+
+func (r *AIUsageRecord) TableName() string {
+	return "ai_usage_records"
+}
+
+// AIModelPrice 模型单价，用于计算用量费用
+type AIModelPrice struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Model           string    `gorm:"type:varchar(100);not null;uniqueIndex" json:"model"`
+	PromptPer1K     float64   `gorm:"column:prompt_per_1k;default:0" json:"prompt_per_1k"`         // 每千输入 token
+	CompletionPer1K float64   `gorm:"column:completion_per_1k;default:0" json:"completion_per_1k"` // 每千输出 token
+	PerImage        float64   `gorm:"default:0" json:"per_image"`
+	PerVideoSecond  float64   `gorm:"default:0" json:"per_video_second"`
+	Currency        string    `gorm:"type:varchar(10);default:'USD'" json:"currency"`
+	CreatedAt       time.Time `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"not null;autoUpdateTime" json:"updated_at"`
+}
+
+func (p *AIModelPrice) TableName() string {
+	return "ai_model_prices"
+}
@@ -19,6 +19,7 @@ type Drama struct {
 	Thumbnail     *string        `gorm:"type:varchar(500)" json:"thumbnail"`
 	Tags          datatypes.JSON `gorm:"type:json" json:"tags"`
 	Metadata      datatypes.JSON `gorm:"type:json" json:"metadata"`
+	BudgetLimit   *float64       `json:"budget_limit"` // AI调用费用上限，为空表示不限制
 	CreatedAt     time.Time      `gorm:"not null;autoCreateTime" json:"created_at"`
 	UpdatedAt     time.Time      `gorm:"not null;autoUpdateTime" json:"updated_at"`
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
@@ -112,6 +113,10 @@ type Storyboard struct {
 	Duration         int            `gorm:"default:5" json:"duration"`
 	ComposedImage    *string        `gorm:"type:text" json:"composed_image"`
 	VideoURL         *string        `gorm:"type:text" json:"video_url"`
+	SelectedImageID  *uint          `gorm:"index" json:"selected_image_id"`         // 选定的图片生成记录，composed_image 与其保持一致
+	SelectedVideoID  *uint          `gorm:"index" json:"selected_video_id"`         // 选定的视频生成记录，video_url 与其保持一致
+	ImageTakePinned  bool           `gorm:"default:false" json:"image_take_pinned"` // 用户手动选定过图片，之后新完成的图片不再自动替换
+	VideoTakePinned  bool           `gorm:"default:false" json:"video_take_pinned"` // 用户手动选定过视频，之后新完成的视频不再自动替换
 	Status           string         `gorm:"type:varchar(20);default:'pending'" json:"status"`
 	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
@@ -28,8 +28,10 @@ type ImageGeneration struct {
 	ImageURL        *string               `gorm:"type:text" json:"image_url,omitempty"`
 	MinioURL        *string               `gorm:"type:text" json:"minio_url,omitempty"`
 	LocalPath       *string               `gorm:"type:text" json:"local_path,omitempty"`
+	ThumbnailURL    *string               `gorm:"type:text" json:"thumbnail_url,omitempty"` // 后处理生成的缩略图
 	Status          ImageGenerationStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
 	TaskID          *string               `gorm:"size:200" json:"task_id,omitempty"`
+	AIConfigID      *uint                 `json:"ai_config_id,omitempty"` // 实际提交任务的AI配置，故障切换后恢复轮询时使用
 	ErrorMsg        *string               `gorm:"type:text" json:"error_msg,omitempty"`
 	Width           *int                  `json:"width,omitempty"`
 	Height          *int                  `json:"height,omitempty"`
@@ -38,6 +40,18 @@ type ImageGeneration struct {
 	UpdatedAt       time.Time             `json:"updated_at"`
 	CompletedAt     *time.Time            `json:"completed_at,omitempty"`
 
+	// 画面质检，仅分镜图片
+	QAStatus          *string        `gorm:"size:20" json:"qa_status,omitempty"` // passed, failed, error
+	QAScore           *int           `json:"qa_score,omitempty"`
+	QAVerdict         datatypes.JSON `gorm:"type:json" json:"qa_verdict,omitempty"`
+	QAError           *string        `gorm:"type:text" json:"qa_error,omitempty"`
+	QACheckedAt       *time.Time     `json:"qa_checked_at,omitempty"`
+	RegeneratedFromID *uint          `gorm:"index" json:"regenerated_from_id,omitempty"` // 因质检不合格自动重新生成时，原图片记录的ID
+
+	// 编辑图片：以父记录的图片为原图按提示词修改，蒙版为黑白图片（白色重绘）的 URL 或 data URI
+	ParentID  *uint   `gorm:"index" json:"parent_id,omitempty"`
+	MaskImage *string `gorm:"type:longtext" json:"-"`
+
 	Storyboard *Storyboard `gorm:"foreignKey:StoryboardID" json:"storyboard,omitempty"`
 	Drama      Drama       `gorm:"foreignKey:DramaID" json:"drama,omitempty"`
 	Scene      *Scene      `gorm:"foreignKey:SceneID" json:"scene,omitempty"`
@@ -58,6 +72,13 @@ const (
 	ImageStatusFailed     ImageGenerationStatus = "failed"
 )
 
+// 画面质检结果
+const (
+	ImageQAStatusPassed = "passed"
+	ImageQAStatusFailed = "failed"
+	ImageQAStatusError  = "error"
+)
+
 type ImageProvider string
 
 const (
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 修订稿状态
+const (
+	RevisionStatusPending  = "pending"
+	RevisionStatusAccepted = "accepted"
+)
+
+// ScriptChatSession 修改剧本的对话，关联到剧本或其中一集
+type ScriptChatSession struct {
+	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	DramaID   uint           `gorm:"not null;index" json:"drama_id"`
+	EpisodeID *uint          `gorm:"index" json:"episode_id"` // 为空时可修改剧本的任意一集
+	Title     string         `gorm:"type:varchar(200)" json:"title"`
+	Model     string         `gorm:"type:varchar(100)" json:"model"` // 指定的文本模型，为空时使用默认配置
+	CreatedAt time.Time      `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"not null;autoUpdateTime" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Messages []ScriptChatMessage `gorm:"foreignKey:SessionID" json:"messages,omitempty"`
+}
+
+func (s *ScriptChatSession) TableName() string {
+	return "script_chat_sessions"
+}
+
+// ScriptChatMessage 对话中的一条消息，助手的回复可以附带某一集的修订稿
+type ScriptChatMessage struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID uint   `gorm:"not null;index" json:"session_id"`
+	Role      string `gorm:"type:varchar(20);not null" json:"role"` // user, assistant
+	Content   string `gorm:"type:text;not null" json:"content"`
+
+	// 修订稿，仅助手消息
+	EpisodeID       *uint      `gorm:"index" json:"episode_id,omitempty"`
+	ProposedScript  *string    `gorm:"type:longtext" json:"proposed_script,omitempty"`
+	RevisionSummary string     `gorm:"type:text" json:"revision_summary,omitempty"`
+	RevisionStatus  string     `gorm:"type:varchar(20)" json:"revision_status,omitempty"`
+	BaseScriptHash  string     `gorm:"type:varchar(64)" json:"-"` // 提出修订时该集剧本的哈希，采纳前据此判断剧本是否已被修改
+	AcceptedAt      *time.Time `json:"accepted_at,omitempty"`
+
+	CreatedAt time.Time `gorm:"not null;autoCreateTime" json:"created_at"`
+}
+
+func (m *ScriptChatMessage) TableName() string {
+	return "script_chat_messages"
+}
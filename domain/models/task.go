@@ -6,18 +6,39 @@ import (
 	"gorm.io/gorm"
 )
 
+// 任务状态
+const (
+	TaskStatusPending    = "pending"
+	TaskStatusProcessing = "processing"
+	TaskStatusCompleted  = "completed"
+	TaskStatusFailed     = "failed"
+	TaskStatusCancelled  = "cancelled"
+	TaskStatusDeadLetter = "dead_letter" // 临时错误重试次数耗尽
+)
+
 // AsyncTask 异步任务模型
 type AsyncTask struct {
 	ID          string         `gorm:"primaryKey;size:36" json:"id"`
 	Type        string         `gorm:"size:50;not null;index" json:"type"`   // 任务类型：storyboard_generation
-	Status      string         `gorm:"size:20;not null;index" json:"status"` // pending, processing, completed, failed
+	Status      string         `gorm:"size:20;not null;index" json:"status"` // pending, processing, completed, failed, cancelled, dead_letter
 	Progress    int            `gorm:"default:0" json:"progress"`            // 0-100
 	Message     string         `gorm:"size:500" json:"message,omitempty"`    // 当前状态消息
 	Error       string         `gorm:"type:text" json:"error,omitempty"`     // 错误信息
+	ErrorCode   string         `gorm:"size:50" json:"error_code,omitempty"`  // 可识别的错误码，如 BUDGET_EXCEEDED
 	Result      string         `gorm:"type:text" json:"result,omitempty"`    // JSON格式的结果数据
 	ResourceID  string         `gorm:"size:36;index" json:"resource_id"`     // 关联资源ID（如episode_id）
 	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	CompletedAt *time.Time     `json:"completed_at,omitempty"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// 任务队列相关字段（仅由 JobQueue 调度的任务使用）
+	Payload        string     `gorm:"type:text" json:"-"`                      // JSON格式的任务参数
+	Attempts       int        `gorm:"default:0" json:"attempts"`               // 已执行次数
+	MaxAttempts    int        `gorm:"default:3" json:"max_attempts"`           // 最大执行次数（含崩溃后恢复）
+	LeaseOwner     string     `gorm:"size:100" json:"lease_owner,omitempty"`   // 持有租约的worker
+	LeaseExpiresAt *time.Time `gorm:"index" json:"lease_expires_at,omitempty"` // 租约过期时间，过期后任务重新入队
+	HeartbeatAt    *time.Time `json:"heartbeat_at,omitempty"`                  // 最近一次心跳时间
+	StartedAt      *time.Time `json:"started_at,omitempty"`                    // 最近一次开始执行时间
+	RunAfter       *time.Time `gorm:"index" json:"run_after,omitempty"`        // 重试退避，早于该时间不会被领取
 }
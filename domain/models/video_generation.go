@@ -48,6 +48,8 @@ type VideoGeneration struct {
 
 	Status VideoStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
 	TaskID *string     `gorm:"type:varchar(200);index" json:"task_id,omitempty"`
+	// 实际提交任务的AI配置，故障切换后恢复轮询时使用
+	AIConfigID *uint `json:"ai_config_id,omitempty"`
 
 	ErrorMsg    *string    `gorm:"type:text" json:"error_msg,omitempty"`
 	CompletedAt *time.Time `json:"completed_at,omitempty"`
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Webhook 事件类型
+const (
+	WebhookEventImageCompleted        = "image.completed"
+	WebhookEventImageFailed           = "image.failed"
+	WebhookEventVideoCompleted        = "video.completed"
+	WebhookEventVideoFailed           = "video.failed"
+	WebhookEventEpisodeFinalized      = "episode.finalized"
+	WebhookEventEpisodeFinalizeFailed = "episode.finalize_failed"
+	WebhookEventTaskCompleted         = "task.completed"
+	WebhookEventTaskFailed            = "task.failed"
+	WebhookEventPing                  = "ping"
+	WebhookEventAll                   = "*" // 订阅全部事件
+)
+
+// Webhook 投递状态
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryRetrying  = "retrying"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook 外部系统订阅的事件回调地址
+type Webhook struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string         `gorm:"type:varchar(100)" json:"name"`
+	URL         string         `gorm:"type:varchar(500);not null" json:"url"`
+	Secret      string         `gorm:"type:varchar(255);not null" json:"-"` // 用于 HMAC-SHA256 签名
+	Events      datatypes.JSON `gorm:"type:json" json:"events"`             // 订阅的事件类型，"*" 表示全部
+	IsActive    bool           `gorm:"default:true" json:"is_active"`
+	Description string         `gorm:"type:text" json:"description,omitempty"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (w *Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDelivery 单次事件投递记录，重试时复用同一条记录
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	WebhookID      uint       `gorm:"not null;index" json:"webhook_id"`
+	EventID        string     `gorm:"size:36;not null;index" json:"event_id"`
+	EventType      string     `gorm:"size:50;not null;index" json:"event_type"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"size:20;not null;index" json:"status"` // pending, retrying, succeeded, failed
+	Attempts       int        `gorm:"default:0" json:"attempts"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `gorm:"type:text" json:"response_body,omitempty"` // 截断保存
+	Error          string     `gorm:"type:text" json:"error,omitempty"`
+	TaskID         string     `gorm:"size:36" json:"task_id,omitempty"` // 负责投递的队列任务
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (d *WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
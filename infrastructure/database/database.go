@@ -70,7 +70,7 @@ func NewDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		// 核心模型
 		&models.Drama{},
 		&models.Episode{},
@@ -85,9 +85,17 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.VideoGeneration{},
 		&models.VideoMerge{},
 
+		// 剧本修改对话
+		&models.ScriptChatSession{},
+		&models.ScriptChatMessage{},
+
 		// AI配置
 		&models.AIServiceConfig{},
 		&models.AIServiceProvider{},
+		&models.AIModelCapability{},
+		&models.AIUsageRecord{},
+		&models.AIModelPrice{},
+		&models.AIResponseCache{},
 
 		// 资源管理
 		&models.Asset{},
@@ -95,5 +103,20 @@ func AutoMigrate(db *gorm.DB) error {
 
 		// 任务管理
 		&models.AsyncTask{},
-	)
+
+		// Webhook
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+	); err != nil {
+		return err
+	}
+
+	// 服务商名称改为按服务类型唯一，删除旧的名称唯一索引
+	migrator := db.Migrator()
+	if migrator.HasIndex(&models.AIServiceProvider{}, "idx_ai_service_providers_name") {
+		if err := migrator.DropIndex(&models.AIServiceProvider{}, "idx_ai_service_providers_name"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package ffmpeg
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -41,7 +42,8 @@ type MergeOptions struct {
 	Clips      []VideoClip
 }
 
-func (f *FFmpeg) MergeVideos(opts *MergeOptions) (string, error) {
+// MergeVideos 下载、裁剪并合并视频片段，ctx 取消时中止下载并结束正在运行的 ffmpeg 进程
+func (f *FFmpeg) MergeVideos(ctx context.Context, opts *MergeOptions) (string, error) {
 	if len(opts.Clips) == 0 {
 		return "", fmt.Errorf("no video clips to merge")
 	}
@@ -55,7 +57,7 @@ func (f *FFmpeg) MergeVideos(opts *MergeOptions) (string, error) {
 	for i, clip := range opts.Clips {
 		// 下载原始视频
 		downloadPath := filepath.Join(f.tempDir, fmt.Sprintf("download_%d_%d.mp4", time.Now().Unix(), i))
-		localPath, err := f.downloadVideo(clip.URL, downloadPath)
+		localPath, err := f.downloadVideo(ctx, clip.URL, downloadPath)
 		if err != nil {
 			f.cleanup(downloadedPaths)
 			f.cleanup(trimmedPaths)
@@ -65,7 +67,7 @@ func (f *FFmpeg) MergeVideos(opts *MergeOptions) (string, error) {
 
 		// 裁剪视频片段（根据StartTime和EndTime）
 		trimmedPath := filepath.Join(f.tempDir, fmt.Sprintf("trimmed_%d_%d.mp4", time.Now().Unix(), i))
-		err = f.trimVideo(localPath, trimmedPath, clip.StartTime, clip.EndTime)
+		err = f.trimVideo(ctx, localPath, trimmedPath, clip.StartTime, clip.EndTime)
 		if err != nil {
 			f.cleanup(downloadedPaths)
 			f.cleanup(trimmedPaths)
@@ -91,7 +93,7 @@ func (f *FFmpeg) MergeVideos(opts *MergeOptions) (string, error) {
 	}
 
 	// 合并裁剪后的视频片段（支持转场效果）
-	err := f.concatenateVideosWithTransitions(trimmedPaths, opts.Clips, opts.OutputPath)
+	err := f.concatenateVideosWithTransitions(ctx, trimmedPaths, opts.Clips, opts.OutputPath)
 
 	// 清理裁剪后的临时文件
 	f.cleanup(trimmedPaths)
@@ -104,7 +106,7 @@ func (f *FFmpeg) MergeVideos(opts *MergeOptions) (string, error) {
 	return opts.OutputPath, nil
 }
 
-func (f *FFmpeg) downloadVideo(url, destPath string) (string, error) {
+func (f *FFmpeg) downloadVideo(ctx context.Context, url, destPath string) (string, error) {
 	// 检查是否是本地文件路径
 	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
 		// 这是本地文件路径，检查文件是否存在
@@ -137,7 +139,11 @@ func (f *FFmpeg) downloadVideo(url, destPath string) (string, error) {
 	// 远程 URL，需要下载
 	f.log.Infow("Downloading video", "url", url, "dest", destPath)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to download: %w", err)
 	}
@@ -161,7 +167,7 @@ func (f *FFmpeg) downloadVideo(url, destPath string) (string, error) {
 	return destPath, nil
 }
 
-func (f *FFmpeg) trimVideo(inputPath, outputPath string, startTime, endTime float64) error {
+func (f *FFmpeg) trimVideo(ctx context.Context, inputPath, outputPath string, startTime, endTime float64) error {
 	f.log.Infow("Trimming video",
 		"input", inputPath,
 		"output", outputPath,
@@ -173,7 +179,7 @@ func (f *FFmpeg) trimVideo(inputPath, outputPath string, startTime, endTime floa
 	if (startTime == 0 && endTime == 0) || endTime <= startTime {
 		f.log.Infow("No valid trim range, re-encoding entire video")
 
-		cmd := exec.Command("ffmpeg",
+		cmd := exec.CommandContext(ctx, "ffmpeg",
 			"-i", inputPath,
 			"-c:v", "libx264",
 			"-preset", "fast",
@@ -202,7 +208,7 @@ func (f *FFmpeg) trimVideo(inputPath, outputPath string, startTime, endTime floa
 	var cmd *exec.Cmd
 	if endTime > 0 {
 		// 有明确的结束时间
-		cmd = exec.Command("ffmpeg",
+		cmd = exec.CommandContext(ctx, "ffmpeg",
 			"-i", inputPath,
 			"-ss", fmt.Sprintf("%.2f", startTime),
 			"-to", fmt.Sprintf("%.2f", endTime),
@@ -217,7 +223,7 @@ func (f *FFmpeg) trimVideo(inputPath, outputPath string, startTime, endTime floa
 		)
 	} else {
 		// 只有开始时间，裁剪到视频末尾
-		cmd = exec.Command("ffmpeg",
+		cmd = exec.CommandContext(ctx, "ffmpeg",
 			"-i", inputPath,
 			"-ss", fmt.Sprintf("%.2f", startTime),
 			"-c:v", "libx264",
@@ -241,7 +247,7 @@ func (f *FFmpeg) trimVideo(inputPath, outputPath string, startTime, endTime floa
 	return nil
 }
 
-func (f *FFmpeg) concatenateVideosWithTransitions(inputPaths []string, clips []VideoClip, outputPath string) error {
+func (f *FFmpeg) concatenateVideosWithTransitions(ctx context.Context, inputPaths []string, clips []VideoClip, outputPath string) error {
 	if len(inputPaths) == 0 {
 		return fmt.Errorf("no input paths")
 	}
@@ -264,15 +270,15 @@ func (f *FFmpeg) concatenateVideosWithTransitions(inputPaths []string, clips []V
 	// 如果没有转场效果，使用简单拼接
 	if !hasTransitions {
 		f.log.Infow("No transitions, using simple concatenation")
-		return f.concatenateVideos(inputPaths, outputPath)
+		return f.concatenateVideos(ctx, inputPaths, outputPath)
 	}
 
 	// 使用xfade滤镜添加转场效果
 	f.log.Infow("Merging with transitions", "clips_count", len(inputPaths))
-	return f.mergeWithXfade(inputPaths, clips, outputPath)
+	return f.mergeWithXfade(ctx, inputPaths, clips, outputPath)
 }
 
-func (f *FFmpeg) concatenateVideos(inputPaths []string, outputPath string) error {
+func (f *FFmpeg) concatenateVideos(ctx context.Context, inputPaths []string, outputPath string) error {
 	// 创建文件列表
 	listFile := filepath.Join(f.tempDir, fmt.Sprintf("filelist_%d.txt", time.Now().Unix()))
 	defer os.Remove(listFile)
@@ -291,7 +297,7 @@ func (f *FFmpeg) concatenateVideos(inputPaths []string, outputPath string) error
 	// -safe 0: 允许不安全的文件路径
 	// -i: 输入文件列表
 	// -c copy: 直接复制流，不重新编码（速度快）
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-f", "concat",
 		"-safe", "0",
 		"-i", listFile,
@@ -310,7 +316,7 @@ func (f *FFmpeg) concatenateVideos(inputPaths []string, outputPath string) error
 	return nil
 }
 
-func (f *FFmpeg) mergeWithXfade(inputPaths []string, clips []VideoClip, outputPath string) error {
+func (f *FFmpeg) mergeWithXfade(ctx context.Context, inputPaths []string, clips []VideoClip, outputPath string) error {
 	// 使用xfade滤镜进行转场
 	// 构建输入参数
 	args := []string{}
@@ -403,7 +409,7 @@ func (f *FFmpeg) mergeWithXfade(inputPaths []string, clips []VideoClip, outputPa
 	// 如果没有任何转场，使用简单拼接
 	if !hasAnyTransition {
 		f.log.Infow("No transitions detected, using simple concatenation")
-		return f.concatenateVideos(inputPaths, outputPath)
+		return f.concatenateVideos(ctx, inputPaths, outputPath)
 	}
 
 	// 构建转场滤镜，使用缩放后的视频流
@@ -616,7 +622,7 @@ func (f *FFmpeg) mergeWithXfade(inputPaths []string, clips []VideoClip, outputPa
 
 	f.log.Infow("Running FFmpeg with transitions", "filter", fullFilter, "has_any_audio", hasAnyAudio)
 
-	cmd := exec.Command("ffmpeg", args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		f.log.Errorw("FFmpeg xfade failed", "error", err, "output", string(output))
@@ -800,7 +806,7 @@ func (f *FFmpeg) ExtractAudio(videoURL, outputPath string) (string, error) {
 
 	// 下载视频文件
 	downloadPath := filepath.Join(f.tempDir, fmt.Sprintf("video_%d.mp4", time.Now().Unix()))
-	localVideoPath, err := f.downloadVideo(videoURL, downloadPath)
+	localVideoPath, err := f.downloadVideo(context.Background(), videoURL, downloadPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to download video: %w", err)
 	}
@@ -126,6 +126,29 @@ func (s *LocalStorage) DownloadFromURLWithPath(url, category string) (*DownloadR
 	}, nil
 }
 
+// SaveWithPath 把数据保存为新文件，ext 为带点的扩展名，返回详细信息
+func (s *LocalStorage) SaveWithPath(data []byte, ext, category string) (*DownloadResult, error) {
+	dir := filepath.Join(s.basePath, category)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create category directory: %w", err)
+	}
+
+	timestamp := time.Now().Format("20060102_150405")
+	uniqueID := uuid.New().String()[:8]
+	filename := fmt.Sprintf("%s_%s%s", timestamp, uniqueID, ext)
+	filePath := filepath.Join(dir, filename)
+
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return &DownloadResult{
+		URL:          fmt.Sprintf("%s/%s/%s", s.baseURL, category, filename),
+		RelativePath: filepath.Join(category, filename),
+		AbsolutePath: filePath,
+	}, nil
+}
+
 // GetAbsolutePath 根据相对路径获取绝对路径
 func (s *LocalStorage) GetAbsolutePath(relativePath string) string {
 	return filepath.Join(s.basePath, relativePath)
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/drama-generator/backend/api/routes"
+	"github.com/drama-generator/backend/application/services"
 	"github.com/drama-generator/backend/infrastructure/database"
 	"github.com/drama-generator/backend/infrastructure/storage"
 	"github.com/drama-generator/backend/pkg/config"
@@ -57,7 +58,46 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	router := routes.SetupRouter(cfg, db, logr, localStorage)
+	// 全局预算在每次调用AI服务前检查
+	services.SetBudgetConfig(cfg.Budget)
+	// mock 服务商生成的图片和视频放在本地存储下
+	services.SetMockStorage(cfg.Storage)
+	services.SetAICacheConfig(cfg.AI.Cache)
+
+	// 服务商 API Key 加密存储，加密升级前保存的明文 Key
+	if err := services.SetMasterKey(cfg.Security.MasterKey); err != nil {
+		logr.Fatal("Failed to initialize master key", "error", err)
+	}
+	if cfg.Security.MasterKey == "" {
+		logr.Warn("security.master_key is not set, provider API keys are stored in plaintext")
+	}
+	if count, err := services.NewAIService(db, logr).EncryptStoredAPIKeys(); err != nil {
+		logr.Fatal("Failed to encrypt stored API keys", "error", err)
+	} else if count > 0 {
+		logr.Infow("Stored API keys migrated", "count", count)
+	}
+
+	// 内置的服务商模型能力，生成图片/视频前按此校验参数
+	if err := services.NewModelCapabilityService(db, logr).SeedDefaults(); err != nil {
+		logr.Fatal("Failed to seed model capabilities", "error", err)
+	}
+
+	// 初始化持久化任务队列
+	jobQueue := services.NewJobQueue(db, cfg, logr)
+
+	router := routes.SetupRouter(cfg, db, logr, localStorage, jobQueue)
+
+	jobQueue.Start()
+
+	// 定时清理过期任务
+	retentionScheduler := services.NewTaskRetentionScheduler(db, cfg, logr)
+	if err := retentionScheduler.Start(); err != nil {
+		logr.Fatal("Failed to start task retention scheduler", "error", err)
+	}
+
+	// 检查长时间卡在 processing 的任务和生成记录
+	watchdog := services.NewStaleTaskWatchdog(db, cfg, logr)
+	watchdog.Start()
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
@@ -90,8 +130,6 @@ func main() {
 
 	logr.Info("Shutting down server...")
 
-	// 清理资源
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -99,5 +137,10 @@ func main() {
 		logr.Fatal("Server forced to shutdown", "error", err)
 	}
 
+	// 清理资源：停止任务队列，未完成的任务释放租约，下次启动时继续执行
+	jobQueue.Stop(ctx)
+	retentionScheduler.Stop()
+	watchdog.Stop()
+
 	logr.Info("Server exited")
 }
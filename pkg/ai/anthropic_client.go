@@ -0,0 +1,402 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+const (
+	anthropicAPIVersion       = "2023-06-01"
+	anthropicDefaultMaxTokens = 8192
+)
+
+// AnthropicClient 调用 Anthropic Messages API 的文本客户端
+type AnthropicClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// AnthropicMessage Content 为字符串，带图片时为内容块数组
+type AnthropicMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// AnthropicContentBlock 文本或图片内容块
+type AnthropicContentBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *AnthropicImageSource `json:"source,omitempty"`
+}
+
+// AnthropicImageSource 图片来源，data URI 以 base64 发送，其他按 URL 发送
+type AnthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicMessagesRequest 系统提示使用顶层 system 字段，max_tokens 为必填
+type AnthropicMessagesRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []AnthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type AnthropicMessagesResponse struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      AnthropicUsage `json:"usage"`
+}
+
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicError 错误响应及流式 error 事件的结构
+type AnthropicError struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// AnthropicStreamEvent 流式响应中的事件，按 type 区分。输入 token 数在 message_start 中，
+// 输出 token 数在 message_delta 中（累计值）
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *AnthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func NewAnthropicClient(baseURL, apiKey, model, endpoint string) *AnthropicClient {
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	if endpoint == "" {
+		endpoint = "/v1/messages"
+	}
+	return &AnthropicClient{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		APIKey:   apiKey,
+		Model:    model,
+		Endpoint: endpoint,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+// buildRequest 将 OpenAI 格式的消息和选项（max_tokens、temperature、top_p、结构化输出）转换为 Messages 请求，
+// system 消息合并到顶层 system 字段
+func (c *AnthropicClient) buildRequest(messages []ChatMessage, options []func(*ChatCompletionRequest)) *AnthropicMessagesRequest {
+	opts := &ChatCompletionRequest{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	maxTokens := anthropicDefaultMaxTokens
+	if opts.MaxTokens != nil && *opts.MaxTokens > 0 {
+		maxTokens = *opts.MaxTokens
+	} else if opts.MaxCompletionTokens != nil && *opts.MaxCompletionTokens > 0 {
+		maxTokens = *opts.MaxCompletionTokens
+	}
+
+	var systemPrompt string
+	var conversation []AnthropicMessage
+	for _, message := range messages {
+		if message.Role == "system" {
+			if systemPrompt != "" {
+				systemPrompt += "\n\n"
+			}
+			systemPrompt += message.Content
+			continue
+		}
+		conversation = append(conversation, AnthropicMessage{Role: message.Role, Content: anthropicContent(message)})
+	}
+
+	// Messages API 没有通用的 JSON Schema 参数，结构化输出要求写入系统提示，由调用方校验结果
+	if opts.ResponseSchema != nil {
+		if systemPrompt != "" {
+			systemPrompt += "\n\n"
+		}
+		systemPrompt += schemaInstruction(opts.ResponseSchema)
+	}
+
+	req := &AnthropicMessagesRequest{
+		Model:     c.Model,
+		System:    systemPrompt,
+		Messages:  conversation,
+		MaxTokens: maxTokens,
+	}
+	if opts.Temperature != 0 {
+		temperature := opts.Temperature
+		req.Temperature = &temperature
+	}
+	if opts.TopP != 0 {
+		topP := opts.TopP
+		req.TopP = &topP
+	}
+	return req
+}
+
+// anthropicContent 没有图片时使用字符串，否则图片在前、文本在后
+func anthropicContent(message ChatMessage) interface{} {
+	if len(message.Images) == 0 {
+		return message.Content
+	}
+
+	blocks := make([]AnthropicContentBlock, 0, len(message.Images)+1)
+	for _, image := range message.Images {
+		source := &AnthropicImageSource{Type: "url", URL: image}
+		if mediaType, data, err := parseDataURI(image); err == nil {
+			source = &AnthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+		blocks = append(blocks, AnthropicContentBlock{Type: "image", Source: source})
+	}
+	return append(blocks, AnthropicContentBlock{Type: "text", Text: message.Content})
+}
+
+func (c *AnthropicClient) newHTTPRequest(ctx context.Context, reqBody *AnthropicMessagesRequest) (*http.Request, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+c.Endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", c.APIKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	if reqBody.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	return req, nil
+}
+
+func (c *AnthropicClient) GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.Chat(ctx, buildChatMessages(prompt, systemPrompt), options...)
+}
+
+func (c *AnthropicClient) Chat(ctx context.Context, messages []ChatMessage, options ...func(*ChatCompletionRequest)) (string, error) {
+	reqBody := c.buildRequest(messages, options)
+
+	req, err := c.newHTTPRequest(ctx, reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Anthropic: Sending request to: %s, model=%s, max_tokens=%d\n", c.BaseURL+c.Endpoint, c.Model, reqBody.MaxTokens)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Anthropic: API error (status %d): %s\n", resp.StatusCode, string(body))
+		return "", parseAnthropicError(resp.StatusCode, body)
+	}
+
+	var result AnthropicMessagesResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		errorPreview := string(body)
+		if len(body) > 200 {
+			errorPreview = string(body[:200])
+		}
+		return "", fmt.Errorf("parse response: %w, body preview: %s", err, errorPreview)
+	}
+
+	var content strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	fmt.Printf("Anthropic: stop_reason=%s, input_tokens=%d, output_tokens=%d\n",
+		result.StopReason, result.Usage.InputTokens, result.Usage.OutputTokens)
+	ReportUsage(ctx, Usage{PromptTokens: result.Usage.InputTokens, CompletionTokens: result.Usage.OutputTokens})
+
+	return finishAnthropicText(content.String(), result.StopReason)
+}
+
+// GenerateTextStream 以 stream=true 请求，从 content_block_delta 事件中读取文本增量
+func (c *AnthropicClient) GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta StreamHandler, options ...func(*ChatCompletionRequest)) (string, error) {
+	reqBody := c.buildRequest(buildChatMessages(prompt, systemPrompt), options)
+	reqBody.Stream = true
+
+	req, err := c.newHTTPRequest(ctx, reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Anthropic: Sending stream request to: %s, model=%s, max_tokens=%d\n", c.BaseURL+c.Endpoint, c.Model, reqBody.MaxTokens)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Anthropic: API error (status %d): %s\n", resp.StatusCode, string(body))
+		return "", parseAnthropicError(resp.StatusCode, body)
+	}
+
+	var content strings.Builder
+	var stopReason string
+	var usage Usage
+	err = readSSE(resp.Body, func(data string) error {
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("parse stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage.PromptTokens = event.Message.Usage.InputTokens
+				usage.CompletionTokens = event.Message.Usage.OutputTokens
+			}
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				return nil
+			}
+			content.WriteString(event.Delta.Text)
+			if onDelta != nil {
+				return onDelta(event.Delta.Text)
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				stopReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			if event.Error != nil {
+				return utils.NewAPIError(anthropicErrorStatus(event.Error.Type, http.StatusInternalServerError), event.Error.Message)
+			}
+			return fmt.Errorf("stream error event: %s", data)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("read stream: %w", err)
+	}
+
+	fmt.Printf("Anthropic: Stream finished, stop_reason=%s, content_length=%d\n", stopReason, content.Len())
+	ReportUsage(ctx, usage)
+
+	return finishAnthropicText(content.String(), stopReason)
+}
+
+// finishAnthropicText 根据 stop_reason 检查生成结果。max_tokens 截断时仍返回已生成内容，由调用方的 JSON 修复逻辑处理。
+func finishAnthropicText(text string, stopReason string) (string, error) {
+	if stopReason == "refusal" {
+		return "", fmt.Errorf("AI拒绝生成该内容 (stop_reason: %s)", stopReason)
+	}
+	if text == "" {
+		return "", fmt.Errorf("no text in response (stop_reason: %s)", stopReason)
+	}
+	if stopReason == "max_tokens" {
+		fmt.Printf("Anthropic: Response truncated by max_tokens, content_length=%d\n", len(text))
+	}
+	return text, nil
+}
+
+// parseAnthropicError 将错误响应转换为 APIError，保留状态码以便判断是否可重试
+func parseAnthropicError(statusCode int, body []byte) error {
+	var apiErr AnthropicError
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error.Message != "" {
+		return utils.NewAPIError(statusCode, fmt.Sprintf("%s: %s", apiErr.Error.Type, apiErr.Error.Message))
+	}
+	return utils.NewAPIError(statusCode, string(body))
+}
+
+// anthropicErrorStatus 流式 error 事件没有 HTTP 状态码，按错误类型映射
+func anthropicErrorStatus(errorType string, fallback int) int {
+	switch errorType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return 529
+	case "api_error":
+		return http.StatusInternalServerError
+	default:
+		return fallback
+	}
+}
+
+func (c *AnthropicClient) GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	return nil, fmt.Errorf("GenerateImage not supported by Anthropic client")
+}
+
+func (c *AnthropicClient) TestConnection() error {
+	fmt.Printf("Anthropic: TestConnection called with BaseURL=%s, Model=%s, Endpoint=%s\n", c.BaseURL, c.Model, c.Endpoint)
+	_, err := c.GenerateText(context.Background(), "Hello", "", WithMaxTokens(16))
+	if err != nil {
+		fmt.Printf("Anthropic: TestConnection failed: %v\n", err)
+	} else {
+		fmt.Printf("Anthropic: TestConnection succeeded\n")
+	}
+	return err
+}
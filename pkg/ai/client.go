@@ -1,8 +1,17 @@
 package ai
 
-// AIClient 定义文本生成客户端接口
+import "context"
+
+// StreamHandler 流式生成时每收到一段增量文本调用一次，返回错误会中止生成
+type StreamHandler func(delta string) error
+
+// AIClient 定义文本生成客户端接口，ctx 取消时进行中的请求会被中断
 type AIClient interface {
-	GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error)
-	GenerateImage(prompt string, size string, n int) ([]string, error)
+	GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error)
+	// GenerateTextStream 以流式方式生成文本，增量内容通过 onDelta 回调，返回完整文本
+	GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta StreamHandler, options ...func(*ChatCompletionRequest)) (string, error)
+	// Chat 多轮对话，messages 按时间顺序排列（role 为 system、user、assistant），返回助手的回复
+	Chat(ctx context.Context, messages []ChatMessage, options ...func(*ChatCompletionRequest)) (string, error)
+	GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error)
 	TestConnection() error
 }
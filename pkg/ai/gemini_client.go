@@ -2,12 +2,15 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 type GeminiClient struct {
@@ -19,8 +22,15 @@ type GeminiClient struct {
 }
 
 type GeminiTextRequest struct {
-	Contents          []GeminiContent    `json:"contents"`
-	SystemInstruction *GeminiInstruction `json:"systemInstruction,omitempty"`
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiInstruction      `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiGenerationConfig 目前仅用于结构化输出
+type GeminiGenerationConfig struct {
+	ResponseMimeType string                 `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]interface{} `json:"responseSchema,omitempty"`
 }
 
 type GeminiContent struct {
@@ -29,7 +39,14 @@ type GeminiContent struct {
 }
 
 type GeminiPart struct {
-	Text string `json:"text"`
+	Text       string            `json:"text,omitempty"`
+	InlineData *GeminiInlineData `json:"inlineData,omitempty"`
+}
+
+// GeminiInlineData 随请求发送的图片
+type GeminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64 编码的图片数据
 }
 
 type GeminiInstruction struct {
@@ -79,24 +96,15 @@ func NewGeminiClient(baseURL, apiKey, model, endpoint string) *GeminiClient {
 	}
 }
 
-func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
-	model := c.Model
-
-	// 构建请求体
-	reqBody := GeminiTextRequest{
-		Contents: []GeminiContent{
-			{
-				Parts: []GeminiPart{{Text: prompt}},
-				Role:  "user",
-			},
-		},
-	}
+func (c *GeminiClient) GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.Chat(ctx, buildChatMessages(prompt, systemPrompt), options...)
+}
 
-	// 使用 systemInstruction 字段处理系统提示
-	if systemPrompt != "" {
-		reqBody.SystemInstruction = &GeminiInstruction{
-			Parts: []GeminiPart{{Text: systemPrompt}},
-		}
+// Chat 多轮对话，assistant 消息转换为 model 角色，system 消息合并到 systemInstruction
+func (c *GeminiClient) Chat(ctx context.Context, messages []ChatMessage, options ...func(*ChatCompletionRequest)) (string, error) {
+	reqBody, err := buildGeminiTextRequest(messages, options)
+	if err != nil {
+		return "", err
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -107,7 +115,7 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 
 	// 替换端点中的 {model} 占位符
 	endpoint := c.BaseURL + c.Endpoint
-	endpoint = strings.ReplaceAll(endpoint, "{model}", model)
+	endpoint = strings.ReplaceAll(endpoint, "{model}", c.Model)
 	url := fmt.Sprintf("%s?key=%s", endpoint, c.APIKey)
 
 	// 打印请求信息（隐藏 API Key）
@@ -119,7 +127,7 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 	}
 	fmt.Printf("Gemini: Request body: %s\n", requestPreview)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		fmt.Printf("Gemini: Failed to create request: %v\n", err)
 		return "", fmt.Errorf("create request: %w", err)
@@ -145,7 +153,7 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 
 	if resp.StatusCode != http.StatusOK {
 		fmt.Printf("Gemini: API error (status %d): %s\n", resp.StatusCode, string(body))
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return "", utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	// 打印响应体用于调试
@@ -167,6 +175,8 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 
 	fmt.Printf("Gemini: Successfully parsed response, candidates count: %d\n", len(result.Candidates))
 
+	ReportUsage(ctx, Usage{PromptTokens: result.UsageMetadata.PromptTokenCount, CompletionTokens: result.UsageMetadata.CandidatesTokenCount})
+
 	if len(result.Candidates) == 0 {
 		fmt.Printf("Gemini: No candidates in response\n")
 		return "", fmt.Errorf("no candidates in response")
@@ -183,13 +193,145 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 	return responseText, nil
 }
 
-func (c *GeminiClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+// GenerateTextStream 调用 streamGenerateContent（alt=sse）流式生成文本
+func (c *GeminiClient) GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta StreamHandler, options ...func(*ChatCompletionRequest)) (string, error) {
+	reqBody, err := buildGeminiTextRequest(buildChatMessages(prompt, systemPrompt), options)
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	// 配置的端点为 generateContent 时切换到对应的流式方法
+	endpoint := c.BaseURL + strings.Replace(c.Endpoint, ":generateContent", ":streamGenerateContent", 1)
+	endpoint = strings.ReplaceAll(endpoint, "{model}", c.Model)
+	url := fmt.Sprintf("%s?alt=sse&key=%s", endpoint, c.APIKey)
+
+	safeURL := strings.Replace(url, c.APIKey, "***", 1)
+	fmt.Printf("Gemini: Sending stream request to: %s\n", safeURL)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Gemini: API error (status %d): %s\n", resp.StatusCode, string(body))
+		return "", utils.NewAPIError(resp.StatusCode, string(body))
+	}
+
+	var content strings.Builder
+	var finishReason string
+	var usage Usage
+	err = readSSE(resp.Body, func(data string) error {
+		var chunk GeminiTextResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("parse stream chunk: %w", err)
+		}
+		// 每个分片的 usageMetadata 都是累计值，保留最后一次
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			usage = Usage{PromptTokens: chunk.UsageMetadata.PromptTokenCount, CompletionTokens: chunk.UsageMetadata.CandidatesTokenCount}
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+
+		candidate := chunk.Candidates[0]
+		if candidate.FinishReason != "" {
+			finishReason = candidate.FinishReason
+		}
+		for _, part := range candidate.Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			content.WriteString(part.Text)
+			if onDelta != nil {
+				if err := onDelta(part.Text); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("read stream: %w", err)
+	}
+
+	fmt.Printf("Gemini: Stream finished, finish_reason=%s, content_length=%d\n", finishReason, content.Len())
+
+	ReportUsage(ctx, usage)
+
+	if finishReason == "SAFETY" {
+		return "", fmt.Errorf("AI内容被安全过滤器拦截 (finish_reason: %s)", finishReason)
+	}
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no text in stream response (finish_reason: %s)", finishReason)
+	}
+
+	return content.String(), nil
+}
+
+// buildGeminiTextRequest 构建请求体，使用 systemInstruction 字段处理系统提示，消息中的图片作为 inlineData 发送，
+// 指定了 ResponseSchema 时通过 responseSchema 约束输出
+func buildGeminiTextRequest(messages []ChatMessage, options []func(*ChatCompletionRequest)) (GeminiTextRequest, error) {
+	reqBody := GeminiTextRequest{Contents: []GeminiContent{}}
+
+	var systemParts []GeminiPart
+	for _, message := range messages {
+		if message.Role == "system" {
+			systemParts = append(systemParts, GeminiPart{Text: message.Content})
+			continue
+		}
+
+		parts := []GeminiPart{{Text: message.Content}}
+		for _, image := range message.Images {
+			mimeType, data, err := parseDataURI(image)
+			if err != nil {
+				return reqBody, fmt.Errorf("gemini: %w", err)
+			}
+			parts = append(parts, GeminiPart{InlineData: &GeminiInlineData{MimeType: mimeType, Data: data}})
+		}
+		role := "user"
+		if message.Role == "assistant" {
+			role = "model"
+		}
+		reqBody.Contents = append(reqBody.Contents, GeminiContent{Parts: parts, Role: role})
+	}
+	if len(systemParts) > 0 {
+		reqBody.SystemInstruction = &GeminiInstruction{Parts: systemParts}
+	}
+
+	opts := &ChatCompletionRequest{}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.ResponseSchema != nil {
+		reqBody.GenerationConfig = &GeminiGenerationConfig{
+			ResponseMimeType: "application/json",
+			ResponseSchema:   geminiSchema(opts.ResponseSchema.Schema),
+		}
+	}
+	return reqBody, nil
+}
+
+func (c *GeminiClient) GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error) {
 	return nil, fmt.Errorf("GenerateImage not implemented for Gemini client")
 }
 
 func (c *GeminiClient) TestConnection() error {
 	fmt.Printf("Gemini: TestConnection called with BaseURL=%s, Model=%s, Endpoint=%s\n", c.BaseURL, c.Model, c.Endpoint)
-	_, err := c.GenerateText("Hello", "")
+	_, err := c.GenerateText(context.Background(), "Hello", "")
 	if err != nil {
 		fmt.Printf("Gemini: TestConnection failed: %v\n", err)
 	} else {
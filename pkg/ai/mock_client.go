@@ -0,0 +1,230 @@
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// mockArrayLength mock 结果中对象数组的元素个数
+const mockArrayLength = 3
+
+// mockStreamChunkRunes 流式输出时每段增量的字符数
+const mockStreamChunkRunes = 16
+
+// mockStringValues 按字段名返回的示例文字，相同提示词选取相同的值
+var mockStringValues = map[string][]string{
+	"name":         {"林晓", "陈默", "苏雨", "老周"},
+	"role":         {"main", "supporting", "minor"},
+	"appearance":   {"二十多岁，黑色短发，穿浅灰色风衣", "三十岁左右，戴眼镜，衬衫袖口卷起", "少女，扎马尾，背着帆布包"},
+	"personality":  {"沉稳冷静，话不多", "热情冲动，讲义气", "敏感细腻，观察力强"},
+	"description":  {"故事的核心人物，推动主要情节发展", "与主角关系密切，关键时刻出手相助", "看似普通，实则隐藏着秘密"},
+	"title":        {"初遇", "对峙", "转折", "余波"},
+	"shot_type":    {"全景", "中景", "近景", "特写"},
+	"angle":        {"平视", "俯视", "仰视"},
+	"time":         {"清晨", "午后", "黄昏", "深夜"},
+	"location":     {"城市街角", "咖啡馆", "旧仓库", "天台"},
+	"movement":     {"固定镜头", "缓慢推进", "横移跟拍"},
+	"action":       {"主角推门走进房间，环顾四周", "两人隔着桌子对视，气氛紧张", "她转身离开，脚步越来越快"},
+	"dialogue":     {"林晓：你终于来了。", "陈默：这件事没那么简单。", ""},
+	"result":       {"人物停在画面中央，表情复杂", "镜头定格在桌上的旧照片", "背影消失在街道尽头"},
+	"atmosphere":   {"安静压抑", "温暖明亮", "紧张悬疑"},
+	"emotion":      {"平静", "紧张", "释然"},
+	"sound_effect": {"脚步声", "雨声", "门轴吱呀声"},
+	"type":         {"道具", "武器", "日常用品"},
+	"prompt": {
+		"cinematic shot of a quiet city street at dusk, soft warm light, anime style",
+		"close-up of a young woman looking out of a rainy window, muted colors",
+		"wide shot of an abandoned warehouse interior, volumetric light, dust particles",
+	},
+	"image_prompt": {
+		"an old brass pocket watch on a wooden table, studio lighting",
+		"a worn leather notebook with a red ribbon, soft focus background",
+		"a folded paper umbrella leaning against a wall, anime style",
+	},
+	"bgm_prompt": {"soft piano, slow tempo", "tense strings, low drums", "light acoustic guitar"},
+}
+
+// MockClient 内置的离线文本客户端，不访问网络。按请求的 JSON Schema 返回确定的示例数据，
+// 相同提示词得到相同结果，用于无服务商密钥时跑通完整流程
+type MockClient struct {
+	Model    string
+	Settings utils.MockSettings
+}
+
+func NewMockClient(model string, settings utils.MockSettings) *MockClient {
+	return &MockClient{Model: model, Settings: settings}
+}
+
+func (c *MockClient) GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	req := &ChatCompletionRequest{Model: c.Model}
+	for _, option := range options {
+		option(req)
+	}
+
+	if err := c.Settings.Simulate(ctx); err != nil {
+		return "", err
+	}
+
+	text, err := c.respond(req, prompt, systemPrompt)
+	if err != nil {
+		return "", err
+	}
+	ReportUsage(ctx, mockUsage(prompt+systemPrompt, text))
+	return text, nil
+}
+
+func (c *MockClient) GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta StreamHandler, options ...func(*ChatCompletionRequest)) (string, error) {
+	req := &ChatCompletionRequest{Model: c.Model}
+	for _, option := range options {
+		option(req)
+	}
+
+	if err := c.Settings.Simulate(ctx); err != nil {
+		return "", err
+	}
+
+	text, err := c.respond(req, prompt, systemPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	runes := []rune(text)
+	for start := 0; start < len(runes); start += mockStreamChunkRunes {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		end := start + mockStreamChunkRunes
+		if end > len(runes) {
+			end = len(runes)
+		}
+		if onDelta != nil {
+			if err := onDelta(string(runes[start:end])); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	ReportUsage(ctx, mockUsage(prompt+systemPrompt, text))
+	return text, nil
+}
+
+// Chat 将对话历史合并为提示词生成，相同对话得到相同结果
+func (c *MockClient) Chat(ctx context.Context, messages []ChatMessage, options ...func(*ChatCompletionRequest)) (string, error) {
+	var systemPrompt, prompt strings.Builder
+	for _, message := range messages {
+		if message.Role == "system" {
+			systemPrompt.WriteString(message.Content + "\n")
+			continue
+		}
+		prompt.WriteString(message.Role + ": " + message.Content + "\n")
+		for _, image := range message.Images {
+			prompt.WriteString(fmt.Sprintf("[image %08x]\n", uint32(utils.MockSeed(image))))
+		}
+	}
+	return c.GenerateText(ctx, prompt.String(), systemPrompt.String(), options...)
+}
+
+// GenerateImage 返回 data URI 形式的占位图
+func (c *MockClient) GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	if err := c.Settings.Simulate(ctx); err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	width, height := 1024, 1024
+	if _, err := fmt.Sscanf(size, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		width, height = 1024, 1024
+	}
+
+	urls := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		seed := utils.MockSeed(c.Model, prompt, fmt.Sprint(i))
+		data, err := utils.RenderPlaceholderPNG(width, height, "MOCK "+c.Model, prompt, seed)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, "data:image/png;base64,"+base64.StdEncoding.EncodeToString(data))
+	}
+
+	ReportUsage(ctx, Usage{Images: len(urls)})
+	return urls, nil
+}
+
+func (c *MockClient) TestConnection() error {
+	return nil
+}
+
+// mockUsage 按约 4 字节一个 token 估算用量
+func mockUsage(input, output string) Usage {
+	return Usage{PromptTokens: (len(input) + 3) / 4, CompletionTokens: (len(output) + 3) / 4}
+}
+
+// respond 有 Schema 时按 Schema 生成 JSON，否则返回固定格式的文字
+func (c *MockClient) respond(req *ChatCompletionRequest, prompt, systemPrompt string) (string, error) {
+	seed := utils.MockSeed(c.Model, systemPrompt, prompt)
+	if req.ResponseSchema == nil || req.ResponseSchema.Schema == nil {
+		return fmt.Sprintf("[mock:%s] 这是针对提示词 #%08x 的示例回复，共 %d 个字符。", c.Model, uint32(seed), len([]rune(prompt))), nil
+	}
+
+	data, err := json.MarshalIndent(mockValue(req.ResponseSchema.Schema, "", 0, seed), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("mock: failed to build response: %w", err)
+	}
+	return string(data), nil
+}
+
+// mockValue 按 Schema 生成示例值，field 为所在字段名，index 为所在数组元素的序号
+func mockValue(schema *utils.JSONSchema, field string, index int, seed uint64) interface{} {
+	switch schema.Type {
+	case "object":
+		obj := make(map[string]interface{}, len(schema.Properties))
+		for _, name := range schema.PropertyOrder {
+			obj[name] = mockValue(schema.Properties[name], name, index, seed)
+		}
+		return obj
+	case "array":
+		items := []interface{}{}
+		if schema.Items == nil {
+			return items
+		}
+		switch {
+		case schema.Items.Type == "object":
+			for i := 0; i < mockArrayLength; i++ {
+				items = append(items, mockValue(schema.Items, field, i, seed))
+			}
+		case schema.Items.Type == "string":
+			items = append(items, mockValue(schema.Items, field, index, seed))
+		case strings.HasSuffix(field, "_numbers"):
+			// 编号列表指向生成结果中的序号，其他 ID 列表可能引用不存在的记录，保持为空
+			items = append(items, index+1)
+		}
+		return items
+	case "integer":
+		switch {
+		case schema.Nullable && strings.HasSuffix(field, "_id"):
+			return nil
+		case field == "duration":
+			return 4 + int((seed+uint64(index))%4)
+		default:
+			return index + 1
+		}
+	case "number":
+		return 0.5
+	case "boolean":
+		return index == 0
+	case "string":
+		if values, ok := mockStringValues[field]; ok {
+			return values[(seed+uint64(index))%uint64(len(values))]
+		}
+		return fmt.Sprintf("mock %s %d", field, index+1)
+	default:
+		return nil
+	}
+}
@@ -2,12 +2,16 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 type OpenAIClient struct {
@@ -21,16 +25,34 @@ type OpenAIClient struct {
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Images 随消息发送的图片（URL 或 data URI），需要模型支持图片输入；Gemini 只支持 data URI
+	Images []string `json:"-"`
 }
 
 type ChatCompletionRequest struct {
-	Model               string        `json:"model"`
-	Messages            []ChatMessage `json:"messages"`
-	Temperature         float64       `json:"temperature,omitempty"`
-	MaxTokens           *int          `json:"max_tokens,omitempty"`
-	MaxCompletionTokens *int          `json:"max_completion_tokens,omitempty"`
-	TopP                float64       `json:"top_p,omitempty"`
-	Stream              bool          `json:"stream,omitempty"`
+	Model               string          `json:"model"`
+	Messages            []ChatMessage   `json:"messages"`
+	Temperature         float64         `json:"temperature,omitempty"`
+	MaxTokens           *int            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
+	TopP                float64         `json:"top_p,omitempty"`
+	Stream              bool            `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat      *ResponseFormat `json:"response_format,omitempty"`
+	// ResponseSchema 结构化输出的原始 Schema，非 OpenAI 格式的客户端据此转换为自身的参数
+	ResponseSchema *ResponseSchema `json:"-"`
+}
+
+// StreamOptions include_usage 为 true 时，流式响应的最后一个分片携带 usage
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatUsage token 用量
+type ChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 type ChatCompletionResponse struct {
@@ -46,11 +68,24 @@ type ChatCompletionResponse struct {
 		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage ChatUsage `json:"usage"`
+}
+
+// ChatCompletionChunk 流式响应中的单个增量
+type ChatCompletionChunk struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *ChatUsage `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
 }
 
 type ImageGenerationRequest struct {
@@ -92,7 +127,7 @@ func NewOpenAIClient(baseURL, apiKey, model, endpoint string) *OpenAIClient {
 	}
 }
 
-func (c *OpenAIClient) ChatCompletion(messages []ChatMessage, options ...func(*ChatCompletionRequest)) (*ChatCompletionResponse, error) {
+func (c *OpenAIClient) ChatCompletion(ctx context.Context, messages []ChatMessage, options ...func(*ChatCompletionRequest)) (*ChatCompletionResponse, error) {
 	req := &ChatCompletionRequest{
 		Model:    c.Model,
 		Messages: messages,
@@ -102,28 +137,23 @@ func (c *OpenAIClient) ChatCompletion(messages []ChatMessage, options ...func(*C
 		option(req)
 	}
 
-	return c.sendChatRequest(req)
+	return c.sendChatRequest(ctx, req)
 }
 
-func (c *OpenAIClient) sendChatRequest(req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
-	resp, err := c.doChatRequest(req)
+func (c *OpenAIClient) sendChatRequest(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	resp, err := c.doChatRequest(ctx, req)
 	if err == nil {
 		return resp, nil
 	}
 
-	if shouldRetryWithMaxCompletionTokens(err, req) {
-		tokens := *req.MaxTokens
-		retryReq := *req
-		retryReq.MaxTokens = nil
-		retryReq.MaxCompletionTokens = &tokens
-		fmt.Printf("OpenAI: retrying with max_completion_tokens=%d\n", tokens)
-		return c.doChatRequest(&retryReq)
+	if retryReq := fallbackChatRequest(err, req); retryReq != nil {
+		return c.sendChatRequest(ctx, retryReq)
 	}
 
 	return nil, err
 }
 
-func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+func (c *OpenAIClient) doChatRequest(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	jsonData, err := json.Marshal(req)
 	if err != nil {
 		fmt.Printf("OpenAI: Failed to marshal request: %v\n", err)
@@ -141,7 +171,7 @@ func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletio
 	}
 	fmt.Printf("OpenAI: Request body: %s\n", requestPreview)
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		fmt.Printf("OpenAI: Failed to create request: %v\n", err)
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -170,9 +200,9 @@ func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletio
 		fmt.Printf("OpenAI: API error (status %d): %s\n", resp.StatusCode, string(body))
 		var errResp ErrorResponse
 		if err := json.Unmarshal(body, &errResp); err != nil {
-			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+			return nil, utils.NewAPIError(resp.StatusCode, string(body))
 		}
-		return nil, fmt.Errorf("API error: %s", errResp.Error.Message)
+		return nil, utils.NewAPIError(resp.StatusCode, errResp.Error.Message)
 	}
 
 	// 打印响应体用于调试
@@ -194,6 +224,8 @@ func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletio
 
 	fmt.Printf("OpenAI: Successfully parsed response, choices count: %d\n", len(chatResp.Choices))
 
+	ReportUsage(ctx, Usage{PromptTokens: chatResp.Usage.PromptTokens, CompletionTokens: chatResp.Usage.CompletionTokens})
+
 	if len(chatResp.Choices) == 0 {
 		fmt.Printf("OpenAI: No choices in response\n")
 		return nil, fmt.Errorf("no choices in response")
@@ -219,6 +251,123 @@ func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletio
 	return &chatResp, nil
 }
 
+// ChatCompletionStream 以 SSE 流式请求对话补全，增量内容通过 onDelta 回调，返回完整文本
+func (c *OpenAIClient) ChatCompletionStream(ctx context.Context, messages []ChatMessage, onDelta StreamHandler, options ...func(*ChatCompletionRequest)) (string, error) {
+	req := &ChatCompletionRequest{
+		Model:    c.Model,
+		Messages: messages,
+	}
+
+	for _, option := range options {
+		option(req)
+	}
+	req.Stream = true
+	req.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	text, err := c.doChatStreamRequest(ctx, req, onDelta)
+	if err == nil {
+		return text, nil
+	}
+
+	// 参数错误在开始输出前返回，此时重试不会重复回调增量
+	for retryReq := fallbackChatRequest(err, req); retryReq != nil; retryReq = fallbackChatRequest(err, req) {
+		req = retryReq
+		text, err = c.doChatStreamRequest(ctx, req, onDelta)
+		if err == nil {
+			return text, nil
+		}
+	}
+
+	return "", err
+}
+
+func (c *OpenAIClient) doChatStreamRequest(ctx context.Context, req *ChatCompletionRequest, onDelta StreamHandler) (string, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := c.BaseURL + c.Endpoint
+	fmt.Printf("OpenAI: Sending stream request to: %s, Model=%s\n", url, c.Model)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("OpenAI: API error (status %d): %s\n", resp.StatusCode, string(body))
+		var errResp ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error.Message == "" {
+			return "", utils.NewAPIError(resp.StatusCode, string(body))
+		}
+		return "", utils.NewAPIError(resp.StatusCode, errResp.Error.Message)
+	}
+
+	var content strings.Builder
+	var finishReason string
+	var usage ChatUsage
+	err = readSSE(resp.Body, func(data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("stream error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+		if choice.Delta.Content == "" {
+			return nil
+		}
+		content.WriteString(choice.Delta.Content)
+		if onDelta != nil {
+			return onDelta(choice.Delta.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	fmt.Printf("OpenAI: Stream finished, finish_reason=%s, content_length=%d\n", finishReason, content.Len())
+
+	ReportUsage(ctx, Usage{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens})
+
+	if finishReason == "content_filter" {
+		return "", fmt.Errorf("AI内容被安全过滤器拦截，可能因为：\n1. 请求内容触发了安全策略\n2. 生成的内容包含敏感信息\n3. 建议：调整输入内容或联系API提供商调整过滤策略")
+	}
+	if content.Len() == 0 {
+		return "", fmt.Errorf("AI返回内容为空 (finish_reason: %s)", finishReason)
+	}
+
+	return content.String(), nil
+}
+
 func WithTemperature(temp float64) func(*ChatCompletionRequest) {
 	return func(req *ChatCompletionRequest) {
 		req.Temperature = temp
@@ -237,7 +386,28 @@ func WithTopP(topP float64) func(*ChatCompletionRequest) {
 	}
 }
 
-func (c *OpenAIClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+func (c *OpenAIClient) GenerateText(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.Chat(ctx, buildChatMessages(prompt, systemPrompt), options...)
+}
+
+func (c *OpenAIClient) Chat(ctx context.Context, messages []ChatMessage, options ...func(*ChatCompletionRequest)) (string, error) {
+	resp, err := c.ChatCompletion(ctx, messages, options...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from API")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (c *OpenAIClient) GenerateTextStream(ctx context.Context, prompt string, systemPrompt string, onDelta StreamHandler, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.ChatCompletionStream(ctx, buildChatMessages(prompt, systemPrompt), onDelta, options...)
+}
+
+func buildChatMessages(prompt string, systemPrompt string) []ChatMessage {
 	messages := []ChatMessage{}
 
 	if systemPrompt != "" {
@@ -251,20 +421,10 @@ func (c *OpenAIClient) GenerateText(prompt string, systemPrompt string, options
 		Role:    "user",
 		Content: prompt,
 	})
-
-	resp, err := c.ChatCompletion(messages, options...)
-	if err != nil {
-		return "", err
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from API")
-	}
-
-	return resp.Choices[0].Message.Content, nil
+	return messages
 }
 
-func (c *OpenAIClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+func (c *OpenAIClient) GenerateImage(ctx context.Context, prompt string, size string, n int) ([]string, error) {
 	// 图片生成端点通常是 /v1/images/generations
 	// 如果 c.Endpoint 是 chat 端点，我们需要将其替换
 	// 这是一个简单的处理逻辑，实际可能需要更复杂的配置
@@ -285,7 +445,7 @@ func (c *OpenAIClient) GenerateImage(prompt string, size string, n int) ([]strin
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -307,9 +467,9 @@ func (c *OpenAIClient) GenerateImage(prompt string, size string, n int) ([]strin
 	if resp.StatusCode != http.StatusOK {
 		var errResp ErrorResponse
 		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
-			return nil, fmt.Errorf("API error: %s", errResp.Error.Message)
+			return nil, utils.NewAPIError(resp.StatusCode, errResp.Error.Message)
 		}
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var imgResp ImageGenerationResponse
@@ -327,6 +487,7 @@ func (c *OpenAIClient) GenerateImage(prompt string, size string, n int) ([]strin
 		}
 	}
 
+	ReportUsage(ctx, Usage{Images: len(urls)})
 	return urls, nil
 }
 
@@ -340,7 +501,7 @@ func (c *OpenAIClient) TestConnection() error {
 		},
 	}
 
-	_, err := c.ChatCompletion(messages, WithMaxTokens(50))
+	_, err := c.ChatCompletion(context.Background(), messages, WithMaxTokens(50))
 	if err != nil {
 		fmt.Printf("OpenAI: TestConnection failed: %v\n", err)
 	} else {
@@ -349,6 +510,33 @@ func (c *OpenAIClient) TestConnection() error {
 	return err
 }
 
+// fallbackChatRequest 根据参数错误返回去掉不受支持参数后的请求，无需重试时返回 nil
+func fallbackChatRequest(err error, req *ChatCompletionRequest) *ChatCompletionRequest {
+	if shouldRetryWithMaxCompletionTokens(err, req) {
+		tokens := *req.MaxTokens
+		retryReq := *req
+		retryReq.MaxTokens = nil
+		retryReq.MaxCompletionTokens = &tokens
+		fmt.Printf("OpenAI: retrying with max_completion_tokens=%d\n", tokens)
+		return &retryReq
+	}
+	if shouldRetryWithoutStreamOptions(err, req) {
+		// 部分 OpenAI 兼容厂商不支持 stream_options，去掉后无法统计流式用量
+		retryReq := *req
+		retryReq.StreamOptions = nil
+		fmt.Printf("OpenAI: stream_options not supported, retrying without it\n")
+		return &retryReq
+	}
+	if shouldRetryWithoutResponseFormat(err, req) {
+		// 部分 OpenAI 兼容厂商不支持 json_schema，退回普通输出，由调用方校验结果
+		retryReq := *req
+		retryReq.ResponseFormat = nil
+		fmt.Printf("OpenAI: response_format not supported, retrying without it\n")
+		return &retryReq
+	}
+	return nil
+}
+
 func shouldRetryWithMaxCompletionTokens(err error, req *ChatCompletionRequest) bool {
 	if err == nil || req == nil || req.MaxTokens == nil || req.MaxCompletionTokens != nil {
 		return false
@@ -366,3 +554,28 @@ func shouldRetryWithMaxCompletionTokens(err error, req *ChatCompletionRequest) b
 	}
 	return false
 }
+
+func shouldRetryWithoutStreamOptions(err error, req *ChatCompletionRequest) bool {
+	if err == nil || req == nil || req.StreamOptions == nil {
+		return false
+	}
+
+	var apiErr *utils.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode < 400 || apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.Message), "stream_options")
+}
+
+func shouldRetryWithoutResponseFormat(err error, req *ChatCompletionRequest) bool {
+	if err == nil || req == nil || req.ResponseFormat == nil {
+		return false
+	}
+
+	var apiErr *utils.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode < 400 || apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "response_format") || strings.Contains(msg, "json_schema")
+}
@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// errStreamDone 由事件处理函数返回，表示流已正常结束（如 OpenAI 的 [DONE]）
+var errStreamDone = errors.New("stream done")
+
+// readSSE 逐条读取 text/event-stream 响应中的 data 字段，多行 data 以换行拼接。
+// handle 返回 errStreamDone 时停止读取并视为正常结束。
+func readSSE(r io.Reader, handle func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var data strings.Builder
+	flush := func() error {
+		if data.Len() == 0 {
+			return nil
+		}
+		event := data.String()
+		data.Reset()
+		return handle(event)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := flush(); err != nil {
+				return ignoreStreamDone(err)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ignoreStreamDone(flush())
+}
+
+func ignoreStreamDone(err error) error {
+	if errors.Is(err, errStreamDone) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// ResponseSchema 结构化输出要求：模型只输出符合 Schema 的 JSON
+type ResponseSchema struct {
+	Name   string
+	Schema *utils.JSONSchema
+}
+
+// ResponseFormat OpenAI 的 response_format 参数
+type ResponseFormat struct {
+	Type       string              `json:"type"`
+	JSONSchema *ResponseJSONSchema `json:"json_schema,omitempty"`
+}
+
+type ResponseJSONSchema struct {
+	Name   string                 `json:"name"`
+	Strict bool                   `json:"strict"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// WithResponseSchema 要求模型按 Schema 输出 JSON。OpenAI 使用 response_format: json_schema，
+// Gemini 使用 responseSchema，Anthropic 将 Schema 写入系统提示。
+func WithResponseSchema(name string, schema *utils.JSONSchema) func(*ChatCompletionRequest) {
+	return func(req *ChatCompletionRequest) {
+		req.ResponseSchema = &ResponseSchema{Name: name, Schema: schema}
+		req.ResponseFormat = &ResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &ResponseJSONSchema{
+				Name:   name,
+				Strict: strictSchemaSupported(schema),
+				Schema: openAISchema(schema),
+			},
+		}
+	}
+}
+
+// openAISchema 转换为 OpenAI strict 模式要求的格式：所有字段必填、禁止额外字段，
+// 可选字段和指针字段改为允许 null
+func openAISchema(schema *utils.JSONSchema) map[string]interface{} {
+	out := map[string]interface{}{}
+	if schema.Type != "" {
+		if schema.Nullable {
+			out["type"] = []string{schema.Type, "null"}
+		} else {
+			out["type"] = schema.Type
+		}
+	}
+
+	switch schema.Type {
+	case "object":
+		required := make(map[string]bool, len(schema.Required))
+		for _, name := range schema.Required {
+			required[name] = true
+		}
+
+		properties := make(map[string]interface{}, len(schema.PropertyOrder))
+		for _, name := range schema.PropertyOrder {
+			child := *schema.Properties[name]
+			if !required[name] {
+				child.Nullable = true
+			}
+			properties[name] = openAISchema(&child)
+		}
+		out["properties"] = properties
+		out["required"] = append([]string{}, schema.PropertyOrder...)
+		out["additionalProperties"] = false
+	case "array":
+		if schema.Items != nil {
+			out["items"] = openAISchema(schema.Items)
+		}
+	}
+	return out
+}
+
+// strictSchemaSupported strict 模式要求每个字段都有确定类型，且对象必须声明属性
+func strictSchemaSupported(schema *utils.JSONSchema) bool {
+	switch schema.Type {
+	case "":
+		return false
+	case "object":
+		if len(schema.PropertyOrder) == 0 {
+			return false
+		}
+		for _, name := range schema.PropertyOrder {
+			if !strictSchemaSupported(schema.Properties[name]) {
+				return false
+			}
+		}
+	case "array":
+		return schema.Items != nil && strictSchemaSupported(schema.Items)
+	}
+	return true
+}
+
+// geminiSchema 转换为 Gemini responseSchema（OpenAPI Schema 子集）
+func geminiSchema(schema *utils.JSONSchema) map[string]interface{} {
+	out := map[string]interface{}{}
+	if schema.Type != "" {
+		out["type"] = strings.ToUpper(schema.Type)
+	}
+	if schema.Nullable {
+		out["nullable"] = true
+	}
+
+	switch schema.Type {
+	case "object":
+		if len(schema.PropertyOrder) > 0 {
+			properties := make(map[string]interface{}, len(schema.PropertyOrder))
+			for _, name := range schema.PropertyOrder {
+				properties[name] = geminiSchema(schema.Properties[name])
+			}
+			out["properties"] = properties
+			out["propertyOrdering"] = schema.PropertyOrder
+		}
+		if len(schema.Required) > 0 {
+			out["required"] = schema.Required
+		}
+	case "array":
+		if schema.Items != nil {
+			out["items"] = geminiSchema(schema.Items)
+		}
+	}
+	return out
+}
+
+// schemaInstruction 供不支持原生结构化输出的接口使用，将 Schema 附加到系统提示中
+func schemaInstruction(schema *ResponseSchema) string {
+	data, err := json.Marshal(openAISchema(schema.Schema))
+	if err != nil {
+		return ""
+	}
+	return "Respond with a single JSON value only, without markdown code blocks or any other text. It must conform to this JSON Schema:\n" + string(data)
+}
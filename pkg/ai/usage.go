@@ -0,0 +1,33 @@
+package ai
+
+import "context"
+
+// Usage 单次调用的用量，由客户端根据响应上报
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	Images           int
+	VideoSeconds     int
+}
+
+// Add 累加用量
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.Images += other.Images
+	u.VideoSeconds += other.VideoSeconds
+}
+
+type usageCollectorKey struct{}
+
+// WithUsageCollector 返回带用量收集器的 context，客户端通过 ReportUsage 上报的用量会回调 collect
+func WithUsageCollector(ctx context.Context, collect func(Usage)) context.Context {
+	return context.WithValue(ctx, usageCollectorKey{}, collect)
+}
+
+// ReportUsage 上报一次调用的用量，ctx 中没有收集器时忽略
+func ReportUsage(ctx context.Context, usage Usage) {
+	if collect, ok := ctx.Value(usageCollectorKey{}).(func(Usage)); ok {
+		collect(usage)
+	}
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// chatContentPart OpenAI 多模态消息的内容片段
+type chatContentPart struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+type chatImageURL struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON 带图片时 content 使用文本加图片的片段数组，否则保持字符串
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	if len(m.Images) == 0 {
+		return json.Marshal(struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}{m.Role, m.Content})
+	}
+
+	parts := []chatContentPart{{Type: "text", Text: m.Content}}
+	for _, image := range m.Images {
+		parts = append(parts, chatContentPart{Type: "image_url", ImageURL: &chatImageURL{URL: image}})
+	}
+	return json.Marshal(struct {
+		Role    string            `json:"role"`
+		Content []chatContentPart `json:"content"`
+	}{m.Role, parts})
+}
+
+// parseDataURI 解析 data:<mime>;base64,<data> 格式的图片，返回 MIME 类型和 base64 数据
+func parseDataURI(uri string) (string, string, error) {
+	if !strings.HasPrefix(uri, "data:") {
+		return "", "", fmt.Errorf("image must be a data URI")
+	}
+	header, data, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", "", fmt.Errorf("image must be a base64 data URI")
+	}
+	mimeType := strings.TrimSuffix(header, ";base64")
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	return mimeType, data, nil
+}
@@ -13,6 +13,9 @@ type Config struct {
 	Storage  StorageConfig  `mapstructure:"storage"`
 	AI       AIConfig       `mapstructure:"ai"`
 	Style    StyleConfig    `mapstructure:"style"`
+	Jobs     JobsConfig     `mapstructure:"jobs"`
+	Budget   BudgetConfig   `mapstructure:"budget"`
+	Security SecurityConfig `mapstructure:"security"`
 }
 
 type AppConfig struct {
@@ -53,6 +56,28 @@ type AIConfig struct {
 	DefaultTextProvider  string `mapstructure:"default_text_provider"`
 	DefaultImageProvider string `mapstructure:"default_image_provider"`
 	DefaultVideoProvider string `mapstructure:"default_video_provider"`
+	// 文本请求的响应缓存
+	Cache AICacheConfig `mapstructure:"cache"`
+	// 分镜图片生成后的画面质检
+	ImageQA ImageQAConfig `mapstructure:"image_qa"`
+}
+
+type AICacheConfig struct {
+	// 是否缓存文本请求的响应，相同的服务商、模型、提示词和参数直接返回缓存结果
+	Enabled bool `mapstructure:"enabled"`
+	// 缓存有效期（小时），0 时使用 24 小时
+	TTLHours int `mapstructure:"ttl_hours"`
+}
+
+type ImageQAConfig struct {
+	// 是否在分镜图片生成后用支持图片输入的文本模型检查画面与分镜是否一致
+	Enabled bool `mapstructure:"enabled"`
+	// 质检使用的模型，为空时使用默认文本配置
+	Model string `mapstructure:"model"`
+	// 合格分数（0-100），0 时使用 60
+	MinScore int `mapstructure:"min_score"`
+	// 低于合格分数时是否自动重新生成一次
+	AutoRegenerate bool `mapstructure:"auto_regenerate"`
 }
 
 type StyleConfig struct {
@@ -76,6 +101,66 @@ type StyleConfig struct {
 	DefaultSceneRatio string `mapstructure:"default_scene_ratio"`
 	// 默认角色比例
 	DefaultRoleRatio string `mapstructure:"default_role_ratio"`
+	// 图片下载后按比例裁剪、缩放并生成缩略图
+	ImageProcessing ImageProcessingConfig `mapstructure:"image_processing"`
+}
+
+type ImageProcessingConfig struct {
+	// 是否对生成完成的图片做后处理
+	Enabled bool `mapstructure:"enabled"`
+	// 比例不一致时的处理方式：crop 居中裁剪（默认），pad 补边
+	Fit string `mapstructure:"fit"`
+	// 补边颜色（#RRGGBB），为空时使用黑色
+	PadColor string `mapstructure:"pad_color"`
+	// 交付图片的长边像素，0 时保持裁剪后的尺寸
+	DeliverySize int `mapstructure:"delivery_size"`
+	// 缩略图的长边像素，0 时使用 320
+	ThumbnailSize int `mapstructure:"thumbnail_size"`
+}
+
+type JobsConfig struct {
+	// 轮询待执行任务的间隔（秒）
+	PollInterval int `mapstructure:"poll_interval"`
+	// 租约时长（秒），worker 崩溃后任务在租约过期时重新入队
+	LeaseSeconds int `mapstructure:"lease_seconds"`
+	// 未单独配置的任务类型的默认并发数
+	DefaultConcurrency int `mapstructure:"default_concurrency"`
+	// 按任务类型配置的并发数，如 image_generation: 4
+	Concurrency map[string]int `mapstructure:"concurrency"`
+	// 最大执行次数（含临时错误自动重试），超过后任务进入 dead_letter 状态
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// 重试退避的初始间隔（秒），每次重试翻倍
+	RetryBaseDelay int `mapstructure:"retry_base_delay"`
+	// 重试退避的最大间隔（秒）
+	RetryMaxDelay int `mapstructure:"retry_max_delay"`
+	// 任务清理的执行时间（cron 表达式，含秒），为空时不启用清理
+	RetentionCron string `mapstructure:"retention_cron"`
+	// 已完成任务保留结果数据的天数，超过后清空 result，0 表示不清理
+	ResultRetentionDays int `mapstructure:"result_retention_days"`
+	// 已完成/已取消任务保留的天数，超过后删除，0 表示不删除
+	TaskRetentionDays int `mapstructure:"task_retention_days"`
+	// 看门狗检查间隔（秒），0 表示不启用
+	WatchdogInterval int `mapstructure:"watchdog_interval"`
+	// 任务停留在 processing 的最长时间（秒），超过后重新排队或标记失败
+	StaleTaskTimeout int `mapstructure:"stale_task_timeout"`
+	// 按任务类型覆盖超时时间（秒），0 表示该类型不检查
+	StaleTaskTimeouts map[string]int `mapstructure:"stale_task_timeouts"`
+	// 图片/视频生成记录停留在 processing 的最长时间（秒）
+	StaleGenerationTimeout int `mapstructure:"stale_generation_timeout"`
+}
+
+type BudgetConfig struct {
+	// 全局预算上限（费用单位与价格表一致），0 表示不限制
+	GlobalLimit float64 `mapstructure:"global_limit"`
+	// 全局预算的统计周期：month 按自然月统计，为空时统计全部用量
+	GlobalPeriod string `mapstructure:"global_period"`
+	// 预警阈值（占预算的比例），达到后在任务消息中提示，为空时使用 0.8
+	WarnRatios []float64 `mapstructure:"warn_ratios"`
+}
+
+type SecurityConfig struct {
+	// 加密服务商 API Key 的主密钥，也可通过环境变量 DRAMA_MASTER_KEY 设置；为空时 Key 以明文保存
+	MasterKey string `mapstructure:"master_key"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -85,6 +170,7 @@ func LoadConfig() (*Config, error) {
 	viper.AddConfigPath(".")
 
 	viper.AutomaticEnv()
+	viper.BindEnv("security.master_key", "DRAMA_MASTER_KEY")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
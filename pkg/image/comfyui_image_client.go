@@ -0,0 +1,409 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// comfyUITxt2ImgWorkflow 内置的文生图工作流（API 格式），适用于单个 checkpoint 的 SD1.5/SDXL 模型
+const comfyUITxt2ImgWorkflow = `{
+  "3": {"class_type": "KSampler", "inputs": {"seed": "{{seed}}", "steps": "{{steps}}", "cfg": "{{cfg}}", "sampler_name": "{{sampler}}", "scheduler": "{{scheduler}}", "denoise": 1, "model": ["4", 0], "positive": ["6", 0], "negative": ["7", 0], "latent_image": ["5", 0]}},
+  "4": {"class_type": "CheckpointLoaderSimple", "inputs": {"ckpt_name": "{{model}}"}},
+  "5": {"class_type": "EmptyLatentImage", "inputs": {"width": "{{width}}", "height": "{{height}}", "batch_size": 1}},
+  "6": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{prompt}}", "clip": ["4", 1]}},
+  "7": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{negative_prompt}}", "clip": ["4", 1]}},
+  "8": {"class_type": "VAEDecode", "inputs": {"samples": ["3", 0], "vae": ["4", 2]}},
+  "9": {"class_type": "SaveImage", "inputs": {"filename_prefix": "drama", "images": ["8", 0]}}
+}`
+
+// comfyUIImg2ImgWorkflow 内置的图生图工作流，以第一张参考图为底图
+const comfyUIImg2ImgWorkflow = `{
+  "3": {"class_type": "KSampler", "inputs": {"seed": "{{seed}}", "steps": "{{steps}}", "cfg": "{{cfg}}", "sampler_name": "{{sampler}}", "scheduler": "{{scheduler}}", "denoise": "{{denoise}}", "model": ["4", 0], "positive": ["6", 0], "negative": ["7", 0], "latent_image": ["11", 0]}},
+  "4": {"class_type": "CheckpointLoaderSimple", "inputs": {"ckpt_name": "{{model}}"}},
+  "6": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{prompt}}", "clip": ["4", 1]}},
+  "7": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{negative_prompt}}", "clip": ["4", 1]}},
+  "8": {"class_type": "VAEDecode", "inputs": {"samples": ["3", 0], "vae": ["4", 2]}},
+  "9": {"class_type": "SaveImage", "inputs": {"filename_prefix": "drama", "images": ["8", 0]}},
+  "10": {"class_type": "LoadImage", "inputs": {"image": "{{image}}"}},
+  "11": {"class_type": "VAEEncode", "inputs": {"pixels": ["10", 0], "vae": ["4", 2]}}
+}`
+
+// comfyUIInpaintWorkflow 内置的局部重绘工作流，{{mask}} 为黑白蒙版，白色区域重绘
+const comfyUIInpaintWorkflow = `{
+  "3": {"class_type": "KSampler", "inputs": {"seed": "{{seed}}", "steps": "{{steps}}", "cfg": "{{cfg}}", "sampler_name": "{{sampler}}", "scheduler": "{{scheduler}}", "denoise": "{{denoise}}", "model": ["4", 0], "positive": ["6", 0], "negative": ["7", 0], "latent_image": ["13", 0]}},
+  "4": {"class_type": "CheckpointLoaderSimple", "inputs": {"ckpt_name": "{{model}}"}},
+  "6": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{prompt}}", "clip": ["4", 1]}},
+  "7": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{negative_prompt}}", "clip": ["4", 1]}},
+  "8": {"class_type": "VAEDecode", "inputs": {"samples": ["3", 0], "vae": ["4", 2]}},
+  "9": {"class_type": "SaveImage", "inputs": {"filename_prefix": "drama", "images": ["8", 0]}},
+  "10": {"class_type": "LoadImage", "inputs": {"image": "{{image}}"}},
+  "11": {"class_type": "VAEEncode", "inputs": {"pixels": ["10", 0], "vae": ["4", 2]}},
+  "12": {"class_type": "LoadImageMask", "inputs": {"image": "{{mask}}", "channel": "red"}},
+  "13": {"class_type": "SetLatentNoiseMask", "inputs": {"samples": ["11", 0], "mask": ["12", 0]}}
+}`
+
+// ComfyUIImageClient ComfyUI 后端：提交工作流到 /prompt，通过 /history 轮询结果。
+// 参考图先上传到 /upload/image，工作流中 {{image}} 为第一张，{{image_2}} 起为后续的参考图
+type ComfyUIImageClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Settings   LocalDiffusionSettings
+	ClientID   string
+	HTTPClient *http.Client
+}
+
+type ComfyUIPromptResponse struct {
+	PromptID   string                 `json:"prompt_id"`
+	Error      interface{}            `json:"error,omitempty"`
+	NodeErrors map[string]interface{} `json:"node_errors,omitempty"`
+}
+
+type ComfyUIHistoryEntry struct {
+	Outputs map[string]struct {
+		Images []ComfyUIImageRef `json:"images"`
+	} `json:"outputs"`
+	Status struct {
+		StatusStr string          `json:"status_str"`
+		Completed bool            `json:"completed"`
+		Messages  json.RawMessage `json:"messages"`
+	} `json:"status"`
+}
+
+type ComfyUIImageRef struct {
+	Filename  string `json:"filename"`
+	Subfolder string `json:"subfolder"`
+	Type      string `json:"type"`
+}
+
+func NewComfyUIImageClient(baseURL, apiKey, model string, settings LocalDiffusionSettings) *ComfyUIImageClient {
+	return &ComfyUIImageClient{
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		APIKey:   apiKey,
+		Model:    model,
+		Settings: settings,
+		ClientID: "drama-generator",
+		HTTPClient: &http.Client{
+			Timeout: 2 * time.Minute,
+		},
+	}
+}
+
+func (c *ComfyUIImageClient) GenerateImage(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return c.generate(ctx, prompt, options, options.ReferenceImages)
+}
+
+// EditImage 以原图为底图，有蒙版时使用局部重绘工作流
+func (c *ComfyUIImageClient) EditImage(ctx context.Context, prompt string, sourceImage string, opts ...ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return c.generate(ctx, prompt, options, []string{sourceImage})
+}
+
+// generate 按是否有底图和蒙版选择文生图、图生图或局部重绘工作流
+func (c *ComfyUIImageClient) generate(ctx context.Context, prompt string, options *ImageOptions, images []string) (*ImageResult, error) {
+	model := c.Model
+	if options.Model != "" {
+		model = options.Model
+	}
+	width, height := diffusionSize(options)
+	seed := options.Seed
+	if seed == 0 {
+		seed = rand.Int63n(1 << 48)
+	}
+	sampler, scheduler := c.Settings.Sampler, c.Settings.Scheduler
+	if sampler == "" {
+		sampler = "euler"
+	}
+	if scheduler == "" {
+		scheduler = "normal"
+	}
+
+	values := map[string]interface{}{
+		"prompt":          prompt,
+		"negative_prompt": options.NegativePrompt,
+		"model":           model,
+		"seed":            seed,
+		"steps":           diffusionSteps(options),
+		"cfg":             diffusionCfgScale(options),
+		"width":           width,
+		"height":          height,
+		"sampler":         sampler,
+		"scheduler":       scheduler,
+		"denoise":         c.Settings.denoisingStrength(),
+	}
+
+	template := []byte(comfyUITxt2ImgWorkflow)
+	if len(c.Settings.Workflow) > 0 {
+		template = c.Settings.Workflow
+	}
+	if len(images) > 0 {
+		template = []byte(comfyUIImg2ImgWorkflow)
+		if len(c.Settings.Img2ImgWorkflow) > 0 {
+			template = c.Settings.Img2ImgWorkflow
+		}
+		if options.Mask != "" {
+			template = []byte(comfyUIInpaintWorkflow)
+			if len(c.Settings.InpaintWorkflow) > 0 {
+				template = c.Settings.InpaintWorkflow
+			}
+			name, err := c.uploadImage(ctx, options.Mask)
+			if err != nil {
+				return nil, err
+			}
+			values["mask"] = name
+		}
+		for i, ref := range images {
+			name, err := c.uploadImage(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			key := "image"
+			if i > 0 {
+				key = fmt.Sprintf("image_%d", i+1)
+			}
+			values[key] = name
+		}
+	}
+
+	var workflow interface{}
+	if err := json.Unmarshal(template, &workflow); err != nil {
+		return nil, fmt.Errorf("parse workflow: %w", err)
+	}
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"prompt":    fillWorkflow(workflow, values),
+		"client_id": c.ClientID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	body, err := c.do(ctx, "POST", "/prompt", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	var result ComfyUIPromptResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if result.Error != nil || len(result.NodeErrors) > 0 {
+		return nil, fmt.Errorf("comfyui workflow error: %v %v", result.Error, result.NodeErrors)
+	}
+	if result.PromptID == "" {
+		return nil, fmt.Errorf("no prompt_id returned")
+	}
+
+	return &ImageResult{
+		TaskID: result.PromptID,
+		Status: "processing",
+		Width:  width,
+		Height: height,
+	}, nil
+}
+
+func (c *ComfyUIImageClient) GetTaskStatus(ctx context.Context, taskID string) (*ImageResult, error) {
+	entry, ok, err := c.historyEntry(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	// history 中没有该任务时，仍在队列中说明在排队或执行；两处都没有说明任务已丢失（如服务重启）
+	if !ok {
+		queued, err := c.inQueue(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if queued {
+			return &ImageResult{TaskID: taskID, Status: "processing"}, nil
+		}
+		// 两次请求之间任务可能刚好执行完，再查一次 history
+		entry, ok, err = c.historyEntry(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return &ImageResult{TaskID: taskID, Status: "failed", Error: "comfyui prompt not found in history or queue"}, nil
+		}
+	}
+	if entry.Status.StatusStr == "error" {
+		return &ImageResult{TaskID: taskID, Status: "failed", Error: fmt.Sprintf("comfyui execution error: %s", string(entry.Status.Messages))}, nil
+	}
+
+	for _, output := range entry.Outputs {
+		for _, img := range output.Images {
+			if img.Type != "output" {
+				continue
+			}
+			query := url.Values{"filename": {img.Filename}, "subfolder": {img.Subfolder}, "type": {img.Type}}
+			return &ImageResult{
+				TaskID:    taskID,
+				Status:    "completed",
+				ImageURL:  c.BaseURL + "/view?" + query.Encode(),
+				Completed: true,
+			}, nil
+		}
+	}
+	if entry.Status.Completed {
+		return &ImageResult{TaskID: taskID, Status: "failed", Error: "comfyui workflow produced no output image"}, nil
+	}
+	return &ImageResult{TaskID: taskID, Status: "processing"}, nil
+}
+
+// historyEntry 查询 /history 中的任务记录
+func (c *ComfyUIImageClient) historyEntry(ctx context.Context, taskID string) (*ComfyUIHistoryEntry, bool, error) {
+	body, err := c.do(ctx, "GET", "/history/"+url.PathEscape(taskID), "", nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var history map[string]ComfyUIHistoryEntry
+	if err := json.Unmarshal(body, &history); err != nil {
+		return nil, false, fmt.Errorf("parse response: %w", err)
+	}
+	entry, ok := history[taskID]
+	return &entry, ok, nil
+}
+
+// inQueue 查询任务是否在 /queue 的执行中或排队列表中，列表项为 [number, prompt_id, prompt, extra_data, outputs]
+func (c *ComfyUIImageClient) inQueue(ctx context.Context, taskID string) (bool, error) {
+	body, err := c.do(ctx, "GET", "/queue", "", nil)
+	if err != nil {
+		return false, err
+	}
+
+	var queue struct {
+		Running [][]json.RawMessage `json:"queue_running"`
+		Pending [][]json.RawMessage `json:"queue_pending"`
+	}
+	if err := json.Unmarshal(body, &queue); err != nil {
+		return false, fmt.Errorf("parse queue response: %w", err)
+	}
+	for _, item := range append(queue.Running, queue.Pending...) {
+		var promptID string
+		if len(item) > 1 && json.Unmarshal(item[1], &promptID) == nil && promptID == taskID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// uploadImage 上传参考图到 ComfyUI 的 input 目录，返回工作流中 LoadImage 使用的文件名
+func (c *ComfyUIImageClient) uploadImage(ctx context.Context, ref string) (string, error) {
+	encoded, err := referenceImageBase64(ref)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decode reference image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile("image", fmt.Sprintf("drama_ref_%d.png", time.Now().UnixNano()))
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.WriteField("overwrite", "true"); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	body, err := c.do(ctx, "POST", "/upload/image", writer.FormDataContentType(), &buf)
+	if err != nil {
+		return "", fmt.Errorf("upload reference image: %w", err)
+	}
+
+	var uploaded struct {
+		Name      string `json:"name"`
+		Subfolder string `json:"subfolder"`
+	}
+	if err := json.Unmarshal(body, &uploaded); err != nil {
+		return "", fmt.Errorf("parse upload response: %w", err)
+	}
+	if uploaded.Subfolder != "" {
+		return uploaded.Subfolder + "/" + uploaded.Name, nil
+	}
+	return uploaded.Name, nil
+}
+
+func (c *ComfyUIImageClient) do(ctx context.Context, method, path, contentType string, payload io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, payload)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// fillWorkflow 替换工作流中的占位符：值恰好为 "{{key}}" 时替换为对应类型的值（数字保持数字），
+// 字符串中包含占位符时按文本替换
+func fillWorkflow(node interface{}, values map[string]interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = fillWorkflow(child, values)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = fillWorkflow(child, values)
+		}
+		return v
+	case string:
+		if strings.HasPrefix(v, "{{") && strings.HasSuffix(v, "}}") {
+			if value, ok := values[strings.TrimSpace(v[2:len(v)-2])]; ok {
+				return value
+			}
+		}
+		for key, value := range values {
+			v = strings.ReplaceAll(v, "{{"+key+"}}", fmt.Sprint(value))
+		}
+		return v
+	default:
+		return v
+	}
+}
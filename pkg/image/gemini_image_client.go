@@ -2,6 +2,7 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 type GeminiImageClient struct {
@@ -58,8 +61,13 @@ type GeminiImageResponse struct {
 }
 
 // downloadImageToBase64 下载图片 URL 并转换为 base64
-func downloadImageToBase64(imageURL string) (string, string, error) {
-	resp, err := http.Get(imageURL)
+func downloadImageToBase64(ctx context.Context, imageURL string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", "", fmt.Errorf("download image: %w", err)
 	}
@@ -105,7 +113,7 @@ func NewGeminiImageClient(baseURL, apiKey, model, endpoint string) *GeminiImageC
 	}
 }
 
-func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error) {
+func (c *GeminiImageClient) GenerateImage(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
 	options := &ImageOptions{
 		Size:    "1920x1920",
 		Quality: "standard",
@@ -141,7 +149,7 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 			// 检查是否是 HTTP/HTTPS URL
 			if strings.HasPrefix(refImg, "http://") || strings.HasPrefix(refImg, "https://") {
 				// 下载图片并转换为 base64
-				base64Data, mimeType, err = downloadImageToBase64(refImg)
+				base64Data, mimeType, err = downloadImageToBase64(ctx, refImg)
 				if err != nil {
 					continue
 				}
@@ -213,7 +221,7 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	endpoint = replaceModelPlaceholder(endpoint, model)
 	url := fmt.Sprintf("%s?key=%s", endpoint, c.APIKey)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -236,7 +244,7 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 		if len(bodyStr) > 1000 {
 			bodyStr = fmt.Sprintf("%s ... %s", bodyStr[:500], bodyStr[len(bodyStr)-500:])
 		}
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, bodyStr)
+		return nil, utils.NewAPIError(resp.StatusCode, bodyStr)
 	}
 
 	var result GeminiImageResponse
@@ -264,7 +272,12 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	}, nil
 }
 
-func (c *GeminiImageClient) GetTaskStatus(taskID string) (*ImageResult, error) {
+// EditImage 以原图为参考图重新生成，不支持蒙版
+func (c *GeminiImageClient) EditImage(ctx context.Context, prompt string, sourceImage string, opts ...ImageOption) (*ImageResult, error) {
+	return editWithReferenceImage(ctx, c, prompt, sourceImage, opts)
+}
+
+func (c *GeminiImageClient) GetTaskStatus(ctx context.Context, taskID string) (*ImageResult, error) {
 	return nil, fmt.Errorf("not supported for Gemini (synchronous generation)")
 }
 
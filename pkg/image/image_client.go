@@ -1,8 +1,19 @@
 package image
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrMaskNotSupported 服务商只支持按提示词整体修改图片，不支持蒙版局部重绘
+var ErrMaskNotSupported = errors.New("mask is not supported by this image provider")
+
+// ImageClient 图片生成客户端接口，ctx 取消时进行中的请求会被中断
 type ImageClient interface {
-	GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error)
-	GetTaskStatus(taskID string) (*ImageResult, error)
+	GenerateImage(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error)
+	// EditImage 按提示词修改 sourceImage（URL、本地路径或 data URI），设置 WithMask 时只重绘蒙版区域
+	EditImage(ctx context.Context, prompt string, sourceImage string, opts ...ImageOption) (*ImageResult, error)
+	GetTaskStatus(ctx context.Context, taskID string) (*ImageResult, error)
 }
 
 type ImageResult struct {
@@ -27,6 +38,7 @@ type ImageOptions struct {
 	Width           int
 	Height          int
 	ReferenceImages []string // 参考图片URL列表
+	Mask            string   // 编辑图片的蒙版，黑白图片，白色为需要重绘的区域
 }
 
 type ImageOption func(*ImageOptions)
@@ -91,3 +103,9 @@ func WithReferenceImages(images []string) ImageOption {
 		o.ReferenceImages = images
 	}
 }
+
+func WithMask(mask string) ImageOption {
+	return func(o *ImageOptions) {
+		o.Mask = mask
+	}
+}
@@ -0,0 +1,66 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+)
+
+// editWithReferenceImage 没有专门编辑接口的服务商：把原图作为第一张参考图重新生成，不支持蒙版
+func editWithReferenceImage(ctx context.Context, client ImageClient, prompt string, sourceImage string, opts []ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.Mask != "" {
+		return nil, ErrMaskNotSupported
+	}
+
+	references := append([]string{sourceImage}, options.ReferenceImages...)
+	return client.GenerateImage(ctx, prompt, append(opts, WithReferenceImages(references))...)
+}
+
+// decodeImageData 读取 URL、本地路径或 data URI 的图片内容
+func decodeImageData(ref string) ([]byte, error) {
+	encoded, err := referenceImageBase64(ref)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	return data, nil
+}
+
+// maskToAlpha 把黑白蒙版（白色重绘）转换为 OpenAI 使用的透明蒙版（透明区域重绘）
+func maskToAlpha(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode mask: %w", err)
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.GrayModel.Convert(src.At(x, y)).(color.Gray)
+			if gray.Y >= 128 {
+				dst.SetNRGBA(x, y, color.NRGBA{})
+			} else {
+				dst.SetNRGBA(x, y, color.NRGBA{A: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("encode mask: %w", err)
+	}
+	return buf.Bytes(), nil
+}
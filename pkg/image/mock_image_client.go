@@ -0,0 +1,134 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// mockImageMaxSide 占位图的最大边长
+const mockImageMaxSide = 2048
+
+// MockImageClient 内置的离线图片客户端，生成绘有提示词的纯色占位图。
+// 指定 OutputDir 和 BaseURL 时写入文件并返回 BaseURL 下的地址，否则返回 data URI
+type MockImageClient struct {
+	Model     string
+	OutputDir string
+	BaseURL   string
+	Settings  utils.MockSettings
+}
+
+func NewMockImageClient(model, outputDir, baseURL string, settings utils.MockSettings) *MockImageClient {
+	return &MockImageClient{
+		Model:     model,
+		OutputDir: outputDir,
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		Settings:  settings,
+	}
+}
+
+func (c *MockImageClient) GenerateImage(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{Size: "1024x1024"}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if err := c.Settings.Simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	width, height := mockImageSize(options)
+	seed := utils.MockSeed(c.Model, prompt, options.NegativePrompt, fmt.Sprint(options.Seed))
+	data, err := utils.RenderPlaceholderPNG(width, height, fmt.Sprintf("MOCK %s #%08x", c.Model, uint32(seed)), prompt, seed)
+	if err != nil {
+		return nil, fmt.Errorf("mock: render image: %w", err)
+	}
+
+	imageURL, err := c.save(data, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImageResult{
+		Status:    "completed",
+		ImageURL:  imageURL,
+		Width:     width,
+		Height:    height,
+		Completed: true,
+	}
+	if !c.Settings.Async {
+		return result, nil
+	}
+
+	taskID := utils.MockTaskID("image", seed)
+	result.TaskID = taskID
+	utils.RegisterMockTask(taskID, time.Duration(c.Settings.TaskDelayMs)*time.Millisecond, result)
+	return &ImageResult{TaskID: taskID, Status: "processing"}, nil
+}
+
+// EditImage 与生成相同，原图和蒙版参与占位图的种子计算
+func (c *MockImageClient) EditImage(ctx context.Context, prompt string, sourceImage string, opts ...ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	seed := utils.MockSeed(sourceImage, options.Mask)
+	return c.GenerateImage(ctx, fmt.Sprintf("%s [edit %08x]", prompt, uint32(seed)), opts...)
+}
+
+func (c *MockImageClient) GetTaskStatus(ctx context.Context, taskID string) (*ImageResult, error) {
+	if err := c.Settings.Simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	value, ready, found := utils.LookupMockTask(taskID)
+	if !found {
+		return &ImageResult{TaskID: taskID, Status: "failed", Error: "mock: task not found (tasks are kept in memory only)"}, nil
+	}
+	if !ready {
+		return &ImageResult{TaskID: taskID, Status: "processing"}, nil
+	}
+	result := *value.(*ImageResult)
+	return &result, nil
+}
+
+// save 写入输出目录，文件名由种子决定，相同请求复用同一个文件
+func (c *MockImageClient) save(data []byte, seed uint64) (string, error) {
+	if c.OutputDir == "" || c.BaseURL == "" {
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	if err := os.MkdirAll(c.OutputDir, 0755); err != nil {
+		return "", fmt.Errorf("mock: create output dir: %w", err)
+	}
+	filename := fmt.Sprintf("image_%016x.png", seed)
+	if err := os.WriteFile(filepath.Join(c.OutputDir, filename), data, 0644); err != nil {
+		return "", fmt.Errorf("mock: write image: %w", err)
+	}
+	return c.BaseURL + "/" + filename, nil
+}
+
+// mockImageSize 优先使用指定的宽高，其次解析 Size（如 1024x1024）
+func mockImageSize(options *ImageOptions) (int, int) {
+	width, height := options.Width, options.Height
+	if width <= 0 || height <= 0 {
+		if _, err := fmt.Sscanf(options.Size, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+			width, height = 1024, 1024
+		}
+	}
+	if width > mockImageMaxSide {
+		height = height * mockImageMaxSide / width
+		width = mockImageMaxSide
+	}
+	if height > mockImageMaxSide {
+		width = width * mockImageMaxSide / height
+		height = mockImageMaxSide
+	}
+	return width, height
+}
@@ -2,11 +2,16 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 type OpenAIImageClient struct {
@@ -30,6 +35,7 @@ type DALLEResponse struct {
 	Created int64 `json:"created"`
 	Data    []struct {
 		URL           string `json:"url"`
+		B64JSON       string `json:"b64_json,omitempty"`
 		RevisedPrompt string `json:"revised_prompt,omitempty"`
 	} `json:"data"`
 }
@@ -49,7 +55,7 @@ func NewOpenAIImageClient(baseURL, apiKey, model, endpoint string) *OpenAIImageC
 	}
 }
 
-func (c *OpenAIImageClient) GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error) {
+func (c *OpenAIImageClient) GenerateImage(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
 	options := &ImageOptions{
 		Size:    "1920x1920",
 		Quality: "standard",
@@ -82,7 +88,7 @@ func (c *OpenAIImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	fmt.Printf("[OpenAI Image] Request URL: %s\n", url)
 	fmt.Printf("[OpenAI Image] Request Body: %s\n", string(jsonData))
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -102,7 +108,7 @@ func (c *OpenAIImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	fmt.Printf("OpenAI API Response: %s\n", string(body))
@@ -123,6 +129,103 @@ func (c *OpenAIImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	}, nil
 }
 
-func (c *OpenAIImageClient) GetTaskStatus(taskID string) (*ImageResult, error) {
+// EditImage 调用 /images/edits（由生成端点推导），蒙版转换为透明区域重绘的 PNG
+func (c *OpenAIImageClient) EditImage(ctx context.Context, prompt string, sourceImage string, opts ...ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	model := c.Model
+	if options.Model != "" {
+		model = options.Model
+	}
+
+	source, err := decodeImageData(sourceImage)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	fields := map[string]string{"model": model, "prompt": prompt, "n": "1"}
+	if options.Size != "" {
+		fields["size"] = options.Size
+	}
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFormFile(writer, "image", "image.png", source); err != nil {
+		return nil, err
+	}
+	if options.Mask != "" {
+		mask, err := decodeImageData(options.Mask)
+		if err != nil {
+			return nil, err
+		}
+		if mask, err = maskToAlpha(mask); err != nil {
+			return nil, err
+		}
+		if err := writeFormFile(writer, "mask", "mask.png", mask); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	url := c.BaseURL + strings.Replace(c.Endpoint, "generations", "edits", 1)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
+	}
+
+	var result DALLEResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("no image generated, response: %s", string(body))
+	}
+
+	imageURL := result.Data[0].URL
+	if imageURL == "" && result.Data[0].B64JSON != "" {
+		imageURL = "data:image/png;base64," + result.Data[0].B64JSON
+	}
+	return &ImageResult{
+		Status:    "completed",
+		ImageURL:  imageURL,
+		Completed: true,
+	}, nil
+}
+
+func writeFormFile(writer *multipart.Writer, field, filename string, data []byte) error {
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(data)
+	return err
+}
+
+func (c *OpenAIImageClient) GetTaskStatus(ctx context.Context, taskID string) (*ImageResult, error) {
 	return nil, fmt.Errorf("not supported for OpenAI/DALL-E")
 }
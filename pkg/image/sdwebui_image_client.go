@@ -0,0 +1,258 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+// 自托管 Stable Diffusion 后端未指定参数时使用的默认值
+const (
+	defaultDiffusionSteps    = 25
+	defaultDiffusionCfgScale = 7.0
+	defaultDiffusionSide     = 1024
+	defaultDenoisingStrength = 0.6 // 图生图的重绘幅度
+)
+
+// LocalDiffusionSettings 自托管后端的附加参数，来自AI配置的 settings（JSON）
+type LocalDiffusionSettings struct {
+	Sampler           string  `json:"sampler"`            // 采样器，如 "DPM++ 2M"、ComfyUI 的 "euler"
+	Scheduler         string  `json:"scheduler"`          // 调度器，如 "Karras"、ComfyUI 的 "normal"
+	DenoisingStrength float64 `json:"denoising_strength"` // 图生图重绘幅度，0 时使用 0.6
+	// ComfyUI API 格式的工作流，字符串中的 {{prompt}}、{{seed}} 等占位符会被替换，为空时使用内置工作流
+	Workflow        json.RawMessage `json:"workflow"`
+	Img2ImgWorkflow json.RawMessage `json:"img2img_workflow"` // 有参考图时使用的工作流，需包含 {{image}}
+	InpaintWorkflow json.RawMessage `json:"inpaint_workflow"` // 带蒙版编辑时使用的工作流，需包含 {{image}} 和 {{mask}}
+}
+
+// ParseLocalDiffusionSettings 解析 settings，为空或格式错误时使用默认值
+func ParseLocalDiffusionSettings(settings string) LocalDiffusionSettings {
+	var s LocalDiffusionSettings
+	if strings.TrimSpace(settings) == "" {
+		return s
+	}
+	if err := json.Unmarshal([]byte(settings), &s); err != nil {
+		return LocalDiffusionSettings{}
+	}
+	return s
+}
+
+func (s LocalDiffusionSettings) denoisingStrength() float64 {
+	if s.DenoisingStrength > 0 && s.DenoisingStrength <= 1 {
+		return s.DenoisingStrength
+	}
+	return defaultDenoisingStrength
+}
+
+// SDWebUIImageClient AUTOMATIC1111 Stable Diffusion WebUI（--api），有参考图时使用 img2img。
+// APIKey 为 "用户名:密码" 时使用 --api-auth 的 Basic 认证
+type SDWebUIImageClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Settings   LocalDiffusionSettings
+	HTTPClient *http.Client
+}
+
+type SDWebUIRequest struct {
+	Prompt            string                 `json:"prompt"`
+	NegativePrompt    string                 `json:"negative_prompt,omitempty"`
+	Steps             int                    `json:"steps"`
+	CfgScale          float64                `json:"cfg_scale"`
+	Seed              int64                  `json:"seed"`
+	Width             int                    `json:"width"`
+	Height            int                    `json:"height"`
+	SamplerName       string                 `json:"sampler_name,omitempty"`
+	Scheduler         string                 `json:"scheduler,omitempty"`
+	InitImages        []string               `json:"init_images,omitempty"`
+	DenoisingStrength float64                `json:"denoising_strength,omitempty"`
+	Mask              string                 `json:"mask,omitempty"`
+	MaskBlur          int                    `json:"mask_blur,omitempty"`
+	InpaintingFill    int                    `json:"inpainting_fill,omitempty"` // 1: 以原图内容填充蒙版区域
+	OverrideSettings  map[string]interface{} `json:"override_settings,omitempty"`
+}
+
+type SDWebUIResponse struct {
+	Images []string `json:"images"`
+	Info   string   `json:"info"`
+}
+
+func NewSDWebUIImageClient(baseURL, apiKey, model string, settings LocalDiffusionSettings) *SDWebUIImageClient {
+	return &SDWebUIImageClient{
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		APIKey:   apiKey,
+		Model:    model,
+		Settings: settings,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+func (c *SDWebUIImageClient) GenerateImage(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return c.generate(ctx, prompt, options, options.ReferenceImages)
+}
+
+// EditImage 以原图为底图调用 img2img，有蒙版时局部重绘
+func (c *SDWebUIImageClient) EditImage(ctx context.Context, prompt string, sourceImage string, opts ...ImageOption) (*ImageResult, error) {
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return c.generate(ctx, prompt, options, []string{sourceImage})
+}
+
+// generate initImages 非空时调用 img2img
+func (c *SDWebUIImageClient) generate(ctx context.Context, prompt string, options *ImageOptions, initImages []string) (*ImageResult, error) {
+	model := c.Model
+	if options.Model != "" {
+		model = options.Model
+	}
+	width, height := diffusionSize(options)
+
+	reqBody := SDWebUIRequest{
+		Prompt:         prompt,
+		NegativePrompt: options.NegativePrompt,
+		Steps:          diffusionSteps(options),
+		CfgScale:       diffusionCfgScale(options),
+		Seed:           -1,
+		Width:          width,
+		Height:         height,
+		SamplerName:    c.Settings.Sampler,
+		Scheduler:      c.Settings.Scheduler,
+	}
+	if options.Seed != 0 {
+		reqBody.Seed = options.Seed
+	}
+	if model != "" {
+		reqBody.OverrideSettings = map[string]interface{}{"sd_model_checkpoint": model}
+	}
+
+	endpoint := "/sdapi/v1/txt2img"
+	if len(initImages) > 0 {
+		endpoint = "/sdapi/v1/img2img"
+		for _, ref := range initImages {
+			data, err := referenceImageBase64(ref)
+			if err != nil {
+				return nil, err
+			}
+			reqBody.InitImages = append(reqBody.InitImages, data)
+		}
+		reqBody.DenoisingStrength = c.Settings.denoisingStrength()
+		if options.Mask != "" {
+			mask, err := referenceImageBase64(options.Mask)
+			if err != nil {
+				return nil, err
+			}
+			reqBody.Mask = mask
+			reqBody.MaskBlur = 4
+			reqBody.InpaintingFill = 1
+		}
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if user, password, ok := strings.Cut(c.APIKey, ":"); ok {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
+	}
+
+	var result SDWebUIResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if len(result.Images) == 0 {
+		return nil, fmt.Errorf("no image generated")
+	}
+
+	return &ImageResult{
+		Status:    "completed",
+		ImageURL:  "data:image/png;base64," + result.Images[0],
+		Width:     width,
+		Height:    height,
+		Completed: true,
+	}, nil
+}
+
+func (c *SDWebUIImageClient) GetTaskStatus(ctx context.Context, taskID string) (*ImageResult, error) {
+	return nil, fmt.Errorf("not supported for Stable Diffusion WebUI (synchronous generation)")
+}
+
+func diffusionSteps(options *ImageOptions) int {
+	if options.Steps > 0 {
+		return options.Steps
+	}
+	return defaultDiffusionSteps
+}
+
+func diffusionCfgScale(options *ImageOptions) float64 {
+	if options.CfgScale > 0 {
+		return options.CfgScale
+	}
+	return defaultDiffusionCfgScale
+}
+
+// diffusionSize 优先使用 Width/Height，其次解析 "宽x高" 格式的 Size，结果取 8 的倍数
+func diffusionSize(options *ImageOptions) (int, int) {
+	width, height := options.Width, options.Height
+	if width <= 0 || height <= 0 {
+		width, height = defaultDiffusionSide, defaultDiffusionSide
+		if w, h, ok := strings.Cut(strings.ToLower(options.Size), "x"); ok {
+			parsedWidth, errW := strconv.Atoi(strings.TrimSpace(w))
+			parsedHeight, errH := strconv.Atoi(strings.TrimSpace(h))
+			if errW == nil && errH == nil && parsedWidth > 0 && parsedHeight > 0 {
+				width, height = parsedWidth, parsedHeight
+			}
+		}
+	}
+	return max(width/8*8, 64), max(height/8*8, 64)
+}
+
+// referenceImageBase64 把参考图（URL、本地路径或 data URI）转换为不带前缀的 base64 数据
+func referenceImageBase64(ref string) (string, error) {
+	dataURI := ref
+	if !strings.HasPrefix(ref, "data:") {
+		var err error
+		if dataURI, err = utils.ImageToBase64(ref); err != nil {
+			return "", fmt.Errorf("load reference image: %w", err)
+		}
+	}
+	if _, data, ok := strings.Cut(dataURI, ","); ok {
+		return data, nil
+	}
+	return dataURI, nil
+}
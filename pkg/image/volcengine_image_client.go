@@ -2,11 +2,15 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 type VolcEngineImageClient struct {
@@ -61,7 +65,7 @@ func NewVolcEngineImageClient(baseURL, apiKey, model, endpoint, queryEndpoint st
 	}
 }
 
-func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error) {
+func (c *VolcEngineImageClient) GenerateImage(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
 	options := &ImageOptions{
 		Size:    "1920x1920",
 		Quality: "standard",
@@ -108,7 +112,7 @@ func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption
 	fmt.Printf("[VolcEngine Image] Request URL: %s\n", url)
 	fmt.Printf("[VolcEngine Image] Request Body: %s\n", string(jsonData))
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -130,7 +134,7 @@ func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption
 	fmt.Printf("VolcEngine Image API Response: %s\n", string(body))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var result VolcEngineImageResponse
@@ -139,7 +143,7 @@ func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption
 	}
 
 	if result.Error != nil {
-		return nil, fmt.Errorf("volcengine error: %v", result.Error)
+		return nil, volcengineError(result.Error)
 	}
 
 	if len(result.Data) == 0 {
@@ -153,6 +157,23 @@ func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption
 	}, nil
 }
 
-func (c *VolcEngineImageClient) GetTaskStatus(taskID string) (*ImageResult, error) {
+// volcengineError 转换火山方舟返回的错误对象，限流、服务过载和内部错误可重试
+func volcengineError(errObj interface{}) error {
+	err := fmt.Errorf("volcengine error: %v", errObj)
+	if m, ok := errObj.(map[string]interface{}); ok {
+		code, _ := m["code"].(string)
+		if strings.HasPrefix(code, "RateLimitExceeded") || code == "ServerOverloaded" || code == "InternalServiceError" {
+			return utils.MarkTransient(err)
+		}
+	}
+	return err
+}
+
+// EditImage 以原图为参考图重新生成，不支持蒙版
+func (c *VolcEngineImageClient) EditImage(ctx context.Context, prompt string, sourceImage string, opts ...ImageOption) (*ImageResult, error) {
+	return editWithReferenceImage(ctx, c, prompt, sourceImage, opts)
+}
+
+func (c *VolcEngineImageClient) GetTaskStatus(ctx context.Context, taskID string) (*ImageResult, error) {
 	return nil, fmt.Errorf("not supported for VolcEngine Seedream (synchronous generation)")
 }
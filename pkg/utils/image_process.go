@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// ParseAspectRatio 解析 "16:9"、"9:16" 格式的比例
+func ParseAspectRatio(ratio string) (int, int, bool) {
+	w, h, ok := strings.Cut(strings.TrimSpace(ratio), ":")
+	if !ok {
+		return 0, 0, false
+	}
+	width, errW := strconv.Atoi(strings.TrimSpace(w))
+	height, errH := strconv.Atoi(strings.TrimSpace(h))
+	if errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// RatioSize 按比例计算长边为 longEdge 的尺寸
+func RatioSize(ratioW, ratioH, longEdge int) (int, int) {
+	if ratioW >= ratioH {
+		return longEdge, max(longEdge*ratioH/ratioW, 1)
+	}
+	return max(longEdge*ratioW/ratioH, 1), longEdge
+}
+
+// CropRect 居中裁剪到指定比例时保留的区域
+func CropRect(width, height, ratioW, ratioH int) image.Rectangle {
+	cropW, cropH := width, height
+	if width*ratioH > height*ratioW {
+		cropW = height * ratioW / ratioH
+	} else {
+		cropH = width * ratioH / ratioW
+	}
+	x := (width - cropW) / 2
+	y := (height - cropH) / 2
+	return image.Rect(x, y, x+cropW, y+cropH)
+}
+
+// CropToRatio 居中裁剪到指定比例
+func CropToRatio(src image.Image, ratioW, ratioH int) image.Image {
+	bounds := src.Bounds()
+	rect := CropRect(bounds.Dx(), bounds.Dy(), ratioW, ratioH).Add(bounds.Min)
+	dst := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, rect.Min, draw.Src)
+	return dst
+}
+
+// PadToRatio 用背景色在两侧补边到指定比例，画面居中
+func PadToRatio(src image.Image, ratioW, ratioH int, background color.Color) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	padW, padH := width, height
+	if width*ratioH > height*ratioW {
+		padH = (width*ratioH + ratioW - 1) / ratioW
+	} else {
+		padW = (height*ratioW + ratioH - 1) / ratioH
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, padW, padH))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	offset := image.Pt((padW-width)/2, (padH-height)/2)
+	draw.Draw(dst, image.Rectangle{Min: offset, Max: offset.Add(bounds.Size())}, src, bounds.Min, draw.Over)
+	return dst
+}
+
+// ResizeImage 缩放到指定尺寸。缩小时取覆盖区域的平均值，放大时使用双线性插值
+func ResizeImage(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if srcW == 0 || srcH == 0 {
+		return dst
+	}
+
+	at := func(x, y int) (uint32, uint32, uint32, uint32) {
+		return color.NRGBAModel.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)).RGBA()
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b, a uint64
+			var n uint64
+			if srcW >= width && srcH >= height {
+				x0, x1 := x*srcW/width, max((x+1)*srcW/width, x*srcW/width+1)
+				y0, y1 := y*srcH/height, max((y+1)*srcH/height, y*srcH/height+1)
+				for sy := y0; sy < y1; sy++ {
+					for sx := x0; sx < x1; sx++ {
+						pr, pg, pb, pa := at(sx, sy)
+						r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+						n++
+					}
+				}
+			} else {
+				fx := max((float64(x)+0.5)*float64(srcW)/float64(width)-0.5, 0)
+				fy := max((float64(y)+0.5)*float64(srcH)/float64(height)-0.5, 0)
+				x0, y0 := int(fx), int(fy)
+				x1, y1 := min(x0+1, srcW-1), min(y0+1, srcH-1)
+				wx, wy := fx-float64(x0), fy-float64(y0)
+				for _, p := range []struct {
+					x, y   int
+					weight float64
+				}{
+					{x0, y0, (1 - wx) * (1 - wy)},
+					{x1, y0, wx * (1 - wy)},
+					{x0, y1, (1 - wx) * wy},
+					{x1, y1, wx * wy},
+				} {
+					pr, pg, pb, pa := at(p.x, p.y)
+					const scale = 1 << 16
+					r += uint64(float64(pr) * p.weight * scale)
+					g += uint64(float64(pg) * p.weight * scale)
+					b += uint64(float64(pb) * p.weight * scale)
+					a += uint64(float64(pa) * p.weight * scale)
+				}
+				n = 1 << 16
+			}
+			// RGBA() 返回预乘 alpha 的 16 位值，写回 NRGBA 前还原
+			if a == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(min(r*0xff/a, 0xff)),
+				G: uint8(min(g*0xff/a, 0xff)),
+				B: uint8(min(b*0xff/a, 0xff)),
+				A: uint8(min(a/n>>8, 0xff)),
+			})
+		}
+	}
+	return dst
+}
+
+// DecodeImage 解码 JPEG、PNG、GIF 图片，返回图片和格式名
+func DecodeImage(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// EncodeImage 按格式编码图片，png 保持无损，其他格式编码为 JPEG。返回数据和扩展名
+func EncodeImage(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == "png" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("encode png: %w", err)
+		}
+		return buf.Bytes(), ".png", nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, "", fmt.Errorf("encode jpeg: %w", err)
+	}
+	return buf.Bytes(), ".jpg", nil
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestParseAspectRatio tests parsing of "w:h" ratios
+func TestParseAspectRatio(t *testing.T) {
+	tests := []struct {
+		input  string
+		wantW  int
+		wantH  int
+		wantOK bool
+	}{
+		{input: "16:9", wantW: 16, wantH: 9, wantOK: true},
+		{input: " 9 : 16 ", wantW: 9, wantH: 16, wantOK: true},
+		{input: "1:1", wantW: 1, wantH: 1, wantOK: true},
+		{input: "16x9"},
+		{input: "0:9"},
+		{input: "a:b"},
+		{input: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			w, h, ok := ParseAspectRatio(tt.input)
+			if w != tt.wantW || h != tt.wantH || ok != tt.wantOK {
+				t.Errorf("ParseAspectRatio(%q) = %d, %d, %v, want %d, %d, %v", tt.input, w, h, ok, tt.wantW, tt.wantH, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestCropAndPadToRatio tests that center crop and padding produce the requested ratio
+func TestCropAndPadToRatio(t *testing.T) {
+	tests := []struct {
+		name           string
+		width, height  int
+		ratioW, ratioH int
+		wantCrop       image.Rectangle
+		wantPadW       int
+		wantPadH       int
+	}{
+		{name: "square to 16:9", width: 1024, height: 1024, ratioW: 16, ratioH: 9, wantCrop: image.Rect(0, 224, 1024, 800), wantPadW: 1821, wantPadH: 1024},
+		{name: "square to 9:16", width: 1024, height: 1024, ratioW: 9, ratioH: 16, wantCrop: image.Rect(224, 0, 800, 1024), wantPadW: 1024, wantPadH: 1821},
+		{name: "already 16:9", width: 1920, height: 1080, ratioW: 16, ratioH: 9, wantCrop: image.Rect(0, 0, 1920, 1080), wantPadW: 1920, wantPadH: 1080},
+		{name: "wide to 1:1", width: 1536, height: 1024, ratioW: 1, ratioH: 1, wantCrop: image.Rect(256, 0, 1280, 1024), wantPadW: 1536, wantPadH: 1536},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CropRect(tt.width, tt.height, tt.ratioW, tt.ratioH); got != tt.wantCrop {
+				t.Errorf("CropRect() = %v, want %v", got, tt.wantCrop)
+			}
+
+			src := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			cropped := CropToRatio(src, tt.ratioW, tt.ratioH).Bounds()
+			if cropped.Dx() != tt.wantCrop.Dx() || cropped.Dy() != tt.wantCrop.Dy() {
+				t.Errorf("CropToRatio() size = %v, want %dx%d", cropped.Size(), tt.wantCrop.Dx(), tt.wantCrop.Dy())
+			}
+
+			padded := PadToRatio(src, tt.ratioW, tt.ratioH, color.Black).Bounds()
+			if padded.Dx() != tt.wantPadW || padded.Dy() != tt.wantPadH {
+				t.Errorf("PadToRatio() size = %v, want %dx%d", padded.Size(), tt.wantPadW, tt.wantPadH)
+			}
+		})
+	}
+}
+
+// TestResizeImage tests output sizes and that a solid color survives down- and upscaling
+func TestResizeImage(t *testing.T) {
+	fill := color.NRGBA{R: 200, G: 100, B: 50, A: 255}
+	tests := []struct {
+		name           string
+		srcW, srcH     int
+		ratioW, ratioH int
+		longEdge       int
+		wantW, wantH   int
+	}{
+		{name: "downscale landscape", srcW: 1024, srcH: 576, ratioW: 16, ratioH: 9, longEdge: 320, wantW: 320, wantH: 180},
+		{name: "upscale landscape", srcW: 160, srcH: 90, ratioW: 16, ratioH: 9, longEdge: 320, wantW: 320, wantH: 180},
+		{name: "downscale portrait", srcW: 576, srcH: 1024, ratioW: 9, ratioH: 16, longEdge: 320, wantW: 180, wantH: 320},
+		{name: "square", srcW: 100, srcH: 100, ratioW: 1, ratioH: 1, longEdge: 64, wantW: 64, wantH: 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height := RatioSize(tt.ratioW, tt.ratioH, tt.longEdge)
+			if width != tt.wantW || height != tt.wantH {
+				t.Fatalf("RatioSize() = %dx%d, want %dx%d", width, height, tt.wantW, tt.wantH)
+			}
+
+			src := image.NewNRGBA(image.Rect(0, 0, tt.srcW, tt.srcH))
+			for i := 0; i < len(src.Pix); i += 4 {
+				src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3] = fill.R, fill.G, fill.B, fill.A
+			}
+
+			dst := ResizeImage(src, width, height)
+			if dst.Bounds().Dx() != tt.wantW || dst.Bounds().Dy() != tt.wantH {
+				t.Fatalf("ResizeImage() size = %v, want %dx%d", dst.Bounds().Size(), tt.wantW, tt.wantH)
+			}
+			for _, p := range []image.Point{{0, 0}, {width / 2, height / 2}, {width - 1, height - 1}} {
+				if got := dst.NRGBAAt(p.X, p.Y); got != fill {
+					t.Errorf("pixel %v = %v, want %v", p, got, fill)
+				}
+			}
+		})
+	}
+}
@@ -192,6 +192,57 @@ func ExtractJSONFromText(text string) string {
 	return text
 }
 
+// ExtractCompleteArrayItems 从流式生成中尚未结束的文本里，提取第一个JSON数组中已完整输出的对象/数组元素。
+// 适用于 [{...}, {...}, {.. 和 {"storyboards": [{...}, {.. 这类部分响应，未闭合的最后一个元素会被忽略。
+func ExtractCompleteArrayItems(partial string) []string {
+	start := strings.Index(partial, "[")
+	if start == -1 {
+		return nil
+	}
+
+	var items []string
+	depth := 0
+	itemStart := -1
+	inString := false
+	escaped := false
+
+	for i := start + 1; i < len(partial); i++ {
+		ch := partial[i]
+		if inString {
+			if escaped {
+				escaped = false
+			} else if ch == '\\' {
+				escaped = true
+			} else if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inString = true
+		case '{', '[':
+			if depth == 0 {
+				itemStart = i
+			}
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				// 外层数组已结束
+				return items
+			}
+			depth--
+			if depth == 0 && itemStart != -1 {
+				items = append(items, partial[itemStart:i+1])
+				itemStart = -1
+			}
+		}
+	}
+
+	return items
+}
+
 // ValidateJSON 验证JSON字符串是否有效
 func ValidateJSON(jsonStr string) error {
 	var js json.RawMessage
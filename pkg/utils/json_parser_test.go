@@ -117,3 +117,33 @@ func TestAttemptJSONRepairFunction(t *testing.T) {
 		})
 	}
 }
+
+// TestExtractCompleteArrayItems tests extracting finished elements from a partially streamed JSON array
+func TestExtractCompleteArrayItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial string
+		want    int
+	}{
+		{name: "no array yet", partial: `{"storyboards": `, want: 0},
+		{name: "first item open", partial: `[{"shot_number": 1, "title": "开`, want: 0},
+		{name: "one complete item", partial: `[{"shot_number": 1}, {"shot_number": 2`, want: 1},
+		{name: "wrapped in object", partial: "```json\n" + `{"storyboards": [{"shot_number": 1, "characters": [1, 2]}, {"shot_number": 2}, {"sh`, want: 2},
+		{name: "brackets inside strings", partial: `[{"dialogue": "他说：\"{别走]\""}, {"dialogue": "}`, want: 1},
+		{name: "closed array", partial: `[{"a": 1}, {"a": 2}] trailing [{"a": 3}]`, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := ExtractCompleteArrayItems(tt.partial)
+			if len(items) != tt.want {
+				t.Fatalf("ExtractCompleteArrayItems() returned %d items, want %d: %v", len(items), tt.want, items)
+			}
+			for _, item := range items {
+				if err := ValidateJSON(item); err != nil {
+					t.Errorf("item %q is not valid JSON: %v", item, err)
+				}
+			}
+		})
+	}
+}
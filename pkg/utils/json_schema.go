@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// JSONSchema 结构化输出使用的 JSON Schema 子集，由 Go 结构体生成，
+// 各厂商客户端再转换为自身支持的格式
+type JSONSchema struct {
+	Type       string                 `json:"type"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *JSONSchema            `json:"items,omitempty"`
+	// Nullable 指针类型字段允许为 null
+	Nullable bool `json:"-"`
+	// PropertyOrder 结构体中字段的声明顺序
+	PropertyOrder []string `json:"-"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaFor 根据 v 的类型生成 JSON Schema，v 通常是解析目标的指针。字段名取自 json 标签，
+// 没有 omitempty 的字段为必填，指针类型的字段允许为 null。
+func SchemaFor(v interface{}) *JSONSchema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return schemaForType(t)
+}
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema *JSONSchema
+	switch {
+	case t == timeType:
+		schema = &JSONSchema{Type: "string"}
+	case t.Kind() == reflect.Struct:
+		schema = &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		addStructFields(schema, t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		schema = &JSONSchema{Type: "string"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = &JSONSchema{Type: "array", Items: schemaForType(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = &JSONSchema{Type: "object"}
+	case t.Kind() == reflect.String:
+		schema = &JSONSchema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		schema = &JSONSchema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = &JSONSchema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = &JSONSchema{Type: "number"}
+	default:
+		// interface{} 等无法确定类型的字段不做约束
+		schema = &JSONSchema{}
+	}
+
+	schema.Nullable = nullable
+	return schema
+}
+
+func addStructFields(schema *JSONSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = schemaForType(field.Type)
+		schema.PropertyOrder = append(schema.PropertyOrder, name)
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// Validate 校验 JSON 数据是否符合 Schema，返回的错误包含出错字段的路径
+func (s *JSONSchema) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("JSON格式错误: %w", err)
+	}
+	return s.validateValue("$", value)
+}
+
+func (s *JSONSchema) validateValue(path string, value interface{}) error {
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: 应为%s，实际为null", path, s.Type)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: 应为object，实际为%s", path, jsonTypeName(value))
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: 缺少必填字段 %s", path, name)
+			}
+		}
+		for _, name := range s.PropertyOrder {
+			fieldValue, ok := obj[name]
+			if !ok {
+				continue
+			}
+			if err := s.Properties[name].validateValue(path+"."+name, fieldValue); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: 应为array，实际为%s", path, jsonTypeName(value))
+		}
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range arr {
+			if err := s.Items.validateValue(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "string", "boolean", "number":
+		if actual := jsonTypeName(value); actual != s.Type && !(s.Type == "number" && actual == "integer") {
+			return fmt.Errorf("%s: 应为%s，实际为%s", path, s.Type, actual)
+		}
+	case "integer":
+		if actual := jsonTypeName(value); actual != "integer" {
+			return fmt.Errorf("%s: 应为integer，实际为%s", path, actual)
+		}
+	}
+	return nil
+}
+
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// ParseAIJSONWithSchema 从AI响应中提取JSON，按 Schema 校验后解析到 v。
+// 与 SafeParseAIJSON 不同，不会尝试修复截断或格式错误的JSON，校验错误可直接反馈给模型重新生成。
+func ParseAIJSONWithSchema(aiResponse string, schema *JSONSchema, v interface{}) error {
+	if strings.TrimSpace(aiResponse) == "" {
+		return fmt.Errorf("AI返回内容为空")
+	}
+
+	jsonStr := extractTopLevelJSON(aiResponse)
+	if err := schema.Validate([]byte(jsonStr)); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(jsonStr), v); err != nil {
+		return fmt.Errorf("JSON解析失败: %w", err)
+	}
+	return nil
+}
+
+// extractTopLevelJSON 去除Markdown代码块和前后说明文字，按最先出现的 { 或 [ 截取JSON，
+// 不改变响应本身的顶层结构，以便校验时发现对象/数组不匹配
+func extractTopLevelJSON(text string) string {
+	text = regexp.MustCompile("(?m)^```(json)?\\s*").ReplaceAllString(strings.TrimSpace(text), "")
+	text = strings.TrimSpace(text)
+
+	start := strings.IndexAny(text, "{[")
+	if start == -1 {
+		return text
+	}
+	closing := "}"
+	if text[start] == '[' {
+		closing = "]"
+	}
+	if end := strings.LastIndex(text, closing); end > start {
+		return text[start : end+1]
+	}
+	return text[start:]
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+type schemaTestShot struct {
+	ShotNumber int     `json:"shot_number"`
+	SceneID    *uint   `json:"scene_id"`
+	Characters []uint  `json:"characters"`
+	Note       string  `json:"note,omitempty"`
+	Score      float64 `json:"score,omitempty"`
+	internal   string
+}
+
+type schemaTestResult struct {
+	Shots []schemaTestShot `json:"shots"`
+}
+
+// TestSchemaFor tests that schemas follow json tags, omitempty and pointer nullability
+func TestSchemaFor(t *testing.T) {
+	schema := SchemaFor(&schemaTestResult{})
+	if schema.Type != "object" || schema.Nullable || !reflect.DeepEqual(schema.Required, []string{"shots"}) {
+		t.Fatalf("unexpected root schema: %+v", schema)
+	}
+
+	shot := schema.Properties["shots"].Items
+	if shot == nil || shot.Type != "object" {
+		t.Fatalf("unexpected items schema: %+v", schema.Properties["shots"])
+	}
+	if want := []string{"shot_number", "scene_id", "characters", "note", "score"}; !reflect.DeepEqual(shot.PropertyOrder, want) {
+		t.Errorf("PropertyOrder = %v, want %v", shot.PropertyOrder, want)
+	}
+	if want := []string{"shot_number", "scene_id", "characters"}; !reflect.DeepEqual(shot.Required, want) {
+		t.Errorf("Required = %v, want %v", shot.Required, want)
+	}
+	if !shot.Properties["scene_id"].Nullable || shot.Properties["shot_number"].Nullable {
+		t.Errorf("unexpected nullability")
+	}
+	if got := shot.Properties["characters"].Items.Type; got != "integer" {
+		t.Errorf("characters items type = %s, want integer", got)
+	}
+}
+
+// TestParseAIJSONWithSchema tests schema validation of AI responses
+func TestParseAIJSONWithSchema(t *testing.T) {
+	schema := SchemaFor(&schemaTestResult{})
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			input: `{"shots": [{"shot_number": 1, "scene_id": null, "characters": [1, 2]}]}`,
+		},
+		{
+			name:  "markdown fenced",
+			input: "```json\n{\"shots\": [{\"shot_number\": 1, \"scene_id\": 3, \"characters\": [], \"score\": 2}]}\n```",
+		},
+		{
+			name:    "missing required field",
+			input:   `{"shots": [{"shot_number": 1, "characters": []}]}`,
+			wantErr: "$.shots[0]: 缺少必填字段 scene_id",
+		},
+		{
+			name:    "wrong type",
+			input:   `{"shots": [{"shot_number": "1", "scene_id": null, "characters": []}]}`,
+			wantErr: "$.shots[0].shot_number: 应为integer，实际为string",
+		},
+		{
+			name:    "non nullable null",
+			input:   `{"shots": [{"shot_number": 1, "scene_id": null, "characters": null}]}`,
+			wantErr: "$.shots[0].characters: 应为array，实际为null",
+		},
+		{
+			name:    "array instead of object",
+			input:   `[{"shot_number": 1, "scene_id": null, "characters": []}]`,
+			wantErr: "$: 应为object，实际为array",
+		},
+		{
+			name:    "fractional integer",
+			input:   `{"shots": [{"shot_number": 1.5, "scene_id": null, "characters": []}]}`,
+			wantErr: "$.shots[0].shot_number: 应为integer，实际为number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result schemaTestResult
+			err := ParseAIJSONWithSchema(tt.input, schema, &result)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseAIJSONWithSchema() error = %v", err)
+				}
+				if len(result.Shots) != 1 {
+					t.Errorf("expected 1 shot, got %d", len(result.Shots))
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseAIJSONWithSchema() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockSettings 内置 mock 服务商的行为，取自AI配置的 settings 字段（JSON），例如
+// {"delay_ms": 500, "failure_rate": 0.1, "async": true, "task_delay_ms": 8000}
+type MockSettings struct {
+	DelayMs     int     `json:"delay_ms"`      // 每次请求的模拟耗时
+	FailureRate float64 `json:"failure_rate"`  // 请求失败的概率（0-1），失败时返回 503
+	Async       bool    `json:"async"`         // 图片和视频是否以异步任务的形式返回
+	TaskDelayMs int     `json:"task_delay_ms"` // 异步任务从提交到完成的时间
+}
+
+// ParseMockSettings 解析 settings，为空或格式错误时使用默认行为（立即成功）
+func ParseMockSettings(settings string) MockSettings {
+	var s MockSettings
+	if strings.TrimSpace(settings) == "" {
+		return s
+	}
+	if err := json.Unmarshal([]byte(settings), &s); err != nil {
+		return MockSettings{}
+	}
+	if s.FailureRate < 0 {
+		s.FailureRate = 0
+	}
+	if s.DelayMs < 0 {
+		s.DelayMs = 0
+	}
+	if s.TaskDelayMs < 0 {
+		s.TaskDelayMs = 0
+	}
+	return s
+}
+
+// Simulate 模拟一次请求：按配置等待，并按失败率返回可重试的服务端错误
+func (s MockSettings) Simulate(ctx context.Context) error {
+	if s.DelayMs > 0 {
+		timer := time.NewTimer(time.Duration(s.DelayMs) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.FailureRate > 0 && rand.Float64() < s.FailureRate {
+		return NewAPIError(http.StatusServiceUnavailable, "mock: simulated provider failure")
+	}
+	return nil
+}
+
+// MockSeed 根据输入计算稳定的种子，相同输入得到相同的 mock 结果
+func MockSeed(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// MockTaskID 生成 mock 异步任务ID，包含种子便于排查
+func MockTaskID(kind string, seed uint64) string {
+	return fmt.Sprintf("mock-%s-%012x-%d", kind, seed&0xffffffffffff, time.Now().UnixNano())
+}
+
+// mockTaskRetention 已完成的 mock 异步任务保留时长
+const mockTaskRetention = time.Hour
+
+type mockTask struct {
+	readyAt time.Time
+	result  interface{}
+}
+
+// mockTasks 本进程内的 mock 异步任务，重启后丢失
+var mockTasks = struct {
+	sync.Mutex
+	tasks map[string]mockTask
+}{tasks: make(map[string]mockTask)}
+
+// RegisterMockTask 登记一个 delay 后完成的 mock 异步任务，result 为完成时返回的结果
+func RegisterMockTask(taskID string, delay time.Duration, result interface{}) {
+	mockTasks.Lock()
+	defer mockTasks.Unlock()
+
+	now := time.Now()
+	for id, task := range mockTasks.tasks {
+		if now.Sub(task.readyAt) > mockTaskRetention {
+			delete(mockTasks.tasks, id)
+		}
+	}
+	mockTasks.tasks[taskID] = mockTask{readyAt: now.Add(delay), result: result}
+}
+
+// LookupMockTask 查询 mock 异步任务，返回结果、是否已完成以及任务是否存在
+func LookupMockTask(taskID string) (interface{}, bool, bool) {
+	mockTasks.Lock()
+	defer mockTasks.Unlock()
+
+	task, ok := mockTasks.tasks[taskID]
+	if !ok {
+		return nil, false, false
+	}
+	return task.result, !time.Now().Before(task.readyAt), true
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+// TestParseMockSettings tests parsing of mock provider settings with fallbacks for invalid input
+func TestParseMockSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     MockSettings
+	}{
+		{name: "empty", settings: "", want: MockSettings{}},
+		{name: "invalid json", settings: "{delay", want: MockSettings{}},
+		{name: "full", settings: `{"delay_ms":200,"failure_rate":0.25,"async":true,"task_delay_ms":3000}`,
+			want: MockSettings{DelayMs: 200, FailureRate: 0.25, Async: true, TaskDelayMs: 3000}},
+		{name: "negative values", settings: `{"delay_ms":-1,"failure_rate":-0.5,"task_delay_ms":-10}`, want: MockSettings{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMockSettings(tt.settings); got != tt.want {
+				t.Errorf("ParseMockSettings(%q) = %+v, want %+v", tt.settings, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMockSettingsSimulate tests that simulated failures are transient and cancellation is honoured
+func TestMockSettingsSimulate(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name          string
+		settings      MockSettings
+		ctx           context.Context
+		wantErr       bool
+		wantTransient bool
+	}{
+		{name: "always succeeds", settings: MockSettings{}, ctx: context.Background()},
+		{name: "always fails", settings: MockSettings{FailureRate: 1}, ctx: context.Background(), wantErr: true, wantTransient: true},
+		{name: "cancelled", settings: MockSettings{DelayMs: 1000}, ctx: cancelled, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.Simulate(tt.ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Simulate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if IsTransientError(err) != tt.wantTransient {
+				t.Errorf("IsTransientError(%v) = %v, want %v", err, IsTransientError(err), tt.wantTransient)
+			}
+		})
+	}
+}
+
+// TestMockSeed tests that seeds are stable and depend on every part
+func TestMockSeed(t *testing.T) {
+	if MockSeed("model", "prompt") != MockSeed("model", "prompt") {
+		t.Error("MockSeed is not stable for identical input")
+	}
+	if MockSeed("model", "prompt") == MockSeed("model", "prompt2") {
+		t.Error("MockSeed should differ for different prompts")
+	}
+	if MockSeed("ab", "c") == MockSeed("a", "bc") {
+		t.Error("MockSeed should separate parts")
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestIsTransientError tests classification of provider errors for automatic retry
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "rate limited", err: NewAPIError(429, "too many requests"), want: true},
+		{name: "server error", err: NewAPIError(503, "unavailable"), want: true},
+		{name: "bad request", err: NewAPIError(400, "invalid prompt"), want: false},
+		{name: "unauthorized", err: NewAPIError(401, "invalid key"), want: false},
+		{name: "wrapped server error", err: fmt.Errorf("send request: %w", NewAPIError(502, "bad gateway")), want: true},
+		{name: "marked by provider", err: MarkTransient(errors.New("minimax error: rate limit")), want: true},
+		{name: "deadline exceeded", err: fmt.Errorf("send request: %w", context.DeadlineExceeded), want: true},
+		{name: "cancelled", err: fmt.Errorf("send request: %w", context.Canceled), want: false},
+		{name: "plain error", err: errors.New("no image generated"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransientError(tt.err); got != tt.want {
+				t.Errorf("IsTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
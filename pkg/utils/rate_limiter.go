@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateWindow 速率限制的统计窗口
+const rateWindow = time.Minute
+
+// RateLimits 单个AI配置的调用限制，取自配置的 settings 字段（JSON），例如
+// {"requests_per_minute": 60, "max_concurrent": 4, "tokens_per_minute": 100000}，0 表示不限制
+type RateLimits struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	MaxConcurrent     int `json:"max_concurrent"`
+	// TokensPerMinute 按调用完成后上报的实际用量统计，最近一分钟达到上限时暂停发出新请求
+	TokensPerMinute int `json:"tokens_per_minute"`
+}
+
+// Enabled 是否设置了任一限制
+func (l RateLimits) Enabled() bool {
+	return l.RequestsPerMinute > 0 || l.MaxConcurrent > 0 || l.TokensPerMinute > 0
+}
+
+// ParseRateLimits 解析 settings 中的限制，为空或格式错误时不限制
+func ParseRateLimits(settings string) RateLimits {
+	var limits RateLimits
+	if strings.TrimSpace(settings) == "" {
+		return limits
+	}
+	if err := json.Unmarshal([]byte(settings), &limits); err != nil {
+		return RateLimits{}
+	}
+	if limits.RequestsPerMinute < 0 {
+		limits.RequestsPerMinute = 0
+	}
+	if limits.MaxConcurrent < 0 {
+		limits.MaxConcurrent = 0
+	}
+	if limits.TokensPerMinute < 0 {
+		limits.TokensPerMinute = 0
+	}
+	return limits
+}
+
+type tokenUsage struct {
+	at     time.Time
+	tokens int
+}
+
+// RateLimiter 按最近一分钟的请求数、token 数和进行中的请求数限流，超过限制时排队等待而不是失败
+type RateLimiter struct {
+	mu       sync.Mutex
+	limits   RateLimits
+	active   int
+	requests []time.Time
+	usage    []tokenUsage
+	// changed 在请求结束或限制变化时关闭并替换，唤醒等待中的请求
+	changed chan struct{}
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{limits: limits, changed: make(chan struct{})}
+}
+
+// Limits 返回当前的限制
+func (l *RateLimiter) Limits() RateLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+// SetLimits 更新限制，等待中的请求按新限制重新判断
+func (l *RateLimiter) SetLimits(limits RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits == limits {
+		return
+	}
+	l.limits = limits
+	l.notifyLocked()
+}
+
+// Acquire 等待直到允许发出请求，ctx 取消时返回错误。
+// 请求结束后必须调用返回的 release，传入本次请求实际消耗的 token 数（未知时为 0）。
+func (l *RateLimiter) Acquire(ctx context.Context) (func(tokens int), error) {
+	for {
+		l.mu.Lock()
+		wait, ok := l.reserveLocked(time.Now())
+		changed := l.changed
+		l.mu.Unlock()
+		if ok {
+			return l.releaseFunc(), nil
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reserveLocked 满足所有限制时占用一个名额；否则返回需要等待的时长，0 表示等待进行中的请求结束
+func (l *RateLimiter) reserveLocked(now time.Time) (time.Duration, bool) {
+	cutoff := now.Add(-rateWindow)
+	for len(l.requests) > 0 && !l.requests[0].After(cutoff) {
+		l.requests = l.requests[1:]
+	}
+	usedTokens := 0
+	for len(l.usage) > 0 && !l.usage[0].at.After(cutoff) {
+		l.usage = l.usage[1:]
+	}
+	for _, u := range l.usage {
+		usedTokens += u.tokens
+	}
+
+	var wait time.Duration
+	blocked := false
+	if l.limits.MaxConcurrent > 0 && l.active >= l.limits.MaxConcurrent {
+		blocked = true
+	}
+	if l.limits.RequestsPerMinute > 0 && len(l.requests) >= l.limits.RequestsPerMinute {
+		blocked = true
+		if d := l.requests[0].Add(rateWindow).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if l.limits.TokensPerMinute > 0 && usedTokens >= l.limits.TokensPerMinute && len(l.usage) > 0 {
+		blocked = true
+		if d := l.usage[0].at.Add(rateWindow).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if blocked {
+		return wait, false
+	}
+
+	l.active++
+	l.requests = append(l.requests, now)
+	return 0, true
+}
+
+func (l *RateLimiter) releaseFunc() func(tokens int) {
+	var once sync.Once
+	return func(tokens int) {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.active--
+			if tokens > 0 {
+				l.usage = append(l.usage, tokenUsage{at: time.Now(), tokens: tokens})
+			}
+			l.notifyLocked()
+		})
+	}
+}
+
+func (l *RateLimiter) notifyLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
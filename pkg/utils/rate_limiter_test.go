@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestParseRateLimits tests parsing of per-config limits from settings JSON
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     RateLimits
+		enabled  bool
+	}{
+		{name: "empty", settings: "", want: RateLimits{}},
+		{name: "invalid json", settings: "{rpm", want: RateLimits{}},
+		{name: "unrelated settings", settings: `{"delay_ms":200}`, want: RateLimits{}},
+		{name: "full", settings: `{"requests_per_minute":60,"max_concurrent":4,"tokens_per_minute":100000}`,
+			want: RateLimits{RequestsPerMinute: 60, MaxConcurrent: 4, TokensPerMinute: 100000}, enabled: true},
+		{name: "negative values", settings: `{"requests_per_minute":-1,"max_concurrent":-2,"tokens_per_minute":-3}`, want: RateLimits{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseRateLimits(tt.settings)
+			if got != tt.want {
+				t.Errorf("ParseRateLimits(%q) = %+v, want %+v", tt.settings, got, tt.want)
+			}
+			if got.Enabled() != tt.enabled {
+				t.Errorf("Enabled() = %v, want %v", got.Enabled(), tt.enabled)
+			}
+		})
+	}
+}
+
+// TestRateLimiterAcquire tests that requests beyond a limit wait until the context expires
+func TestRateLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   RateLimits
+		previous int // 先发出并保持进行中的请求数
+		tokens   int // 已完成请求上报的 token 数
+		wantErr  bool
+	}{
+		{name: "no limits", limits: RateLimits{}, previous: 5},
+		{name: "under concurrency", limits: RateLimits{MaxConcurrent: 2}, previous: 1},
+		{name: "concurrency reached", limits: RateLimits{MaxConcurrent: 2}, previous: 2, wantErr: true},
+		{name: "requests per minute reached", limits: RateLimits{RequestsPerMinute: 3}, previous: 3, wantErr: true},
+		{name: "tokens per minute reached", limits: RateLimits{TokensPerMinute: 100}, tokens: 150, wantErr: true},
+		{name: "tokens under limit", limits: RateLimits{TokensPerMinute: 100}, tokens: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(tt.limits)
+			if tt.tokens > 0 {
+				release, err := limiter.Acquire(context.Background())
+				if err != nil {
+					t.Fatalf("Acquire() error = %v", err)
+				}
+				release(tt.tokens)
+			}
+			for i := 0; i < tt.previous; i++ {
+				if _, err := limiter.Acquire(context.Background()); err != nil {
+					t.Fatalf("Acquire() #%d error = %v", i, err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			release, err := limiter.Acquire(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Acquire() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if release != nil {
+				release(0)
+			}
+		})
+	}
+}
+
+// TestRateLimiterWakesWaiters tests that a waiting request proceeds once a running request finishes
+func TestRateLimiterWakesWaiters(t *testing.T) {
+	limiter := NewRateLimiter(RateLimits{MaxConcurrent: 1})
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := limiter.Acquire(ctx)
+		acquired <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	release(0)
+	release(0) // 重复调用不会多释放名额
+
+	if err := <-acquired; err != nil {
+		t.Fatalf("waiting Acquire() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); err == nil {
+		t.Errorf("Acquire() succeeded beyond max_concurrent after double release")
+	}
+}
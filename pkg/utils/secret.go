@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// encryptedSecretPrefix 加密后的值带版本前缀，便于区分升级前保存的明文
+const encryptedSecretPrefix = "enc:v1:"
+
+// secretMask 脱敏值中替换的部分
+const secretMask = "****"
+
+// SecretBox 使用主密钥以 AES-256-GCM 加解密敏感字段，主密钥经 SHA-256 派生为 32 字节密钥
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+func NewSecretBox(masterKey string) (*SecretBox, error) {
+	if masterKey == "" {
+		return nil, errors.New("master key is empty")
+	}
+	key := sha256.Sum256([]byte(masterKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Encrypt 加密明文，空字符串原样返回
+func (b *SecretBox) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 Encrypt 的结果，未加密的值（升级前保存的明文）原样返回
+func (b *SecretBox) Decrypt(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	nonceSize := b.aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", errors.New("secret is too short")
+	}
+	plaintext, err := b.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt secret, master key may be wrong")
+	}
+	return string(plaintext), nil
+}
+
+// IsEncryptedSecret 判断值是否由 SecretBox 加密
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// MaskSecret 脱敏显示密钥：保留短横线前缀和最后 4 位，如 sk-****abcd；过短时只返回 ****
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return secretMask
+	}
+	prefix := ""
+	if i := strings.Index(secret, "-"); i > 0 && i <= 4 {
+		prefix = secret[:i+1]
+	}
+	return prefix + secretMask + secret[len(secret)-4:]
+}
+
+// IsMaskedSecret 判断值是否为 MaskSecret 的结果，用于忽略前端原样提交回来的脱敏值
+func IsMaskedSecret(value string) bool {
+	return strings.Contains(value, secretMask)
+}
@@ -0,0 +1,82 @@
+package utils
+
+import "testing"
+
+// TestSecretBoxRoundTrip tests encryption, decryption and passthrough of legacy plaintext values
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box, err := NewSecretBox("master-key")
+	if err != nil {
+		t.Fatalf("NewSecretBox() error = %v", err)
+	}
+	otherBox, err := NewSecretBox("another-key")
+	if err != nil {
+		t.Fatalf("NewSecretBox() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{name: "empty", plaintext: ""},
+		{name: "api key", plaintext: "sk-1234567890abcdef"},
+		{name: "unicode", plaintext: "密钥-测试"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := box.Encrypt(tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if tt.plaintext != "" && (!IsEncryptedSecret(sealed) || sealed == tt.plaintext) {
+				t.Fatalf("Encrypt() = %q, want encrypted value", sealed)
+			}
+			got, err := box.Decrypt(sealed)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if got != tt.plaintext {
+				t.Errorf("Decrypt() = %q, want %q", got, tt.plaintext)
+			}
+			if tt.plaintext != "" {
+				if _, err := otherBox.Decrypt(sealed); err == nil {
+					t.Errorf("Decrypt() with wrong master key succeeded")
+				}
+			}
+		})
+	}
+
+	if got, err := box.Decrypt("sk-legacy-plaintext"); err != nil || got != "sk-legacy-plaintext" {
+		t.Errorf("Decrypt(plaintext) = %q, %v, want passthrough", got, err)
+	}
+	if _, err := NewSecretBox(""); err == nil {
+		t.Errorf("NewSecretBox(\"\") succeeded, want error")
+	}
+}
+
+// TestMaskSecret tests masking of API keys for display
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		want   string
+	}{
+		{name: "empty", secret: "", want: ""},
+		{name: "short", secret: "abcd1234", want: "****"},
+		{name: "openai style", secret: "sk-1234567890abcd", want: "sk-****abcd"},
+		{name: "no prefix", secret: "AIzaSyD1234567890wxyz", want: "****wxyz"},
+		{name: "long prefix", secret: "chatfire-1234567890wxyz", want: "****wxyz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MaskSecret(tt.secret)
+			if got != tt.want {
+				t.Errorf("MaskSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+			}
+			if tt.secret != "" && !IsMaskedSecret(got) {
+				t.Errorf("IsMaskedSecret(%q) = false, want true", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 差异行的类型
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// diffMaxCells 逐行比较的最大计算量（原文行数×新文本行数），超过时整体视为删除后新增
+const diffMaxCells = 4000000
+
+// DiffLine 行级差异中的一行，行号从 1 开始，新增行没有原文行号，删除行没有新文本行号
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// DiffStats 差异统计
+type DiffStats struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// splitDiffLines 按行拆分文本，统一换行符，空文本没有行
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// DiffLines 按行比较两段文本（最长公共子序列），返回包含相同行在内的完整差异序列
+func DiffLines(oldText, newText string) []DiffLine {
+	a, b := splitDiffLines(oldText), splitDiffLines(newText)
+
+	// 先去掉相同的开头和结尾，只对中间部分计算
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]DiffLine, 0, len(a)+len(b))
+	oldLine, newLine := 0, 0
+	appendLine := func(op, text string) {
+		line := DiffLine{Op: op, Text: text}
+		if op != DiffInsert {
+			oldLine++
+			line.OldLine = oldLine
+		}
+		if op != DiffDelete {
+			newLine++
+			line.NewLine = newLine
+		}
+		lines = append(lines, line)
+	}
+
+	for _, text := range a[:prefix] {
+		appendLine(DiffEqual, text)
+	}
+	for _, op := range diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		appendLine(op.Op, op.Text)
+	}
+	for _, text := range a[len(a)-suffix:] {
+		appendLine(DiffEqual, text)
+	}
+	return lines
+}
+
+// diffMiddle 用最长公共子序列比较两组行，删除行排在同位置的新增行之前
+func diffMiddle(a, b []string) []DiffLine {
+	var ops []DiffLine
+	if len(a)*len(b) > diffMaxCells {
+		for _, text := range a {
+			ops = append(ops, DiffLine{Op: DiffDelete, Text: text})
+		}
+		for _, text := range b {
+			ops = append(ops, DiffLine{Op: DiffInsert, Text: text})
+		}
+		return ops
+	}
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, DiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, DiffLine{Op: DiffDelete, Text: a[i]})
+			i++
+		default:
+			ops = append(ops, DiffLine{Op: DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, DiffLine{Op: DiffDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, DiffLine{Op: DiffInsert, Text: b[j]})
+	}
+	return ops
+}
+
+// CountDiff 统计新增和删除的行数
+func CountDiff(lines []DiffLine) DiffStats {
+	var stats DiffStats
+	for _, line := range lines {
+		switch line.Op {
+		case DiffInsert:
+			stats.Added++
+		case DiffDelete:
+			stats.Removed++
+		}
+	}
+	return stats
+}
+
+// UnifiedDiff 生成 unified 格式的差异文本，context 为每处修改前后保留的相同行数，没有差异时返回空
+func UnifiedDiff(oldName, newName string, lines []DiffLine, context int) string {
+	var changes []int
+	for i, line := range lines {
+		if line.Op != DiffEqual {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for k := 0; k < len(changes); {
+		start := changes[k] - context
+		if start < 0 {
+			start = 0
+		}
+		// 相邻修改之间的相同行不超过 2*context 时合并为一段
+		end := changes[k]
+		for k < len(changes) && changes[k]-end <= 2*context+1 {
+			end = changes[k]
+			k++
+		}
+		end += context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+		writeDiffHunk(&sb, lines, start, end)
+	}
+	return sb.String()
+}
+
+// writeDiffHunk 输出 lines[start:end] 为一段，起始行号按该段之前的行计算
+func writeDiffHunk(sb *strings.Builder, lines []DiffLine, start, end int) {
+	oldStart, newStart := 0, 0
+	for _, line := range lines[:start] {
+		if line.Op != DiffInsert {
+			oldStart++
+		}
+		if line.Op != DiffDelete {
+			newStart++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, line := range lines[start:end] {
+		if line.Op != DiffInsert {
+			oldCount++
+		}
+		if line.Op != DiffDelete {
+			newCount++
+		}
+	}
+	// 与 diff -u 一致：段内有对应行时起始行号指向第一行，否则指向前一行
+	if oldCount > 0 {
+		oldStart++
+	}
+	if newCount > 0 {
+		newStart++
+	}
+
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, line := range lines[start:end] {
+		prefix := " "
+		switch line.Op {
+		case DiffInsert:
+			prefix = "+"
+		case DiffDelete:
+			prefix = "-"
+		}
+		sb.WriteString(prefix + line.Text + "\n")
+	}
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDiffLines tests line diffs and that applying them reproduces both texts
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		oldText     string
+		newText     string
+		wantAdded   int
+		wantRemoved int
+	}{
+		{name: "identical", oldText: "a\nb\nc", newText: "a\nb\nc"},
+		{name: "both empty", oldText: "", newText: ""},
+		{name: "from empty", oldText: "", newText: "a\nb", wantAdded: 2},
+		{name: "to empty", oldText: "a\nb", newText: "", wantRemoved: 2},
+		{name: "changed ending", oldText: "开场\n冲突\n和解", newText: "开场\n冲突\n悬念：门外传来敲门声", wantAdded: 1, wantRemoved: 1},
+		{name: "inserted middle", oldText: "a\nc", newText: "a\nb\nc", wantAdded: 1},
+		{name: "crlf and trailing newline", oldText: "a\r\nb\r\n", newText: "a\nb", wantAdded: 0},
+		{name: "reordered", oldText: "a\nb\nc\nd", newText: "d\na\nb\nc", wantAdded: 1, wantRemoved: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := DiffLines(tt.oldText, tt.newText)
+
+			stats := CountDiff(lines)
+			if stats.Added != tt.wantAdded || stats.Removed != tt.wantRemoved {
+				t.Errorf("CountDiff() = %+v, want added %d removed %d", stats, tt.wantAdded, tt.wantRemoved)
+			}
+
+			var oldLines, newLines []string
+			for _, line := range lines {
+				if line.Op != DiffInsert {
+					oldLines = append(oldLines, line.Text)
+					if line.OldLine != len(oldLines) {
+						t.Errorf("line %q OldLine = %d, want %d", line.Text, line.OldLine, len(oldLines))
+					}
+				}
+				if line.Op != DiffDelete {
+					newLines = append(newLines, line.Text)
+					if line.NewLine != len(newLines) {
+						t.Errorf("line %q NewLine = %d, want %d", line.Text, line.NewLine, len(newLines))
+					}
+				}
+			}
+			if got, want := strings.Join(oldLines, "\n"), strings.Join(splitDiffLines(tt.oldText), "\n"); got != want {
+				t.Errorf("old side = %q, want %q", got, want)
+			}
+			if got, want := strings.Join(newLines, "\n"), strings.Join(splitDiffLines(tt.newText), "\n"); got != want {
+				t.Errorf("new side = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestUnifiedDiff tests hunk headers and context trimming
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		context int
+		want    string
+	}{
+		{name: "no changes", oldText: "a\nb", newText: "a\nb", context: 3, want: ""},
+		{
+			name:    "single change with context",
+			oldText: "1\n2\n3\n4\n5\n6\n7",
+			newText: "1\n2\n3\nX\n5\n6\n7",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -3,3 +3,3 @@\n 3\n-4\n+X\n 5\n",
+		},
+		{
+			name:    "separate hunks",
+			oldText: "1\n2\n3\n4\n5\n6\n7\n8",
+			newText: "X\n2\n3\n4\n5\n6\n7\nY",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+X\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+Y\n",
+		},
+		{
+			name:    "append to empty",
+			oldText: "",
+			newText: "a",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("old", "new", DiffLines(tt.oldText, tt.newText), tt.context)
+			if got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package utils
+
+import "testing"
+
+// TestVerifyWebhookSignature tests that signatures bind the secret, timestamp and body
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"image.completed"}`)
+	signature := SignWebhookPayload("secret", 1700000000, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{name: "valid", secret: "secret", timestamp: 1700000000, body: body, signature: signature, want: true},
+		{name: "wrong secret", secret: "other", timestamp: 1700000000, body: body, signature: signature, want: false},
+		{name: "replayed timestamp", secret: "secret", timestamp: 1700000001, body: body, signature: signature, want: false},
+		{name: "tampered body", secret: "secret", timestamp: 1700000000, body: []byte(`{"event":"video.failed"}`), signature: signature, want: false},
+		{name: "missing prefix", secret: "secret", timestamp: 1700000000, body: body, signature: signature[len("sha256="):], want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyWebhookSignature(tt.secret, tt.timestamp, tt.body, tt.signature); got != tt.want {
+				t.Errorf("VerifyWebhookSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
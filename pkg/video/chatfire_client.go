@@ -2,12 +2,15 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 // ChatfireClient Chatfire 视频生成客户端
@@ -122,7 +125,7 @@ func NewChatfireClient(baseURL, apiKey, model, endpoint, queryEndpoint string) *
 	}
 }
 
-func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+func (c *ChatfireClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	options := &VideoOptions{
 		Duration:    5,
 		AspectRatio: "16:9",
@@ -273,7 +276,7 @@ func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpt
 	}
 
 	endpoint := c.BaseURL + c.Endpoint
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -293,7 +296,7 @@ func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpt
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	// 调试日志：打印响应内容
@@ -336,7 +339,7 @@ func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpt
 	return videoResult, nil
 }
 
-func (c *ChatfireClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+func (c *ChatfireClient) GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error) {
 	queryPath := c.QueryEndpoint
 	if strings.Contains(queryPath, "{taskId}") {
 		queryPath = strings.ReplaceAll(queryPath, "{taskId}", taskID)
@@ -347,7 +350,7 @@ func (c *ChatfireClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 	}
 
 	endpoint := c.BaseURL + queryPath
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -2,11 +2,14 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 // MiniMax Hailuo 支持的模型
@@ -113,7 +116,7 @@ func NewMinimaxClient(baseURL, apiKey, model string) *MinimaxClient {
 
 // GenerateVideo 生成视频（支持首尾帧和主体参考）
 // 步骤1：创建任务，返回 task_id
-func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+func (c *MinimaxClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	options := &VideoOptions{
 		Duration:   6,
 		Resolution: "1080P",
@@ -159,7 +162,7 @@ func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpti
 	// 步骤1：创建任务，POST 请求
 	// 注意：BaseURL 应该已包含 /v1，例如 https://api.minimaxi.com/v1
 	endpoint := c.BaseURL + "/video_generation"
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -179,7 +182,7 @@ func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpti
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var result MinimaxCreateResponse
@@ -188,7 +191,7 @@ func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpti
 	}
 
 	if result.BaseResp.StatusCode != 0 {
-		return nil, fmt.Errorf("minimax error: %s", result.BaseResp.StatusMsg)
+		return nil, minimaxError(result.BaseResp.StatusCode, result.BaseResp.StatusMsg)
 	}
 
 	// 第一步只返回 task_id，状态为 Processing
@@ -201,13 +204,23 @@ func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpti
 	return videoResult, nil
 }
 
+// minimaxError 转换 MiniMax 业务错误码，超时、限流和服务内部错误可重试
+func minimaxError(code int, msg string) error {
+	err := fmt.Errorf("minimax error: %s", msg)
+	switch code {
+	case 1001, 1002, 1013, 1039: // 请求超时、触发限流、服务内部错误、触发TPM限流
+		return utils.MarkTransient(err)
+	}
+	return err
+}
+
 // GetTaskStatus 查询任务状态
 // 步骤2：查询任务状态，如果成功则进入步骤3获取文件下载地址
-func (c *MinimaxClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+func (c *MinimaxClient) GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error) {
 	// 步骤2：查询任务状态
 	// 注意：BaseURL 应该已包含 /v1
 	endpoint := fmt.Sprintf("%s/query/video_generation?task_id=%s", c.BaseURL, taskID)
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -226,7 +239,7 @@ func (c *MinimaxClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var queryResult MinimaxQueryResponse
@@ -235,7 +248,7 @@ func (c *MinimaxClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 	}
 
 	if queryResult.BaseResp.StatusCode != 0 {
-		return nil, fmt.Errorf("minimax error: %s", queryResult.BaseResp.StatusMsg)
+		return nil, minimaxError(queryResult.BaseResp.StatusCode, queryResult.BaseResp.StatusMsg)
 	}
 
 	videoResult := &VideoResult{
@@ -248,7 +261,7 @@ func (c *MinimaxClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 
 	// 如果状态是 Success 且有 file_id，则获取文件下载地址
 	if queryResult.Status == "Success" && queryResult.FileID != "" {
-		downloadURL, err := c.getFileDownloadURL(queryResult.FileID)
+		downloadURL, err := c.getFileDownloadURL(ctx, queryResult.FileID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get download URL: %w", err)
 		}
@@ -263,10 +276,10 @@ func (c *MinimaxClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 }
 
 // getFileDownloadURL 步骤3：根据 file_id 获取文件下载地址
-func (c *MinimaxClient) getFileDownloadURL(fileID string) (string, error) {
+func (c *MinimaxClient) getFileDownloadURL(ctx context.Context, fileID string) (string, error) {
 	// 注意：BaseURL 应该已包含 /v1
 	endpoint := fmt.Sprintf("%s/files/retrieve?file_id=%s", c.BaseURL, fileID)
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return "", fmt.Errorf("create request: %w", err)
 	}
@@ -285,7 +298,7 @@ func (c *MinimaxClient) getFileDownloadURL(fileID string) (string, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return "", utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var fileResult MinimaxFileResponse
@@ -294,7 +307,7 @@ func (c *MinimaxClient) getFileDownloadURL(fileID string) (string, error) {
 	}
 
 	if fileResult.BaseResp.StatusCode != 0 {
-		return "", fmt.Errorf("minimax error: %s", fileResult.BaseResp.StatusMsg)
+		return "", minimaxError(fileResult.BaseResp.StatusCode, fileResult.BaseResp.StatusMsg)
 	}
 
 	return fileResult.File.DownloadURL, nil
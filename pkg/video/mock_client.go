@@ -0,0 +1,156 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+const (
+	mockDefaultDuration = 5
+	mockFrameRate       = 24
+)
+
+// MockClient 内置的离线视频客户端，调用 ffmpeg 生成纯色短视频，颜色由提示词决定。
+// 未指定 OutputDir 时写入系统临时目录并返回本地路径
+type MockClient struct {
+	Model     string
+	OutputDir string
+	BaseURL   string
+	Settings  utils.MockSettings
+}
+
+func NewMockClient(model, outputDir, baseURL string, settings utils.MockSettings) *MockClient {
+	return &MockClient{
+		Model:     model,
+		OutputDir: outputDir,
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		Settings:  settings,
+	}
+}
+
+func (c *MockClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+	options := &VideoOptions{Duration: mockDefaultDuration}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.Duration <= 0 {
+		options.Duration = mockDefaultDuration
+	}
+
+	if err := c.Settings.Simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	width, height := mockVideoSize(options.Resolution, options.AspectRatio)
+	seed := utils.MockSeed(c.Model, prompt, imageURL, fmt.Sprint(options.Seed))
+	videoURL, err := c.render(ctx, seed, width, height, options.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VideoResult{
+		Status:    "completed",
+		VideoURL:  videoURL,
+		Duration:  options.Duration,
+		Width:     width,
+		Height:    height,
+		Completed: true,
+	}
+	if !c.Settings.Async {
+		return result, nil
+	}
+
+	taskID := utils.MockTaskID("video", seed)
+	result.TaskID = taskID
+	utils.RegisterMockTask(taskID, time.Duration(c.Settings.TaskDelayMs)*time.Millisecond, result)
+	return &VideoResult{TaskID: taskID, Status: "processing"}, nil
+}
+
+func (c *MockClient) GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error) {
+	if err := c.Settings.Simulate(ctx); err != nil {
+		return nil, err
+	}
+
+	value, ready, found := utils.LookupMockTask(taskID)
+	if !found {
+		return &VideoResult{TaskID: taskID, Status: "failed", Error: "mock: task not found (tasks are kept in memory only)"}, nil
+	}
+	if !ready {
+		return &VideoResult{TaskID: taskID, Status: "processing"}, nil
+	}
+	result := *value.(*VideoResult)
+	return &result, nil
+}
+
+// render 生成纯色视频，文件名由种子、尺寸和时长决定，已存在时直接复用
+func (c *MockClient) render(ctx context.Context, seed uint64, width, height, duration int) (string, error) {
+	outputDir := c.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(os.TempDir(), "drama-mock-videos")
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("mock: create output dir: %w", err)
+	}
+
+	filename := fmt.Sprintf("video_%016x_%dx%d_%ds.mp4", seed, width, height, duration)
+	outputPath := filepath.Join(outputDir, filename)
+	if _, err := os.Stat(outputPath); err != nil {
+		bg := utils.PlaceholderColor(seed)
+		source := fmt.Sprintf("color=c=0x%02X%02X%02X:s=%dx%d:r=%d:d=%d", bg.R, bg.G, bg.B, width, height, mockFrameRate, duration)
+		tmpPath := outputPath + ".tmp.mp4"
+		cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-f", "lavfi", "-i", source,
+			"-pix_fmt", "yuv420p", "-movflags", "+faststart", tmpPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(tmpPath)
+			return "", fmt.Errorf("mock: ffmpeg failed: %w, output: %s", err, tailLines(string(output), 5))
+		}
+		if err := os.Rename(tmpPath, outputPath); err != nil {
+			return "", fmt.Errorf("mock: save video: %w", err)
+		}
+	}
+
+	if c.OutputDir == "" || c.BaseURL == "" {
+		return outputPath, nil
+	}
+	return c.BaseURL + "/" + filename, nil
+}
+
+// mockVideoSize 根据分辨率（480p/720p/1080p）和宽高比计算尺寸，宽高取偶数以满足 yuv420p
+func mockVideoSize(resolution, aspectRatio string) (int, int) {
+	short := 720
+	switch strings.ToLower(resolution) {
+	case "480p":
+		short = 480
+	case "1080p":
+		short = 1080
+	}
+
+	ratioW, ratioH := 16, 9
+	if _, err := fmt.Sscanf(aspectRatio, "%d:%d", &ratioW, &ratioH); err != nil || ratioW <= 0 || ratioH <= 0 {
+		ratioW, ratioH = 16, 9
+	}
+
+	if ratioW >= ratioH {
+		return evenSize(short * ratioW / ratioH), short
+	}
+	return short, evenSize(short * ratioH / ratioW)
+}
+
+func evenSize(n int) int {
+	return n / 2 * 2
+}
+
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
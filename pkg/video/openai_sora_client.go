@@ -2,6 +2,7 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 type OpenAISoraClient struct {
@@ -53,7 +56,7 @@ func NewOpenAISoraClient(baseURL, apiKey, model string) *OpenAISoraClient {
 	}
 }
 
-func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+func (c *OpenAISoraClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	options := &VideoOptions{
 		Duration: 4,
 	}
@@ -120,7 +123,11 @@ func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoO
 
 		} else {
 			// Case B: Handle Standard HTTP/HTTPS URL
-			resp, err := http.Get(imageURL)
+			req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create download request: %w", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
 				return nil, fmt.Errorf("failed to download reference image: %w", err)
 			}
@@ -183,7 +190,7 @@ func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoO
 	writer.Close()
 
 	endpoint := c.BaseURL + "/videos"
-	req, err := http.NewRequest("POST", endpoint, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, body)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -203,7 +210,7 @@ func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoO
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, utils.NewAPIError(resp.StatusCode, string(respBody))
 	}
 
 	var result OpenAISoraResponse
@@ -231,9 +238,9 @@ func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoO
 	return videoResult, nil
 }
 
-func (c *OpenAISoraClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+func (c *OpenAISoraClient) GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error) {
 	endpoint := c.BaseURL + "/videos/" + taskID
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -2,16 +2,20 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
+// VideoClient 视频生成客户端接口，ctx 取消时进行中的请求会被中断
 type VideoClient interface {
-	GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error)
-	GetTaskStatus(taskID string) (*VideoResult, error)
+	GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error)
+	GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error)
 }
 
 type VideoResult struct {
@@ -151,7 +155,7 @@ func NewRunwayClient(baseURL, apiKey, model string) *RunwayClient {
 	}
 }
 
-func (c *RunwayClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+func (c *RunwayClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	options := &VideoOptions{
 		Duration:    5,
 		AspectRatio: "16:9",
@@ -181,7 +185,7 @@ func (c *RunwayClient) GenerateVideo(imageURL, prompt string, opts ...VideoOptio
 	}
 
 	endpoint := c.BaseURL + "/v1/video/generate"
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -201,7 +205,7 @@ func (c *RunwayClient) GenerateVideo(imageURL, prompt string, opts ...VideoOptio
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var result RunwayResponse
@@ -226,9 +230,9 @@ func (c *RunwayClient) GenerateVideo(imageURL, prompt string, opts ...VideoOptio
 	return videoResult, nil
 }
 
-func (c *RunwayClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+func (c *RunwayClient) GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error) {
 	endpoint := c.BaseURL + "/v1/video/status/" + taskID
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -306,7 +310,7 @@ func NewPikaClient(baseURL, apiKey, model string) *PikaClient {
 	}
 }
 
-func (c *PikaClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+func (c *PikaClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	options := &VideoOptions{
 		Duration:    3,
 		AspectRatio: "16:9",
@@ -339,7 +343,7 @@ func (c *PikaClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption)
 	}
 
 	endpoint := c.BaseURL + "/v1/video/generate"
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -359,7 +363,7 @@ func (c *PikaClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption)
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var result PikaResponse
@@ -384,9 +388,9 @@ func (c *PikaClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption)
 	return videoResult, nil
 }
 
-func (c *PikaClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+func (c *PikaClient) GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error) {
 	endpoint := c.BaseURL + "/v1/video/status/" + taskID
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
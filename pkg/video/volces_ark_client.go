@@ -2,12 +2,15 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/drama-generator/backend/pkg/utils"
 )
 
 // VolcesArkClient 火山引擎ARK视频生成客户端
@@ -77,7 +80,7 @@ func NewVolcesArkClient(baseURL, apiKey, model, endpoint, queryEndpoint string)
 }
 
 // GenerateVideo 生成视频（支持首帧、首尾帧、参考图等多种模式）
-func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+func (c *VolcesArkClient) GenerateVideo(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	options := &VideoOptions{
 		Duration:    5,
 		AspectRatio: "adaptive",
@@ -177,7 +180,7 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 	fmt.Printf("[VolcesARK] Generating video - Endpoint: %s, FullURL: %s, Model: %s\n", c.Endpoint, endpoint, model)
 	fmt.Printf("[VolcesARK] Request body: %s\n", string(jsonData))
 
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -199,7 +202,7 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 	fmt.Printf("[VolcesARK] Response status: %d, body: %s\n", resp.StatusCode, string(body))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, utils.NewAPIError(resp.StatusCode, string(body))
 	}
 
 	var result VolcesArkResponse
@@ -210,8 +213,7 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 	fmt.Printf("[VolcesARK] Video generation initiated - TaskID: %s, Status: %s\n", result.ID, result.Status)
 
 	if result.Error != nil {
-		errorMsg := fmt.Sprintf("%v", result.Error)
-		return nil, fmt.Errorf("volces error: %s", errorMsg)
+		return nil, volcesError(result.Error)
 	}
 
 	videoResult := &VideoResult{
@@ -229,7 +231,19 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 	return videoResult, nil
 }
 
-func (c *VolcesArkClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+// volcesError 转换火山方舟返回的错误对象，限流、服务过载和内部错误可重试
+func volcesError(errObj interface{}) error {
+	err := fmt.Errorf("volces error: %v", errObj)
+	if m, ok := errObj.(map[string]interface{}); ok {
+		code, _ := m["code"].(string)
+		if strings.HasPrefix(code, "RateLimitExceeded") || code == "ServerOverloaded" || code == "InternalServiceError" {
+			return utils.MarkTransient(err)
+		}
+	}
+	return err
+}
+
+func (c *VolcesArkClient) GetTaskStatus(ctx context.Context, taskID string) (*VideoResult, error) {
 	// 替换占位符{taskId}、{task_id}或直接拼接
 	queryPath := c.QueryEndpoint
 	if strings.Contains(queryPath, "{taskId}") {
@@ -243,7 +257,7 @@ func (c *VolcesArkClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 	endpoint := c.BaseURL + queryPath
 	fmt.Printf("[VolcesARK] Querying task status - TaskID: %s, QueryEndpoint: %s, FullURL: %s\n", taskID, c.QueryEndpoint, endpoint)
 
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -1,6 +1,10 @@
 import type {
+    AIModelCapability,
     AIServiceConfig,
+    AIServiceProvider,
     AIServiceType,
+    ModelCapabilities,
+    ResolvedModelCapabilities,
     CreateAIConfigRequest,
     TestConnectionRequest,
     UpdateAIConfigRequest
@@ -32,5 +36,29 @@ export const aiAPI = {
 
   testConnection(data: TestConnectionRequest) {
     return request.post('/ai-configs/test', data)
+  },
+
+  listProviders(serviceType?: AIServiceType) {
+    return request.get<AIServiceProvider[]>('/ai-providers', {
+      params: { service_type: serviceType }
+    })
+  },
+
+  getCapabilities(serviceType: AIServiceType, provider: string, model?: string) {
+    return request.get<ResolvedModelCapabilities>('/ai-providers/capabilities', {
+      params: { service_type: serviceType, provider, model }
+    })
+  },
+
+  upsertModelCapability(providerId: number, model: string, capabilities: ModelCapabilities) {
+    return request.put<AIModelCapability>(`/ai-providers/${providerId}/models`, { model, capabilities })
+  },
+
+  deleteModelCapability(id: number) {
+    return request.delete(`/ai-providers/models/${id}`)
+  },
+
+  setProviderActive(id: number, isActive: boolean) {
+    return request.put(`/ai-providers/${id}/active`, { is_active: isActive })
   }
 }
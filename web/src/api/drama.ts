@@ -3,6 +3,8 @@ import type {
   Drama,
   DramaListQuery,
   DramaStats,
+  Storyboard,
+  StoryboardTakes,
   UpdateDramaRequest
 } from '../types/drama'
 import request from '../utils/request'
@@ -160,5 +162,19 @@ export const dramaAPI = {
 
   deleteStoryboard(storyboardId: number) {
     return request.delete(`/storyboards/${storyboardId}`)
+  },
+
+  getStoryboardTakes(storyboardId: number) {
+    return request.get<StoryboardTakes>(`/storyboards/${storyboardId}/takes`)
+  },
+
+  // 选定分镜使用的图片，同步更新 composed_image
+  selectImageTake(storyboardId: number, imageGenId: number) {
+    return request.put<Storyboard>(`/storyboards/${storyboardId}/selected-image`, { image_gen_id: imageGenId })
+  },
+
+  // 选定分镜使用的视频，同步更新 video_url 和时长
+  selectVideoTake(storyboardId: number, videoGenId: number) {
+    return request.put<Storyboard>(`/storyboards/${storyboardId}/selected-video`, { video_gen_id: videoGenId })
   }
 }
@@ -1,7 +1,9 @@
 import type {
+  EditImageRequest,
   GenerateImageRequest,
   ImageGeneration,
-  ImageGenerationListParams
+  ImageGenerationListParams,
+  ImageLineage
 } from '../types/image'
 import request from '../utils/request'
 
@@ -10,6 +12,11 @@ export const imageAPI = {
     return request.post<ImageGeneration>('/images', data)
   },
 
+  // 一次生成多个候选，返回全部记录
+  generateImageTakes(data: GenerateImageRequest & { candidates: number }) {
+    return request.post<ImageGeneration[]>('/images', data)
+  },
+
   generateForScene(sceneId: number) {
     return request.post<ImageGeneration[]>(`/images/scene/${sceneId}`)
   },
@@ -38,6 +45,20 @@ export const imageAPI = {
     return request.delete(`/images/${id}`)
   },
 
+  // 在已完成的图片基础上修改，生成关联到原图的新记录
+  editImage(id: number, data: EditImageRequest) {
+    return request.post<ImageGeneration>(`/images/${id}/edit`, data)
+  },
+
+  getLineage(id: number) {
+    return request.get<ImageLineage>(`/images/${id}/lineage`)
+  },
+
+  // 重新进行画面质检，结果异步写入记录
+  checkQuality(id: number) {
+    return request.post<ImageGeneration>(`/images/${id}/qa`)
+  },
+
   // 上传图片并创建图片生成记录
   uploadImage(data: {
     storyboard_id: number
@@ -0,0 +1,83 @@
+import request from '../utils/request'
+
+export interface ScriptChatMessage {
+    id: number
+    session_id: number
+    role: 'user' | 'assistant'
+    content: string
+    episode_id?: number
+    proposed_script?: string
+    revision_summary?: string
+    revision_status?: 'pending' | 'accepted'
+    accepted_at?: string
+    created_at: string
+}
+
+export interface ScriptChatSession {
+    id: number
+    drama_id: number
+    episode_id?: number
+    title: string
+    model: string
+    messages?: ScriptChatMessage[]
+    created_at: string
+    updated_at: string
+}
+
+export interface DiffLine {
+    op: 'equal' | 'insert' | 'delete'
+    text: string
+    old_line?: number
+    new_line?: number
+}
+
+// 修订稿与该集当前剧本的差异，stale 表示提出修订后剧本已被修改
+export interface ScriptRevisionDiff {
+    message_id: number
+    episode_id: number
+    episode_number: number
+    status: 'pending' | 'accepted'
+    stale: boolean
+    stats: { added: number; removed: number }
+    unified: string
+    lines: DiffLine[]
+}
+
+export interface ScriptChatReply {
+    user_message: ScriptChatMessage
+    assistant_message: ScriptChatMessage
+    diff?: ScriptRevisionDiff
+}
+
+export const scriptChatAPI = {
+    list(dramaId: number, episodeId?: number) {
+        return request.get<ScriptChatSession[]>('/script-chats', {
+            params: { drama_id: dramaId, episode_id: episodeId }
+        })
+    },
+
+    create(data: { drama_id: number; episode_id?: number; title?: string; model?: string }) {
+        return request.post<ScriptChatSession>('/script-chats', data)
+    },
+
+    get(id: number) {
+        return request.get<ScriptChatSession>(`/script-chats/${id}`)
+    },
+
+    delete(id: number) {
+        return request.delete(`/script-chats/${id}`)
+    },
+
+    send(id: number, content: string) {
+        return request.post<ScriptChatReply>(`/script-chats/${id}/messages`, { content })
+    },
+
+    getDiff(id: number, messageId: number) {
+        return request.get<ScriptRevisionDiff>(`/script-chats/${id}/messages/${messageId}/diff`)
+    },
+
+    // 剧本在提出修订后被修改过时返回 409，确认差异后以 force 重新提交
+    accept(id: number, messageId: number, force = false) {
+        return request.post<ScriptRevisionDiff>(`/script-chats/${id}/messages/${messageId}/accept`, { force })
+    }
+}
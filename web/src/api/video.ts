@@ -10,6 +10,11 @@ export const videoAPI = {
     return request.post<VideoGeneration>('/videos', data)
   },
 
+  // 一次生成多个候选，返回全部记录
+  generateVideoTakes(data: GenerateVideoRequest & { candidates: number }) {
+    return request.post<VideoGeneration[]>('/videos', data)
+  },
+
   generateFromImage(imageGenId: number) {
     return request.post<VideoGeneration>(`/videos/image/${imageGenId}`)
   },
@@ -4,7 +4,7 @@ export interface AIServiceConfig {
   provider?: string  // 厂商标识
   name: string
   base_url: string
-  api_key: string
+  api_key: string  // 脱敏后的 Key，如 sk-****abcd
   model: string | string[]  // 支持单个或多个模型
   endpoint: string
   query_endpoint?: string  // 异步查询端点（用于视频等异步任务）
@@ -44,6 +44,7 @@ export interface UpdateAIConfigRequest {
 }
 
 export interface TestConnectionRequest {
+  config_id?: number  // 测试已保存的配置，api_key 为脱敏值时使用保存的 Key
   base_url: string
   api_key: string
   model: string | string[]  // 支持单个或多个模型
@@ -60,6 +61,38 @@ export interface AIServiceProvider {
   default_url: string
   description: string
   is_active: boolean
+  models?: AIModelCapability[]
   created_at: string
   updated_at: string
 }
+
+// 模型支持的参数，生成前按此校验或调整
+export interface ModelCapabilities {
+  image_to_video: boolean
+  last_frame: boolean
+  min_duration?: number
+  max_duration?: number
+  durations?: number[]
+  aspect_ratios?: string[]
+  resolutions?: string[]
+  sizes?: string[]
+  negative_prompt: boolean
+  max_reference_images: number
+}
+
+export interface AIModelCapability {
+  id: number
+  provider_id: number
+  model: string  // 以 * 结尾表示前缀匹配，单独的 * 匹配其他模型
+  capabilities: ModelCapabilities
+  created_at: string
+  updated_at: string
+}
+
+export interface ResolvedModelCapabilities {
+  service_type: AIServiceType
+  provider: string
+  model: string
+  matched_model: string
+  capabilities: ModelCapabilities
+}
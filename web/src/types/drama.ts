@@ -1,4 +1,6 @@
+import type { ImageGeneration } from './image'
 import { Prop } from './prop'
+import type { VideoGeneration } from './video'
 
 export interface Drama {
   id: string
@@ -89,6 +91,10 @@ export interface Storyboard {
   image_url?: string
   video_url?: string
   composed_image?: string
+  selected_image_id?: number  // 选定的图片生成记录
+  selected_video_id?: number  // 选定的视频生成记录
+  image_take_pinned?: boolean  // 手动选定过图片后，新图片不再自动替换
+  video_take_pinned?: boolean  // 手动选定过视频后，新视频不再自动替换
   scene_id?: string
   scene?: Scene
   created_at: string
@@ -96,6 +102,17 @@ export interface Storyboard {
   [key: string]: any
 }
 
+// 分镜的图片和视频候选
+export interface StoryboardTakes {
+  storyboard_id: number
+  selected_image_id?: number
+  selected_video_id?: number
+  image_take_pinned: boolean
+  video_take_pinned: boolean
+  images: ImageGeneration[]
+  videos: VideoGeneration[]
+}
+
 export interface Scene {
   id: string
   drama_id: string
@@ -19,6 +19,7 @@ export interface ImageGeneration {
   image_url?: string
   image_generation?: any
   local_path?: string
+  thumbnail_url?: string  // 后处理生成的缩略图
   status: ImageStatus
   task_id?: string
   error_msg?: string
@@ -27,6 +28,40 @@ export interface ImageGeneration {
   created_at: string
   updated_at: string
   completed_at?: string
+  qa_status?: ImageQAStatus
+  qa_score?: number
+  qa_verdict?: ImageQAVerdict
+  qa_error?: string
+  qa_checked_at?: string
+  regenerated_from_id?: number
+  parent_id?: number
+}
+
+export interface EditImageRequest {
+  prompt: string
+  mask?: string // 黑白蒙版（白色区域重绘）的 URL 或 data URI
+  model?: string
+}
+
+// 图片的编辑链：从最初的图片到当前图片，以及直接基于当前图片的编辑
+export interface ImageLineage {
+  ancestors: ImageGeneration[]
+  current: ImageGeneration
+  edits: ImageGeneration[]
+}
+
+export type ImageQAStatus = 'passed' | 'failed' | 'error'
+
+// 分镜图片的画面质检结论
+export interface ImageQAVerdict {
+  score: number
+  characters_present: string[]
+  missing_characters: string[]
+  time_of_day_match: boolean
+  location_match: boolean
+  action_match: boolean
+  issues: string[]
+  summary: string
 }
 
 export type ImageStatus = 'pending' | 'processing' | 'completed' | 'failed'
@@ -52,6 +87,7 @@ export interface GenerateImageRequest {
   seed?: number
   width?: number
   height?: number
+  candidates?: number  // 候选数量（1-4），大于 1 时返回全部记录
 }
 
 export interface ImageGenerationListParams {
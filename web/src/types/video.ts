@@ -53,6 +53,7 @@ export interface GenerateVideoRequest {
   first_frame_url?: string  // 首帧图片URL
   last_frame_url?: string   // 尾帧图片URL
   reference_image_urls?: string[]  // 多图参考模式
+  candidates?: number  // 候选数量（1-4），大于 1 时返回全部记录
 }
 
 export interface VideoGenerationListParams {